@@ -1,30 +1,25 @@
 package main
 
 import (
+	"context"
 	"log"
 	"math/rand"
 	"strconv"
-	"time"
+	"strings"
 
+	"github.com/hoshinonyaruko/palworld-go/audit"
 	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/event"
+	"github.com/hoshinonyaruko/palworld-go/tool"
 )
 
 type palworldBroadcast struct {
-	Config     config.Config
-	Ticker     *time.Ticker
-	BackupTask *BackupTask
+	Config config.Config
 }
 
 func NewpalworldBroadcast(config config.Config) *palworldBroadcast {
 	return &palworldBroadcast{
 		Config: config,
-		Ticker: time.NewTicker(time.Duration(config.MessageBroadcastInterval) * time.Second),
-	}
-}
-
-func (task *palworldBroadcast) Schedule() {
-	for range task.Ticker.C {
-		task.RunpalworldBroadcast()
 	}
 }
 
@@ -32,7 +27,7 @@ func (task *palworldBroadcast) RunpalworldBroadcast() {
 	log.Println("准备进行全服推送...现已支持所有语言broadcast!")
 	// 初始化RCON客户端
 	address := task.Config.Address + ":" + strconv.Itoa(task.Config.WorldSettings.RconPort)
-	rconClient := NewRconClient(address, task.Config.WorldSettings.AdminPassword, task.BackupTask, &task.Config)
+	rconClient := NewRconClient(address, task.Config.WorldSettings.AdminPassword, &task.Config)
 	if rconClient == nil {
 		log.Println("RCON客户端初始化失败,无法进行定期推送,请按教程正确开启rcon和设置服务端admin密码")
 		return
@@ -44,6 +39,26 @@ func (task *palworldBroadcast) RunpalworldBroadcast() {
 
 		// 获取随机选择的消息
 		randomMessage := task.Config.RegularMessages[randomIndex]
-		Broadcast(randomMessage, rconClient, task.Config.UseDll)
+		Broadcast(randomMessage, rconClient)
 	}
 }
+
+// SubscribeWelcome 设置了WelcomeMessage时,在玩家加入后发送全服欢迎广播
+func SubscribeWelcome(config config.Config) {
+	if strings.TrimSpace(config.WelcomeMessage) == "" {
+		return
+	}
+
+	event.Subscribe(func(e event.Event) {
+		joined, ok := e.Data.(event.PlayerJoined)
+		if !ok {
+			return
+		}
+
+		message := strings.ReplaceAll(config.WelcomeMessage, "{name}", joined.Player.Name)
+		ctx := audit.WithOrigin(context.Background(), audit.OriginBroadcast)
+		if err := tool.BroadcastContext(ctx, config, message); err != nil {
+			log.Printf("发送欢迎广播失败: %v", err)
+		}
+	})
+}
@@ -0,0 +1,300 @@
+// Package audit 把palworld-go发出的每条RCON指令记录到bbolt中,
+// 包括时间、来源子系统、操作用户、指令、响应、耗时和错误,便于事后查询是谁执行了什么。
+package audit
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// BucketName 审计日志所在的bucket
+	BucketName = "audit"
+	// UserHeader 机器人通过webui api代发指令时,用该请求头携带实际发起指令的QQ号,
+	// webui只在该QQ号已经用请求的cookie绑定面板时采用
+	UserHeader = "X-Palworld-Go-User"
+	// MaxResponseSize 记录的响应最大长度,超出部分被截断
+	MaxResponseSize = 4096
+)
+
+// 来源子系统
+const (
+	OriginSystem      = "system"
+	OriginWebui       = "webui"
+	OriginConsole     = "console"
+	OriginBot         = "bot"
+	OriginProxy       = "proxy"
+	OriginSupervisor  = "supervisor"
+	OriginMemoryCheck = "memorycheck"
+	OriginBroadcast   = "broadcast"
+	OriginSchedule    = "schedule"
+	OriginWhitelist   = "whitelist"
+	OriginPresence    = "presence"
+	OriginHealth      = "health"
+	OriginRestart     = "restart"
+	OriginBackup      = "backup"
+)
+
+// unaudited 周期性探测的来源不记录,否则会在AuditMaxEntries内挤掉真实的操作记录
+var unaudited = map[string]bool{
+	OriginPresence: true,
+	OriginHealth:   true,
+}
+
+// Entry 一条审计记录
+type Entry struct {
+	ID        uint64    `json:"id"`
+	Time      time.Time `json:"time"`
+	Origin    string    `json:"origin"`
+	User      string    `json:"user,omitempty"`
+	Command   string    `json:"command"`
+	Response  string    `json:"response,omitempty"`
+	LatencyMs int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+}
+
+var (
+	mu sync.RWMutex
+	db *bbolt.DB
+)
+
+// InitDB 使用db保存审计日志,未初始化时Record不做任何事
+func InitDB(d *bbolt.DB) error {
+	err := d.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(BucketName))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	db = d
+	mu.Unlock()
+	return nil
+}
+
+func getDB() *bbolt.DB {
+	mu.RLock()
+	defer mu.RUnlock()
+	return db
+}
+
+type contextKey int
+
+const (
+	originKey contextKey = iota
+	userKey
+)
+
+// WithOrigin 返回标记了来源子系统的ctx
+func WithOrigin(ctx context.Context, origin string) context.Context {
+	return context.WithValue(ctx, originKey, origin)
+}
+
+// WithUser 返回标记了操作用户的ctx
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// Origin 返回ctx中的来源子系统,没有标记时为OriginSystem
+func Origin(ctx context.Context) string {
+	if origin, ok := ctx.Value(originKey).(string); ok && origin != "" {
+		return origin
+	}
+	return OriginSystem
+}
+
+// User 返回ctx中的操作用户
+func User(ctx context.Context) string {
+	user, _ := ctx.Value(userKey).(string)
+	return user
+}
+
+// Record 记录一条指令,写入失败只打印日志,不影响指令本身。健康检查和玩家检测的指令不记录
+func Record(ctx context.Context, command, response string, latency time.Duration, err error) {
+	d := getDB()
+	if d == nil || unaudited[Origin(ctx)] {
+		return
+	}
+
+	if len(response) > MaxResponseSize {
+		response = response[:MaxResponseSize] + "...(truncated)"
+	}
+
+	entry := Entry{
+		Time:      time.Now(),
+		Origin:    Origin(ctx),
+		User:      User(ctx),
+		Command:   command,
+		Response:  response,
+		LatencyMs: latency.Milliseconds(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if err := put(d, &entry); err != nil {
+		log.Printf("写入审计日志失败: %v", err)
+	}
+}
+
+func put(d *bbolt.DB, entry *Entry) error {
+	return d.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(BucketName))
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		entry.ID = id
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(itob(id), data)
+	})
+}
+
+// Filter 查询条件,零值字段不参与过滤
+type Filter struct {
+	Origin string
+	User   string
+	// Command 指令中包含的子串,不区分大小写
+	Command    string
+	Since      time.Time
+	Until      time.Time
+	ErrorsOnly bool
+	// Before 只返回ID小于Before的记录,用于翻页
+	Before uint64
+	Limit  int
+}
+
+const (
+	// DefaultLimit 每页默认条数
+	DefaultLimit = 50
+	// MaxLimit 每页最大条数
+	MaxLimit = 500
+)
+
+// Query 按时间倒序返回符合条件的记录,next非0时可作为下一页的Before
+func Query(filter Filter) (entries []Entry, next uint64, err error) {
+	d := getDB()
+	if d == nil {
+		return nil, 0, nil
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	command := strings.ToLower(filter.Command)
+
+	entries = make([]Entry, 0, limit)
+	err = d.View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket([]byte(BucketName)).Cursor()
+
+		var k, v []byte
+		if filter.Before > 0 {
+			k, v = cursor.Seek(itob(filter.Before))
+			if k == nil {
+				k, v = cursor.Last()
+			} else {
+				k, v = cursor.Prev()
+			}
+		} else {
+			k, v = cursor.Last()
+		}
+
+		for ; k != nil; k, v = cursor.Prev() {
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				continue
+			}
+
+			// 按时间倒序遍历,早于Since之后的记录都不需要再看
+			if !filter.Since.IsZero() && entry.Time.Before(filter.Since) {
+				break
+			}
+			if !filter.Until.IsZero() && entry.Time.After(filter.Until) {
+				continue
+			}
+			if filter.Origin != "" && !strings.EqualFold(entry.Origin, filter.Origin) {
+				continue
+			}
+			if filter.User != "" && entry.User != filter.User {
+				continue
+			}
+			if command != "" && !strings.Contains(strings.ToLower(entry.Command), command) {
+				continue
+			}
+			if filter.ErrorsOnly && entry.Error == "" {
+				continue
+			}
+
+			if len(entries) == limit {
+				next = entries[len(entries)-1].ID
+				return nil
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+
+	return entries, next, err
+}
+
+// Prune 删除早于maxAge的记录,并只保留最新的maxEntries条,参数为0时不做对应的限制
+func Prune(maxAge time.Duration, maxEntries int) (int, error) {
+	d := getDB()
+	if d == nil {
+		return 0, nil
+	}
+
+	var deleted int
+	err := d.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(BucketName))
+		excess := 0
+		if maxEntries > 0 {
+			excess = bucket.Stats().KeyN - maxEntries
+		}
+		cutoff := time.Now().Add(-maxAge)
+
+		// ID递增,从最旧的记录开始删除
+		cursor := bucket.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.First() {
+			if deleted >= excess {
+				if maxAge <= 0 {
+					break
+				}
+				var entry Entry
+				if err := json.Unmarshal(v, &entry); err == nil && !entry.Time.Before(cutoff) {
+					break
+				}
+			}
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+
+	return deleted, err
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
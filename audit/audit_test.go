@@ -0,0 +1,142 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/audit"
+	"go.etcd.io/bbolt"
+)
+
+func openDB(t *testing.T) {
+	t.Helper()
+
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "audit.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := audit.InitDB(db); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+}
+
+func record(origin, user, command string, err error) {
+	ctx := audit.WithUser(audit.WithOrigin(context.Background(), origin), user)
+	audit.Record(ctx, command, "ok", time.Millisecond, err)
+}
+
+func commands(entries []audit.Entry) string {
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Command
+	}
+	return strings.Join(names, ",")
+}
+
+func TestQuery(t *testing.T) {
+	openDB(t)
+
+	record(audit.OriginWebui, "admin", "ShowPlayers", nil)
+	record(audit.OriginBot, "10001", "KickPlayer 1", nil)
+	record(audit.OriginConsole, "admin", "Save", errors.New("timeout"))
+	record(audit.OriginProxy, "mod", "Broadcast hi", nil)
+	// 周期性探测不记录
+	record(audit.OriginHealth, "", "Info", nil)
+	record(audit.OriginPresence, "", "ShowPlayers", nil)
+	audit.Record(context.Background(), "Info", strings.Repeat("x", audit.MaxResponseSize+10), 0, nil)
+
+	tests := []struct {
+		name   string
+		filter audit.Filter
+		want   string
+	}{
+		{"all", audit.Filter{}, "Info,Broadcast hi,Save,KickPlayer 1,ShowPlayers"},
+		{"origin", audit.Filter{Origin: "BOT"}, "KickPlayer 1"},
+		{"default origin", audit.Filter{Origin: audit.OriginSystem}, "Info"},
+		{"user", audit.Filter{User: "admin"}, "Save,ShowPlayers"},
+		{"command", audit.Filter{Command: "kick"}, "KickPlayer 1"},
+		{"errors", audit.Filter{ErrorsOnly: true}, "Save"},
+		{"until", audit.Filter{Until: time.Now().Add(-time.Hour)}, ""},
+		{"since", audit.Filter{Since: time.Now().Add(time.Hour)}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, _, err := audit.Query(tt.filter)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			if got := commands(entries); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	entries, _, _ := audit.Query(audit.Filter{Command: "Info"})
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Response, "(truncated)") {
+		t.Errorf("long response was not truncated")
+	}
+}
+
+func TestQuery_Pagination(t *testing.T) {
+	openDB(t)
+
+	for i := 0; i < 5; i++ {
+		record(audit.OriginWebui, "admin", string(rune('a'+i)), nil)
+	}
+
+	var pages []string
+	filter := audit.Filter{Limit: 2}
+	for {
+		entries, next, err := audit.Query(filter)
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		pages = append(pages, commands(entries))
+		if next == 0 {
+			break
+		}
+		filter.Before = next
+	}
+
+	if got := strings.Join(pages, "|"); got != "e,d|c,b|a" {
+		t.Errorf("pages = %q", got)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	openDB(t)
+
+	for i := 0; i < 5; i++ {
+		record(audit.OriginWebui, "admin", string(rune('a'+i)), nil)
+	}
+
+	deleted, err := audit.Prune(0, 3)
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("deleted %d entries, want 2", deleted)
+	}
+	entries, _, _ := audit.Query(audit.Filter{})
+	if got := commands(entries); got != "e,d,c" {
+		t.Errorf("entries after max entries prune = %q", got)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	record(audit.OriginWebui, "admin", "f", nil)
+
+	if _, err := audit.Prune(5*time.Millisecond, 0); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	entries, _, _ = audit.Query(audit.Filter{})
+	if got := commands(entries); got != "f" {
+		t.Errorf("entries after max age prune = %q", got)
+	}
+}
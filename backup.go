@@ -1,166 +1,201 @@
 package main
 
 import (
-	"io"
+	"context"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
+	"github.com/hoshinonyaruko/palworld-go/audit"
+	"github.com/hoshinonyaruko/palworld-go/backup"
 	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/event"
+	"github.com/hoshinonyaruko/palworld-go/tool"
 )
 
 type BackupTask struct {
 	Config config.Config
-	Ticker *time.Ticker
+	Format backup.Format
+	// formatErr 配置的备份格式不可用,此时备份直接失败而不是改用其他格式
+	formatErr error
+
+	// mu 避免定时备份和手动备份同时写入
+	mu sync.Mutex
 }
 
 func NewBackupTask(config config.Config) *BackupTask {
-	var ticker *time.Ticker
-	if config.BackupInterval > 0 {
-		ticker = time.NewTicker(time.Duration(config.BackupInterval) * time.Second)
+	format, err := backup.ParseFormat(config.BackupFormat)
+	if err == nil && !backup.Supported(format) {
+		err = fmt.Errorf("%w: %v", backup.ErrUnsupported, format)
+	}
+	if err != nil {
+		log.Printf("备份格式%v不可用,修改backupFormat之前不会进行备份: %v", config.BackupFormat, err)
 	}
 
 	return &BackupTask{
-		Config: config,
-		Ticker: ticker,
+		Config:    config,
+		Format:    format,
+		formatErr: err,
 	}
 }
 
-func (task *BackupTask) Schedule() {
-	if task.Ticker == nil {
-		// 如果 Ticker 为 nil，不需要进行定时备份
-		return
-	}
+// RunBackup 让服务端保存存档后,把存档和配置写入BackupPath下的一个压缩包,任何一个目录失败时不保留压缩包。
+// trigger为创建备份的原因,记录在清单中。备份完成后按清单校验一次
+func (task *BackupTask) RunBackup(trigger string) error {
+	task.mu.Lock()
+	defer task.mu.Unlock()
 
-	for range task.Ticker.C {
-		task.RunBackup()
+	if task.formatErr != nil {
+		log.Printf("Backup skipped: %v", task.formatErr)
+		event.Publish(event.BackupCompleted{Path: task.Config.BackupPath, Trigger: trigger, Error: task.formatErr.Error()})
+		return task.formatErr
 	}
-}
 
-func (task *BackupTask) RunBackup() {
-	// 获取当前日期和时间
-	currentDate := time.Now().Format("2006-01-02-15-04-05")
+	opts := task.describeServer()
+	opts.Trigger = trigger
+	opts = task.saveWorld(opts)
 
-	// 创建新的备份目录
-	backupDir := filepath.Join(task.Config.BackupPath, currentDate)
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
+	if err := os.MkdirAll(task.Config.BackupPath, 0755); err != nil {
 		log.Printf("Failed to create backup directory: %v", err)
-		return
+		event.Publish(event.BackupCompleted{Path: task.Config.BackupPath, Trigger: trigger, Error: err.Error()})
+		return err
 	}
 
-	// 确定源文件的路径和目标路径
-	sourcePath := filepath.Join(task.Config.GameSavePath, "SaveGames")
-	destinationPath := filepath.Join(backupDir, "SaveGames")
-
-	// 执行文件复制操作
-	if err := copyDir(sourcePath, destinationPath); err != nil {
-		log.Printf("Failed to copy files for backup SaveGames: %v", err)
-	} else {
-		log.Printf("Backup completed successfully: %s", destinationPath)
+	file := filepath.Join(task.Config.BackupPath, backup.FileName(time.Now(), task.Format))
+	info, err := backup.Create(file, task.Format, []backup.Source{
+		{Name: "SaveGames", Path: filepath.Join(task.Config.GameSavePath, "SaveGames")},
+		{Name: "Config", Path: filepath.Join(task.Config.GameSavePath, "Config")},
+	}, opts)
+	if err != nil {
+		log.Printf("Failed to create backup %v: %v", file, err)
+		event.Publish(event.BackupCompleted{Path: file, Trigger: trigger, Error: err.Error()})
+		return err
 	}
-
-	// 确定源文件的路径和目标路径
-	sourcePath = filepath.Join(task.Config.GameSavePath, "Config")
-	destinationPath = filepath.Join(backupDir, "Config")
-
-	// 执行文件复制操作
-	if err := copyDir(sourcePath, destinationPath); err != nil {
-		log.Printf("Failed to copy files for backup Config: %v", err)
+	if info.Format == backup.FormatSnapshot {
+		log.Printf("Backup completed successfully: %s (%d files, %d new bytes stored)", file, info.Files, info.Stored)
 	} else {
-		log.Printf("Backup completed successfully: %s", destinationPath)
+		log.Printf("Backup completed successfully: %s (%d files, %d bytes)", file, info.Files, info.Size)
 	}
 
-	// 删除旧备份（如果设置了天数）
-	if task.Config.SaveDeleteDays > 0 {
-		task.deleteOldBackups()
+	// 重新读取刚写入的备份,确认与清单一致
+	completed := event.BackupCompleted{Path: file, Size: info.Size, Trigger: trigger, SaveConfirmed: opts.SaveConfirmed}
+	report, err := backup.Verify(info)
+	switch {
+	case err != nil:
+		err = fmt.Errorf("verify: %w", err)
+	case !report.OK:
+		err = fmt.Errorf("verify: %v", verifyProblem(report))
+	}
+	if err != nil {
+		// 保留校验失败的备份以便检查,但不删除旧备份,避免只剩下损坏的备份
+		log.Printf("Backup verification failed: %s: %v", file, err)
+		completed.Error = err.Error()
+		event.Publish(completed)
+		return err
 	}
+	completed.Verified = true
+	event.Publish(completed)
 
+	// 按保留策略删除旧备份
+	task.deleteOldBackups()
+	return nil
 }
 
-func (task *BackupTask) deleteOldBackups() {
-	// 读取备份目录
-	files, err := os.ReadDir(task.Config.BackupPath)
+// describeServer 返回备份时的版本和在线玩家,记录在清单中。RCON不可用时服务端版本和玩家为空
+func (task *BackupTask) describeServer() backup.Options {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ctx = audit.WithOrigin(ctx, audit.OriginBackup)
+
+	opts := backup.Options{ToolVersion: version}
+	if info, err := tool.InfoContext(ctx, task.Config); err == nil {
+		opts.ServerVersion = info["version"]
+	}
+	client, err := tool.NewServerClient(task.Config)
 	if err != nil {
-		log.Printf("Failed to list backup directory: %v", err)
-		return
+		return opts
 	}
-
-	// 删除超过SaveDeleteDays天数的备份
-	for _, f := range files {
-		if f.IsDir() {
-			backupTime, err := time.Parse("2006-01-02-15-04-05", f.Name())
-			if err != nil {
-				log.Printf("Failed to parse backup directory name: %s, error: %v", f.Name(), err)
-				continue
-			}
-
-			if time.Since(backupTime).Hours() > float64(task.Config.SaveDeleteDays*24) {
-				err := os.RemoveAll(filepath.Join(task.Config.BackupPath, f.Name()))
-				if err != nil {
-					log.Printf("Failed to delete old backup: %s, error: %v", f.Name(), err)
-				} else {
-					log.Printf("Old backup deleted successfully: %s", f.Name())
-				}
-			}
-		}
+	if players, err := client.ShowPlayers(ctx); err == nil {
+		opts.Players = players
 	}
+	return opts
 }
 
-// copyDir 递归复制目录及其内容
-func copyDir(src string, dst string) error {
-	srcInfo, err := os.Stat(src)
-	if err != nil {
-		return err
+// verifyProblem 概括校验发现的问题
+func verifyProblem(report backup.Report) string {
+	if report.Error != "" {
+		return report.Error
 	}
+	return fmt.Sprintf("%d missing, %d corrupted files", len(report.Missing), len(report.Corrupted))
+}
 
-	if err := os.MkdirAll(dst, srcInfo.Mode()); err != nil {
-		return err
+// saveWorld 备份前让服务端保存存档,并等待存档文件写入完成,避免复制到写入一半的Level.sav。
+// RCON不可用时只等待文件停止变化,清单中记录为没有确认保存
+func (task *BackupTask) saveWorld(opts backup.Options) backup.Options {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(task.Config.BackupSettleTimeout)*time.Second)
+	defer cancel()
+
+	since := time.Now()
+	err := func() error {
+		client, err := tool.NewServerClient(task.Config)
+		if err != nil {
+			return err
+		}
+		return client.Save(audit.WithOrigin(ctx, audit.OriginBackup))
+	}()
+	if err != nil {
+		log.Printf("备份前保存存档失败,直接备份当前的存档文件: %v", err)
+		opts.SaveError = "save: " + err.Error()
+		since = time.Time{}
 	}
 
-	dir, _ := os.Open(src)
-	defer dir.Close()
-	entries, _ := dir.Readdir(-1)
-
-	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
-
-		if entry.IsDir() {
-			if err := copyDir(srcPath, dstPath); err != nil {
-				return err
-			}
-		} else {
-			if err := copyFile(srcPath, dstPath); err != nil {
-				return err
-			}
+	dirs := []string{filepath.Join(task.Config.GameSavePath, "SaveGames")}
+	quiet := time.Duration(task.Config.BackupSettleTime) * time.Second
+	if err := backup.WaitSettled(ctx, dirs, since, quiet); err != nil {
+		log.Printf("等待存档写入完成失败: %v", err)
+		if opts.SaveError == "" {
+			opts.SaveError = err.Error()
 		}
+		return opts
 	}
-	return nil
+	opts.SaveConfirmed = opts.SaveError == ""
+	return opts
 }
 
-// copyFile 复制单个文件
-func copyFile(src, dst string) error {
-	srcFile, err := os.Open(src)
-	if err != nil {
-		return err
+// deleteOldBackups 按保留策略删除旧备份,包括旧版本按目录复制的备份,固定的备份不会被删除
+func (task *BackupTask) deleteOldBackups() {
+	policy := backup.PolicyFromConfig(task.Config)
+	if !policy.Enabled() {
+		return
 	}
-	defer srcFile.Close()
 
-	dstFile, err := os.Create(dst)
+	decisions, err := backup.Prune(task.Config.BackupPath, policy, time.Now(), false)
 	if err != nil {
-		return err
+		log.Printf("Failed to delete old backups: %v", err)
+	}
+	prunedSnapshots := false
+	for _, d := range decisions {
+		if !d.Keep && d.Error == "" {
+			log.Printf("Old backup deleted successfully: %s", d.Name)
+			prunedSnapshots = prunedSnapshots || d.Format == backup.FormatSnapshot
+		}
 	}
-	defer dstFile.Close()
 
-	if _, err = io.Copy(dstFile, srcFile); err != nil {
-		return err
+	// 清理不再被增量备份引用的文件内容
+	if prunedSnapshots {
+		collectBackupGarbage(task.Config.BackupPath)
 	}
+}
 
-	srcInfo, err := os.Stat(src)
+// collectBackupGarbage 删除增量备份对象库中不再被引用的内容
+func collectBackupGarbage(dir string) {
+	stats, err := backup.GC(dir)
 	if err != nil {
-		return err
+		log.Printf("Failed to collect unreferenced backup objects: %v", err)
+		return
 	}
-
-	return os.Chmod(dst, srcInfo.Mode())
+	log.Printf("Backup GC removed %d objects (%d bytes), %d objects kept", stats.Removed, stats.Freed, stats.Objects)
 }
@@ -0,0 +1,186 @@
+package backup
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// archiveWriter 流式写入压缩包,目录的名称以/结尾,r为nil
+type archiveWriter interface {
+	add(name string, info fs.FileInfo, r io.Reader) error
+	Close() error
+}
+
+// entryFunc 处理压缩包中的一个条目
+type entryFunc func(name string, mode fs.FileMode, r io.Reader) error
+
+// writers 可以写入的格式
+var writers = map[Format]func(w io.Writer) archiveWriter{
+	FormatTarGz:  newTarGzWriter,
+	FormatTarZst: newTarZstWriter,
+	FormatZip:    newZipWriter,
+}
+
+// readers 可以解压的格式
+var readers = map[Format]func(file string, fn entryFunc) error{
+	FormatTarGz:    readTarGz,
+	FormatTarZst:   readTarZst,
+	FormatZip:      readZip,
+	FormatSnapshot: readSnapshot,
+}
+
+// tarWriter 写入经过压缩的tar包
+type tarWriter struct {
+	compressor io.WriteCloser
+	tw         *tar.Writer
+}
+
+func newTarGzWriter(w io.Writer) archiveWriter {
+	gz := gzip.NewWriter(w)
+	return &tarWriter{compressor: gz, tw: tar.NewWriter(gz)}
+}
+
+func newTarZstWriter(w io.Writer) archiveWriter {
+	// 只有选项错误时才会返回错误,默认选项不会出错
+	zw, _ := zstd.NewWriter(w)
+	return &tarWriter{compressor: zw, tw: tar.NewWriter(zw)}
+}
+
+func (w *tarWriter) add(name string, info fs.FileInfo, r io.Reader) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Format = tar.FormatPAX
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if r == nil {
+		return nil
+	}
+	_, err = io.Copy(w.tw, r)
+	return err
+}
+
+func (w *tarWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		w.compressor.Close()
+		return err
+	}
+	return w.compressor.Close()
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func newZipWriter(w io.Writer) archiveWriter {
+	return &zipWriter{zw: zip.NewWriter(w)}
+}
+
+func (w *zipWriter) add(name string, info fs.FileInfo, r io.Reader) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if r != nil {
+		header.Method = zip.Deflate
+	}
+	dst, err := w.zw.CreateHeader(header)
+	if err != nil || r == nil {
+		return err
+	}
+	_, err = io.Copy(dst, r)
+	return err
+}
+
+func (w *zipWriter) Close() error {
+	return w.zw.Close()
+}
+
+func readTarGz(file string, fn entryFunc) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	return readTar(gz, fn)
+}
+
+func readTarZst(file string, fn entryFunc) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	return readTar(zr, fn)
+}
+
+// readTar 读取已经解压的tar流
+func readTar(r io.Reader, fn entryFunc) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir, tar.TypeReg:
+			if err := fn(header.Name, header.FileInfo().Mode(), tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func readZip(file string, fn entryFunc) error {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, entry := range zr.File {
+		mode := entry.Mode()
+		if !mode.IsDir() && !mode.IsRegular() {
+			continue
+		}
+		err := func() error {
+			r, err := entry.Open()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			return fn(entry.Name, mode, r)
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
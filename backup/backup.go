@@ -0,0 +1,284 @@
+// Package backup 把存档和配置目录流式写入单个压缩包,并负责列出和解压备份。
+// 每个备份是BackupPath下以时间命名的一个文件,如 2024-03-13-04-00-00.tar.gz,
+// 写入时先写临时文件再重命名,不会留下不完整的备份。旧版本按目录复制的备份仍然可以列出和还原。
+// 也可以选择增量去重备份,见FormatSnapshot。
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format 压缩包格式
+type Format string
+
+const (
+	FormatTarGz  Format = "tar.gz"
+	FormatTarZst Format = "tar.zst"
+	FormatZip    Format = "zip"
+)
+
+// TimeLayout 备份名称使用的时间格式
+const TimeLayout = "2006-01-02-15-04-05"
+
+// partialSuffix 正在写入的备份的后缀,写完后重命名
+const partialSuffix = ".partial"
+
+// ErrUnsupported 格式无法识别,或当前版本没有对应的压缩实现
+var ErrUnsupported = errors.New("unsupported backup format")
+
+// formats 按扩展名从长到短排列,用于从文件名识别格式
+var formats = []Format{FormatSnapshot, FormatTarZst, FormatTarGz, FormatZip}
+
+// ParseFormat 解析配置中的格式名称,为空时使用tar.gz
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "tar.gz", "tgz", "gzip", "gz":
+		return FormatTarGz, nil
+	case "zip":
+		return FormatZip, nil
+	case "tar.zst", "tzst", "zstd", "zst":
+		return FormatTarZst, nil
+	case "snapshot", "snapshot.json", "dedup", "incremental":
+		return FormatSnapshot, nil
+	}
+	return "", fmt.Errorf("%w: %v", ErrUnsupported, s)
+}
+
+// Supported 当前版本是否可以写入和读取这种格式
+func Supported(format Format) bool {
+	_, ok := writers[format]
+	return ok || format == FormatSnapshot
+}
+
+// FormatOf 根据文件名识别格式,不是压缩包时返回空
+func FormatOf(name string) Format {
+	for _, format := range formats {
+		if strings.HasSuffix(name, "."+string(format)) {
+			return format
+		}
+	}
+	return ""
+}
+
+// FileName 返回t时刻创建的备份的文件名
+func FileName(t time.Time, format Format) string {
+	return t.Format(TimeLayout) + "." + string(format)
+}
+
+// Source 一个要备份的目录
+type Source struct {
+	// Name 压缩包中的目录名,如 SaveGames
+	Name string
+	// Path 磁盘上的目录
+	Path string
+}
+
+// Info 一个备份
+type Info struct {
+	Name   string    `json:"name"`
+	Path   string    `json:"-"`
+	Time   time.Time `json:"time"`
+	Format Format    `json:"format,omitempty"`
+	// Dir 旧版本按目录复制的备份
+	Dir   bool  `json:"dir,omitempty"`
+	Size  int64 `json:"size"`
+	Files int   `json:"files,omitempty"`
+	// Stored 增量备份本次新写入的文件内容大小,只在Create时返回
+	Stored int64 `json:"stored,omitempty"`
+}
+
+// Create 把sources写入压缩包file,返回写入的文件数和压缩后的大小。
+// 压缩包旁边同时写入记录文件列表的清单 <file>.manifest.json。出错时不会留下文件
+func Create(file string, format Format, sources []Source, opts Options) (Info, error) {
+	if format == FormatSnapshot {
+		return createSnapshot(file, sources, opts)
+	}
+	newWriter, ok := writers[format]
+	if !ok {
+		return Info{}, fmt.Errorf("%w: %v", ErrUnsupported, format)
+	}
+
+	partial := file + partialSuffix
+	f, err := os.Create(partial)
+	if err != nil {
+		return Info{}, err
+	}
+	info := Info{Name: filepath.Base(file), Path: file, Time: time.Now(), Format: format}
+	manifest := newManifest(info.Time, opts)
+
+	err = func() error {
+		w := newWriter(f)
+		for _, source := range sources {
+			entries, err := addDir(w, source)
+			manifest.Files = append(manifest.Files, entries...)
+			if err != nil {
+				w.Close()
+				return fmt.Errorf("%v: %w", source.Name, err)
+			}
+		}
+		return w.Close()
+	}()
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	// 先写清单再重命名压缩包,压缩包存在时清单一定存在
+	if err == nil {
+		err = writeManifest(file+ManifestSuffix, manifest)
+	}
+	if err == nil {
+		err = os.Rename(partial, file)
+	}
+	if err != nil {
+		os.Remove(partial)
+		os.Remove(file + ManifestSuffix)
+		return Info{}, err
+	}
+
+	info.Files = manifest.fileCount()
+	if stat, err := os.Stat(file); err == nil {
+		info.Size = stat.Size()
+	}
+	return info, nil
+}
+
+// addDir 把一个目录写入压缩包,返回写入的条目
+func addDir(w archiveWriter, source Source) ([]FileEntry, error) {
+	var entries []FileEntry
+	err := filepath.WalkDir(source.Path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source.Path, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(source.Name, filepath.ToSlash(rel))
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := FileEntry{Path: name, Mode: info.Mode(), ModTime: info.ModTime()}
+
+		switch {
+		case d.IsDir():
+			entries = append(entries, entry)
+			return w.add(name+"/", info, nil)
+		case info.Mode().IsRegular():
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			// 写入压缩包的同时计算SHA-256,不需要再读一遍文件
+			h := sha256.New()
+			var n countWriter
+			if err := w.add(name, info, io.TeeReader(f, io.MultiWriter(h, &n))); err != nil {
+				return err
+			}
+			entry.Size = int64(n)
+			entry.Hash = hex.EncodeToString(h.Sum(nil))
+			entries = append(entries, entry)
+			return nil
+		}
+		// 跳过符号链接等特殊文件
+		return nil
+	})
+	return entries, err
+}
+
+// countWriter 统计写入的字节数
+type countWriter int64
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	*c += countWriter(len(p))
+	return len(p), nil
+}
+
+// Extract 把压缩包解压到dir,条目不能指向dir之外
+func Extract(file, dir string) error {
+	format := FormatOf(file)
+	newReader, ok := readers[format]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrUnsupported, filepath.Base(file))
+	}
+	return newReader(file, func(name string, mode fs.FileMode, r io.Reader) error {
+		target, err := safeJoin(dir, name)
+		if err != nil {
+			return err
+		}
+		if mode.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0200)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, r); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
+
+// safeJoin 把压缩包中的条目名拼接到dir下,拒绝绝对路径和..
+func safeJoin(dir, name string) (string, error) {
+	name = strings.TrimSuffix(strings.ReplaceAll(name, "\\", "/"), "/")
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("invalid entry %q", name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(name)), nil
+}
+
+// List 列出dir下的备份,按时间从新到旧排列。名称不是时间格式的文件和目录被忽略
+func List(dir string) ([]Info, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []Info
+	for _, entry := range entries {
+		name := entry.Name()
+		backup := Info{Name: name, Path: filepath.Join(dir, name), Dir: entry.IsDir()}
+		stamp := name
+		if !backup.Dir {
+			backup.Format = FormatOf(name)
+			if backup.Format == "" {
+				continue
+			}
+			stamp = strings.TrimSuffix(name, "."+string(backup.Format))
+		}
+		t, err := time.ParseInLocation(TimeLayout, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		backup.Time = t
+		if info, err := entry.Info(); err == nil && !backup.Dir {
+			backup.Size = info.Size()
+		}
+		backups = append(backups, backup)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+	return backups, nil
+}
@@ -0,0 +1,190 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/backup"
+)
+
+// writeTree 在dir下创建files中的文件
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCreateExtract(t *testing.T) {
+	saved := t.TempDir()
+	writeTree(t, saved, map[string]string{
+		"SaveGames/0/ABC123/Level.sav":         "level",
+		"SaveGames/0/ABC123/Players/P1.sav":    "player",
+		"Config/WindowsServer/PalWorld.ini":    "[settings]",
+		"Config/WindowsServer/Engine.ini":      "",
+		"SaveGames/0/ABC123/LevelMeta.sav.bak": "meta",
+	})
+	sources := []backup.Source{
+		{Name: "SaveGames", Path: filepath.Join(saved, "SaveGames")},
+		{Name: "Config", Path: filepath.Join(saved, "Config")},
+	}
+
+	for _, format := range []backup.Format{backup.FormatTarGz, backup.FormatTarZst, backup.FormatZip} {
+		t.Run(string(format), func(t *testing.T) {
+			dir := t.TempDir()
+			file := filepath.Join(dir, backup.FileName(time.Now(), format))
+			info, err := backup.Create(file, format, sources, backup.Options{SaveConfirmed: true})
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if info.Files != 5 || info.Size == 0 || info.Format != format {
+				t.Errorf("info = %+v", info)
+			}
+			if _, err := os.Stat(file + ".partial"); !os.IsNotExist(err) {
+				t.Errorf("partial file left behind: %v", err)
+			}
+
+			out := t.TempDir()
+			if err := backup.Extract(file, out); err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(out, "SaveGames", "0", "ABC123", "Players", "P1.sav"))
+			if err != nil || string(data) != "player" {
+				t.Errorf("extracted P1.sav = %q, %v", data, err)
+			}
+			data, err = os.ReadFile(filepath.Join(out, "Config", "WindowsServer", "Engine.ini"))
+			if err != nil || len(data) != 0 {
+				t.Errorf("extracted Engine.ini = %q, %v", data, err)
+			}
+
+			// 压缩包旁边的清单记录了文件列表和保存状态
+			m, err := backup.ManifestOf(info)
+			if err != nil {
+				t.Fatalf("ManifestOf: %v", err)
+			}
+			if !m.SaveConfirmed || len(m.Files) != 11 {
+				t.Errorf("manifest = %+v", m)
+			}
+			if backups, _ := backup.List(dir); len(backups) != 1 {
+				t.Errorf("List = %+v", backups)
+			}
+			if err := backup.Remove(file); err != nil {
+				t.Fatalf("Remove: %v", err)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("Remove left %d files", len(entries))
+			}
+		})
+	}
+}
+
+func TestCreate_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "2024-03-13-04-00-00.tar.gz")
+	_, err := backup.Create(file, backup.FormatTarGz, []backup.Source{{Name: "SaveGames", Path: filepath.Join(dir, "missing")}}, backup.Options{})
+	if err == nil {
+		t.Fatal("Create with missing source succeeded")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("failed Create left %d files", len(entries))
+	}
+
+	_, err = backup.Create(filepath.Join(dir, "x.tar.xz"), backup.Format("tar.xz"), nil, backup.Options{})
+	if !errors.Is(err, backup.ErrUnsupported) {
+		t.Errorf("Create tar.xz error = %v", err)
+	}
+}
+
+func TestExtract_RejectsTraversal(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "evil.tar.gz")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "../escaped.txt", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+	tw.Write([]byte("x"))
+	tw.Close()
+	gz.Close()
+	f.Close()
+
+	out := filepath.Join(dir, "out")
+	if err := backup.Extract(file, out); err == nil {
+		t.Error("Extract accepted ../ entry")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.txt")); !os.IsNotExist(err) {
+		t.Error("entry escaped the target directory")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		in   string
+		want backup.Format
+		ok   bool
+	}{
+		{"", backup.FormatTarGz, true},
+		{"TAR.GZ", backup.FormatTarGz, true},
+		{"zip", backup.FormatZip, true},
+		{"zstd", backup.FormatTarZst, true},
+		{"tar.zst", backup.FormatTarZst, true},
+		{"rar", "", false},
+	}
+	for _, tt := range tests {
+		got, err := backup.ParseFormat(tt.in)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("ParseFormat(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+	if !backup.Supported(backup.FormatZip) || !backup.Supported(backup.FormatTarZst) || backup.Supported(backup.Format("tar.xz")) {
+		t.Error("Supported reports wrong formats")
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"2024-03-12-04-00-00/SaveGames/0/A/Level.sav": "old",
+		"2024-03-13-04-00-00.tar.gz":                  "gz",
+		"2024-03-14-04-00-00.zip":                     "zip",
+		"2024-03-15-04-00-00.tar.zst":                 "zst",
+		"2024-03-16-04-00-00.tar.gz.partial":          "partial",
+		"notes.txt":                                   "ignored",
+	})
+	os.Mkdir(filepath.Join(dir, "restore-123"), 0755)
+
+	backups, err := backup.List(dir)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var names []string
+	for _, b := range backups {
+		names = append(names, b.Name)
+	}
+	want := []string{"2024-03-15-04-00-00.tar.zst", "2024-03-14-04-00-00.zip", "2024-03-13-04-00-00.tar.gz", "2024-03-12-04-00-00"}
+	if len(names) != len(want) {
+		t.Fatalf("List = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("List = %v, want %v", names, want)
+		}
+	}
+	if !backups[3].Dir || backups[0].Format != backup.FormatTarZst || backups[1].Format != backup.FormatZip || backups[2].Size != 2 {
+		t.Errorf("List entries = %+v", backups)
+	}
+}
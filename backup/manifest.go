@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+)
+
+// ManifestSuffix 压缩包备份的清单文件后缀,清单与压缩包放在同一目录
+const ManifestSuffix = ".manifest.json"
+
+// manifestVersion 清单格式的版本,版本2起压缩包的清单也记录每个文件的SHA-256
+const manifestVersion = 2
+
+// 创建备份的原因
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+	TriggerRestart  = "restart"
+)
+
+// Options 创建备份时记录在清单中的信息
+type Options struct {
+	// Trigger 创建备份的原因,如TriggerSchedule
+	Trigger string
+	// ToolVersion palworld-go的版本
+	ToolVersion string
+	// ServerVersion 服务端的版本,RCON不可用时为空
+	ServerVersion string
+	// Players 备份时在线的玩家
+	Players []palworld.Player
+	// SaveConfirmed 备份前服务端确认保存了存档,并且存档文件已经写入完成
+	SaveConfirmed bool
+	// SaveError 没有确认保存的原因
+	SaveError string
+}
+
+// Manifest 一次备份的文件列表。增量备份的清单本身就是备份,压缩包备份的清单与压缩包放在一起
+type Manifest struct {
+	Version       int               `json:"version"`
+	Time          time.Time         `json:"time"`
+	Trigger       string            `json:"trigger,omitempty"`
+	ToolVersion   string            `json:"tool_version,omitempty"`
+	ServerVersion string            `json:"server_version,omitempty"`
+	Players       []palworld.Player `json:"players,omitempty"`
+	// SaveConfirmed 备份前服务端确认保存了存档,为false时存档可能是服务端写入到一半时复制的
+	SaveConfirmed bool        `json:"save_confirmed"`
+	SaveError     string      `json:"save_error,omitempty"`
+	Files         []FileEntry `json:"files"`
+}
+
+// FileEntry 清单中的一个文件或目录
+type FileEntry struct {
+	// Path 压缩包中的路径,如 SaveGames/0/<hash>/Level.sav
+	Path    string      `json:"path"`
+	Mode    fs.FileMode `json:"mode"`
+	Size    int64       `json:"size,omitempty"`
+	ModTime time.Time   `json:"mtime"`
+	// Hash 文件内容的SHA-256,目录和版本1的压缩包清单为空
+	Hash string `json:"sha256,omitempty"`
+}
+
+func newManifest(t time.Time, opts Options) Manifest {
+	return Manifest{
+		Version:       manifestVersion,
+		Time:          t,
+		Trigger:       opts.Trigger,
+		ToolVersion:   opts.ToolVersion,
+		ServerVersion: opts.ServerVersion,
+		Players:       opts.Players,
+		SaveConfirmed: opts.SaveConfirmed,
+		SaveError:     opts.SaveError,
+	}
+}
+
+// fileCount 清单中的文件数,不包括目录
+func (m Manifest) fileCount() int {
+	n := 0
+	for _, entry := range m.Files {
+		if !entry.Mode.IsDir() {
+			n++
+		}
+	}
+	return n
+}
+
+// ReadManifest 读取清单文件
+func ReadManifest(file string) (Manifest, error) {
+	var m Manifest
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("%v: %w", filepath.Base(file), err)
+	}
+	return m, nil
+}
+
+// ManifestOf 返回一个备份的清单,旧版本按目录复制的备份和没有清单的压缩包返回os.ErrNotExist
+func ManifestOf(b Info) (Manifest, error) {
+	switch {
+	case b.Dir:
+		return Manifest{}, os.ErrNotExist
+	case b.Format == FormatSnapshot:
+		return ReadManifest(b.Path)
+	}
+	return ReadManifest(b.Path + ManifestSuffix)
+}
+
+// Remove 删除一个备份和它的清单
+func Remove(path string) error {
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	if err := os.Remove(path + ManifestSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// writeManifest 先写临时文件再重命名
+func writeManifest(file string, m Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	partial := file + partialSuffix
+	if err := writeFileSync(partial, data); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	if err := os.Rename(partial, file); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return nil
+}
+
+func writeFileSync(name string, data []byte) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
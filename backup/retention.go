@@ -0,0 +1,252 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/config"
+)
+
+// PinsFile 固定的备份列表,位于BackupPath下
+const PinsFile = "pins.json"
+
+// 保留备份的原因
+const (
+	ReasonPinned  = "pinned"
+	ReasonLast    = "last"
+	ReasonWithin  = "within"
+	ReasonHourly  = "hourly"
+	ReasonDaily   = "daily"
+	ReasonWeekly  = "weekly"
+	ReasonMonthly = "monthly"
+)
+
+// ErrNotFound 没有这个名称的备份
+var ErrNotFound = errors.New("backup not found")
+
+var pinsMu sync.Mutex
+
+// Policy 备份保留策略。满足任意一条规则或被固定的备份被保留,其余的被删除;
+// 所有规则都为0时不删除任何备份
+type Policy struct {
+	// KeepLast 保留最新的N个备份
+	KeepLast int
+	// Hourly 在最近H个有备份的小时中,每小时保留最新的一个
+	Hourly int
+	// Daily 在最近D个有备份的日子中,每天保留最新的一个
+	Daily int
+	// Weekly 在最近W个有备份的周中,每周保留最新的一个
+	Weekly int
+	// Monthly 在最近M个有备份的月份中,每月保留最新的一个
+	Monthly int
+	// Within 保留这段时间内的所有备份,对应SaveDeleteDays
+	Within time.Duration
+}
+
+// PolicyFromConfig 从配置读取保留策略
+func PolicyFromConfig(cfg config.Config) Policy {
+	return Policy{
+		KeepLast: cfg.BackupKeepLast,
+		Hourly:   cfg.BackupKeepHourly,
+		Daily:    cfg.BackupKeepDaily,
+		Weekly:   cfg.BackupKeepWeekly,
+		Monthly:  cfg.BackupKeepMonthly,
+		Within:   time.Duration(cfg.SaveDeleteDays) * 24 * time.Hour,
+	}
+}
+
+// Enabled 是否配置了任何规则
+func (p Policy) Enabled() bool {
+	return p.KeepLast > 0 || p.Hourly > 0 || p.Daily > 0 || p.Weekly > 0 || p.Monthly > 0 || p.Within > 0
+}
+
+// Decision 保留策略对一个备份的处理
+type Decision struct {
+	Info
+	Keep    bool     `json:"keep"`
+	Pinned  bool     `json:"pinned"`
+	Reasons []string `json:"reasons,omitempty"`
+	// Error 删除失败的原因
+	Error string `json:"error,omitempty"`
+}
+
+// Plan 按策略决定保留哪些备份,backups需按时间从新到旧排列(List的顺序)
+func Plan(backups []Info, pins map[string]bool, policy Policy, now time.Time) []Decision {
+	decisions := make([]Decision, len(backups))
+	for i, b := range backups {
+		decisions[i] = Decision{Info: b, Pinned: pins[b.Name]}
+	}
+	keep := func(i int, reason string) {
+		decisions[i].Keep = true
+		decisions[i].Reasons = append(decisions[i].Reasons, reason)
+	}
+
+	if !policy.Enabled() {
+		for i := range decisions {
+			decisions[i].Keep = true
+			if decisions[i].Pinned {
+				decisions[i].Reasons = []string{ReasonPinned}
+			}
+		}
+		return decisions
+	}
+
+	// bucket 在最近n个有备份的时间段中,每个时间段保留最新的一个
+	bucket := func(reason string, n int, key func(t time.Time) string) {
+		seen := make(map[string]bool)
+		for i, b := range backups {
+			k := key(b.Time)
+			if seen[k] {
+				continue
+			}
+			if len(seen) == n {
+				return
+			}
+			seen[k] = true
+			keep(i, reason)
+		}
+	}
+
+	for i, b := range backups {
+		if decisions[i].Pinned {
+			keep(i, ReasonPinned)
+		}
+		if i < policy.KeepLast {
+			keep(i, ReasonLast)
+		}
+		if policy.Within > 0 && b.Time.After(now.Add(-policy.Within)) {
+			keep(i, ReasonWithin)
+		}
+	}
+	bucket(ReasonHourly, policy.Hourly, func(t time.Time) string {
+		return t.Format("2006-01-02 15")
+	})
+	bucket(ReasonDaily, policy.Daily, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+	bucket(ReasonWeekly, policy.Weekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	})
+	bucket(ReasonMonthly, policy.Monthly, func(t time.Time) string {
+		return t.Format("2006-01")
+	})
+	return decisions
+}
+
+// Prune 按策略删除dir下的备份,dryRun为true时只返回结果不删除。
+// 删除失败时设置对应结果的Error,并返回遇到的错误
+func Prune(dir string, policy Policy, now time.Time, dryRun bool) ([]Decision, error) {
+	backups, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	pins, err := Pins(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions := Plan(backups, pins, policy, now)
+	if dryRun {
+		return decisions, nil
+	}
+	var errs []error
+	for i, d := range decisions {
+		if d.Keep {
+			continue
+		}
+		if err := Remove(d.Path); err != nil {
+			decisions[i].Error = err.Error()
+			errs = append(errs, fmt.Errorf("%v: %w", d.Name, err))
+		}
+	}
+	return decisions, errors.Join(errs...)
+}
+
+// Pins 返回dir下被固定的备份
+func Pins(dir string) (map[string]bool, error) {
+	pinsMu.Lock()
+	defer pinsMu.Unlock()
+	return readPins(dir)
+}
+
+// Pin 固定一个备份,固定的备份不会被保留策略删除
+func Pin(dir, name string) error {
+	backups, err := List(dir)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, b := range backups {
+		found = found || b.Name == name
+	}
+	if !found {
+		return fmt.Errorf("%w: %v", ErrNotFound, name)
+	}
+
+	pinsMu.Lock()
+	defer pinsMu.Unlock()
+	pins, err := readPins(dir)
+	if err != nil {
+		return err
+	}
+	pins[name] = true
+	return writePins(dir, pins)
+}
+
+// Unpin 取消固定一个备份
+func Unpin(dir, name string) error {
+	pinsMu.Lock()
+	defer pinsMu.Unlock()
+	pins, err := readPins(dir)
+	if err != nil {
+		return err
+	}
+	if !pins[name] {
+		return nil
+	}
+	delete(pins, name)
+	return writePins(dir, pins)
+}
+
+func readPins(dir string) (map[string]bool, error) {
+	pins := make(map[string]bool)
+	data, err := os.ReadFile(filepath.Join(dir, PinsFile))
+	if os.IsNotExist(err) {
+		return pins, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("%v: %w", PinsFile, err)
+	}
+	for _, name := range names {
+		pins[name] = true
+	}
+	return pins, nil
+}
+
+func writePins(dir string, pins map[string]bool) error {
+	names := make([]string, 0, len(pins))
+	for name := range pins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	data, err := json.MarshalIndent(names, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(dir, PinsFile)
+	if err := writeFileSync(file+partialSuffix, data); err != nil {
+		return err
+	}
+	return os.Rename(file+partialSuffix, file)
+}
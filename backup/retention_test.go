@@ -0,0 +1,156 @@
+package backup_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/backup"
+)
+
+// hourlyBackups 从now开始每隔step一个备份,共n个,从新到旧排列
+func hourlyBackups(now time.Time, step time.Duration, n int) []backup.Info {
+	backups := make([]backup.Info, n)
+	for i := range backups {
+		t := now.Add(-time.Duration(i) * step)
+		backups[i] = backup.Info{Name: backup.FileName(t, backup.FormatTarGz), Time: t}
+	}
+	return backups
+}
+
+func kept(decisions []backup.Decision) []string {
+	var names []string
+	for _, d := range decisions {
+		if d.Keep {
+			names = append(names, d.Info.Time.Format("01-02 15:04"))
+		}
+	}
+	return names
+}
+
+func TestPlan(t *testing.T) {
+	// 2024-03-13是星期三
+	now := time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC)
+	every30m := hourlyBackups(now, 30*time.Minute, 6)
+	daily := hourlyBackups(now, 24*time.Hour, 60)
+
+	tests := []struct {
+		name    string
+		backups []backup.Info
+		pins    map[string]bool
+		policy  backup.Policy
+		want    []string
+	}{
+		{
+			name:    "disabled keeps everything",
+			backups: every30m,
+			want:    []string{"03-13 12:00", "03-13 11:30", "03-13 11:00", "03-13 10:30", "03-13 10:00", "03-13 09:30"},
+		},
+		{
+			name:    "keep last",
+			backups: every30m,
+			policy:  backup.Policy{KeepLast: 2},
+			want:    []string{"03-13 12:00", "03-13 11:30"},
+		},
+		{
+			name:    "hourly keeps newest per hour",
+			backups: every30m,
+			policy:  backup.Policy{Hourly: 2},
+			want:    []string{"03-13 12:00", "03-13 11:30"},
+		},
+		{
+			name:    "within",
+			backups: every30m,
+			policy:  backup.Policy{Within: 90 * time.Minute},
+			want:    []string{"03-13 12:00", "03-13 11:30", "03-13 11:00"},
+		},
+		{
+			name:    "pinned",
+			backups: every30m,
+			pins:    map[string]bool{every30m[4].Name: true},
+			policy:  backup.Policy{KeepLast: 1},
+			want:    []string{"03-13 12:00", "03-13 10:00"},
+		},
+		{
+			name:    "weekly",
+			backups: daily[:15],
+			policy:  backup.Policy{Weekly: 2},
+			// 03-11是星期一,每个ISO周保留最新的一个
+			want: []string{"03-13 12:00", "03-10 12:00"},
+		},
+		{
+			name:    "monthly",
+			backups: daily,
+			policy:  backup.Policy{Monthly: 2},
+			want:    []string{"03-13 12:00", "02-29 12:00"},
+		},
+		{
+			name:    "grandfather father son",
+			backups: daily,
+			policy:  backup.Policy{Daily: 3, Weekly: 2, Monthly: 3},
+			want:    []string{"03-13 12:00", "03-12 12:00", "03-11 12:00", "03-10 12:00", "02-29 12:00", "01-31 12:00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := kept(backup.Plan(tt.backups, tt.pins, tt.policy, now))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("kept %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	var names []string
+	for i := 0; i < 4; i++ {
+		name := backup.FileName(now.Add(-time.Duration(i)*time.Hour), backup.FormatTarGz)
+		writeTree(t, dir, map[string]string{name: "x"})
+		names = append(names, name)
+	}
+	policy := backup.Policy{KeepLast: 1}
+
+	if err := backup.Pin(dir, names[2]); err != nil {
+		t.Fatalf("Pin: %v", err)
+	}
+	if err := backup.Pin(dir, "missing.tar.gz"); !errors.Is(err, backup.ErrNotFound) {
+		t.Errorf("Pin missing = %v", err)
+	}
+
+	// 预览不删除任何文件
+	decisions, err := backup.Prune(dir, policy, now, true)
+	if err != nil {
+		t.Fatalf("Prune dry run: %v", err)
+	}
+	if len(decisions) != 4 || !decisions[2].Pinned || decisions[1].Keep || decisions[3].Keep {
+		t.Errorf("dry run decisions = %+v", decisions)
+	}
+	if backups, _ := backup.List(dir); len(backups) != 4 {
+		t.Errorf("dry run deleted backups, %d left", len(backups))
+	}
+
+	if _, err := backup.Prune(dir, policy, now, false); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	backups, _ := backup.List(dir)
+	if len(backups) != 2 || backups[0].Name != names[0] || backups[1].Name != names[2] {
+		t.Errorf("after prune %+v", backups)
+	}
+
+	// 取消固定后可以被删除
+	if err := backup.Unpin(dir, names[2]); err != nil {
+		t.Fatalf("Unpin: %v", err)
+	}
+	backup.Prune(dir, policy, now, false)
+	if _, err := os.Stat(filepath.Join(dir, names[2])); !os.IsNotExist(err) {
+		t.Errorf("unpinned backup survived prune: %v", err)
+	}
+	if pins, err := backup.Pins(dir); err != nil || len(pins) != 0 {
+		t.Errorf("Pins = %v, %v", pins, err)
+	}
+}
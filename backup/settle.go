@@ -0,0 +1,83 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotWritten 保存指令之后存档文件没有被写入
+var ErrNotWritten = errors.New("save files were not written after the save command")
+
+// mtimeSlack 文件系统修改时间精度的余量,FAT等文件系统的精度只有2秒
+const mtimeSlack = 2 * time.Second
+
+// WaitSettled 等待dirs下的文件写入完成:since不为零时先等待有文件在since之后被修改,
+// 然后等待连续quiet时间内所有文件的大小和修改时间都不再变化。ctx结束时返回错误
+func WaitSettled(ctx context.Context, dirs []string, since time.Time, quiet time.Duration) error {
+	poll := quiet / 5
+	if poll < 50*time.Millisecond {
+		poll = 50 * time.Millisecond
+	}
+
+	last, newest := fingerprint(dirs)
+	stableSince := time.Now()
+	for {
+		written := since.IsZero() || !newest.Before(since.Add(-mtimeSlack))
+		if written && time.Since(stableSince) >= quiet {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if !written {
+				return ErrNotWritten
+			}
+			return fmt.Errorf("save files still changing: %w", ctx.Err())
+		case <-time.After(poll):
+		}
+
+		current, n := fingerprint(dirs)
+		if current != last {
+			last, newest = current, n
+			stableSince = time.Now()
+		}
+	}
+}
+
+// fingerprint 汇总dirs下所有文件的路径、大小和修改时间,返回摘要和最新的修改时间。
+// 遍历时文件被删除等错误也计入摘要,使下一次比较时视为有变化
+func fingerprint(dirs []string) (string, time.Time) {
+	h := sha256.New()
+	var newest time.Time
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				fmt.Fprintf(h, "%v\x00error\x00", p)
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				fmt.Fprintf(h, "%v\x00error\x00", p)
+				return nil
+			}
+			fmt.Fprintf(h, "%v\x00%d\x00%d\x00", p, info.Size(), info.ModTime().UnixNano())
+			if info.ModTime().After(newest) {
+				newest = info.ModTime()
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(h, "%v\x00error\x00", dir)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), newest
+}
@@ -0,0 +1,52 @@
+package backup_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/backup"
+)
+
+func TestWaitSettled(t *testing.T) {
+	dir := t.TempDir()
+	level := filepath.Join(dir, "Level.sav")
+	writeTree(t, dir, map[string]string{"Level.sav": "v0"})
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(level, old, old)
+	quiet := 200 * time.Millisecond
+
+	// 保存指令之后持续写入一段时间,写入结束后才返回
+	since := time.Now()
+	go func() {
+		for i := 0; i < 5; i++ {
+			time.Sleep(50 * time.Millisecond)
+			os.WriteFile(level, []byte(time.Now().String()), 0644)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := backup.WaitSettled(ctx, []string{dir}, since, quiet); err != nil {
+		t.Fatalf("WaitSettled: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond+quiet {
+		t.Errorf("returned after %v, before writes settled", elapsed)
+	}
+
+	// 不要求写入时,文件不变化就返回
+	if err := backup.WaitSettled(ctx, []string{dir}, time.Time{}, quiet); err != nil {
+		t.Errorf("WaitSettled without since: %v", err)
+	}
+
+	// 保存指令之后文件没有被写入
+	os.Chtimes(level, old, old)
+	short, cancelShort := context.WithTimeout(context.Background(), 3*quiet)
+	defer cancelShort()
+	if err := backup.WaitSettled(short, []string{dir}, time.Now(), quiet); !errors.Is(err, backup.ErrNotWritten) {
+		t.Errorf("WaitSettled without write = %v, want ErrNotWritten", err)
+	}
+}
@@ -0,0 +1,293 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 增量备份(FormatSnapshot):每个文件按SHA-256保存在BackupPath/objects下,内容相同的文件只保存一次,
+// 每次备份只写入一个记录文件列表的清单 <时间>.snapshot.json。
+// 删除清单后由GC清理不再被任何清单引用的文件。
+
+// FormatSnapshot 增量去重备份的清单
+const FormatSnapshot Format = "snapshot.json"
+
+// ObjectsDir 增量备份的文件内容所在的目录,位于BackupPath下
+const ObjectsDir = "objects"
+
+// storeMu 保证GC不会和正在进行的增量备份同时运行,否则新写入还没有被清单引用的文件会被删除
+var storeMu sync.Mutex
+
+// GCStats 一次GC的结果
+type GCStats struct {
+	// Objects GC后保留的文件数
+	Objects int `json:"objects"`
+	Removed int `json:"removed"`
+	// Freed 释放的空间(字节)
+	Freed int64 `json:"freed"`
+}
+
+// createSnapshot 把sources写入file所在目录的对象库,file为清单。
+// 大小和修改时间与上一次备份相同的文件直接引用上一次的内容,不重新读取
+func createSnapshot(file string, sources []Source, opts Options) (Info, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	dir := filepath.Dir(file)
+	objects := filepath.Join(dir, ObjectsDir)
+	if err := os.MkdirAll(objects, 0755); err != nil {
+		return Info{}, err
+	}
+
+	previous := make(map[string]FileEntry)
+	if m, err := latestManifest(dir); err == nil {
+		for _, entry := range m.Files {
+			previous[entry.Path] = entry
+		}
+	}
+
+	info := Info{Name: filepath.Base(file), Path: file, Time: time.Now(), Format: FormatSnapshot}
+	manifest := newManifest(info.Time, opts)
+	for _, source := range sources {
+		err := filepath.WalkDir(source.Path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(source.Path, p)
+			if err != nil {
+				return err
+			}
+			stat, err := d.Info()
+			if err != nil {
+				return err
+			}
+			entry := FileEntry{
+				Path:    path.Join(source.Name, filepath.ToSlash(rel)),
+				Mode:    stat.Mode(),
+				ModTime: stat.ModTime(),
+			}
+
+			switch {
+			case d.IsDir():
+			case stat.Mode().IsRegular():
+				entry.Size = stat.Size()
+				if prev, ok := previous[entry.Path]; ok && prev.Size == entry.Size && prev.ModTime.Equal(entry.ModTime) && objectExists(objects, prev.Hash) {
+					entry.Hash = prev.Hash
+				} else {
+					hash, written, err := storeObject(objects, p)
+					if err != nil {
+						return err
+					}
+					entry.Hash = hash
+					info.Stored += written
+				}
+				info.Files++
+			default:
+				// 跳过符号链接等特殊文件
+				return nil
+			}
+			manifest.Files = append(manifest.Files, entry)
+			return nil
+		})
+		if err != nil {
+			return Info{}, fmt.Errorf("%v: %w", source.Name, err)
+		}
+	}
+
+	if err := writeManifest(file, manifest); err != nil {
+		return Info{}, err
+	}
+	if stat, err := os.Stat(file); err == nil {
+		info.Size = stat.Size()
+	}
+	return info, nil
+}
+
+// storeObject 把文件内容写入对象库,返回内容的SHA-256和新写入的字节数,已经存在的内容不重复写入
+func storeObject(objects, file string) (string, int64, error) {
+	src, err := os.Open(file)
+	if err != nil {
+		return "", 0, err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(objects, "object-*"+partialSuffix)
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), src)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	if objectExists(objects, hash) {
+		return hash, 0, nil
+	}
+	target := objectPath(objects, hash)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", 0, err
+	}
+	return hash, n, nil
+}
+
+// objectPath 对象按哈希的前两位分目录保存
+func objectPath(objects, hash string) string {
+	return filepath.Join(objects, hash[:2], hash)
+}
+
+func objectExists(objects, hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := os.Stat(objectPath(objects, hash))
+	return err == nil
+}
+
+// latestManifest 返回dir下最新的增量备份清单
+func latestManifest(dir string) (Manifest, error) {
+	backups, err := List(dir)
+	if err != nil {
+		return Manifest{}, err
+	}
+	for _, b := range backups {
+		if b.Format == FormatSnapshot {
+			return ReadManifest(b.Path)
+		}
+	}
+	return Manifest{}, os.ErrNotExist
+}
+
+// readSnapshot 按清单依次读取对象库中的文件,读取时校验内容的SHA-256
+func readSnapshot(file string, fn entryFunc) error {
+	m, err := ReadManifest(file)
+	if err != nil {
+		return err
+	}
+	objects := filepath.Join(filepath.Dir(file), ObjectsDir)
+
+	for _, entry := range m.Files {
+		if entry.Mode.IsDir() {
+			if err := fn(entry.Path+"/", entry.Mode, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		err := func() error {
+			if len(entry.Hash) != sha256.Size*2 {
+				return fmt.Errorf("%v: invalid hash %q", entry.Path, entry.Hash)
+			}
+			f, err := os.Open(objectPath(objects, entry.Hash))
+			if err != nil {
+				return fmt.Errorf("%v: %w", entry.Path, err)
+			}
+			defer f.Close()
+
+			h := sha256.New()
+			if err := fn(entry.Path, entry.Mode, io.TeeReader(f, h)); err != nil {
+				return err
+			}
+			if sum := hex.EncodeToString(h.Sum(nil)); sum != entry.Hash {
+				return fmt.Errorf("%v: content hash %v does not match %v", entry.Path, sum, entry.Hash)
+			}
+			return nil
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GC 删除dir下不再被任何增量备份清单引用的文件内容。
+// 有清单无法读取时不删除任何内容
+func GC(dir string) (GCStats, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	var stats GCStats
+	backups, err := List(dir)
+	if err != nil {
+		return stats, err
+	}
+	referenced := make(map[string]bool)
+	for _, b := range backups {
+		if b.Format != FormatSnapshot {
+			continue
+		}
+		m, err := ReadManifest(b.Path)
+		if err != nil {
+			return stats, err
+		}
+		for _, entry := range m.Files {
+			if entry.Hash != "" {
+				referenced[entry.Hash] = true
+			}
+		}
+	}
+
+	objects := filepath.Join(dir, ObjectsDir)
+	shards, err := os.ReadDir(objects)
+	if os.IsNotExist(err) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	for _, shard := range shards {
+		shardPath := filepath.Join(objects, shard.Name())
+		if !shard.IsDir() {
+			// 中断的写入留下的临时文件
+			if strings.HasSuffix(shard.Name(), partialSuffix) {
+				os.Remove(shardPath)
+			}
+			continue
+		}
+		entries, err := os.ReadDir(shardPath)
+		if err != nil {
+			return stats, err
+		}
+		kept := 0
+		for _, entry := range entries {
+			if referenced[entry.Name()] {
+				kept++
+				continue
+			}
+			size := int64(0)
+			if info, err := entry.Info(); err == nil {
+				size = info.Size()
+			}
+			if err := os.Remove(filepath.Join(shardPath, entry.Name())); err != nil {
+				return stats, err
+			}
+			stats.Removed++
+			stats.Freed += size
+		}
+		stats.Objects += kept
+		if kept == 0 {
+			os.Remove(shardPath)
+		}
+	}
+	return stats, nil
+}
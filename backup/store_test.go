@@ -0,0 +1,139 @@
+package backup_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/backup"
+)
+
+func snapshot(t *testing.T, dir string, at time.Time, sources []backup.Source) backup.Info {
+	t.Helper()
+	info, err := backup.Create(filepath.Join(dir, backup.FileName(at, backup.FormatSnapshot)), backup.FormatSnapshot, sources, backup.Options{})
+	if err != nil {
+		t.Fatalf("Create snapshot: %v", err)
+	}
+	return info
+}
+
+func TestSnapshot_Dedup(t *testing.T) {
+	saved := t.TempDir()
+	writeTree(t, saved, map[string]string{
+		"SaveGames/0/A/Level.sav":      "level-v1",
+		"SaveGames/0/A/Players/P1.sav": "same",
+		"SaveGames/0/A/Players/P2.sav": "same",
+		"SaveGames/0/A/Players/P3.sav": "player3",
+	})
+	sources := []backup.Source{{Name: "SaveGames", Path: filepath.Join(saved, "SaveGames")}}
+	dir := t.TempDir()
+	start := time.Date(2024, 3, 13, 4, 0, 0, 0, time.Local)
+
+	// 内容相同的P1和P2只保存一次
+	first := snapshot(t, dir, start, sources)
+	if first.Files != 4 || first.Stored != int64(len("level-v1")+len("same")+len("player3")) {
+		t.Errorf("first snapshot = %+v", first)
+	}
+
+	// 没有变化时不写入任何内容
+	second := snapshot(t, dir, start.Add(30*time.Minute), sources)
+	if second.Files != 4 || second.Stored != 0 {
+		t.Errorf("unchanged snapshot = %+v", second)
+	}
+
+	// 只写入修改过的文件
+	level := filepath.Join(saved, "SaveGames", "0", "A", "Level.sav")
+	os.WriteFile(level, []byte("level-v2!"), 0644)
+	os.Chtimes(level, time.Now(), time.Now().Add(time.Minute))
+	third := snapshot(t, dir, start.Add(time.Hour), sources)
+	if third.Stored != int64(len("level-v2!")) {
+		t.Errorf("changed snapshot stored %d bytes", third.Stored)
+	}
+
+	// 每个快照都能还原各自的内容
+	for _, tt := range []struct {
+		info  backup.Info
+		level string
+	}{{first, "level-v1"}, {third, "level-v2!"}} {
+		out := t.TempDir()
+		if err := backup.Extract(tt.info.Path, out); err != nil {
+			t.Fatalf("Extract %v: %v", tt.info.Name, err)
+		}
+		data, _ := os.ReadFile(filepath.Join(out, "SaveGames", "0", "A", "Level.sav"))
+		if string(data) != tt.level {
+			t.Errorf("%v Level.sav = %q, want %q", tt.info.Name, data, tt.level)
+		}
+		data, _ = os.ReadFile(filepath.Join(out, "SaveGames", "0", "A", "Players", "P2.sav"))
+		if string(data) != "same" {
+			t.Errorf("%v P2.sav = %q", tt.info.Name, data)
+		}
+	}
+
+	backups, err := backup.List(dir)
+	if err != nil || len(backups) != 3 || backups[0].Name != third.Name || backups[0].Format != backup.FormatSnapshot {
+		t.Errorf("List = %+v, %v", backups, err)
+	}
+}
+
+func TestSnapshot_GC(t *testing.T) {
+	saved := t.TempDir()
+	writeTree(t, saved, map[string]string{"SaveGames/Level.sav": "old", "SaveGames/Meta.sav": "meta"})
+	sources := []backup.Source{{Name: "SaveGames", Path: filepath.Join(saved, "SaveGames")}}
+	dir := t.TempDir()
+	start := time.Date(2024, 3, 13, 4, 0, 0, 0, time.Local)
+
+	first := snapshot(t, dir, start, sources)
+	level := filepath.Join(saved, "SaveGames", "Level.sav")
+	os.WriteFile(level, []byte("newer"), 0644)
+	os.Chtimes(level, time.Now(), time.Now().Add(time.Minute))
+	second := snapshot(t, dir, start.Add(time.Hour), sources)
+
+	// 所有内容都被引用时不删除
+	stats, err := backup.GC(dir)
+	if err != nil || stats.Removed != 0 || stats.Objects != 3 {
+		t.Errorf("GC with all referenced = %+v, %v", stats, err)
+	}
+
+	// 删除第一个快照后只清理它独有的内容
+	os.Remove(first.Path)
+	stats, err = backup.GC(dir)
+	if err != nil || stats.Removed != 1 || stats.Freed != int64(len("old")) || stats.Objects != 2 {
+		t.Errorf("GC after prune = %+v, %v", stats, err)
+	}
+	if err := backup.Extract(second.Path, t.TempDir()); err != nil {
+		t.Errorf("Extract after GC: %v", err)
+	}
+
+	// 清单损坏时不删除任何内容
+	os.WriteFile(filepath.Join(dir, backup.FileName(start.Add(2*time.Hour), backup.FormatSnapshot)), []byte("{"), 0644)
+	os.Remove(second.Path)
+	if _, err := backup.GC(dir); err == nil {
+		t.Error("GC with unreadable manifest succeeded")
+	}
+}
+
+func TestSnapshot_Corrupt(t *testing.T) {
+	saved := t.TempDir()
+	writeTree(t, saved, map[string]string{"SaveGames/Level.sav": "level"})
+	dir := t.TempDir()
+	info := snapshot(t, dir, time.Now(), []backup.Source{{Name: "SaveGames", Path: filepath.Join(saved, "SaveGames")}})
+
+	m, err := backup.ReadManifest(info.Path)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	var hash string
+	for _, entry := range m.Files {
+		if entry.Path == "SaveGames/Level.sav" {
+			hash = entry.Hash
+		}
+	}
+	object := filepath.Join(dir, backup.ObjectsDir, hash[:2], hash)
+	if err := os.WriteFile(object, []byte("LEVEL"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := backup.Extract(info.Path, t.TempDir()); err == nil {
+		t.Error("Extract of corrupted object succeeded")
+	}
+}
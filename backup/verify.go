@@ -0,0 +1,134 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Report 一次校验的结果
+type Report struct {
+	Name      string    `json:"name"`
+	CheckedAt time.Time `json:"checked_at"`
+	OK        bool      `json:"ok"`
+	// Files 清单中的文件数
+	Files int `json:"files"`
+	// Missing 清单中有但备份中没有的文件
+	Missing []string `json:"missing,omitempty"`
+	// Corrupted 大小或SHA-256与清单不一致,或者无法读取的文件
+	Corrupted []string `json:"corrupted,omitempty"`
+	// Error 备份无法完整读取的原因,如压缩包被截断
+	Error string `json:"error,omitempty"`
+}
+
+// Verify 按清单重新计算备份中每个文件的SHA-256,报告缺失和损坏的文件。
+// 没有清单的备份(旧版本按目录复制的备份)返回错误
+func Verify(b Info) (Report, error) {
+	report := Report{Name: b.Name, CheckedAt: time.Now()}
+	m, err := ManifestOf(b)
+	if err != nil {
+		return report, fmt.Errorf("%v: manifest: %w", b.Name, err)
+	}
+
+	expected := make(map[string]FileEntry)
+	for _, entry := range m.Files {
+		if !entry.Mode.IsDir() {
+			expected[entry.Path] = entry
+		}
+	}
+	report.Files = len(expected)
+
+	seen := make(map[string]bool)
+	if b.Format == FormatSnapshot {
+		verifySnapshot(filepath.Dir(b.Path), m, &report, seen)
+	} else if err := verifyArchive(b, expected, &report, seen); err != nil {
+		report.Error = err.Error()
+	}
+
+	for _, entry := range m.Files {
+		if _, ok := expected[entry.Path]; ok && !seen[entry.Path] {
+			report.Missing = append(report.Missing, entry.Path)
+		}
+	}
+	report.OK = report.Error == "" && len(report.Missing) == 0 && len(report.Corrupted) == 0
+	return report, nil
+}
+
+// verifyArchive 读取整个压缩包并与清单比较。单个文件读取失败计为损坏,压缩包本身无法继续读取时返回错误
+func verifyArchive(b Info, expected map[string]FileEntry, report *Report, seen map[string]bool) error {
+	read, ok := readers[b.Format]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrUnsupported, b.Name)
+	}
+	return read(b.Path, func(name string, mode fs.FileMode, r io.Reader) error {
+		name = strings.TrimSuffix(name, "/")
+		entry, ok := expected[name]
+		if mode.IsDir() || !ok || seen[name] {
+			return nil
+		}
+		seen[name] = true
+		h := sha256.New()
+		n, err := io.Copy(h, r)
+		if err != nil || !entry.matches(n, h.Sum(nil)) {
+			report.Corrupted = append(report.Corrupted, name)
+		}
+		return nil
+	})
+}
+
+// verifySnapshot 检查增量备份引用的每个文件内容,内容相同的文件只计算一次
+func verifySnapshot(dir string, m Manifest, report *Report, seen map[string]bool) {
+	objects := filepath.Join(dir, ObjectsDir)
+	checked := make(map[string]bool)
+	for _, entry := range m.Files {
+		if entry.Mode.IsDir() {
+			continue
+		}
+		ok, done := checked[entry.Hash]
+		if !done {
+			var exists bool
+			ok, exists = checkObject(objects, entry)
+			if !exists {
+				continue
+			}
+			checked[entry.Hash] = ok
+		}
+		seen[entry.Path] = true
+		if !ok {
+			report.Corrupted = append(report.Corrupted, entry.Path)
+		}
+	}
+}
+
+// checkObject 返回对象库中的内容是否与清单一致,以及对象是否存在
+func checkObject(objects string, entry FileEntry) (ok, exists bool) {
+	if len(entry.Hash) != sha256.Size*2 {
+		return false, true
+	}
+	f, err := os.Open(objectPath(objects, entry.Hash))
+	if os.IsNotExist(err) {
+		return false, false
+	}
+	if err != nil {
+		return false, true
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	return err == nil && entry.matches(n, h.Sum(nil)), true
+}
+
+// matches 内容的大小和SHA-256是否与清单一致,版本1的压缩包清单没有哈希时只比较大小
+func (entry FileEntry) matches(size int64, sum []byte) bool {
+	if size != entry.Size {
+		return false
+	}
+	return entry.Hash == "" || hex.EncodeToString(sum) == entry.Hash
+}
@@ -0,0 +1,147 @@
+package backup_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/backup"
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+)
+
+// editManifest 读取清单,修改后写回
+func editManifest(t *testing.T, file string, edit func(m *backup.Manifest)) {
+	t.Helper()
+	m, err := backup.ReadManifest(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(&m)
+	data, _ := json.Marshal(m)
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify_Archive(t *testing.T) {
+	saved := t.TempDir()
+	writeTree(t, saved, map[string]string{
+		"SaveGames/0/A/Level.sav":      "level",
+		"SaveGames/0/A/Players/P1.sav": "player",
+	})
+	sources := []backup.Source{{Name: "SaveGames", Path: filepath.Join(saved, "SaveGames")}}
+	opts := backup.Options{
+		Trigger:       backup.TriggerManual,
+		ToolVersion:   "v0.5.0",
+		ServerVersion: "v0.1.5.0",
+		Players:       []palworld.Player{{Name: "alice", SteamID: "7656"}},
+	}
+
+	for _, format := range []backup.Format{backup.FormatTarGz, backup.FormatZip} {
+		t.Run(string(format), func(t *testing.T) {
+			dir := t.TempDir()
+			info, err := backup.Create(filepath.Join(dir, backup.FileName(time.Now(), format)), format, sources, opts)
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			m, err := backup.ManifestOf(info)
+			if err != nil {
+				t.Fatalf("ManifestOf: %v", err)
+			}
+			if m.Trigger != backup.TriggerManual || m.ToolVersion != "v0.5.0" || m.ServerVersion != "v0.1.5.0" || len(m.Players) != 1 {
+				t.Errorf("manifest = %+v", m)
+			}
+			for _, entry := range m.Files {
+				if !entry.Mode.IsDir() && len(entry.Hash) != 64 {
+					t.Errorf("%v has no hash", entry.Path)
+				}
+			}
+
+			report, err := backup.Verify(info)
+			if err != nil || !report.OK || report.Files != 2 {
+				t.Fatalf("Verify = %+v, %v", report, err)
+			}
+
+			// 清单中的哈希与内容不一致,清单中的文件不在压缩包中
+			editManifest(t, info.Path+backup.ManifestSuffix, func(m *backup.Manifest) {
+				for i := range m.Files {
+					if m.Files[i].Path == "SaveGames/0/A/Level.sav" {
+						m.Files[i].Hash = "0000000000000000000000000000000000000000000000000000000000000000"
+					}
+				}
+				m.Files = append(m.Files, backup.FileEntry{Path: "SaveGames/0/A/Players/P2.sav", Mode: 0644, Size: 1})
+			})
+			report, err = backup.Verify(info)
+			if err != nil || report.OK {
+				t.Fatalf("Verify of edited manifest = %+v, %v", report, err)
+			}
+			if len(report.Corrupted) != 1 || report.Corrupted[0] != "SaveGames/0/A/Level.sav" {
+				t.Errorf("Corrupted = %v", report.Corrupted)
+			}
+			if len(report.Missing) != 1 || report.Missing[0] != "SaveGames/0/A/Players/P2.sav" {
+				t.Errorf("Missing = %v", report.Missing)
+			}
+
+			// 截断的压缩包
+			stat, _ := os.Stat(info.Path)
+			if err := os.Truncate(info.Path, stat.Size()/2); err != nil {
+				t.Fatal(err)
+			}
+			report, err = backup.Verify(info)
+			if err != nil || report.OK {
+				t.Errorf("Verify of truncated archive = %+v, %v", report, err)
+			}
+		})
+	}
+}
+
+func TestVerify_Snapshot(t *testing.T) {
+	saved := t.TempDir()
+	writeTree(t, saved, map[string]string{
+		"SaveGames/Level.sav": "level",
+		"SaveGames/Meta.sav":  "meta",
+	})
+	dir := t.TempDir()
+	info := snapshot(t, dir, time.Now(), []backup.Source{{Name: "SaveGames", Path: filepath.Join(saved, "SaveGames")}})
+
+	report, err := backup.Verify(info)
+	if err != nil || !report.OK || report.Files != 2 {
+		t.Fatalf("Verify = %+v, %v", report, err)
+	}
+
+	m, _ := backup.ReadManifest(info.Path)
+	objects := make(map[string]string)
+	for _, entry := range m.Files {
+		if !entry.Mode.IsDir() {
+			objects[entry.Path] = filepath.Join(dir, backup.ObjectsDir, entry.Hash[:2], entry.Hash)
+		}
+	}
+	os.WriteFile(objects["SaveGames/Level.sav"], []byte("LEVEL"), 0644)
+	os.Remove(objects["SaveGames/Meta.sav"])
+
+	report, err = backup.Verify(info)
+	if err != nil || report.OK {
+		t.Fatalf("Verify of damaged snapshot = %+v, %v", report, err)
+	}
+	if len(report.Corrupted) != 1 || report.Corrupted[0] != "SaveGames/Level.sav" {
+		t.Errorf("Corrupted = %v", report.Corrupted)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != "SaveGames/Meta.sav" {
+		t.Errorf("Missing = %v", report.Missing)
+	}
+}
+
+func TestVerify_Legacy(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"2024-03-12-04-00-00/SaveGames/Level.sav": "old"})
+	backups, _ := backup.List(dir)
+	if len(backups) != 1 {
+		t.Fatalf("List = %+v", backups)
+	}
+	if _, err := backup.Verify(backups[0]); err == nil {
+		t.Errorf("Verify of legacy backup succeeded")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/palworld-go/audit"
 	"github.com/hoshinonyaruko/palworld-go/config"
 )
 
@@ -338,6 +339,7 @@ func getplayerHandler(msg string, message OnebotGroupMessage, config config.Conf
 			return
 		}
 		req.AddCookie(&http.Cookie{Name: "login_cookie", Value: userIPData.UUID})
+		req.Header.Set(audit.UserHeader, strconv.FormatInt(message.UserID, 10))
 
 		// 发送请求
 		resp, err := client.Do(req)
@@ -503,6 +505,7 @@ func kickorbanHandler(msg string, message OnebotGroupMessage, config config.Conf
 		}
 		req.Header.Set("Content-Type", "application/json")
 		req.AddCookie(&http.Cookie{Name: "login_cookie", Value: userIPData.UUID})
+		req.Header.Set(audit.UserHeader, strconv.FormatInt(message.UserID, 10))
 
 		resp, err := client.Do(req)
 		if err != nil {
@@ -569,6 +572,7 @@ func broadcastMessageHandler(msg string, message OnebotGroupMessage, config conf
 		}
 		req.Header.Set("Content-Type", "application/json")
 		req.AddCookie(&http.Cookie{Name: "login_cookie", Value: userIPData.UUID})
+		req.Header.Set(audit.UserHeader, strconv.FormatInt(message.UserID, 10))
 
 		// 执行请求
 		client := &http.Client{}
@@ -650,6 +654,7 @@ func restartHandler(msg string, message OnebotGroupMessage, config config.Config
 
 		req.Header.Set("Content-Type", "application/json")
 		req.AddCookie(&http.Cookie{Name: "login_cookie", Value: userIPData.UUID})
+		req.Header.Set(audit.UserHeader, strconv.FormatInt(message.UserID, 10))
 
 		// 执行请求
 		client := &http.Client{}
@@ -824,6 +829,7 @@ func getplayernumHandler(message OnebotGroupMessage, config config.Config) {
 		}
 		req.Header.Set("Content-Type", "application/json")
 		req.AddCookie(&http.Cookie{Name: "login_cookie", Value: userIPData.UUID})
+		req.Header.Set(audit.UserHeader, strconv.FormatInt(message.UserID, 10))
 
 		resp, err := client.Do(req)
 		if err != nil {
@@ -0,0 +1,238 @@
+package bot_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/palworld-go/audit"
+	"github.com/hoshinonyaruko/palworld-go/bot"
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+	"github.com/hoshinonyaruko/palworld-go/palworld/palworldtest"
+	"github.com/hoshinonyaruko/palworld-go/tool"
+	"github.com/hoshinonyaruko/palworld-go/webui"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	groupID = 10001
+	ownerID = 20001
+)
+
+var (
+	alice = palworld.Player{Name: "Alice", PlayerUID: "1001", SteamID: "76561190000000001"}
+	bob   = palworld.Player{Name: "Bob", PlayerUID: "1002", SteamID: "76561190000000002"}
+)
+
+// onebot 记录机器人通过OneBot v11 HTTP API发出的群消息
+type onebot struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (o *onebot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		GroupID int64  `json:"group_id"`
+		Message string `json:"message"`
+	}
+	if r.URL.Path != "/send_group_msg" || json.NewDecoder(r.Body).Decode(&req) != nil || req.GroupID != groupID {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	o.mu.Lock()
+	o.messages = append(o.messages, req.Message)
+	o.mu.Unlock()
+}
+
+// last 返回最后一条群消息
+func (o *onebot) last() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.messages) == 0 {
+		return ""
+	}
+	return o.messages[len(o.messages)-1]
+}
+
+// fixture 模拟服务端、webui、OneBot实现和机器人
+type fixture struct {
+	server *palworldtest.Server
+	onebot *onebot
+	bot    http.Handler
+	// panel cookie webui地址和发给机器人的cookie
+	panel  string
+	cookie string
+}
+
+func newFixture(t *testing.T, players ...palworld.Player) *fixture {
+	t.Helper()
+
+	// 机器人和webui的cookie数据库都在工作目录下
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	bot.InitializeDB()
+	t.Cleanup(func() { bot.CloseDatabase() })
+	webui.InitializeDB()
+	t.Cleanup(webui.CloseDB)
+
+	db, err := bbolt.Open(filepath.Join(dir, "players.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("players"))
+		return err
+	})
+	if err := audit.InitDB(db); err != nil {
+		t.Fatal(err)
+	}
+
+	server := palworldtest.NewServer(palworldtest.WithPlayers(players...))
+	t.Cleanup(func() {
+		tool.GetRconPool(server.Addr(), server.Password()).Close()
+		server.Close()
+	})
+	cfg := server.Config()
+
+	gin.SetMode(gin.TestMode)
+	panelRouter := gin.New()
+	panelRouter.GET("/*filepath", webui.CombinedMiddleware(cfg, db))
+	panelRouter.POST("/*filepath", webui.CombinedMiddleware(cfg, db))
+	panel := httptest.NewServer(panelRouter)
+	t.Cleanup(panel.Close)
+
+	ob := &onebot{}
+	obServer := httptest.NewServer(ob)
+	t.Cleanup(obServer.Close)
+	cfg.Onebotv11HttpApiPath = obServer.URL
+
+	// 服务器主人已经把面板生成的指令发给机器人
+	cookie, err := webui.GenerateCookie(webui.BotCookieOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.StoreUserIDAndIP(ownerID, strings.TrimPrefix(panel.URL, "http://"), cookie, false); err != nil {
+		t.Fatal(err)
+	}
+
+	botRouter := gin.New()
+	botRouter.POST("/", func(c *gin.Context) { bot.GensokyoHandlerClosure(c, cfg) })
+
+	return &fixture{server: server, onebot: ob, bot: botRouter, panel: panel.URL, cookie: cookie}
+}
+
+// send 以userID的身份在群里发送一条消息
+func (f *fixture) send(t *testing.T, userID int64, message string) {
+	t.Helper()
+
+	body, _ := json.Marshal(bot.OnebotGroupMessage{
+		PostType:    "message",
+		MessageType: "group",
+		GroupID:     groupID,
+		UserID:      userID,
+		Message:     message,
+		RawMessage:  message,
+	})
+	w := httptest.NewRecorder()
+	f.bot.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+}
+
+func TestBot_PlayerListAndKick(t *testing.T) {
+	f := newFixture(t, alice, bob)
+
+	f.send(t, ownerID, "update player")
+	list := f.onebot.last()
+	match := regexp.MustCompile(`\[(\d+)\] Alice .*在线:true`).FindStringSubmatch(list)
+	if match == nil || !strings.Contains(list, "Bob") {
+		t.Fatalf("player list = %q", list)
+	}
+
+	// 用玩家列表中的编号踢人
+	f.send(t, ownerID, "kick "+match[1])
+	if got := f.onebot.last(); got != "kick Alice 成功" {
+		t.Errorf("kick reply = %q", got)
+	}
+	if players := f.server.Players(); len(players) != 1 || players[0].Name != bob.Name {
+		t.Errorf("players after kick = %+v", players)
+	}
+
+	// 玩家已经不在线,服务端返回失败
+	f.send(t, ownerID, "踢人 "+match[1])
+	if got := f.onebot.last(); got != "kick Alice 失败" {
+		t.Errorf("second kick reply = %q", got)
+	}
+
+	// 审计日志记录实际发起指令的QQ号
+	entries, _, err := audit.Query(audit.Filter{Origin: audit.OriginBot, Command: "KickPlayer"})
+	if err != nil || len(entries) != 2 || entries[0].User != strconv.Itoa(ownerID) {
+		t.Errorf("audit entries = %+v, %v", entries, err)
+	}
+}
+
+func TestBot_ForgedAuditUser(t *testing.T) {
+	f := newFixture(t, alice)
+
+	// 持有机器人cookie但冒充没有绑定这个cookie的QQ号,只记录为bot
+	body, _ := json.Marshal(map[string]string{"message": "hi"})
+	req := httptest.NewRequest(http.MethodPost, f.panel+"/api/broadcast", bytes.NewReader(body))
+	req.RequestURI = ""
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(audit.UserHeader, "30003")
+	req.AddCookie(&http.Cookie{Name: "login_cookie", Value: f.cookie})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	entries, _, err := audit.Query(audit.Filter{Origin: audit.OriginBot})
+	if err != nil || len(entries) != 1 || entries[0].User != webui.BotCookieOwner {
+		t.Errorf("audit entries = %+v, %v", entries, err)
+	}
+}
+
+func TestBot_Broadcast(t *testing.T) {
+	f := newFixture(t)
+
+	f.send(t, ownerID, "Broadcast hello everyone")
+	if got := f.onebot.last(); got != "广播消息已成功发送" {
+		t.Errorf("broadcast reply = %q", got)
+	}
+	if got := f.server.Broadcasts(); len(got) != 1 || got[0] != "hello_everyone" {
+		t.Errorf("Broadcasts = %q", got)
+	}
+}
+
+func TestBot_UnknownUser(t *testing.T) {
+	f := newFixture(t, alice)
+
+	// 没有绑定面板的用户不能操作服务器
+	f.send(t, ownerID+1, "kick 1")
+	if got := f.onebot.last(); !strings.Contains(got, "获取玩家信息失败") {
+		t.Errorf("kick reply = %q", got)
+	}
+	f.send(t, ownerID+1, "Broadcast hi")
+	if got := f.onebot.last(); !strings.Contains(got, "没有正确设置") {
+		t.Errorf("broadcast reply = %q", got)
+	}
+	if len(f.server.Players()) != 1 || len(f.server.Broadcasts()) != 0 {
+		t.Error("unknown user reached the server")
+	}
+}
@@ -0,0 +1,80 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/event"
+)
+
+// SubscribeEvents 订阅事件总线:服务端启动和结束时按guilds.txt推送run/stop消息,
+// 开启机器人广播时把其余事件通知到配置的群
+func SubscribeEvents(config config.Config) {
+	notify := config.EnableBotNotification && config.Onebotv11HttpApiPath != "" && len(config.BotNotifyGroups) > 0
+
+	event.Subscribe(func(e event.Event) {
+		switch e.Type {
+		case event.TypeServerStarted:
+			SendCommandMessages("run", config)
+			return
+		case event.TypeServerStopped:
+			SendCommandMessages("stop", config)
+			return
+		}
+
+		if !notify {
+			return
+		}
+		message := formatEvent(e)
+		if message == "" {
+			return
+		}
+		for _, groupID := range config.BotNotifyGroups {
+			if err := sendGroupMessage(groupID, 0, message, config); err != nil {
+				log.Printf("发送群%v通知失败: %v", groupID, err)
+			}
+		}
+	})
+}
+
+// formatEvent 把事件转换为群消息,不需要通知的事件返回空字符串
+func formatEvent(e event.Event) string {
+	switch data := e.Data.(type) {
+	case event.PlayerJoined:
+		return fmt.Sprintf("玩家 %v 加入了服务器", data.Player.Name)
+	case event.PlayerLeft:
+		return fmt.Sprintf("玩家 %v 离开了服务器,本次在线%v", data.Player.Name, formatDuration(data.Duration()))
+	case event.ServerCrashed:
+		return "检测到服务端意外退出,正在自动重启"
+	case event.ServerCrashLoop:
+		return fmt.Sprintf("服务端%d分钟内已崩溃重启%d次,已停止自动重启,请检查后手动启动", data.Window/60, data.Restarts)
+	case event.ServerUnhealthy:
+		return fmt.Sprintf("服务端无响应(%v连续失败%d次),正在保存并强制重启", data.Probe, data.Failures)
+	case event.RestartCompleted:
+		if data.Status == "failed" {
+			return "服务端重启失败: " + data.Error
+		}
+		return ""
+	case event.BackupCompleted:
+		if data.Error != "" {
+			return "备份失败: " + data.Error
+		}
+		return ""
+	case event.MemoryThresholdExceeded:
+		return fmt.Sprintf("服务器内存占用%.1f%%,超过阈值%v%%,即将保存并重启", data.Usage, data.Threshold)
+	case event.UpdateAvailable:
+		return fmt.Sprintf("palworld-go有新版本%v可用,当前版本%v", data.Latest, data.Current)
+	}
+	return ""
+}
+
+func formatDuration(d time.Duration) string {
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+	if hours > 0 {
+		return fmt.Sprintf("%d小时%d分钟", hours, minutes)
+	}
+	return fmt.Sprintf("%d分钟", minutes)
+}
@@ -24,6 +24,23 @@ type PlayerW struct {
 	PlayerUID string `json:"playeruid"`
 }
 
+// RconProxyUser RCON代理的一个用户
+type RconProxyUser struct {
+	Name     string   `json:"name"`     // 用户名,用于日志
+	Token    string   `json:"token"`    // 连接RCON代理时使用的密码
+	Commands []string `json:"commands"` // 允许执行的指令,为空时拒绝所有指令,包含*时不限制
+}
+
+// Webhook 一个外发webhook
+type Webhook struct {
+	Name     string   `json:"name"`     // 名称,用于投递记录
+	URL      string   `json:"url"`      // 接收地址
+	Events   []string `json:"events"`   // 订阅的事件类型,支持player.*这样的前缀,为空时订阅全部
+	Format   string   `json:"format"`   // 请求体格式 json/form
+	Template string   `json:"template"` // 请求体模板(text/template),为空时发送完整事件
+	Secret   string   `json:"secret"`   // HMAC-SHA256签名密钥,为空时不签名
+}
+
 type Config struct {
 	Title                     string             `json:"title"`                     // 自定义标题
 	GameService               bool               `json:"gameService"`               // 游戏以服务方式启动
@@ -46,6 +63,14 @@ type Config struct {
 	ServerOptions             []string           `json:"serverOptions"`             // 服务器启动参数
 	CheckInterval             int                `json:"checkInterval"`             // 进程存活检查时间（秒）
 	BackupInterval            int                `json:"backupInterval"`            // 备份间隔（秒）
+	BackupFormat              string             `json:"backupFormat"`              // 备份格式 tar.gz/tar.zst/zip/snapshot(增量去重,只保存变化的文件)
+	BackupSettleTime          int                `json:"backupSettleTime"`          // 备份前保存存档后,存档文件连续多少秒没有变化才开始备份
+	BackupSettleTimeout       int                `json:"backupSettleTimeout"`       // 备份前等待保存和存档写入完成的最长时间（秒）,超时后照常备份
+	BackupKeepLast            int                `json:"backupKeepLast"`            // 保留最新的N个备份,0不启用
+	BackupKeepHourly          int                `json:"backupKeepHourly"`          // 每小时保留一个备份,保留最近N个小时,0不启用
+	BackupKeepDaily           int                `json:"backupKeepDaily"`           // 每天保留一个备份,保留最近N天,0不启用
+	BackupKeepWeekly          int                `json:"backupKeepWeekly"`          // 每周保留一个备份,保留最近N周,0不启用
+	BackupKeepMonthly         int                `json:"backupKeepMonthly"`         // 每月保留一个备份,保留最近N个月,0不启用
 	RestartInterval           int                `json:"RestartInterval"`           // 自动重启服务器（秒）
 	MemoryCheckInterval       int                `json:"memoryCheckInterval"`       // 内存占用检测时间（秒）
 	MemoryUsageThreshold      float64            `json:"memoryUsageThreshold"`      // 重启阈值（百分比）
@@ -58,7 +83,7 @@ type Config struct {
 	Engine                    *Engine            `json:"engine"`                    // 服务端引擎设置
 	Players                   []*PlayerW         `json:"players"`                   // 白名单玩家数组
 	WhiteCheckTime            int                `json:"whiteCheckTime"`            // 白名单检测时间
-	SaveDeleteDays            int                `json:"saveDeleteDays"`            // 存档删除时间
+	SaveDeleteDays            int                `json:"saveDeleteDays"`            // 保留最近N天内的所有备份,更早的备份按保留策略删除,0不启用
 	SteamCmdPath              string             `json:"steamCmdPath"`              // 自定义steamcmd路径
 	EnableUe4Debug            bool               `json:"enableUe4Debug"`            // 是否开启UE4 Debug窗口
 	EnableEngineSetting       bool               `json:"enableEngineSetting"`       // 是否开启引擎设置
@@ -66,6 +91,48 @@ type Config struct {
 	EnableRebootLater         bool               `json:"enableRebootLater"`         // 是否开启延时关闭&重启
 	OverrideDLL               bool               `json:"overrideDLL"`               // 是否由palgo中内置的dll覆盖游戏目录的dll
 	UsePalServerExe           bool               `json:"usePalserverexe"`           // 是否维持传统启动行为
+	RconPoolSize              int                `json:"rconPoolSize"`              // 共享RCON长连接数量
+	RconKeepAliveInterval     int                `json:"rconKeepAliveInterval"`     // RCON连接保活探测间隔（秒）
+	RconMultiPacket           bool               `json:"rconMultiPacket"`           // 重组被拆分成多个包的RCON响应
+	RconEncoding              string             `json:"rconEncoding"`              // RCON指令编码 auto/plain/base64
+	RconProxyPort             int                `json:"rconProxyPort"`             // RCON代理监听端口,0为不开启
+	RconProxyAddress          string             `json:"rconProxyAddress"`          // RCON代理监听地址,默认监听所有网卡以便团队成员从其他机器连接
+	RconProxyUsers            []*RconProxyUser   `json:"rconProxyUsers"`            // RCON代理用户
+	Backend                   string             `json:"backend"`                   // 管理后端 rcon/rest/auto
+	RestApiPort               int                `json:"restApiPort"`               // 官方REST API端口
+	AuditRetentionDays        int                `json:"auditRetentionDays"`        // 审计日志保留天数
+	AuditMaxEntries           int                `json:"auditMaxEntries"`           // 审计日志最多保留条数
+	PresenceInterval          int                `json:"presenceInterval"`          // 检测玩家加入和离开的间隔（秒）
+	BotNotifyGroups           []int64            `json:"botNotifyGroups"`           // 接收玩家加入离开通知的群
+	WelcomeMessage            string             `json:"welcomeMessage"`            // 玩家加入时的全服广播,{name}替换为玩家名,为空不广播
+	Webhooks                  []*Webhook         `json:"webhooks"`                  // 外发webhook
+	CrashBackoffBase          int                `json:"crashBackoffBase"`          // 崩溃后第一次重启前的等待时间（秒）,之后每次翻倍
+	CrashBackoffMax           int                `json:"crashBackoffMax"`           // 崩溃重启等待时间上限（秒）
+	CrashMaxRestarts          int                `json:"crashMaxRestarts"`          // 时间窗口内最多自动重启次数,超过后停止自动重启
+	CrashRestartWindow        int                `json:"crashRestartWindow"`        // 统计自动重启次数的时间窗口（秒）
+	CrashStartGrace           int                `json:"crashStartGrace"`           // 启动后等待进程出现的时间（秒）,期间检测不到进程不算崩溃
+	GameLogPath               string             `json:"gameLogPath"`               // 服务端输出日志目录
+	GameLogMaxSize            int                `json:"gameLogMaxSize"`            // 单个服务端日志文件大小上限（MB）
+	GameLogMaxFiles           int                `json:"gameLogMaxFiles"`           // 最多保留的服务端日志文件数
+	HealthCheckInterval       int                `json:"healthCheckInterval"`       // 健康检查间隔（秒）
+	HealthCheckTimeout        int                `json:"healthCheckTimeout"`        // 单个探针的超时时间（秒）
+	HealthStartupGrace        int                `json:"healthStartupGrace"`        // 服务端启动后多久开始健康检查（秒）
+	HealthRconThreshold       int                `json:"healthRconThreshold"`       // RCON Info连续失败多少次后强制重启,-1不启用
+	HealthUdpThreshold        int                `json:"healthUdpThreshold"`        // Steam查询端口UDP查询连续失败多少次后强制重启,0不启用
+	HealthQueryPort           int                `json:"healthQueryPort"`           // 服务端的Steam查询端口(A2S),UDP健康检查向它发送查询
+	HealthRestThreshold       int                `json:"healthRestThreshold"`       // REST API连续失败多少次后强制重启,0不启用
+	RestartCountdown          []int              `json:"restartCountdown"`          // 重启前在剩余这些时间时广播（秒）,最大值为定时重启的倒计时总时长
+	RestartCountdownMessage   string             `json:"restartCountdownMessage"`   // 重启倒计时广播,{time}替换为剩余时间,不能包含空格
+	RestartExitTimeout        int                `json:"restartExitTimeout"`        // 正常关闭后等待服务端退出的时间（秒）,超时后强制结束
+	RestartVerifyTimeout      int                `json:"restartVerifyTimeout"`      // 重新启动后等待健康检查通过的时间（秒）
+	RestartSchedule           []string           `json:"restartSchedule"`           // 定时重启计划,cron表达式(分 时 日 月 星期)或每天的HH:MM,如"0 4 * * *" "16:00"
+	RestartTimezone           string             `json:"restartTimezone"`           // 定时重启和维护窗口使用的时区,如Asia/Shanghai,为空使用系统时区
+	MaintenanceWindows        []string           `json:"maintenanceWindows"`        // 维护窗口,如"02:00-06:00" "Sat,Sun 01:00-09:00",定时和内存超限的重启推迟到窗口内进行,为空不限制
+	RestartDeferForPlayers    bool               `json:"restartDeferForPlayers"`    // 定时和内存超限的重启等待服务器没有玩家在线后进行
+	RestartMaxDeferral        int                `json:"restartMaxDeferral"`        // 等待玩家下线的最长时间（秒）,超过后照常倒计时重启
+	RestartDeferWarnings      []int              `json:"restartDeferWarnings"`      // 等待玩家下线时,在距离最长等待时间还剩这些秒数时广播
+	RestartDeferMessage       string             `json:"restartDeferMessage"`       // 等待玩家下线时的广播,{time}替换为剩余时间,不能包含空格
+	MemoryHardLimit           float64            `json:"memoryHardLimit"`           // 内存占用硬上限（百分比）,超过时立即重启,不等待维护窗口和玩家下线,大于100不启用
 }
 
 // 默认配置
@@ -94,6 +161,9 @@ var defaultConfig = Config{
 	OverrideDLL:               true,
 	UsePalServerExe:           false,
 	BackupInterval:            1800,                                                        // 30 分钟
+	BackupFormat:              "tar.gz",                                                    // 备份为单个tar.gz压缩包
+	BackupSettleTime:          5,                                                           // 存档文件5秒没有变化后开始备份
+	BackupSettleTimeout:       60,                                                          // 最多等待1分钟
 	MemoryCheckInterval:       30,                                                          // 30 秒
 	MemoryUsageThreshold:      80,                                                          // 80%
 	TotalMemoryGB:             16,                                                          // 16G
@@ -104,6 +174,36 @@ var defaultConfig = Config{
 	RegularMessages:           []string{"", ""},                                            // 默认的定期推送消息数组，初始可为空
 	MessageBroadcastInterval:  3600,                                                        // 默认消息广播周期，假设为1小时（3600秒）
 	MaintenanceWarningMessage: "server is going to rebot,please relogin at 1minute later.", // 默认的维护警告消息
+	RconPoolSize:              2,                                                           // 共享RCON长连接数量
+	RconKeepAliveInterval:     60,                                                          // RCON连接保活探测间隔
+	RconEncoding:              "auto",                                                      // 启动时根据palguard.json决定是否使用base64
+	RconProxyAddress:          "0.0.0.0",                                                   // 监听所有网卡
+	Backend:                   "rcon",                                                      // 管理后端 rcon/rest/auto(优先REST,失败时回退到RCON)
+	RestApiPort:               8212,                                                        // 官方REST API端口
+	AuditRetentionDays:        30,                                                          // 审计日志保留30天
+	AuditMaxEntries:           100000,                                                      // 审计日志最多保留10万条
+	PresenceInterval:          30,                                                          // 30秒检测一次玩家加入和离开
+	CrashBackoffBase:          10,                                                          // 第一次崩溃等待10秒后重启
+	CrashBackoffMax:           600,                                                         // 最多等待10分钟
+	CrashMaxRestarts:          5,                                                           // 30分钟内最多自动重启5次
+	CrashRestartWindow:        1800,                                                        // 30分钟
+	CrashStartGrace:           60,                                                          // 启动后1分钟内检测不到进程不算崩溃
+	GameLogPath:               "gamelogs",                                                  // 服务端输出保存在gamelogs目录
+	GameLogMaxSize:            10,                                                          // 每个文件10MB
+	GameLogMaxFiles:           5,                                                           // 最多保留5个文件
+	HealthCheckInterval:       30,                                                          // 30秒检查一次
+	HealthCheckTimeout:        10,                                                          // 10秒无响应算失败
+	HealthStartupGrace:        120,                                                         // 启动2分钟后开始检查
+	HealthRconThreshold:       3,                                                           // RCON连续3次无响应时重启
+	HealthQueryPort:           27015,                                                       // Steam默认查询端口
+	RestartCountdown:          []int{600, 300, 60, 30, 10},                                 // 10分钟 5分钟 1分钟 30秒 10秒时广播
+	RestartCountdownMessage:   "Server_will_restart_in_{time}",                             // 倒计时广播
+	RestartExitTimeout:        120,                                                         // 2分钟未退出时强制结束
+	RestartVerifyTimeout:      300,                                                         // 5分钟内恢复响应
+	RestartMaxDeferral:        3600,                                                        // 最多等待1小时
+	RestartDeferWarnings:      []int{1800, 900, 300, 60},                                   // 剩余30分钟 15分钟 5分钟 1分钟时提醒
+	RestartDeferMessage:       "Restart_pending._Server_restarts_when_empty_or_in_{time}",  // 等待玩家下线时的广播
+	MemoryHardLimit:           95,                                                          // 内存占用超过95%时立即重启
 	Players: []*PlayerW{
 		{}, // 一个空的PlayerW
 	},
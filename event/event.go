@@ -0,0 +1,205 @@
+// Package event 是palworld-go内部的事件总线,
+// 各子系统发布事件,机器人、全服广播、webhook等按需订阅,互相之间不需要直接调用。
+// 总线保留最近的事件,供 /api/events 查询和SSE推送。
+package event
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Type 事件类型
+type Type string
+
+// Payload 事件内容,每种事件内容对应一个事件类型
+type Payload interface {
+	EventType() Type
+}
+
+// Event 一个事件
+type Event struct {
+	// ID 总线内递增的序号,可作为SSE的Last-Event-ID
+	ID   uint64    `json:"id"`
+	Type Type      `json:"type"`
+	Time time.Time `json:"time"`
+	Data Payload   `json:"data"`
+}
+
+// Handler 处理事件的订阅者
+type Handler func(Event)
+
+const (
+	// queueSize 每个订阅者的事件队列长度,处理过慢时多出的事件会被丢弃
+	queueSize = 64
+	// DefaultHistorySize 默认保留的最近事件数量
+	DefaultHistorySize = 500
+)
+
+// Bus 事件总线。每个订阅者有独立的队列和goroutine,
+// 发布不会被慢的订阅者阻塞,同一订阅者收到事件的顺序与发布顺序一致。
+type Bus struct {
+	mu     sync.RWMutex
+	next   int
+	queues map[int]*subscriber
+	// pending 已经进入队列但还没有处理完的事件数
+	pending atomic.Int64
+
+	// 环形缓冲区保存最近的事件
+	lastID  uint64
+	history []Event
+	start   int
+	count   int
+}
+
+// subscriber 一个订阅者的队列
+type subscriber struct {
+	queue chan Event
+	// block 队列满时发布者等待,而不是丢弃事件
+	block bool
+}
+
+// NewBus 创建一个事件总线,保留最近historySize个事件,不大于0时使用DefaultHistorySize
+func NewBus(historySize int) *Bus {
+	if historySize <= 0 {
+		historySize = DefaultHistorySize
+	}
+	return &Bus{
+		queues:  make(map[int]*subscriber),
+		history: make([]Event, historySize),
+	}
+}
+
+// Subscribe 订阅所有事件,返回取消订阅的函数
+func (b *Bus) Subscribe(handler Handler) (unsubscribe func()) {
+	return b.subscribe(handler, false)
+}
+
+// SubscribeBlocking 订阅所有事件,队列满时发布者等待handler处理,不会丢失事件。
+// 用于不能丢失事件的订阅者(如webhook),handler必须尽快返回且不能发布事件
+func (b *Bus) SubscribeBlocking(handler Handler) (unsubscribe func()) {
+	return b.subscribe(handler, true)
+}
+
+func (b *Bus) subscribe(handler Handler, block bool) (unsubscribe func()) {
+	sub := &subscriber{queue: make(chan Event, queueSize), block: block}
+
+	b.mu.Lock()
+	id := b.next
+	b.next++
+	b.queues[id] = sub
+	b.mu.Unlock()
+
+	go func() {
+		for e := range sub.queue {
+			handler(e)
+			b.pending.Add(-1)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.queues, id)
+			b.mu.Unlock()
+			close(sub.queue)
+		})
+	}
+}
+
+// Publish 发布事件并返回它
+func (b *Bus) Publish(payload Payload) Event {
+	return b.PublishAt(payload, time.Now())
+}
+
+// PublishAt 以指定的时间发布事件
+func (b *Bus) PublishAt(payload Payload, at time.Time) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e := Event{ID: b.lastID, Type: payload.EventType(), Time: at, Data: payload}
+
+	if b.count < len(b.history) {
+		b.history[(b.start+b.count)%len(b.history)] = e
+		b.count++
+	} else {
+		b.history[b.start] = e
+		b.start = (b.start + 1) % len(b.history)
+	}
+
+	for _, sub := range b.queues {
+		b.pending.Add(1)
+		if sub.block {
+			sub.queue <- e
+			continue
+		}
+		select {
+		case sub.queue <- e:
+		default:
+			b.pending.Add(-1)
+			log.Printf("事件订阅者处理过慢,丢弃事件: %v", e.Type)
+		}
+	}
+	return e
+}
+
+// Flush 等待已经发布的事件被所有订阅者处理完,如在重启程序之前。超时返回false
+func (b *Bus) Flush(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for b.pending.Load() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// Recent 按发布顺序返回ID大于after的最近事件,types不为空时只返回这些类型,
+// limit大于0时只返回最新的limit个
+func (b *Bus) Recent(after uint64, types []Type, limit int) []Event {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	events := make([]Event, 0, b.count)
+	for i := 0; i < b.count; i++ {
+		e := b.history[(b.start+i)%len(b.history)]
+		if e.ID <= after || !matchType(e.Type, types) {
+			continue
+		}
+		events = append(events, e)
+	}
+
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	return events
+}
+
+func matchType(t Type, types []Type) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, want := range types {
+		if t == want {
+			return true
+		}
+	}
+	return false
+}
+
+// Default 默认的事件总线
+var Default = NewBus(DefaultHistorySize)
+
+// Subscribe 订阅默认事件总线
+func Subscribe(handler Handler) (unsubscribe func()) {
+	return Default.Subscribe(handler)
+}
+
+// Publish 向默认事件总线发布事件
+func Publish(payload Payload) Event {
+	return Default.Publish(payload)
+}
@@ -0,0 +1,183 @@
+package event_test
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/event"
+)
+
+func receive(t *testing.T, ch <-chan event.Event) event.Event {
+	t.Helper()
+
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+		return event.Event{}
+	}
+}
+
+func TestBus(t *testing.T) {
+	bus := event.NewBus(0)
+
+	first := make(chan event.Event, 10)
+	second := make(chan event.Event, 10)
+	unsubscribe := bus.Subscribe(func(e event.Event) { first <- e })
+	defer bus.Subscribe(func(e event.Event) { second <- e })()
+
+	bus.Publish(event.ServerStarted{Pid: 42})
+	bus.Publish(event.ServerCrashed{Pid: 42})
+
+	for _, ch := range []chan event.Event{first, second} {
+		e := receive(t, ch)
+		if e.Type != event.TypeServerStarted || e.ID != 1 || e.Time.IsZero() {
+			t.Errorf("first event = %+v", e)
+		}
+		if started, ok := e.Data.(event.ServerStarted); !ok || started.Pid != 42 {
+			t.Errorf("first event data = %#v", e.Data)
+		}
+		if e := receive(t, ch); e.Type != event.TypeServerCrashed || e.ID != 2 {
+			t.Errorf("second event = %+v", e)
+		}
+	}
+
+	unsubscribe()
+	unsubscribe()
+	bus.Publish(event.ConfigChanged{Source: "test"})
+
+	receive(t, second)
+	select {
+	case e := <-first:
+		t.Errorf("unsubscribed handler received %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBus_SlowSubscriber(t *testing.T) {
+	bus := event.NewBus(0)
+
+	block := make(chan struct{})
+	defer close(block)
+	bus.Subscribe(func(e event.Event) { <-block })
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			bus.Publish(event.ServerStarted{})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+}
+
+func TestBus_SubscribeBlocking(t *testing.T) {
+	bus := event.NewBus(0)
+
+	var handled atomic.Int32
+	bus.SubscribeBlocking(func(e event.Event) {
+		time.Sleep(time.Millisecond)
+		handled.Add(1)
+	})
+
+	// 超过队列长度的事件也不会被丢弃
+	for i := 0; i < 200; i++ {
+		bus.Publish(event.ServerStarted{})
+	}
+	if !bus.Flush(5*time.Second) || handled.Load() != 200 {
+		t.Errorf("handled = %d, want 200", handled.Load())
+	}
+}
+
+func TestBus_Flush(t *testing.T) {
+	bus := event.NewBus(0)
+
+	release := make(chan struct{})
+	var handled atomic.Int32
+	bus.Subscribe(func(e event.Event) {
+		<-release
+		handled.Add(1)
+	})
+	bus.Publish(event.ConfigChanged{Source: "config.json"})
+
+	if bus.Flush(20 * time.Millisecond) {
+		t.Fatal("Flush returned before the subscriber handled the event")
+	}
+	close(release)
+	if !bus.Flush(time.Second) || handled.Load() != 1 {
+		t.Errorf("Flush did not wait for the subscriber, handled = %d", handled.Load())
+	}
+}
+
+func TestBus_Recent(t *testing.T) {
+	bus := event.NewBus(3)
+	for i := 1; i <= 5; i++ {
+		bus.Publish(event.BackupCompleted{Path: string(rune('0' + i))})
+	}
+	bus.Publish(event.ServerStarted{})
+
+	ids := func(events []event.Event) []uint64 {
+		result := make([]uint64, len(events))
+		for i, e := range events {
+			result[i] = e.ID
+		}
+		return result
+	}
+
+	tests := []struct {
+		name  string
+		after uint64
+		types []event.Type
+		limit int
+		want  []uint64
+	}{
+		{"ring buffer keeps the newest", 0, nil, 0, []uint64{4, 5, 6}},
+		{"after", 4, nil, 0, []uint64{5, 6}},
+		{"type", 0, []event.Type{event.TypeBackupCompleted}, 0, []uint64{4, 5}},
+		{"limit", 0, nil, 1, []uint64{6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(bus.Recent(tt.after, tt.types, tt.limit))
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestEvent_JSON(t *testing.T) {
+	e := event.NewBus(0).Publish(event.MemoryThresholdExceeded{Usage: 91.5, Threshold: 80})
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var decoded struct {
+		Type string `json:"type"`
+		Data struct {
+			Usage float64 `json:"usage"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if decoded.Type != "memory.threshold_exceeded" || decoded.Data.Usage != 91.5 {
+		t.Errorf("decoded = %+v from %s", decoded, data)
+	}
+}
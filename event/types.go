@@ -0,0 +1,142 @@
+package event
+
+import (
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+)
+
+// 事件类型
+const (
+	TypeServerStarted           Type = "server.started"
+	TypeServerStopped           Type = "server.stopped"
+	TypeServerCrashed           Type = "server.crashed"
+	TypeServerCrashLoop         Type = "server.crash_loop"
+	TypeServerUnhealthy         Type = "server.unhealthy"
+	TypeServerRestarted         Type = "server.restarted"
+	TypeBackupCompleted         Type = "backup.completed"
+	TypePlayerJoined            Type = "player.joined"
+	TypePlayerLeft              Type = "player.left"
+	TypeMemoryThresholdExceeded Type = "memory.threshold_exceeded"
+	TypeConfigChanged           Type = "config.changed"
+	TypeUpdateAvailable         Type = "update.available"
+)
+
+// Types 所有事件类型
+var Types = []Type{
+	TypeServerStarted,
+	TypeServerStopped,
+	TypeServerCrashed,
+	TypeServerCrashLoop,
+	TypeServerUnhealthy,
+	TypeServerRestarted,
+	TypeBackupCompleted,
+	TypePlayerJoined,
+	TypePlayerLeft,
+	TypeMemoryThresholdExceeded,
+	TypeConfigChanged,
+	TypeUpdateAvailable,
+}
+
+// ServerStarted 服务端进程已启动
+type ServerStarted struct {
+	Pid int `json:"pid"`
+}
+
+// ServerStopped 服务端被主动结束
+type ServerStopped struct {
+	Pid int `json:"pid"`
+}
+
+// ServerCrashed 守护发现服务端进程意外退出
+type ServerCrashed struct {
+	Pid int `json:"pid"`
+	// Reason 退出原因,如退出码或信号
+	Reason string `json:"reason,omitempty"`
+}
+
+// ServerCrashLoop 服务端在时间窗口内崩溃重启过于频繁,已停止自动重启
+type ServerCrashLoop struct {
+	Restarts int `json:"restarts"`
+	// Window 统计重启次数的时间窗口(秒)
+	Window int `json:"window_seconds"`
+}
+
+// ServerUnhealthy 健康检查探针连续失败达到阈值,服务端将被保存并强制重启
+type ServerUnhealthy struct {
+	Probe    string `json:"probe"`
+	Failures int    `json:"failures"`
+	Error    string `json:"error"`
+}
+
+// RestartCompleted 一次重启流程结束,Status为completed failed或cancelled
+type RestartCompleted struct {
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+	Status string `json:"status"`
+	// Duration 整个流程(包括倒计时)的耗时(秒)
+	Duration float64 `json:"duration_seconds"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// BackupCompleted 一次备份结束,Error不为空时备份失败或不完整
+type BackupCompleted struct {
+	Path string `json:"path"`
+	// Size 压缩包的大小(字节)
+	Size int64 `json:"size,omitempty"`
+	// Trigger 创建备份的原因,如 schedule、manual、restart
+	Trigger string `json:"trigger,omitempty"`
+	// SaveConfirmed 备份前服务端确认保存了存档
+	SaveConfirmed bool `json:"save_confirmed"`
+	// Verified 备份完成后按清单校验通过
+	Verified bool   `json:"verified"`
+	Error    string `json:"error,omitempty"`
+}
+
+// PlayerJoined 玩家加入服务器
+type PlayerJoined struct {
+	Player palworld.Player `json:"player"`
+	Start  time.Time       `json:"start"`
+}
+
+// PlayerLeft 玩家离开服务器
+type PlayerLeft struct {
+	Player palworld.Player `json:"player"`
+	Start  time.Time       `json:"start"`
+	End    time.Time       `json:"end"`
+}
+
+// Duration 本次在线时长
+func (p PlayerLeft) Duration() time.Duration {
+	return p.End.Sub(p.Start)
+}
+
+// MemoryThresholdExceeded 内存占用超过阈值
+type MemoryThresholdExceeded struct {
+	Usage     float64 `json:"usage"`
+	Threshold float64 `json:"threshold"`
+}
+
+// ConfigChanged 配置被修改
+type ConfigChanged struct {
+	Source string `json:"source"`
+}
+
+// UpdateAvailable 有新版本的palworld-go可用
+type UpdateAvailable struct {
+	Current string `json:"current"`
+	Latest  string `json:"latest"`
+}
+
+func (ServerStarted) EventType() Type           { return TypeServerStarted }
+func (ServerStopped) EventType() Type           { return TypeServerStopped }
+func (ServerCrashed) EventType() Type           { return TypeServerCrashed }
+func (ServerCrashLoop) EventType() Type         { return TypeServerCrashLoop }
+func (ServerUnhealthy) EventType() Type         { return TypeServerUnhealthy }
+func (RestartCompleted) EventType() Type        { return TypeServerRestarted }
+func (BackupCompleted) EventType() Type         { return TypeBackupCompleted }
+func (PlayerJoined) EventType() Type            { return TypePlayerJoined }
+func (PlayerLeft) EventType() Type              { return TypePlayerLeft }
+func (MemoryThresholdExceeded) EventType() Type { return TypeMemoryThresholdExceeded }
+func (ConfigChanged) EventType() Type           { return TypeConfigChanged }
+func (UpdateAvailable) EventType() Type         { return TypeUpdateAvailable }
@@ -0,0 +1,318 @@
+// Package gamelog 捕获服务端进程的stdout和stderr,按行写入大小受限的滚动日志文件,
+// 同时在内存中保留最近的若干行,供webui查看、搜索和实时推送。
+package gamelog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 默认参数
+const (
+	// FileName 当前日志文件名,滚动后的文件依次为server.log.1 server.log.2 ...
+	FileName        = "server.log"
+	DefaultMaxSize  = 10 << 20
+	DefaultMaxFiles = 5
+	// BufferSize 内存中保留的最近行数
+	BufferSize = 1000
+	// MaxLineLength 单行最大长度,超出部分截断为新行
+	MaxLineLength = 64 << 10
+	// subscriberQueue 每个订阅者的缓冲行数,满时丢弃,不阻塞服务端输出
+	subscriberQueue = 256
+	timeLayout      = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// Stream 输出来源
+type Stream string
+
+const (
+	Stdout Stream = "stdout"
+	Stderr Stream = "stderr"
+)
+
+// Line 一行输出。从日志文件中搜索到的行没有Seq
+type Line struct {
+	Seq    uint64    `json:"seq,omitempty"`
+	Time   time.Time `json:"time"`
+	Stream Stream    `json:"stream"`
+	Text   string    `json:"text"`
+}
+
+// Log 滚动日志,可以并发使用
+type Log struct {
+	dir      string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	seq  uint64
+	// buffer 最近的行,环形缓冲
+	buffer []Line
+	start  int
+	subs   map[int]chan Line
+	nextID int
+}
+
+// Open 在dir下打开或创建日志。maxSize为单个文件的大小上限(字节),
+// maxFiles为包括当前文件在内最多保留的文件数,不大于0时使用默认值
+func Open(dir string, maxSize int64, maxFiles int) (*Log, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxFiles <= 0 {
+		maxFiles = DefaultMaxFiles
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	l := &Log{
+		dir:      dir,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		subs:     make(map[int]chan Line),
+	}
+	if err := l.openFile(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Dir 日志目录
+func (l *Log) Dir() string {
+	return l.dir
+}
+
+// Close 关闭当前日志文件
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Writer 返回写入指定来源的io.Writer,按换行拆分后记录,未结束的行会等到下一次写入
+func (l *Log) Writer(stream Stream) io.Writer {
+	return &lineWriter{log: l, stream: stream}
+}
+
+// Tail 返回内存中最近的最多n行,query不为空时只返回包含query的行(不区分大小写)
+func (l *Log) Tail(n int, query string) []Line {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	query = strings.ToLower(query)
+	var result []Line
+	for i := len(l.buffer) - 1; i >= 0 && (n <= 0 || len(result) < n); i-- {
+		line := l.buffer[(l.start+i)%len(l.buffer)]
+		if Match(line, query) {
+			result = append(result, line)
+		}
+	}
+	// 按时间顺序返回
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// Subscribe 订阅新的输出行,返回的函数用于取消订阅。订阅者处理过慢时新行会被丢弃
+func (l *Log) Subscribe() (<-chan Line, func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id := l.nextID
+	l.nextID++
+	ch := make(chan Line, subscriberQueue)
+	l.subs[id] = ch
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			delete(l.subs, id)
+			l.mu.Unlock()
+		})
+	}
+}
+
+// Search 在所有日志文件中搜索包含query的行(不区分大小写),从新到旧返回最多limit条
+func (l *Log) Search(query string, limit int) ([]Line, error) {
+	query = strings.ToLower(query)
+
+	l.mu.Lock()
+	if l.file != nil {
+		l.file.Sync()
+	}
+	l.mu.Unlock()
+
+	var result []Line
+	for i := 0; i < l.maxFiles && (limit <= 0 || len(result) < limit); i++ {
+		lines, err := readFile(l.path(i))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for j := len(lines) - 1; j >= 0 && (limit <= 0 || len(result) < limit); j-- {
+			if Match(lines[j], query) {
+				result = append(result, lines[j])
+			}
+		}
+	}
+	return result, nil
+}
+
+// Match 判断行是否包含已经转为小写的query,query为空时总是匹配
+func Match(line Line, query string) bool {
+	return query == "" || strings.Contains(strings.ToLower(line.Text), query)
+}
+
+func (l *Log) path(i int) string {
+	if i == 0 {
+		return filepath.Join(l.dir, FileName)
+	}
+	return filepath.Join(l.dir, fmt.Sprintf("%s.%d", FileName, i))
+}
+
+func (l *Log) openFile() error {
+	file, err := os.OpenFile(l.path(0), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// rotate 把server.log依次重命名为server.log.1,超出maxFiles的文件被删除
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+
+	os.Remove(l.path(l.maxFiles - 1))
+	for i := l.maxFiles - 2; i >= 0; i-- {
+		if err := os.Rename(l.path(i), l.path(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return l.openFile()
+}
+
+// add 记录一行:写入文件、放入缓冲区并推送给订阅者
+func (l *Log) add(stream Stream, text string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	line := Line{Seq: l.seq, Time: time.Now(), Stream: stream, Text: text}
+
+	if l.file != nil {
+		data := []byte(formatLine(line))
+		if l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+			if err := l.rotate(); err != nil {
+				fmt.Fprintf(os.Stderr, "滚动服务端日志失败: %v\n", err)
+			}
+		}
+		if l.file != nil {
+			n, _ := l.file.Write(data)
+			l.size += int64(n)
+		}
+	}
+
+	if len(l.buffer) < BufferSize {
+		l.buffer = append(l.buffer, line)
+	} else {
+		l.buffer[l.start] = line
+		l.start = (l.start + 1) % BufferSize
+	}
+
+	for _, ch := range l.subs {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+func formatLine(line Line) string {
+	return fmt.Sprintf("%s [%s] %s\n", line.Time.Format(timeLayout), line.Stream, line.Text)
+}
+
+// parseLine 解析formatLine写入的行,无法解析的行整行作为Text
+func parseLine(s string) Line {
+	if fields := strings.SplitN(s, " ", 3); len(fields) == 3 &&
+		strings.HasPrefix(fields[1], "[") && strings.HasSuffix(fields[1], "]") {
+		if t, err := time.Parse(timeLayout, fields[0]); err == nil {
+			return Line{Time: t, Stream: Stream(strings.Trim(fields[1], "[]")), Text: fields[2]}
+		}
+	}
+	return Line{Text: s}
+}
+
+func readFile(path string) ([]Line, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []Line
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64<<10), MaxLineLength+1024)
+	for scanner.Scan() {
+		lines = append(lines, parseLine(scanner.Text()))
+	}
+	return lines, scanner.Err()
+}
+
+// lineWriter 把写入的数据按行交给Log
+type lineWriter struct {
+	log    *Log
+	stream Stream
+
+	mu      sync.Mutex
+	pending []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		w.log.add(w.stream, strings.TrimRight(string(w.pending[:i]), "\r"))
+		w.pending = w.pending[i+1:]
+	}
+	for len(w.pending) >= MaxLineLength {
+		w.log.add(w.stream, string(w.pending[:MaxLineLength]))
+		w.pending = w.pending[MaxLineLength:]
+	}
+	return len(p), nil
+}
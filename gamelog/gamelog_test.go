@@ -0,0 +1,180 @@
+package gamelog_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/gamelog"
+)
+
+func texts(lines []gamelog.Line) []string {
+	result := make([]string, len(lines))
+	for i, line := range lines {
+		result[i] = line.Text
+	}
+	return result
+}
+
+func TestLog_Writer(t *testing.T) {
+	l, err := gamelog.Open(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer l.Close()
+
+	stdout := l.Writer(gamelog.Stdout)
+	io.WriteString(stdout, "Setting breakpad minidump AppID = 2394010\r\npartial")
+	io.WriteString(l.Writer(gamelog.Stderr), "warning\n")
+	io.WriteString(stdout, " line\n")
+
+	lines := l.Tail(0, "")
+	want := []string{"Setting breakpad minidump AppID = 2394010", "warning", "partial line"}
+	if got := texts(lines); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("lines = %q, want %q", got, want)
+	}
+	if lines[1].Stream != gamelog.Stderr || lines[2].Seq != 3 {
+		t.Errorf("lines = %+v", lines)
+	}
+}
+
+func TestLog_Tail(t *testing.T) {
+	l, err := gamelog.Open(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer l.Close()
+
+	w := l.Writer(gamelog.Stdout)
+	for i := 0; i < gamelog.BufferSize+10; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+	}
+
+	tests := []struct {
+		name  string
+		n     int
+		query string
+		want  []string
+	}{
+		{"last lines", 2, "", []string{"line 1008", "line 1009"}},
+		{"filter", 0, "LINE 100", []string{"line 100", "line 1000", "line 1001", "line 1002", "line 1003", "line 1004", "line 1005", "line 1006", "line 1007", "line 1008", "line 1009"}},
+		{"filter with limit", 1, "line 99", []string{"line 999"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := texts(l.Tail(tt.n, tt.query))
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Tail(%d, %q) = %q, want %q", tt.n, tt.query, got, tt.want)
+			}
+		})
+	}
+	// 最早的10行已被挤出缓冲区
+	if all := l.Tail(0, ""); len(all) != gamelog.BufferSize || all[0].Text != "line 10" {
+		t.Errorf("buffer holds %d lines starting at %q", len(all), all[0].Text)
+	}
+}
+
+func TestLog_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	l, err := gamelog.Open(dir, 200, 3)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer l.Close()
+
+	w := l.Writer(gamelog.Stdout)
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(w, "player %02d joined\n", i)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("files = %v, want 3", entries)
+	}
+	for _, entry := range entries {
+		info, _ := entry.Info()
+		if info.Size() > 200 {
+			t.Errorf("%v is %d bytes", entry.Name(), info.Size())
+		}
+	}
+
+	// 最新的行在当前文件里,最早的行已随滚动删除
+	lines, err := l.Search("JOINED", 0)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(lines) == 0 || lines[0].Text != "player 49 joined" || lines[0].Stream != gamelog.Stdout {
+		t.Fatalf("newest match = %+v", lines)
+	}
+	if lines[len(lines)-1].Text == "player 00 joined" {
+		t.Errorf("rotated-out line still searchable")
+	}
+	if lines, _ := l.Search("joined", 2); len(lines) != 2 || lines[1].Text != "player 48 joined" {
+		t.Errorf("limited search = %+v", lines)
+	}
+
+	// 重新打开后继续追加到当前文件
+	l.Close()
+	l, err = gamelog.Open(dir, 200, 3)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer l.Close()
+	if _, err := os.Stat(filepath.Join(dir, gamelog.FileName)); err != nil {
+		t.Errorf("current file: %v", err)
+	}
+}
+
+func TestLog_Subscribe(t *testing.T) {
+	l, err := gamelog.Open(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer l.Close()
+
+	lines, unsubscribe := l.Subscribe()
+	io.WriteString(l.Writer(gamelog.Stdout), "hello\n")
+
+	select {
+	case line := <-lines:
+		if line.Text != "hello" {
+			t.Errorf("line = %+v", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for line")
+	}
+
+	unsubscribe()
+	unsubscribe()
+	io.WriteString(l.Writer(gamelog.Stdout), "bye\n")
+	select {
+	case line := <-lines:
+		t.Errorf("unsubscribed channel received %+v", line)
+	default:
+	}
+
+	// 订阅者不读取时不会阻塞写入
+	_, unsubscribe = l.Subscribe()
+	defer unsubscribe()
+	done := make(chan struct{})
+	go func() {
+		w := l.Writer(gamelog.Stdout)
+		for i := 0; i < 1000; i++ {
+			io.WriteString(w, "spam\n")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer blocked on a slow subscriber")
+	}
+}
@@ -0,0 +1,226 @@
+// Package health 定期运行存活探针(RCON Info、UDP查询、REST API等),
+// 记录每个探针连续失败的次数,达到阈值时通知守护强制保存并重启服务端。
+package health
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// 默认参数
+const (
+	DefaultInterval = 30 * time.Second
+	DefaultTimeout  = 10 * time.Second
+)
+
+// Probe 一个存活探针,Check返回nil表示服务端正常响应
+type Probe struct {
+	Name string
+	// Threshold 连续失败多少次后判定服务端无响应
+	Threshold int
+	Check     func(ctx context.Context) error
+}
+
+// Status 探针的当前状态
+type Status struct {
+	Name      string `json:"name"`
+	Healthy   bool   `json:"healthy"`
+	Failures  int    `json:"failures"`
+	Threshold int    `json:"threshold"`
+	// Checked 是否已经检查过,未检查过的探针不算就绪
+	Checked     bool       `json:"checked"`
+	LastCheck   *time.Time `json:"last_check,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LatencyMs   int64      `json:"latency_ms"`
+}
+
+// Checker 运行一组探针,可以并发使用
+type Checker struct {
+	// Active 返回false时不运行探针并清空状态,如服务端未运行或仍在启动中
+	Active func() bool
+	// OnUnhealthy 探针连续失败次数达到阈值时调用,每轮连续失败只调用一次
+	OnUnhealthy func(Status)
+
+	probes   []Probe
+	interval time.Duration
+	timeout  time.Duration
+
+	mu       sync.Mutex
+	statuses []Status
+	active   bool
+}
+
+// New 创建检查器,interval和timeout不大于0时使用默认值,Threshold不大于0的探针被忽略
+func New(probes []Probe, interval, timeout time.Duration) *Checker {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	c := &Checker{interval: interval, timeout: timeout}
+	for _, probe := range probes {
+		if probe.Threshold <= 0 || probe.Check == nil {
+			continue
+		}
+		c.probes = append(c.probes, probe)
+		c.statuses = append(c.statuses, Status{Name: probe.Name, Threshold: probe.Threshold})
+	}
+	return c
+}
+
+// Run 每隔interval运行一次所有探针,直到ctx被取消
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.CheckOnce(ctx)
+		}
+	}
+}
+
+// CheckOnce 并发运行所有探针一次并更新状态
+func (c *Checker) CheckOnce(ctx context.Context) {
+	if c.Active != nil && !c.Active() {
+		c.reset()
+		return
+	}
+
+	type result struct {
+		err     error
+		latency time.Duration
+	}
+	results := make([]result, len(c.probes))
+
+	var wg sync.WaitGroup
+	for i, probe := range c.probes {
+		wg.Add(1)
+		go func(i int, probe Probe) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := probe.Check(probeCtx)
+			results[i] = result{err: err, latency: time.Since(start)}
+		}(i, probe)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	var tripped []Status
+
+	c.mu.Lock()
+	c.active = true
+	for i, r := range results {
+		s := &c.statuses[i]
+		checked := now
+		s.Checked = true
+		s.LastCheck = &checked
+		s.LatencyMs = r.latency.Milliseconds()
+		if r.err == nil {
+			s.Healthy = true
+			s.Failures = 0
+			s.LastSuccess = &checked
+			s.LastError = ""
+			continue
+		}
+
+		s.Healthy = false
+		s.Failures++
+		s.LastError = r.err.Error()
+		log.Printf("健康检查%v失败(%d/%d): %v", s.Name, s.Failures, s.Threshold, r.err)
+		if s.Failures == s.Threshold {
+			tripped = append(tripped, *s)
+		}
+	}
+	handler := c.OnUnhealthy
+	c.mu.Unlock()
+
+	if handler != nil && len(tripped) > 0 {
+		handler(tripped[0])
+	}
+}
+
+// Verify 运行所有探针一次,返回第一个失败的探针的错误。不更新状态,也不触发OnUnhealthy,
+// 用于重启后确认服务端恢复响应
+func (c *Checker) Verify(ctx context.Context) error {
+	errs := make([]error, len(c.probes))
+
+	var wg sync.WaitGroup
+	for i, probe := range c.probes {
+		wg.Add(1)
+		go func(i int, probe Probe) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+			if err := probe.Check(probeCtx); err != nil {
+				errs[i] = fmt.Errorf("%v: %w", probe.Name, err)
+			}
+		}(i, probe)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Statuses 返回所有探针的状态
+func (c *Checker) Statuses() []Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Status(nil), c.statuses...)
+}
+
+// Live 没有探针的连续失败次数达到阈值
+func (c *Checker) Live() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range c.statuses {
+		if s.Failures >= s.Threshold {
+			return false
+		}
+	}
+	return true
+}
+
+// Ready 检查器处于活动状态,且所有探针最近一次都成功
+func (c *Checker) Ready() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.active {
+		return false
+	}
+	for _, s := range c.statuses {
+		if !s.Checked || !s.Healthy {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Checker) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.active = false
+	for i := range c.statuses {
+		c.statuses[i] = Status{Name: c.statuses[i].Name, Threshold: c.statuses[i].Threshold}
+	}
+}
@@ -0,0 +1,162 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/health"
+)
+
+// flaky 按顺序返回results中的结果,用完后一直返回最后一个
+func flaky(results ...error) func(ctx context.Context) error {
+	var i int32 = -1
+	return func(ctx context.Context) error {
+		n := int(atomic.AddInt32(&i, 1))
+		if n >= len(results) {
+			n = len(results) - 1
+		}
+		return results[n]
+	}
+}
+
+func TestChecker_Threshold(t *testing.T) {
+	hung := errors.New("i/o timeout")
+	checker := health.New([]health.Probe{
+		{Name: "rcon", Threshold: 2, Check: flaky(nil, hung, hung, hung, nil)},
+		{Name: "rest", Threshold: 5, Check: flaky(nil)},
+		{Name: "disabled", Threshold: 0, Check: flaky(hung)},
+	}, time.Second, time.Second)
+
+	var tripped []health.Status
+	checker.OnUnhealthy = func(s health.Status) { tripped = append(tripped, s) }
+	ctx := context.Background()
+
+	if checker.Ready() {
+		t.Fatal("ready before the first check")
+	}
+
+	tests := []struct {
+		live, ready bool
+		tripped     int
+	}{
+		{true, true, 0},
+		{true, false, 0},
+		{false, false, 1},
+		// 持续失败不会重复通知
+		{false, false, 1},
+		{true, true, 1},
+	}
+	for i, tt := range tests {
+		checker.CheckOnce(ctx)
+		if checker.Live() != tt.live || checker.Ready() != tt.ready || len(tripped) != tt.tripped {
+			t.Fatalf("check %d: live = %v, ready = %v, tripped = %d, want %+v", i+1, checker.Live(), checker.Ready(), len(tripped), tt)
+		}
+	}
+
+	if tripped[0].Name != "rcon" || tripped[0].LastError != hung.Error() {
+		t.Errorf("tripped = %+v", tripped[0])
+	}
+	statuses := checker.Statuses()
+	if len(statuses) != 2 || !statuses[0].Healthy || statuses[0].LastSuccess == nil {
+		t.Errorf("statuses = %+v", statuses)
+	}
+}
+
+func TestChecker_Inactive(t *testing.T) {
+	var calls int32
+	active := true
+	checker := health.New([]health.Probe{
+		{Name: "rcon", Threshold: 1, Check: func(ctx context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return errors.New("refused")
+		}},
+	}, time.Second, time.Second)
+	checker.Active = func() bool { return active }
+
+	checker.CheckOnce(context.Background())
+	if checker.Live() {
+		t.Fatal("live after reaching the threshold")
+	}
+
+	// 服务端未运行时不检查,状态清空
+	active = false
+	checker.CheckOnce(context.Background())
+	if !checker.Live() || checker.Ready() || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("inactive: live = %v, ready = %v, calls = %d", checker.Live(), checker.Ready(), calls)
+	}
+	if s := checker.Statuses()[0]; s.Checked || s.Failures != 0 {
+		t.Errorf("status after reset = %+v", s)
+	}
+}
+
+func TestChecker_Timeout(t *testing.T) {
+	checker := health.New([]health.Probe{
+		{Name: "hung", Threshold: 1, Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	}, time.Second, 10*time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		checker.CheckOnce(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("probe timeout was not applied")
+	}
+	if checker.Live() {
+		t.Error("timed out probe counted as healthy")
+	}
+}
+
+func TestUDPCheck(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer server.Close()
+
+	go func() {
+		buf := make([]byte, 1400)
+		for {
+			n, addr, err := server.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// 回复challenge
+			if n > 4 {
+				server.WriteTo([]byte{0xFF, 0xFF, 0xFF, 0xFF, 'A', 1, 2, 3, 4}, addr)
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := health.UDPCheck(server.LocalAddr().String())(ctx); err != nil {
+		t.Errorf("UDPCheck on a responding server: %v", err)
+	}
+}
+
+func TestUDPCheck_Silent(t *testing.T) {
+	// 收到查询但从不回复的端口(如游戏端口)在超时后失败
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer silent.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = health.UDPCheck(silent.LocalAddr().String())(ctx)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("UDPCheck on a silent server = %v, want a timeout", err)
+	}
+}
@@ -0,0 +1,43 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// a2sInfo Steam A2S_INFO查询包
+var a2sInfo = append([]byte{0xFF, 0xFF, 0xFF, 0xFF}, "TSource Engine Query\x00"...)
+
+// UDPCheck 返回向address发送A2S_INFO查询的探针。只要收到任意回复(包括challenge)即视为正常,
+// 端口关闭(ICMP不可达)或超时视为失败
+func UDPCheck(address string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "udp", address)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			deadline = time.Now().Add(DefaultTimeout)
+		}
+		conn.SetDeadline(deadline)
+
+		if _, err := conn.Write(a2sInfo); err != nil {
+			return err
+		}
+		buf := make([]byte, 1400)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("empty response from %v", address)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,457 @@
+// Package jobs 统一调度周期任务(备份、推送、内存检查、白名单等)。
+// 每个任务有唯一的名称,按固定间隔或cron计划触发,可以加随机抖动;同一任务不会重叠运行。
+// 暂停状态和最近一次运行的结果保存在bbolt中,程序重启后保留。
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Bucket 任务状态所在的bucket
+const Bucket = "jobs"
+
+// persistInterval 触发间隔短于它的任务程序重启后马上运行也没有影响,不必每次运行都保存运行时间
+const persistInterval = time.Minute
+
+var (
+	// ErrNotFound 没有这个名称的任务
+	ErrNotFound = errors.New("job not found")
+	// ErrRunning 任务正在运行
+	ErrRunning = errors.New("job is already running")
+	// ErrDuplicate 任务名称重复
+	ErrDuplicate = errors.New("duplicate job name")
+)
+
+// 运行结果
+const (
+	ResultOK      = "ok"
+	ResultError   = "error"
+	ResultSkipped = "skipped"
+)
+
+// Trigger 决定任务的触发时间,Next返回t之后的下一次触发时间,返回零值表示不再触发。
+// *schedule.Schedule 可以直接作为Trigger使用
+type Trigger interface {
+	Next(t time.Time) time.Time
+	String() string
+}
+
+// Every 固定间隔触发
+type Every time.Duration
+
+// Next 返回t之后间隔d的时间
+func (e Every) Next(t time.Time) time.Time {
+	if e <= 0 {
+		return time.Time{}
+	}
+	return t.Add(time.Duration(e))
+}
+
+func (e Every) String() string {
+	return "every " + time.Duration(e).String()
+}
+
+// Job 一个周期任务
+type Job struct {
+	// Name 唯一的名称,用于API和持久化
+	Name        string
+	Description string
+	Trigger     Trigger
+	// Jitter 每次触发时间随机推迟[0, Jitter),避免多个任务同时运行
+	Jitter time.Duration
+	Run    func(ctx context.Context) error
+}
+
+// State 任务的状态
+type State struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Trigger     string `json:"trigger"`
+	Paused      bool   `json:"paused"`
+	Running     bool   `json:"running"`
+	// LastRun 最近一次开始运行的时间
+	LastRun *time.Time `json:"last_run,omitempty"`
+	// LastDuration 最近一次运行的耗时(秒)
+	LastDuration float64    `json:"last_duration_seconds"`
+	LastResult   string     `json:"last_result,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	NextRun      *time.Time `json:"next_run,omitempty"`
+	Runs         int        `json:"runs"`
+	Failures     int        `json:"failures"`
+	// Skipped 因上一次还没结束而跳过的次数
+	Skipped int `json:"skipped"`
+}
+
+type entry struct {
+	job   Job
+	state State
+	next  time.Time
+	// saved 最近一次保存的状态
+	saved State
+}
+
+// Scheduler 任务调度器,可以并发使用
+type Scheduler struct {
+	db *bbolt.DB
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	order   []string
+	ctx     context.Context
+	wake    chan struct{}
+	// version 每次保存递增,在锁外写入时避免较旧的状态覆盖较新的
+	version uint64
+
+	writeMu sync.Mutex
+	written map[string]uint64
+}
+
+// New 创建调度器,db为nil时不保存状态
+func New(db *bbolt.DB) (*Scheduler, error) {
+	if db != nil {
+		err := db.Update(func(tx *bbolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte(Bucket))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Scheduler{
+		db:      db,
+		entries: make(map[string]*entry),
+		ctx:     context.Background(),
+		wake:    make(chan struct{}, 1),
+		written: make(map[string]uint64),
+	}, nil
+}
+
+// Add 添加任务,恢复保存的暂停状态和运行记录。
+// 上一次运行之后的下一次触发时间还没到时沿用它,程序重启不会推迟或提前任务
+func (s *Scheduler) Add(job Job) error {
+	if job.Name == "" || job.Run == nil || job.Trigger == nil {
+		return fmt.Errorf("job %q: name, trigger and run are required", job.Name)
+	}
+
+	s.mu.Lock()
+	if _, ok := s.entries[job.Name]; ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %v", ErrDuplicate, job.Name)
+	}
+
+	e := &entry{job: job}
+	if saved, ok := s.load(job.Name); ok {
+		e.state = saved
+		e.saved = saved
+	}
+	e.state.Name = job.Name
+	e.state.Description = job.Description
+	e.state.Trigger = job.Trigger.String()
+	e.state.Running = false
+	if !e.state.Paused {
+		e.resume(time.Now())
+	} else {
+		e.state.NextRun = nil
+	}
+
+	s.entries[job.Name] = e
+	s.order = append(s.order, job.Name)
+	write := s.save(e, true)
+	s.notify()
+	s.mu.Unlock()
+
+	write()
+	return nil
+}
+
+// Run 按计划运行任务,直到ctx被取消。任务的ctx随之取消
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		var next time.Time
+		var writes []func()
+		for _, name := range s.order {
+			e := s.entries[name]
+			if e.state.Paused || e.next.IsZero() {
+				continue
+			}
+			if !e.next.After(now) {
+				s.start(e)
+				e.schedule(now)
+				writes = append(writes, s.save(e, false))
+				if e.next.IsZero() {
+					continue
+				}
+			}
+			if next.IsZero() || e.next.Before(next) {
+				next = e.next
+			}
+		}
+		s.mu.Unlock()
+
+		for _, write := range writes {
+			write()
+		}
+
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			fire = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-fire:
+		case <-s.wake:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// RunNow 立即运行一次任务,不影响下一次计划运行的时间。暂停的任务也可以手动运行
+func (s *Scheduler) RunNow(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if e.state.Running {
+		return ErrRunning
+	}
+	s.start(e)
+	return nil
+}
+
+// Pause 暂停任务,正在进行的运行不受影响
+func (s *Scheduler) Pause(name string) error {
+	s.mu.Lock()
+	e, ok := s.entries[name]
+	if !ok {
+		s.mu.Unlock()
+		return ErrNotFound
+	}
+	e.state.Paused = true
+	e.next = time.Time{}
+	e.state.NextRun = nil
+	write := s.save(e, false)
+	s.notify()
+	s.mu.Unlock()
+
+	write()
+	return nil
+}
+
+// Resume 恢复任务,从现在开始重新计算下一次运行的时间
+func (s *Scheduler) Resume(name string) error {
+	s.mu.Lock()
+	e, ok := s.entries[name]
+	if !ok {
+		s.mu.Unlock()
+		return ErrNotFound
+	}
+	write := func() {}
+	if e.state.Paused {
+		e.state.Paused = false
+		e.schedule(time.Now())
+		write = s.save(e, false)
+		s.notify()
+	}
+	s.mu.Unlock()
+
+	write()
+	return nil
+}
+
+// Get 返回一个任务的状态
+func (s *Scheduler) Get(name string) (State, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return State{}, false
+	}
+	return e.state, true
+}
+
+// List 按添加顺序返回所有任务的状态
+func (s *Scheduler) List() []State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make([]State, 0, len(s.order))
+	for _, name := range s.order {
+		states = append(states, s.entries[name].state)
+	}
+	return states
+}
+
+// start 在新的goroutine中运行任务,上一次还没结束时跳过。调用方持有s.mu
+func (s *Scheduler) start(e *entry) {
+	if e.state.Running {
+		e.state.Skipped++
+		e.state.LastResult = ResultSkipped
+		log.Printf("任务%v上一次运行还没有结束,跳过本次运行", e.job.Name)
+		return
+	}
+
+	started := time.Now()
+	e.state.Running = true
+	e.state.LastRun = &started
+	ctx := s.ctx
+
+	go func() {
+		err := runSafely(ctx, e.job.Run)
+		duration := time.Since(started)
+
+		s.mu.Lock()
+		e.state.Running = false
+		e.state.Runs++
+		e.state.LastDuration = duration.Seconds()
+		if err != nil {
+			e.state.Failures++
+			e.state.LastResult = ResultError
+			e.state.LastError = err.Error()
+			log.Printf("任务%v运行失败: %v", e.job.Name, err)
+		} else {
+			e.state.LastResult = ResultOK
+			e.state.LastError = ""
+		}
+		write := s.save(e, false)
+		s.mu.Unlock()
+
+		write()
+	}()
+}
+
+// runSafely 运行任务,把panic转换为错误
+func runSafely(ctx context.Context, run func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run(ctx)
+}
+
+// schedule 计算now之后的下一次运行时间
+func (e *entry) schedule(now time.Time) {
+	e.next = e.job.Trigger.Next(now)
+	if !e.next.IsZero() && e.job.Jitter > 0 {
+		e.next = e.next.Add(time.Duration(rand.Int63n(int64(e.job.Jitter))))
+	}
+	if e.next.IsZero() {
+		e.state.NextRun = nil
+		return
+	}
+	next := e.next
+	e.state.NextRun = &next
+}
+
+// resume 根据保存的上一次运行时间计算下一次运行时间,已经错过时从now开始计算
+func (e *entry) resume(now time.Time) {
+	if e.state.LastRun != nil {
+		if next := e.job.Trigger.Next(*e.state.LastRun); next.After(now) {
+			e.next = next
+			e.state.NextRun = &next
+			return
+		}
+	}
+	e.schedule(now)
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) load(name string) (State, bool) {
+	if s.db == nil {
+		return State{}, false
+	}
+	var state State
+	found := false
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket([]byte(Bucket)).Get([]byte(name))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &state)
+	})
+	if err != nil {
+		log.Printf("读取任务%v的状态失败: %v", name, err)
+		return State{}, false
+	}
+	return state, found
+}
+
+// changed 判断状态的变化是否影响程序重启后的恢复:暂停状态、错误,或者间隔较长的任务开始了新的运行
+func (e *entry) changed() bool {
+	if e.state.Paused != e.saved.Paused || e.state.LastError != e.saved.LastError {
+		return true
+	}
+	last := e.state.LastRun
+	if last == nil || (e.saved.LastRun != nil && last.Equal(*e.saved.LastRun)) {
+		return false
+	}
+	if e.saved.LastRun == nil {
+		return true
+	}
+	next := e.job.Trigger.Next(*last)
+	return next.IsZero() || next.Sub(*last) >= persistInterval
+}
+
+// save 在状态的变化需要保存时(force为true时总是)记录要保存的状态,返回写入数据库的函数,
+// 由调用方在释放s.mu之后调用,避免运行频繁的任务在持有锁时反复写盘。调用方持有s.mu
+func (s *Scheduler) save(e *entry, force bool) (write func()) {
+	if s.db == nil || !(force || e.changed()) {
+		return func() {}
+	}
+	data, err := json.Marshal(e.state)
+	if err != nil {
+		return func() {}
+	}
+	e.saved = e.state
+	s.version++
+	version, name := s.version, e.job.Name
+
+	return func() {
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
+		if version < s.written[name] {
+			return
+		}
+		s.written[name] = version
+
+		err := s.db.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket([]byte(Bucket)).Put([]byte(name), data)
+		})
+		if err != nil {
+			log.Printf("保存任务%v的状态失败: %v", name, err)
+		}
+	}
+}
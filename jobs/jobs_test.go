@@ -0,0 +1,275 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/jobs"
+	"github.com/hoshinonyaruko/palworld-go/schedule"
+	"go.etcd.io/bbolt"
+)
+
+func openDB(t *testing.T, path string) *bbolt.DB {
+	t.Helper()
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	return db
+}
+
+func newScheduler(t *testing.T, db *bbolt.DB) *jobs.Scheduler {
+	t.Helper()
+	s, err := jobs.New(db)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return s
+}
+
+// waitFor 等待cond成立,超时后失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestScheduler_Every(t *testing.T) {
+	s := newScheduler(t, nil)
+	var runs int32
+	failing := errors.New("rcon refused")
+	err := s.Add(jobs.Job{
+		Name:    "broadcast",
+		Trigger: jobs.Every(20 * time.Millisecond),
+		Run: func(ctx context.Context) error {
+			if atomic.AddInt32(&runs, 1) == 2 {
+				return failing
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	waitFor(t, "three runs", func() bool {
+		state, _ := s.Get("broadcast")
+		return state.Runs >= 3 && !state.Running
+	})
+	state, _ := s.Get("broadcast")
+	if state.Failures != 1 || state.LastResult != jobs.ResultOK || state.LastError != "" || state.LastRun == nil || state.NextRun == nil {
+		t.Errorf("state = %+v", state)
+	}
+	if state.Trigger != "every 20ms" {
+		t.Errorf("Trigger = %q", state.Trigger)
+	}
+}
+
+func TestScheduler_Overlap(t *testing.T) {
+	s := newScheduler(t, nil)
+	release := make(chan struct{})
+	var runs int32
+	s.Add(jobs.Job{
+		Name:    "backup",
+		Trigger: jobs.Every(10 * time.Millisecond),
+		Run: func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			<-release
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	// 第一次运行没有结束时,后续的触发被跳过
+	waitFor(t, "skipped runs", func() bool {
+		state, _ := s.Get("backup")
+		return state.Skipped >= 2
+	})
+	if err := s.RunNow("backup"); err != jobs.ErrRunning {
+		t.Errorf("RunNow while running = %v, want ErrRunning", err)
+	}
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Errorf("job started %d times while running", n)
+	}
+	close(release)
+}
+
+func TestScheduler_PauseResumeRunNow(t *testing.T) {
+	s := newScheduler(t, nil)
+	var runs int32
+	s.Add(jobs.Job{
+		Name:    "whitelist",
+		Trigger: jobs.Every(time.Hour),
+		Run: func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		},
+	})
+
+	if err := s.Pause("whitelist"); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if state, _ := s.Get("whitelist"); !state.Paused || state.NextRun != nil {
+		t.Errorf("paused state = %+v", state)
+	}
+
+	// 暂停的任务可以手动运行
+	if err := s.RunNow("whitelist"); err != nil {
+		t.Fatalf("RunNow: %v", err)
+	}
+	waitFor(t, "manual run", func() bool {
+		state, _ := s.Get("whitelist")
+		return state.Runs == 1 && !state.Running
+	})
+
+	if err := s.Resume("whitelist"); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	state, _ := s.Get("whitelist")
+	if state.Paused || state.NextRun == nil || time.Until(*state.NextRun) < 59*time.Minute {
+		t.Errorf("resumed state = %+v", state)
+	}
+
+	for _, err := range []error{s.Pause("nope"), s.Resume("nope"), s.RunNow("nope")} {
+		if err != jobs.ErrNotFound {
+			t.Errorf("unknown job error = %v, want ErrNotFound", err)
+		}
+	}
+	if err := s.Add(jobs.Job{Name: "whitelist", Trigger: jobs.Every(time.Second), Run: func(context.Context) error { return nil }}); !errors.Is(err, jobs.ErrDuplicate) {
+		t.Errorf("duplicate Add error = %v", err)
+	}
+}
+
+func TestScheduler_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	job := func(run func(ctx context.Context) error) jobs.Job {
+		return jobs.Job{Name: "memory-check", Trigger: jobs.Every(time.Hour), Run: run}
+	}
+
+	db := openDB(t, path)
+	s := newScheduler(t, db)
+	s.Add(job(func(ctx context.Context) error { panic("wmic not found") }))
+	s.RunNow("memory-check")
+	waitFor(t, "run", func() bool {
+		state, _ := s.Get("memory-check")
+		return state.Runs == 1 && !state.Running
+	})
+	s.Pause("memory-check")
+	db.Close()
+
+	// 重新打开后恢复暂停状态和运行记录
+	db = openDB(t, path)
+	defer db.Close()
+	s = newScheduler(t, db)
+	s.Add(job(func(ctx context.Context) error { return nil }))
+	state, _ := s.Get("memory-check")
+	if !state.Paused || state.Runs != 1 || state.Failures != 1 || state.LastResult != jobs.ResultError || state.LastError != "panic: wmic not found" || state.LastRun == nil {
+		t.Errorf("restored state = %+v", state)
+	}
+}
+
+func TestScheduler_ResumeNextRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	job := jobs.Job{Name: "backup", Trigger: jobs.Every(time.Hour), Run: func(context.Context) error { return nil }}
+
+	db := openDB(t, path)
+	s := newScheduler(t, db)
+	s.Add(job)
+	s.RunNow("backup")
+	waitFor(t, "run", func() bool {
+		state, _ := s.Get("backup")
+		return state.Runs == 1 && !state.Running
+	})
+	state, _ := s.Get("backup")
+	lastRun := *state.LastRun
+	db.Close()
+
+	// 重新打开后从上一次运行的时间继续计算,而不是从现在重新等待一个间隔
+	db = openDB(t, path)
+	defer db.Close()
+	s = newScheduler(t, db)
+	s.Add(job)
+	state, _ = s.Get("backup")
+	if want := lastRun.Add(time.Hour); state.NextRun == nil || !state.NextRun.Equal(want) {
+		t.Errorf("NextRun = %v, want %v", state.NextRun, want)
+	}
+}
+
+func TestScheduler_SaveOnlyOnChange(t *testing.T) {
+	db := openDB(t, filepath.Join(t.TempDir(), "jobs.db"))
+	defer db.Close()
+	s := newScheduler(t, db)
+
+	var runs int32
+	failing := errors.New("ini sync failed")
+	s.Add(jobs.Job{Name: "ini-sync", Trigger: jobs.Every(10 * time.Millisecond), Run: func(context.Context) error {
+		if atomic.AddInt32(&runs, 1) == 3 {
+			return failing
+		}
+		return nil
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	waitFor(t, "runs", func() bool {
+		state, _ := s.Get("ini-sync")
+		return state.Runs >= 5
+	})
+	cancel()
+
+	saved := func() (state jobs.State) {
+		db.View(func(tx *bbolt.Tx) error {
+			return json.Unmarshal(tx.Bucket([]byte(jobs.Bucket)).Get([]byte("ini-sync")), &state)
+		})
+		return state
+	}
+
+	// 间隔很短的任务只在第一次运行和错误变化时保存,不是每次运行都写盘
+	if state := saved(); state.LastRun == nil || state.Failures != 1 || state.LastError != "" || state.Runs >= 5 {
+		t.Errorf("saved state = %+v", state)
+	}
+}
+
+func TestScheduler_CronAndJitter(t *testing.T) {
+	s := newScheduler(t, nil)
+	cron, err := schedule.Parse("0 4 * * *", time.UTC)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	s.Add(jobs.Job{Name: "restart", Trigger: cron, Jitter: 10 * time.Minute, Run: func(context.Context) error { return nil }})
+
+	state, _ := s.Get("restart")
+	want := cron.Next(time.Now())
+	if state.NextRun == nil || state.NextRun.Before(want) || !state.NextRun.Before(want.Add(10*time.Minute)) {
+		t.Errorf("NextRun = %v, want within 10m after %v", state.NextRun, want)
+	}
+	if state.Trigger != "0 4 * * *" {
+		t.Errorf("Trigger = %q", state.Trigger)
+	}
+
+	// 零间隔的任务不会被触发
+	s.Add(jobs.Job{Name: "disabled", Trigger: jobs.Every(0), Run: func(context.Context) error { return nil }})
+	if state, _ := s.Get("disabled"); state.NextRun != nil {
+		t.Errorf("disabled NextRun = %v", state.NextRun)
+	}
+	if got := len(s.List()); got != 2 {
+		t.Errorf("List returned %d jobs", got)
+	}
+}
@@ -0,0 +1,362 @@
+// Package lifecycle 服务端进程的生命周期状态机。
+// 守护每次检查进程是否存活后调用Machine.Observe,由状态机决定是否需要拉起进程,
+// 连续崩溃时按指数退避等待,在时间窗口内重启次数过多时停止自动重启并发出告警。
+package lifecycle
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/event"
+)
+
+// State 生命周期状态
+type State string
+
+const (
+	// Stopped 手动关闭,守护不会拉起
+	Stopped State = "stopped"
+	// Starting 已经发起启动,等待进程出现
+	Starting State = "starting"
+	// Running 进程正常运行
+	Running State = "running"
+	// Stopping 已经发起关闭,等待进程退出
+	Stopping State = "stopping"
+	// Crashed 进程意外退出,随后立即进入Backoff或Disabled
+	Crashed State = "crashed"
+	// Backoff 等待退避时间结束后重启
+	Backoff State = "backoff"
+	// Disabled 重启过于频繁,停止自动重启,需要手动启动
+	Disabled State = "disabled"
+)
+
+// Action Observe返回的需要守护执行的动作
+type Action int
+
+const (
+	// ActionNone 无需操作
+	ActionNone Action = iota
+	// ActionStart 需要启动服务端
+	ActionStart
+)
+
+// 默认参数
+const (
+	DefaultBaseDelay   = 10 * time.Second
+	DefaultMaxDelay    = 10 * time.Minute
+	DefaultMaxRestarts = 5
+	DefaultWindow      = 30 * time.Minute
+	// DefaultStableAfter 连续运行多久后清零退避次数
+	DefaultStableAfter = 5 * time.Minute
+	// DefaultStopTimeout 发起关闭后等待进程退出的最长时间,需要大于定时关服的倒计时
+	DefaultStopTimeout = 10 * time.Minute
+	// DefaultStartGrace 发起启动后等待进程出现的时间,期间检测不到进程不算崩溃
+	DefaultStartGrace = time.Minute
+	// HistorySize 保留的状态变化条数
+	HistorySize = 100
+)
+
+// Options 状态机参数,零值使用对应的默认值
+type Options struct {
+	// BaseDelay 第一次崩溃后的等待时间,之后每次翻倍
+	BaseDelay time.Duration
+	// MaxDelay 等待时间上限
+	MaxDelay time.Duration
+	// MaxRestarts Window内最多自动重启的次数,超过后进入Disabled
+	MaxRestarts int
+	Window      time.Duration
+	StableAfter time.Duration
+	StopTimeout time.Duration
+	StartGrace  time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.BaseDelay <= 0 {
+		o.BaseDelay = DefaultBaseDelay
+	}
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = DefaultMaxDelay
+	}
+	if o.MaxRestarts <= 0 {
+		o.MaxRestarts = DefaultMaxRestarts
+	}
+	if o.Window <= 0 {
+		o.Window = DefaultWindow
+	}
+	if o.StableAfter <= 0 {
+		o.StableAfter = DefaultStableAfter
+	}
+	if o.StopTimeout <= 0 {
+		o.StopTimeout = DefaultStopTimeout
+	}
+	if o.StartGrace <= 0 {
+		o.StartGrace = DefaultStartGrace
+	}
+	return o
+}
+
+// Transition 一次状态变化
+type Transition struct {
+	From   State     `json:"from"`
+	To     State     `json:"to"`
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+}
+
+// Snapshot 状态机的当前状态
+type Snapshot struct {
+	State       State        `json:"state"`
+	Since       time.Time    `json:"since"`
+	Failures    int          `json:"failures"`
+	Restarts    int          `json:"restarts"`
+	MaxRestarts int          `json:"max_restarts"`
+	Window      int          `json:"window_seconds"`
+	NextStart   *time.Time   `json:"next_start,omitempty"`
+	History     []Transition `json:"history"`
+}
+
+// Machine 生命周期状态机,可以并发使用
+type Machine struct {
+	opts Options
+	bus  *event.Bus
+	now  func() time.Time
+
+	mu    sync.Mutex
+	state State
+	since time.Time
+	// failures 连续崩溃次数,决定退避时间
+	failures int
+	// restart Stopping结束后是否重新启动
+	restart   bool
+	nextStart time.Time
+	// restarts 自动重启的时间,只保留Window内的
+	restarts []time.Time
+	history  []Transition
+}
+
+// New 创建状态机,初始状态为Stopped。bus为nil时使用event.Default
+func New(opts Options, bus *event.Bus) *Machine {
+	if bus == nil {
+		bus = event.Default
+	}
+	return &Machine{
+		opts:  opts.withDefaults(),
+		bus:   bus,
+		now:   time.Now,
+		state: Stopped,
+		since: time.Now(),
+	}
+}
+
+// Default 守护使用的状态机,webui等其他包通过它发起启动、关闭和计划内的重启
+var Default = New(Options{}, nil)
+
+// SetOptions 修改状态机参数,零值使用对应的默认值
+func (m *Machine) SetOptions(opts Options) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.opts = opts.withDefaults()
+}
+
+// State 返回当前状态
+func (m *Machine) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Snapshot 返回当前状态和最近的状态变化(按时间倒序)
+func (m *Machine) Snapshot() Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.pruneRestarts(now)
+
+	snapshot := Snapshot{
+		State:       m.state,
+		Since:       m.since,
+		Failures:    m.failures,
+		Restarts:    len(m.restarts),
+		MaxRestarts: m.opts.MaxRestarts,
+		Window:      int(m.opts.Window / time.Second),
+		History:     make([]Transition, 0, len(m.history)),
+	}
+	if m.state == Backoff {
+		next := m.nextStart
+		snapshot.NextStart = &next
+	}
+	for i := len(m.history) - 1; i >= 0; i-- {
+		snapshot.History = append(snapshot.History, m.history[i])
+	}
+	return snapshot
+}
+
+// Start 手动启动,调用方随后负责拉起进程。会清除Disabled和退避状态
+func (m *Machine) Start(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failures = 0
+	m.restarts = nil
+	m.transition(Starting, reason)
+}
+
+// Stop 手动关闭,调用方随后负责结束进程。进程退出后进入Stopped,不会被自动拉起
+func (m *Machine) Stop(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.restart = false
+	m.transition(Stopping, reason)
+}
+
+// Restart 计划内的重启(如定时重启或延迟关服),调用方随后负责关闭进程。
+// 进程退出后直接重新启动,不计为崩溃,也不计入自动重启次数
+func (m *Machine) Restart(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.restart = true
+	m.transition(Stopping, reason)
+}
+
+// Observe 根据进程是否存活推进状态机,返回守护需要执行的动作。
+// 返回ActionStart时状态已经变为Starting,并计入一次自动重启。
+func (m *Machine) Observe(running bool, pid int) Action {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	switch m.state {
+	case Stopped, Disabled:
+		if running {
+			m.transition(Running, "检测到进程已在运行")
+		}
+	case Stopping:
+		if running && now.Sub(m.since) >= m.opts.StopTimeout {
+			m.transition(Running, "等待进程退出超时")
+		} else if !running {
+			return m.stopped()
+		}
+	case Starting:
+		// 通过系统服务启动时拿不到pid,进程可能要过一会才能检测到
+		if running {
+			m.transition(Running, "进程已启动")
+		} else if now.Sub(m.since) >= m.opts.StartGrace {
+			m.crash(now, pid, "启动后进程未能存活")
+		}
+	case Running:
+		if !running {
+			m.crash(now, pid, "进程意外退出")
+		} else if m.failures > 0 && now.Sub(m.since) >= m.opts.StableAfter {
+			m.failures = 0
+		}
+	case Backoff:
+		if running {
+			m.transition(Running, "检测到进程已在运行")
+		} else if !now.Before(m.nextStart) {
+			m.restarts = append(m.restarts, now)
+			m.transition(Starting, fmt.Sprintf("第%d次自动重启", len(m.restarts)))
+			return ActionStart
+		}
+	}
+	return ActionNone
+}
+
+// Exited 处理守护回收到的服务端进程退出。expected为true时进程是被主动结束的(KillProcess),
+// 不会自动拉起,只有通过Restart请求的重启才会重新启动;clean为true时进程自行以0退出(如RCON的DoExit和Shutdown),
+// 运行中正常退出不计为崩溃,但计入自动重启次数并至少等待BaseDelay,避免反复退出时无限重启;
+// 启动阶段意外退出的,无论退出码都按崩溃处理
+func (m *Machine) Exited(pid int, expected, clean bool, reason string) Action {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	switch m.state {
+	case Stopping:
+		return m.stopped()
+	case Starting, Running:
+		switch {
+		case expected:
+			m.transition(Stopped, "进程被主动结束: "+reason)
+		case m.state == Starting:
+			m.crash(now, pid, "启动后进程未能存活: "+reason)
+		case !clean:
+			m.crash(now, pid, "进程意外退出: "+reason)
+		default:
+			m.transition(Crashed, "进程正常退出: "+reason)
+			m.backoff(now, m.opts.BaseDelay)
+		}
+	}
+	return ActionNone
+}
+
+// stopped 进程在Stopping状态下退出,计划内重启时直接重新启动
+func (m *Machine) stopped() Action {
+	if m.restart {
+		m.restart = false
+		m.transition(Starting, "计划内重启")
+		return ActionStart
+	}
+	m.transition(Stopped, "进程已退出")
+	return ActionNone
+}
+
+// Delay 第n次连续崩溃后的等待时间
+func (m *Machine) Delay(n int) time.Duration {
+	delay := m.opts.BaseDelay
+	for i := 1; i < n; i++ {
+		delay *= 2
+		if delay >= m.opts.MaxDelay {
+			return m.opts.MaxDelay
+		}
+	}
+	if delay > m.opts.MaxDelay {
+		return m.opts.MaxDelay
+	}
+	return delay
+}
+
+// crash 记录一次崩溃,进入Backoff;Window内的自动重启次数已达上限时进入Disabled并告警
+func (m *Machine) crash(now time.Time, pid int, reason string) {
+	m.transition(Crashed, reason)
+	m.bus.PublishAt(event.ServerCrashed{Pid: pid, Reason: reason}, now)
+
+	m.failures++
+	m.backoff(now, m.Delay(m.failures))
+}
+
+// backoff 等待delay后自动重启;Window内的自动重启次数已达上限时进入Disabled并告警
+func (m *Machine) backoff(now time.Time, delay time.Duration) {
+	m.pruneRestarts(now)
+	if len(m.restarts) >= m.opts.MaxRestarts {
+		m.transition(Disabled, fmt.Sprintf("%v内已自动重启%d次,停止自动重启", m.opts.Window, len(m.restarts)))
+		m.bus.PublishAt(event.ServerCrashLoop{Restarts: len(m.restarts), Window: int(m.opts.Window / time.Second)}, now)
+		return
+	}
+
+	m.nextStart = now.Add(delay)
+	m.transition(Backoff, fmt.Sprintf("%v后重启", delay))
+}
+
+func (m *Machine) pruneRestarts(now time.Time) {
+	i := 0
+	for i < len(m.restarts) && now.Sub(m.restarts[i]) >= m.opts.Window {
+		i++
+	}
+	m.restarts = m.restarts[i:]
+}
+
+func (m *Machine) transition(to State, reason string) {
+	now := m.now()
+	m.history = append(m.history, Transition{From: m.state, To: to, Time: now, Reason: reason})
+	if len(m.history) > HistorySize {
+		m.history = m.history[len(m.history)-HistorySize:]
+	}
+	m.state = to
+	m.since = now
+}
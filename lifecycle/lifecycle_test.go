@@ -0,0 +1,272 @@
+package lifecycle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/event"
+)
+
+// newMachine 创建使用可控时钟的状态机
+func newMachine(opts Options) (*Machine, *event.Bus, *time.Time) {
+	bus := event.NewBus(0)
+	m := New(opts, bus)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	return m, bus, &now
+}
+
+func types(bus *event.Bus) []event.Type {
+	var result []event.Type
+	for _, e := range bus.Recent(0, nil, 0) {
+		result = append(result, e.Type)
+	}
+	return result
+}
+
+func TestMachine_CrashLoop(t *testing.T) {
+	m, bus, now := newMachine(Options{BaseDelay: 10 * time.Second, MaxRestarts: 3, Window: time.Hour, StartGrace: time.Second})
+
+	m.Start("test")
+	if m.Observe(true, 1) != ActionNone || m.State() != Running {
+		t.Fatalf("state = %v, want running", m.State())
+	}
+
+	// 每次崩溃后等待时间翻倍,启动后超过等待时间仍检测不到进程也算崩溃
+	for i, delay := range []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second} {
+		*now = now.Add(time.Second)
+		if action := m.Observe(false, 1); action != ActionNone || m.State() != Backoff {
+			t.Fatalf("crash %d: action = %v, state = %v", i+1, action, m.State())
+		}
+		*now = now.Add(delay - time.Second)
+		if action := m.Observe(false, 1); action != ActionNone {
+			t.Fatalf("crash %d: restarted before the backoff elapsed", i+1)
+		}
+		*now = now.Add(time.Second)
+		if action := m.Observe(false, 1); action != ActionStart || m.State() != Starting {
+			t.Fatalf("crash %d: action = %v, state = %v after backoff", i+1, action, m.State())
+		}
+	}
+
+	// 窗口内已重启3次,再次崩溃后停止自动重启
+	*now = now.Add(time.Second)
+	m.Observe(false, 1)
+	if m.State() != Disabled {
+		t.Fatalf("state = %v, want disabled", m.State())
+	}
+	*now = now.Add(time.Hour)
+	if action := m.Observe(false, 1); action != ActionNone || m.State() != Disabled {
+		t.Fatalf("disabled machine returned %v, state %v", action, m.State())
+	}
+
+	got := types(bus)
+	want := []event.Type{
+		event.TypeServerCrashed, event.TypeServerCrashed, event.TypeServerCrashed,
+		event.TypeServerCrashed, event.TypeServerCrashLoop,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("events = %v, want %v", got, want)
+		}
+	}
+
+	// 手动启动解除Disabled
+	m.Start("manual")
+	snapshot := m.Snapshot()
+	if snapshot.State != Starting || snapshot.Failures != 0 || snapshot.Restarts != 0 {
+		t.Errorf("snapshot after manual start = %+v", snapshot)
+	}
+	if snapshot.History[0].To != Starting || snapshot.History[0].From != Disabled {
+		t.Errorf("latest transition = %+v", snapshot.History[0])
+	}
+}
+
+func TestMachine_StartGrace(t *testing.T) {
+	m, _, now := newMachine(Options{StartGrace: time.Minute})
+
+	// 通过系统服务启动时进程出现前检测不到,等待时间内不算崩溃
+	m.Start("test")
+	*now = now.Add(30 * time.Second)
+	if action := m.Observe(false, 0); action != ActionNone || m.State() != Starting {
+		t.Fatalf("action = %v, state = %v within the grace period", action, m.State())
+	}
+	*now = now.Add(30 * time.Second)
+	if action := m.Observe(false, 0); action != ActionNone || m.State() != Backoff {
+		t.Fatalf("action = %v, state = %v after the grace period", action, m.State())
+	}
+}
+
+func TestMachine_Window(t *testing.T) {
+	m, _, now := newMachine(Options{BaseDelay: time.Second, MaxDelay: time.Second, MaxRestarts: 2, Window: time.Minute})
+
+	m.Start("test")
+	m.Observe(true, 1)
+	for i := 0; i < 5; i++ {
+		m.Observe(false, 1)
+		// 每次重启间隔超过窗口,不会触发停止自动重启
+		*now = now.Add(time.Minute)
+		if action := m.Observe(false, 1); action != ActionStart {
+			t.Fatalf("restart %d: action = %v, state = %v", i+1, action, m.State())
+		}
+		m.Observe(true, 1)
+	}
+	if m.State() != Running {
+		t.Errorf("state = %v, want running", m.State())
+	}
+}
+
+func TestMachine_StableResetsBackoff(t *testing.T) {
+	m, _, now := newMachine(Options{BaseDelay: 10 * time.Second, StableAfter: time.Minute})
+
+	m.Start("test")
+	m.Observe(true, 1)
+	m.Observe(false, 1)
+	*now = now.Add(10 * time.Second)
+	m.Observe(false, 1)
+	m.Observe(true, 1)
+
+	*now = now.Add(time.Minute)
+	m.Observe(true, 1)
+	m.Observe(false, 1)
+	if snapshot := m.Snapshot(); snapshot.NextStart == nil || !snapshot.NextStart.Equal(now.Add(10*time.Second)) {
+		t.Errorf("next start = %v, want the base delay after a stable run", snapshot.NextStart)
+	}
+}
+
+func TestMachine_StopAndRestart(t *testing.T) {
+	tests := []struct {
+		name       string
+		request    func(m *Machine)
+		wantAction Action
+		wantState  State
+	}{
+		{"stop", func(m *Machine) { m.Stop("test") }, ActionNone, Stopped},
+		{"restart", func(m *Machine) { m.Restart("test") }, ActionStart, Starting},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, bus, _ := newMachine(Options{})
+			m.Start("test")
+			m.Observe(true, 1)
+
+			tt.request(m)
+			if action := m.Observe(true, 1); action != ActionNone || m.State() != Stopping {
+				t.Fatalf("while shutting down: action = %v, state = %v", action, m.State())
+			}
+			if action := m.Observe(false, 1); action != tt.wantAction || m.State() != tt.wantState {
+				t.Fatalf("after exit: action = %v, state = %v", action, m.State())
+			}
+			if got := types(bus); len(got) != 0 {
+				t.Errorf("planned shutdown published %v", got)
+			}
+			if snapshot := m.Snapshot(); snapshot.Restarts != 0 {
+				t.Errorf("planned shutdown counted as %d restarts", snapshot.Restarts)
+			}
+		})
+	}
+}
+
+func TestMachine_StopTimeout(t *testing.T) {
+	m, _, now := newMachine(Options{StopTimeout: time.Minute})
+	m.Start("test")
+	m.Observe(true, 1)
+
+	m.Restart("test")
+	*now = now.Add(time.Minute)
+	m.Observe(true, 1)
+	if m.State() != Running {
+		t.Fatalf("state = %v, want running after the stop timeout", m.State())
+	}
+	// 超时后进程再退出按崩溃处理
+	m.Observe(false, 1)
+	if m.State() != Backoff {
+		t.Errorf("state = %v, want backoff", m.State())
+	}
+}
+
+func TestMachine_Delay(t *testing.T) {
+	m := New(Options{BaseDelay: 10 * time.Second, MaxDelay: time.Minute}, event.NewBus(0))
+
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, w := range want {
+		if got := m.Delay(i + 1); got != w {
+			t.Errorf("Delay(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestMachine_Exited(t *testing.T) {
+	tests := []struct {
+		name       string
+		prepare    func(m *Machine)
+		expected   bool
+		clean      bool
+		wantAction Action
+		wantState  State
+		wantCrash  bool
+	}{
+		{"clean exit while running", func(m *Machine) { m.Observe(true, 1) }, false, true, ActionNone, Backoff, false},
+		{"crash while running", func(m *Machine) { m.Observe(true, 1) }, false, false, ActionNone, Backoff, true},
+		{"clean exit while starting", func(m *Machine) {}, false, true, ActionNone, Backoff, true},
+		{"killed while running", func(m *Machine) { m.Observe(true, 1) }, true, true, ActionNone, Stopped, false},
+		{"killed while starting", func(m *Machine) {}, true, true, ActionNone, Stopped, false},
+		{"killed while stopping", func(m *Machine) { m.Observe(true, 1); m.Stop("test") }, true, true, ActionNone, Stopped, false},
+		{"killed for restart", func(m *Machine) { m.Observe(true, 1); m.Restart("test") }, true, true, ActionStart, Starting, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, bus, _ := newMachine(Options{})
+			m.Start("test")
+			tt.prepare(m)
+
+			if action := m.Exited(1, tt.expected, tt.clean, "exit code 0"); action != tt.wantAction || m.State() != tt.wantState {
+				t.Fatalf("action = %v, state = %v, want %v, %v", action, m.State(), tt.wantAction, tt.wantState)
+			}
+
+			crashes := bus.Recent(0, []event.Type{event.TypeServerCrashed}, 0)
+			if got := len(crashes) > 0; got != tt.wantCrash {
+				t.Errorf("crashed = %v, want %v", got, tt.wantCrash)
+			}
+		})
+	}
+}
+
+func TestMachine_CleanExitLoop(t *testing.T) {
+	m, bus, now := newMachine(Options{BaseDelay: 10 * time.Second, MaxRestarts: 2, Window: time.Hour})
+	m.Start("test")
+
+	// 反复正常退出不计为崩溃,但每次都等待BaseDelay并计入自动重启次数
+	for i := 0; i < 2; i++ {
+		m.Observe(true, 1)
+		if action := m.Exited(1, false, true, "exit code 0"); action != ActionNone || m.State() != Backoff {
+			t.Fatalf("exit %d: action = %v, state = %v", i+1, action, m.State())
+		}
+		if snapshot := m.Snapshot(); snapshot.Failures != 0 || !snapshot.NextStart.Equal(now.Add(10*time.Second)) {
+			t.Fatalf("exit %d: snapshot = %+v", i+1, snapshot)
+		}
+		if m.Observe(false, 0) != ActionNone {
+			t.Fatalf("exit %d: restarted before the delay", i+1)
+		}
+		*now = now.Add(10 * time.Second)
+		if action := m.Observe(false, 0); action != ActionStart || m.State() != Starting {
+			t.Fatalf("exit %d: action = %v, state = %v", i+1, action, m.State())
+		}
+	}
+
+	m.Observe(true, 1)
+	m.Exited(1, false, true, "exit code 0")
+	if m.State() != Disabled {
+		t.Fatalf("state = %v, want disabled", m.State())
+	}
+	if got := len(bus.Recent(0, []event.Type{event.TypeServerCrashLoop}, 0)); got != 1 {
+		t.Errorf("crash loop events = %d", got)
+	}
+	if got := len(bus.Recent(0, []event.Type{event.TypeServerCrashed}, 0)); got != 0 {
+		t.Errorf("crash events = %d", got)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -20,18 +21,34 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
+	// 内置时区数据,Windows上也能使用restartTimezone
+	_ "time/tzdata"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorcon/rcon"
+	"github.com/hoshinonyaruko/palworld-go/audit"
+	"github.com/hoshinonyaruko/palworld-go/backup"
+	"github.com/hoshinonyaruko/palworld-go/event"
+	"github.com/hoshinonyaruko/palworld-go/gamelog"
+	"github.com/hoshinonyaruko/palworld-go/health"
+	"github.com/hoshinonyaruko/palworld-go/jobs"
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+	"github.com/hoshinonyaruko/palworld-go/presence"
 	"go.etcd.io/bbolt"
 
 	"github.com/hoshinonyaruko/palworld-go/bot"
 	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/rconproxy"
+	"github.com/hoshinonyaruko/palworld-go/restart"
+	"github.com/hoshinonyaruko/palworld-go/schedule"
 	"github.com/hoshinonyaruko/palworld-go/status"
 	"github.com/hoshinonyaruko/palworld-go/sys"
 	"github.com/hoshinonyaruko/palworld-go/tool"
+	"github.com/hoshinonyaruko/palworld-go/webhook"
 	"github.com/hoshinonyaruko/palworld-go/webui"
 )
 
@@ -119,33 +136,148 @@ func main() {
 	//还原状态
 	status.SetManualServerShutdown(false)
 
+	// 所有子系统共享的RCON长连接池
+	tool.SetRconPoolSettings(jsonconfig.RconPoolSize, time.Duration(jsonconfig.RconKeepAliveInterval)*time.Second)
+	tool.SetRconDialOptions(
+		rcon.SetMultiPacket(jsonconfig.RconMultiPacket),
+		rcon.SetEncoding(tool.ResolveRconEncoding(jsonconfig)),
+	)
+
+	//玩家数据库,打开失败时InitDB直接退出
+	db = webui.InitDB()
+	defer db.Close()
+	//RCON指令审计日志与玩家数据共用数据库,需在任何子系统发出指令前初始化
+	auditErr := audit.InitDB(db)
+	if auditErr != nil {
+		log.Printf("初始化审计日志失败: %v", auditErr)
+	}
+
+	// 周期任务统一由调度器运行,暂停状态和运行记录保存在玩家数据库中
+	scheduler, err := jobs.New(db)
+	if err != nil {
+		log.Printf("初始化任务调度失败,任务状态不会被保存: %v", err)
+		scheduler, _ = jobs.New(nil)
+	}
+	webui.SetJobScheduler(scheduler)
+	go scheduler.Run(context.Background())
+
+	// 每小时按保留策略清理一次审计日志
+	auditMaxAge := time.Duration(jsonconfig.AuditRetentionDays) * 24 * time.Hour
+	if auditErr == nil && (auditMaxAge > 0 || jsonconfig.AuditMaxEntries > 0) {
+		addJob(scheduler, jobs.Job{
+			Name:        "audit-prune",
+			Description: "清理过期的审计日志",
+			Trigger:     jobs.Every(time.Hour),
+			Jitter:      intervalJitter(time.Hour),
+			Run: func(ctx context.Context) error {
+				deleted, err := audit.Prune(auditMaxAge, jsonconfig.AuditMaxEntries)
+				if deleted > 0 {
+					log.Printf("已清理%d条过期审计日志", deleted)
+				}
+				return err
+			},
+		})
+	}
+
+	// 外发webhook,待投递的请求保存在玩家数据库中,重启后继续投递
+	if hooks, err := webhook.HooksFromConfig(jsonconfig.Webhooks); err != nil {
+		log.Printf("webhook配置错误: %v", err)
+	} else if dispatcher, err := webhook.New(db, hooks, nil); err != nil {
+		log.Printf("初始化webhook失败: %v", err)
+	} else {
+		dispatcher.Subscribe(event.Default)
+		webui.SetWebhookDispatcher(dispatcher)
+		go dispatcher.Run(context.Background())
+	}
+
+	// 捕获服务端的stdout和stderr,写入滚动日志并推送到webui
+	if gameLog, err := gamelog.Open(jsonconfig.GameLogPath, int64(jsonconfig.GameLogMaxSize)<<20, jsonconfig.GameLogMaxFiles); err != nil {
+		log.Printf("打开服务端日志失败: %v", err)
+	} else {
+		sys.SetOutput(gameLog.Writer(gamelog.Stdout), gameLog.Writer(gamelog.Stderr))
+		webui.SetGameLog(gameLog)
+	}
+
+	// RCON代理,团队成员使用各自的令牌连接,不需要知道管理员密码
+	if jsonconfig.RconProxyPort != 0 {
+		address := jsonconfig.Address + ":" + strconv.Itoa(jsonconfig.WorldSettings.RconPort)
+		executor, err := tool.NewExecutor(address, jsonconfig.WorldSettings.AdminPassword, false)
+		if err != nil {
+			log.Printf("RCON代理启动失败: %v", err)
+		} else {
+			proxy := rconproxy.New(executor, rconproxy.UsersFromConfig(jsonconfig.RconProxyUsers))
+			go func() {
+				if err := proxy.ListenAndServe(net.JoinHostPort(jsonconfig.RconProxyAddress, strconv.Itoa(jsonconfig.RconProxyPort))); err != nil {
+					log.Printf("RCON代理停止运行: %v", err)
+				}
+			}()
+			fmt.Printf("RCON代理运行在%v:%v\n", jsonconfig.RconProxyAddress, jsonconfig.RconProxyPort)
+		}
+	}
+
 	// 设置监控和自动重启
 	supervisor := NewSupervisor(jsonconfig)
 	go supervisor.Start()
 
+	// 健康检查,服务端无响应时保存并强制重启
+	checker := health.New(supervisor.HealthProbes(), time.Duration(jsonconfig.HealthCheckInterval)*time.Second, time.Duration(jsonconfig.HealthCheckTimeout)*time.Second)
+	checker.Active = supervisor.HealthActive
+	checker.OnUnhealthy = supervisor.ForceRestart
+	webui.SetHealthChecker(checker)
+	go checker.Run(context.Background())
+
 	// 设置备份任务
 	backupTask := NewBackupTask(jsonconfig)
-	go backupTask.Schedule()
+	webui.SetBackup(backupTask.RunBackup)
+	if jsonconfig.BackupInterval > 0 {
+		addJob(scheduler, jobs.Job{
+			Name:        "backup",
+			Description: "备份存档和配置",
+			Trigger:     jobs.Every(time.Duration(jsonconfig.BackupInterval) * time.Second),
+			Jitter:      intervalJitter(time.Duration(jsonconfig.BackupInterval) * time.Second),
+			Run: func(ctx context.Context) error {
+				return backupTask.RunBackup(backup.TriggerSchedule)
+			},
+		})
+	}
+
+	// 所有重启经由同一个流程:倒计时广播、保存、备份、关闭、重新启动并等待健康检查通过
+	restartLoc := restartLocation(jsonconfig)
+	windows, err := schedule.ParseWindows(jsonconfig.MaintenanceWindows, restartLoc)
+	if err != nil {
+		log.Printf("维护窗口配置无效,不限制重启时间: %v", err)
+	}
+	setupRestarter(jsonconfig, backupTask, checker, windows)
+
+	// 按cron计划定时重启
+	restartSchedules := parseRestartSchedules(jsonconfig, restartLoc)
+	webui.SetRestartSchedule(restartSchedules, windows)
+	if len(restartSchedules) > 0 {
+		addJob(scheduler, restartScheduleJob(restartSchedules))
+	}
 
 	if !supervisor.isServiceRunning() {
+		supervisor.Lifecycle.Start("启动服务端")
 		sys.RestartService(jsonconfig)
 	} else {
 		fmt.Printf("当前服务端正常运行中,守护和内存助手已启动\n")
 	}
 	//cookie数据库
 	webui.InitializeDB()
-	//玩家数据库
-	db = webui.InitDB()
 	//机器人数据库
 	if jsonconfig.Onebotv11HttpApiPath != "" {
 		bot.InitializeDB()
 	}
-	//启动周期任务
-	go tool.ScheduleTask(db, jsonconfig)
-	if db == nil {
-		log.Fatal("Failed to initialize database")
-	}
-	defer db.Close()
+	//定期记录在线玩家
+	addJob(scheduler, jobs.Job{
+		Name:        "player-data",
+		Description: "更新玩家数据库",
+		Trigger:     jobs.Every(3 * time.Minute),
+		Jitter:      intervalJitter(3 * time.Minute),
+		Run: func(ctx context.Context) error {
+			return tool.RefreshPlayerData(ctx, db, jsonconfig)
+		},
+	})
 	r := gin.Default()
 
 	//webui和它的api
@@ -251,11 +383,44 @@ func main() {
 
 	// 设置推送任务
 	palworldBroadcast := NewpalworldBroadcast(jsonconfig)
-	go palworldBroadcast.Schedule()
+	if jsonconfig.MessageBroadcastInterval > 0 {
+		addJob(scheduler, jobs.Job{
+			Name:        "broadcast",
+			Description: "随机推送一条定期消息",
+			Trigger:     jobs.Every(time.Duration(jsonconfig.MessageBroadcastInterval) * time.Second),
+			Jitter:      intervalJitter(time.Duration(jsonconfig.MessageBroadcastInterval) * time.Second),
+			Run: func(ctx context.Context) error {
+				palworldBroadcast.RunpalworldBroadcast()
+				return nil
+			},
+		})
+	}
+
+	// 检测玩家加入和离开,通过事件总线通知机器人和全服广播
+	bot.SubscribeEvents(jsonconfig)
+	SubscribeWelcome(jsonconfig)
+	tracker := presence.NewTracker(func(ctx context.Context) ([]palworld.Player, error) {
+		client, err := tool.NewServerClient(jsonconfig)
+		if err != nil {
+			return nil, err
+		}
+		return client.ShowPlayers(audit.WithOrigin(ctx, audit.OriginPresence))
+	}, time.Duration(jsonconfig.PresenceInterval)*time.Second, event.Default)
+	go tracker.Run(context.Background())
 
 	// 设置内存检查任务
-	memoryCheckTask := NewMemoryCheckTask(jsonconfig, backupTask)
-	go memoryCheckTask.Schedule()
+	memoryCheckTask := NewMemoryCheckTask(jsonconfig)
+	if jsonconfig.MemoryCheckInterval > 0 {
+		addJob(scheduler, jobs.Job{
+			Name:        "memory-check",
+			Description: "检查内存占用",
+			Trigger:     jobs.Every(time.Duration(jsonconfig.MemoryCheckInterval) * time.Second),
+			Jitter:      intervalJitter(time.Duration(jsonconfig.MemoryCheckInterval) * time.Second),
+			Run: func(ctx context.Context) error {
+				return memoryCheckTask.checkMemory()
+			},
+		})
+	}
 	fmt.Printf("webui-api运行在%v端口\n", jsonconfig.WebuiPort)
 	fmt.Printf("webui地址:http://127.0.0.1:%v\n", jsonconfig.WebuiPort)
 	fmt.Printf("开放52000端口后可外网访问,用户名,服务器名(可以中文),初始用户名palgo初始密码useradmin\n")
@@ -270,6 +435,9 @@ func main() {
 	}
 
 	fmt.Printf("当前版本: %s 最新版本: %s \n", version, latestTag)
+	if version != "" && latestTag != "" && latestTag != version {
+		event.Publish(event.UpdateAvailable{Current: version, Latest: latestTag})
+	}
 
 	if runtime.GOOS == "windows" {
 		if jsonconfig.MemoryCleanupInterval != 0 {
@@ -282,69 +450,79 @@ func main() {
 			}
 			defer os.Remove(rammapExecutable) // 确保程序结束时删除文件
 
-			// 创建定时器，根据配置间隔定期运行RAMMap
-			ticker := time.NewTicker(time.Duration(jsonconfig.MemoryCleanupInterval) * time.Second)
-			go func() {
-				defer ticker.Stop()
-				for range ticker.C {
-					runRAMMap(rammapExecutable)
-				}
-			}()
+			// 根据配置间隔定期运行RAMMap
+			addJob(scheduler, jobs.Job{
+				Name:        "rammap",
+				Description: "使用RAMMap清理内存",
+				Trigger:     jobs.Every(time.Duration(jsonconfig.MemoryCleanupInterval) * time.Second),
+				Jitter:      intervalJitter(time.Duration(jsonconfig.MemoryCleanupInterval) * time.Second),
+				Run: func(ctx context.Context) error {
+					return runRAMMap(rammapExecutable)
+				},
+			})
 		}
 	}
 
 	if runtime.GOOS == "windows" {
-		// 创建一个定时器，每10秒触发一次，保存游戏设置，允许玩家修改json配置并同步到ini
-		saveSettingsTicker := time.NewTicker(10 * time.Second)
-		go func() {
-			defer saveSettingsTicker.Stop()
-			for range saveSettingsTicker.C {
+		// 每10秒保存一次游戏设置，允许玩家修改json配置并同步到ini
+		addJob(scheduler, jobs.Job{
+			Name:        "ini-sync",
+			Description: "同步配置到服务端ini",
+			Trigger:     jobs.Every(10 * time.Second),
+			Run: func(ctx context.Context) error {
 				// 定时保存配置
 				jsonconfig := config.ReadConfigv2()
 				//保存帕鲁服务端配置
 				err := config.WriteGameWorldSettings(&jsonconfig, jsonconfig.WorldSettings)
 				if err != nil {
 					fmt.Println("Error writing game world settings:", err)
-				} else {
-					fmt.Println("Game world settings saved successfully.")
+					return err
 				}
+				fmt.Println("Game world settings saved successfully.")
 				if jsonconfig.EnableEngineSetting {
 					//保存引擎配置
 					err = config.WriteEngineSettings(&jsonconfig, jsonconfig.Engine)
 					if err != nil {
 						fmt.Println("Error writing Engine settings:", err)
-					} else {
-						fmt.Println("Engine settings saved successfully.")
+						return err
 					}
+					fmt.Println("Engine settings saved successfully.")
 				}
-			}
-		}()
+				return nil
+			},
+		})
 	}
 
 	if jsonconfig.WhiteCheckTime != 0 {
 		//白名单
-		whiteInterval := time.Duration(jsonconfig.WhiteCheckTime) * time.Second
-		whiteTicker := time.NewTicker(whiteInterval)
-		go func() {
-			defer whiteTicker.Stop()
-			for range whiteTicker.C {
+		addJob(scheduler, jobs.Job{
+			Name:        "whitelist",
+			Description: "检查白名单并踢出名单外的玩家",
+			Trigger:     jobs.Every(time.Duration(jsonconfig.WhiteCheckTime) * time.Second),
+			Jitter:      intervalJitter(time.Duration(jsonconfig.WhiteCheckTime) * time.Second),
+			Run: func(ctx context.Context) error {
 				fmt.Println("checking player whitelist")
 				tool.CheckAndKickPlayers(jsonconfig)
-			}
-		}()
+				return nil
+			},
+		})
 	}
 
 	//定时重启
 	if jsonconfig.RestartInterval != 0 {
-		restartInterval := time.Duration(jsonconfig.RestartInterval) * time.Second
-		restartTicker := time.NewTicker(restartInterval)
-		go func() {
-			defer restartTicker.Stop()
-			for range restartTicker.C {
-				// 定时推送并重启 120秒 发数组第一条信息
-				tool.Shutdown(jsonconfig, "120", jsonconfig.RegularMessages[0])
-			}
-		}()
+		addJob(scheduler, jobs.Job{
+			Name:        "restart-interval",
+			Description: "按固定间隔重启服务端",
+			Trigger:     jobs.Every(time.Duration(jsonconfig.RestartInterval) * time.Second),
+			Run: func(ctx context.Context) error {
+				// 按RestartCountdown倒计时广播后重启
+				_, err := restart.Default.Restart(restart.Request{
+					Reason: restart.ReasonScheduled,
+					Delay:  restart.Default.DefaultDelay(),
+				})
+				return err
+			},
+		})
 	}
 
 	// 设置信号捕获
@@ -390,7 +568,7 @@ func extractRAMMapExecutable() (string, error) {
 	return tmpFile.Name(), nil
 }
 
-func runRAMMap(rammapExecutable string) {
+func runRAMMap(rammapExecutable string) error {
 	log.Printf("正在使用rammap清理内存....")
 	// 调用RAMMap的命令
 	cmd := exec.Command(rammapExecutable, "-Ew")
@@ -398,6 +576,23 @@ func runRAMMap(rammapExecutable string) {
 	if err != nil {
 		log.Printf("运行RAMMap时发生错误: %v", err)
 	}
+	return err
+}
+
+// intervalJitter 间隔任务的随机抖动,取间隔的5%,最多1分钟,避免多个任务总在同一时刻运行
+func intervalJitter(interval time.Duration) time.Duration {
+	jitter := interval / 20
+	if jitter > time.Minute {
+		jitter = time.Minute
+	}
+	return jitter
+}
+
+// addJob 向调度器添加任务,失败时只记录日志
+func addJob(scheduler *jobs.Scheduler, job jobs.Job) {
+	if err := scheduler.Add(job); err != nil {
+		log.Printf("添加任务%v失败: %v", job.Name, err)
+	}
 }
 
 // OpenWebUI 在默认浏览器中打开Web UI
@@ -2,48 +2,29 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"os/exec"
 	"runtime"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/hoshinonyaruko/palworld-go/config"
 )
 
 type MemoryCheckTask struct {
-	Config     config.Config
-	Ticker     *time.Ticker
-	BackupTask *BackupTask
+	Config config.Config
 }
 
-func NewMemoryCheckTask(config config.Config, BackupTask *BackupTask) *MemoryCheckTask {
-	var ticker *time.Ticker
-	if config.MemoryCheckInterval > 0 {
-		ticker = time.NewTicker(time.Duration(config.MemoryCheckInterval) * time.Second)
-	}
-
+func NewMemoryCheckTask(config config.Config) *MemoryCheckTask {
 	return &MemoryCheckTask{
-		Config:     config,
-		Ticker:     ticker,
-		BackupTask: BackupTask,
-	}
-}
-
-func (task *MemoryCheckTask) Schedule() {
-	if task.Ticker == nil {
-		// 如果 Ticker 为 nil，不需要进行定时检查
-		return
-	}
-
-	for range task.Ticker.C {
-		task.checkMemory()
+		Config: config,
 	}
 }
 
-func (task *MemoryCheckTask) checkMemory() {
+// checkMemory 检查内存占用,超过阈值时按配置清理或重启
+func (task *MemoryCheckTask) checkMemory() error {
 	var cmd *exec.Cmd
 	threshold := task.Config.MemoryUsageThreshold
 
@@ -58,13 +39,13 @@ func (task *MemoryCheckTask) checkMemory() {
 	err := cmd.Run()
 	if err != nil {
 		log.Printf("Failed to execute memory check command: %v", err)
-		return
+		return err
 	}
 
 	memoryUsage, err := task.parseMemoryUsage(out.String(), runtime.GOOS)
 	if err != nil {
 		log.Printf("Failed to parse memory usage: %v", err)
-		return
+		return err
 	}
 
 	log.Printf("Now Memory usage is  %v%%.", memoryUsage)
@@ -73,16 +54,17 @@ func (task *MemoryCheckTask) checkMemory() {
 		log.Printf("Memory usage is above %v%%. Running clean command.", threshold)
 		// 初始化RCON客户端
 		address := task.Config.Address + ":" + strconv.Itoa(task.Config.WorldSettings.RconPort)
-		rconClient := NewRconClient(address, task.Config.WorldSettings.AdminPassword, task.BackupTask, &task.Config)
+		rconClient := NewRconClient(address, task.Config.WorldSettings.AdminPassword, &task.Config)
 		if rconClient == nil {
 			log.Println("RCON客户端初始化失败,无法处理内存使用情况,请按教程正确开启rcon和设置服务端admin密码")
-			return
+			return errors.New("RCON客户端初始化失败")
 		}
-		HandleMemoryUsage(threshold, rconClient, task.Config)
+		HandleMemoryUsage(memoryUsage, threshold, rconClient, task.Config)
 		defer rconClient.Close()
 	} else {
 		log.Printf("Memory usage is below %v%%. No action required.", threshold)
 	}
+	return nil
 }
 
 func (task *MemoryCheckTask) parseMemoryUsage(output, os string) (float64, error) {
@@ -0,0 +1,233 @@
+// Package palworld 提供基于RCON的帕鲁服务端指令客户端,把服务端的文本响应解析为结构化结果
+package palworld
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorcon/rcon"
+)
+
+// InvalidField ShowPlayers中无法解析的字段值(例如包含\u0000)
+const InvalidField = "<null/err>"
+
+// Executor 执行一条RCON指令,tool.Executor和rcon.Conn均满足该接口
+type Executor interface {
+	ExecuteContext(ctx context.Context, command string) (string, error)
+}
+
+// ServerInfo Info指令的结果
+type ServerInfo struct {
+	Version string `json:"version"`
+	Name    string `json:"name"`
+}
+
+// Player ShowPlayers指令返回的一名在线玩家
+type Player struct {
+	Name      string `json:"name"`
+	PlayerUID string `json:"playeruid"`
+	SteamID   string `json:"steamid"`
+}
+
+// Client 帕鲁服务端指令客户端
+type Client struct {
+	exec Executor
+}
+
+// NewClient 创建一个指令客户端,指令的编码方式由exec底层的rcon连接决定
+func NewClient(exec Executor) *Client {
+	return &Client{exec: exec}
+}
+
+var infoPattern = regexp.MustCompile(`\[(v[\d\.]+)\]\s*(.+)`)
+
+// Info 查询服务端版本和名称
+func (c *Client) Info(ctx context.Context) (ServerInfo, error) {
+	response, err := c.execute(ctx, "Info")
+	if err != nil {
+		return ServerInfo{}, err
+	}
+
+	matches := infoPattern.FindStringSubmatch(response)
+	if len(matches) < 3 {
+		return ServerInfo{}, &CommandError{Command: "Info", Response: response, Kind: ErrUnexpectedResponse}
+	}
+
+	return ServerInfo{Version: matches[1], Name: strings.TrimSpace(matches[2])}, nil
+}
+
+// ShowPlayers 查询当前在线玩家
+func (c *Client) ShowPlayers(ctx context.Context) ([]Player, error) {
+	response, err := c.execute(ctx, "ShowPlayers")
+	if err != nil {
+		return nil, err
+	}
+
+	// 第一行是列标题,之后每行一名玩家
+	lines := strings.Split(strings.TrimSpace(response), "\n")
+	titles := strings.Split(strings.TrimSpace(lines[0]), ",")
+	if len(titles) < 2 {
+		return nil, &CommandError{Command: "ShowPlayers", Response: response, Kind: ErrUnexpectedResponse}
+	}
+
+	players := make([]Player, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		var player Player
+		for i, title := range titles {
+			value := InvalidField
+			if i < len(fields) && !strings.Contains(fields[i], "\u0000") {
+				value = fields[i]
+			}
+
+			switch strings.ToLower(strings.TrimSpace(title)) {
+			case "name":
+				player.Name = value
+			case "playeruid":
+				player.PlayerUID = value
+			case "steamid":
+				player.SteamID = value
+			}
+		}
+		players = append(players, player)
+	}
+
+	return players, nil
+}
+
+// KickPlayer 按SteamID踢出玩家
+func (c *Client) KickPlayer(ctx context.Context, steamID string) error {
+	return c.playerCommand(ctx, "KickPlayer", steamID, "Kicked:")
+}
+
+// BanPlayer 按SteamID封禁玩家
+func (c *Client) BanPlayer(ctx context.Context, steamID string) error {
+	return c.playerCommand(ctx, "BanPlayer", steamID, "Banned:")
+}
+
+// UnBanPlayer 按SteamID解除封禁
+func (c *Client) UnBanPlayer(ctx context.Context, steamID string) error {
+	return c.playerCommand(ctx, "UnBanPlayer", steamID, "")
+}
+
+// TeleportToPlayer 把管理员传送到玩家身边,仅在游戏内以管理员身份执行时有效
+func (c *Client) TeleportToPlayer(ctx context.Context, steamID string) error {
+	return c.playerCommand(ctx, "TeleportToPlayer", steamID, "")
+}
+
+// TeleportToMe 把玩家传送到管理员身边,仅在游戏内以管理员身份执行时有效
+func (c *Client) TeleportToMe(ctx context.Context, steamID string) error {
+	return c.playerCommand(ctx, "TeleportToMe", steamID, "")
+}
+
+// Broadcast 向全服发送广播,服务端只接受一个参数,空格会被替换为下划线
+func (c *Client) Broadcast(ctx context.Context, message string) error {
+	if strings.TrimSpace(message) == "" {
+		return &CommandError{Command: "Broadcast", Kind: ErrInvalidArgument}
+	}
+
+	_, err := c.expect(ctx, "Broadcast "+strings.ReplaceAll(message, " ", "_"), "Broadcasted:")
+	return err
+}
+
+// Save 立即保存世界
+func (c *Client) Save(ctx context.Context) error {
+	_, err := c.expect(ctx, "Save", "")
+	return err
+}
+
+// Shutdown 在seconds秒后关闭服务端,并向玩家显示message
+func (c *Client) Shutdown(ctx context.Context, seconds int, message string) error {
+	if seconds < 0 {
+		return &CommandError{Command: "Shutdown", Kind: ErrInvalidArgument}
+	}
+
+	command := "Shutdown " + strconv.Itoa(seconds)
+	if message = strings.TrimSpace(message); message != "" {
+		command += " " + strings.ReplaceAll(message, " ", "_")
+	}
+
+	_, err := c.expect(ctx, command, "")
+	return err
+}
+
+// DoExit 立即关闭服务端。服务端退出时可能直接断开连接,此时视为成功。
+func (c *Client) DoExit(ctx context.Context) error {
+	_, err := c.expect(ctx, "DoExit", "")
+	if err != nil && errors.Is(err, ErrTransport) && errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// playerCommand 执行以SteamID为参数的指令
+func (c *Client) playerCommand(ctx context.Context, name, steamID, prefix string) error {
+	steamID = strings.TrimSpace(steamID)
+	if steamID == "" || strings.ContainsAny(steamID, " \t\r\n") || steamID == InvalidField {
+		return &CommandError{Command: name, Kind: ErrInvalidArgument}
+	}
+
+	_, err := c.expect(ctx, name+" "+steamID, prefix)
+	return err
+}
+
+// expect 执行指令并校验响应。prefix为空时,只要服务端没有返回失败即视为成功。
+func (c *Client) expect(ctx context.Context, command, prefix string) (string, error) {
+	response, err := c.execute(ctx, command)
+	if err != nil {
+		return response, err
+	}
+
+	if prefix != "" && !strings.HasPrefix(response, prefix) {
+		return response, &CommandError{Command: command, Response: response, Kind: ErrUnexpectedResponse}
+	}
+
+	return response, nil
+}
+
+// execute 发送指令并把失败响应归类为对应的错误
+func (c *Client) execute(ctx context.Context, command string) (string, error) {
+	response, err := c.exec.ExecuteContext(ctx, command)
+	response = strings.TrimSpace(response)
+	if err != nil {
+		return response, &CommandError{Command: command, Response: response, Kind: ErrTransport, Err: markNotSent(err)}
+	}
+
+	if kind := classifyFailure(response); kind != nil {
+		return response, &CommandError{Command: command, Response: response, Kind: kind}
+	}
+
+	return response, nil
+}
+
+// markNotSent 连接或认证失败时指令还没有发出,用ErrNotSent标记,以便安全地改用其他后端重试
+func markNotSent(err error) error {
+	var opErr *net.OpError
+	if (errors.As(err, &opErr) && opErr.Op == "dial") || errors.Is(err, rcon.ErrAuthFailed) || errors.Is(err, rcon.ErrInvalidAuthResponse) {
+		return fmt.Errorf("%w: %w", ErrNotSent, err)
+	}
+	return err
+}
+
+// classifyFailure 根据服务端响应判断指令是否失败
+func classifyFailure(response string) error {
+	lower := strings.ToLower(response)
+	switch {
+	case strings.HasPrefix(lower, "failed to find player"), strings.HasPrefix(lower, "player not found"):
+		return ErrPlayerNotFound
+	case strings.HasPrefix(lower, "failed"), strings.HasPrefix(lower, "unknown command"):
+		return ErrCommandFailed
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package palworld
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/gorcon/rcon"
+	"github.com/gorcon/rcon/rcontest"
+)
+
+const testPassword = "password"
+
+// testHandler 模拟帕鲁服务端对各条指令的响应
+func testHandler(c *rcontest.Context) {
+	command := c.Request().Body()
+	name, arg, _ := strings.Cut(command, " ")
+
+	var response string
+	switch name {
+	case "Info":
+		response = "Welcome to Pal Server[v0.1.4.1] Test Server"
+	case "ShowPlayers":
+		response = "name,playeruid,steamid\n" +
+			"Alice,1234,76561190000000001\n" +
+			"Bob\u0000,5678,76561190000000002\n"
+	case "KickPlayer", "BanPlayer", "UnBanPlayer", "TeleportToPlayer", "TeleportToMe":
+		switch arg {
+		case "76561190000000001":
+			prefix := map[string]string{"KickPlayer": "Kicked", "BanPlayer": "Banned", "UnBanPlayer": "Unbanned"}[name]
+			response = prefix + ": " + arg
+		case "garbage":
+			response = "???"
+		default:
+			response = "Failed to find player: " + arg
+		}
+	case "Broadcast":
+		response = "Broadcasted: " + arg
+	case "Save":
+		response = "Complete Save"
+	case "Shutdown":
+		if strings.HasPrefix(arg, "-") {
+			response = "Failed to shutdown"
+		} else {
+			response = "The server will shut down in " + arg
+		}
+	case "DoExit":
+		response = "Exited"
+	default:
+		response = "Unknown command"
+	}
+
+	_, _ = rcon.NewPacket(rcon.SERVERDATA_RESPONSE_VALUE, c.Request().ID, response).WriteTo(c.Conn())
+}
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+
+	server := rcontest.NewServer(
+		rcontest.SetSettings(rcontest.Settings{Password: testPassword}),
+		rcontest.SetCommandHandler(testHandler),
+	)
+	t.Cleanup(server.Close)
+
+	conn, err := rcon.Dial(server.Addr(), testPassword)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return NewClient(conn)
+}
+
+func TestClient_Info(t *testing.T) {
+	client := newTestClient(t)
+
+	info, err := client.Info(context.Background())
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+
+	want := ServerInfo{Version: "v0.1.4.1", Name: "Test Server"}
+	if info != want {
+		t.Errorf("Info = %+v, want %+v", info, want)
+	}
+}
+
+func TestClient_ShowPlayers(t *testing.T) {
+	client := newTestClient(t)
+
+	players, err := client.ShowPlayers(context.Background())
+	if err != nil {
+		t.Fatalf("ShowPlayers: %v", err)
+	}
+
+	want := []Player{
+		{Name: "Alice", PlayerUID: "1234", SteamID: "76561190000000001"},
+		{Name: InvalidField, PlayerUID: "5678", SteamID: "76561190000000002"},
+	}
+	if len(players) != len(want) {
+		t.Fatalf("got %d players, want %d", len(players), len(want))
+	}
+	for i := range want {
+		if players[i] != want[i] {
+			t.Errorf("players[%d] = %+v, want %+v", i, players[i], want[i])
+		}
+	}
+}
+
+func TestClient_Commands(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{"kick", func() error { return client.KickPlayer(ctx, "76561190000000001") }, nil},
+		{"kick not found", func() error { return client.KickPlayer(ctx, "76561190000000009") }, ErrPlayerNotFound},
+		{"kick unexpected", func() error { return client.KickPlayer(ctx, "garbage") }, ErrUnexpectedResponse},
+		{"kick empty", func() error { return client.KickPlayer(ctx, "") }, ErrInvalidArgument},
+		{"kick invalid field", func() error { return client.KickPlayer(ctx, InvalidField) }, ErrInvalidArgument},
+		{"ban", func() error { return client.BanPlayer(ctx, "76561190000000001") }, nil},
+		{"ban not found", func() error { return client.BanPlayer(ctx, "76561190000000009") }, ErrPlayerNotFound},
+		{"unban", func() error { return client.UnBanPlayer(ctx, "76561190000000001") }, nil},
+		{"teleport to player", func() error { return client.TeleportToPlayer(ctx, "76561190000000001") }, nil},
+		{"teleport to me", func() error { return client.TeleportToMe(ctx, "76561190000000009") }, ErrPlayerNotFound},
+		{"broadcast", func() error { return client.Broadcast(ctx, "hello world") }, nil},
+		{"broadcast empty", func() error { return client.Broadcast(ctx, "  ") }, ErrInvalidArgument},
+		{"save", func() error { return client.Save(ctx) }, nil},
+		{"shutdown", func() error { return client.Shutdown(ctx, 60, "bye bye") }, nil},
+		{"shutdown negative", func() error { return client.Shutdown(ctx, -1, "") }, ErrInvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got error %v, want %v", err, tt.want)
+			}
+
+			var commandErr *CommandError
+			if !errors.As(err, &commandErr) {
+				t.Fatalf("error %T is not *CommandError", err)
+			}
+		})
+	}
+}
+
+// closingExecutor 模拟服务端执行DoExit后直接断开连接
+type closingExecutor struct{}
+
+func (closingExecutor) ExecuteContext(context.Context, string) (string, error) {
+	return "", fmt.Errorf("rcon: read packet size: %w", io.EOF)
+}
+
+func TestClient_DoExit(t *testing.T) {
+	if err := newTestClient(t).DoExit(context.Background()); err != nil {
+		t.Fatalf("DoExit: %v", err)
+	}
+
+	if err := NewClient(closingExecutor{}).DoExit(context.Background()); err != nil {
+		t.Fatalf("DoExit with closed connection: %v", err)
+	}
+}
+
+func TestClient_TransportError(t *testing.T) {
+	client := newTestClient(t)
+	client.exec.(*rcon.Conn).Close()
+
+	err := client.Save(context.Background())
+	if !errors.Is(err, ErrTransport) {
+		t.Fatalf("got error %v, want %v", err, ErrTransport)
+	}
+}
+
+func TestClient_CanceledContext(t *testing.T) {
+	client := newTestClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.Info(ctx)
+	if !errors.Is(err, ErrTransport) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want transport error wrapping %v", err, context.Canceled)
+	}
+}
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		response string
+		want     error
+	}{
+		{"Complete Save", nil},
+		{"Broadcasted: find your pals at the base", nil},
+		{"Broadcasted: item not found", nil},
+		{"Failed to find player by SteamID: 76561190000000009", ErrPlayerNotFound},
+		{"Failed to find player: alice", ErrPlayerNotFound},
+		{"Failed to shutdown", ErrCommandFailed},
+		{"Failed to find save directory", ErrCommandFailed},
+		{"Unknown command: Foo", ErrCommandFailed},
+	}
+	for _, tt := range tests {
+		if got := classifyFailure(tt.response); got != tt.want {
+			t.Errorf("classifyFailure(%q) = %v, want %v", tt.response, got, tt.want)
+		}
+	}
+}
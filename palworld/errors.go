@@ -0,0 +1,57 @@
+package palworld
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidArgument 参数不合法,指令没有被发送到服务端
+	ErrInvalidArgument = errors.New("palworld: invalid argument")
+
+	// ErrTransport RCON连接、认证或读写失败,无法确定指令是否被执行
+	ErrTransport = errors.New("palworld: transport error")
+
+	// ErrNotSent 指令在送达服务端之前失败(连接失败、认证失败或REST接口拒绝了请求),一定没有被执行。
+	// 只作为传输错误的底层错误出现
+	ErrNotSent = errors.New("palworld: command not sent")
+
+	// ErrCommandFailed 服务端明确返回了执行失败
+	ErrCommandFailed = errors.New("palworld: command failed")
+
+	// ErrPlayerNotFound 指定的玩家不存在或不在线
+	ErrPlayerNotFound = errors.New("palworld: player not found")
+
+	// ErrUnexpectedResponse 服务端返回了无法识别的响应
+	ErrUnexpectedResponse = errors.New("palworld: unexpected response")
+)
+
+// CommandError 描述一次执行失败的指令,可以用errors.Is判断错误类别
+type CommandError struct {
+	// Command 发送的指令
+	Command string
+	// Response 服务端的原始响应,传输错误时可能为空
+	Response string
+	// Kind 错误类别,为上方定义的ErrXxx之一
+	Kind error
+	// Err 底层错误,仅传输错误时存在
+	Err error
+}
+
+func (e *CommandError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%v: %s: %v", e.Kind, e.Command, e.Err)
+	}
+	if e.Response != "" {
+		return fmt.Sprintf("%v: %s: %q", e.Kind, e.Command, e.Response)
+	}
+	return fmt.Sprintf("%v: %s", e.Kind, e.Command)
+}
+
+// Unwrap 同时暴露错误类别和底层错误
+func (e *CommandError) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
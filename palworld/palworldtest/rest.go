@@ -0,0 +1,199 @@
+package palworldtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+)
+
+// restEndpoint 官方REST API的一个接口,以及对应的RCON指令名称
+type restEndpoint struct {
+	method  string
+	command string
+}
+
+var restEndpoints = map[string]restEndpoint{
+	"info":     {http.MethodGet, "Info"},
+	"players":  {http.MethodGet, "ShowPlayers"},
+	"metrics":  {http.MethodGet, "Metrics"},
+	"settings": {http.MethodGet, "Settings"},
+	"announce": {http.MethodPost, "Broadcast"},
+	"kick":     {http.MethodPost, "KickPlayer"},
+	"ban":      {http.MethodPost, "BanPlayer"},
+	"unban":    {http.MethodPost, "UnBanPlayer"},
+	"save":     {http.MethodPost, "Save"},
+	"shutdown": {http.MethodPost, "Shutdown"},
+	"stop":     {http.MethodPost, "DoExit"},
+}
+
+// restRequest 各POST接口的请求体
+type restRequest struct {
+	Message  string `json:"message"`
+	UserID   string `json:"userid"`
+	WaitTime int    `json:"waittime"`
+}
+
+// StartREST 启动模拟的官方REST API并返回其地址,与RCON共享玩家列表、故障注入和指令记录。
+// 注入故障时使用对应的RCON指令名称,例如announce接口对应Broadcast。
+func (s *Server) StartREST() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rest == nil {
+		s.rest = httptest.NewServer(http.HandlerFunc(s.serveREST))
+	}
+	return s.rest.URL
+}
+
+// RESTURL 返回REST API地址,未启动时返回空字符串
+func (s *Server) RESTURL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rest == nil {
+		return ""
+	}
+	return s.rest.URL
+}
+
+// serveREST 按官方REST API的格式响应请求
+func (s *Server) serveREST(w http.ResponseWriter, r *http.Request) {
+	if !s.Running() {
+		// 游戏进程已经退出,REST API随之不可用
+		dropHTTP(w)
+		return
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok || username != palworld.RESTUsername || password != s.password {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	endpoint, ok := restEndpoints[strings.TrimPrefix(r.URL.Path, "/v1/api/")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != endpoint.method {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req restRequest
+	if r.Method == http.MethodPost && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	name := strings.ToLower(endpoint.command)
+	args := restArgs(name, req)
+	command := strings.TrimSpace(endpoint.command + " " + args)
+
+	if failure, failed := s.begin(name, command); failed {
+		if failure.Drop {
+			dropHTTP(w)
+			return
+		}
+		http.Error(w, failure.Response, http.StatusBadRequest)
+		return
+	}
+
+	switch name {
+	case "info":
+		s.mu.Lock()
+		info := map[string]string{"version": s.version, "servername": s.name, "description": "", "worldguid": ""}
+		s.mu.Unlock()
+		writeJSON(w, info)
+	case "showplayers":
+		writeJSON(w, map[string]interface{}{"players": s.restPlayers()})
+	case "metrics":
+		s.mu.Lock()
+		uptime := time.Since(s.startedAt)
+		metrics := palworld.Metrics{
+			ServerFPS:        60,
+			CurrentPlayerNum: len(s.players),
+			ServerFrameTime:  16.6,
+			MaxPlayerNum:     32,
+			Uptime:           int(uptime.Seconds()),
+			Days:             int(uptime.Hours() / 24),
+		}
+		s.mu.Unlock()
+		writeJSON(w, metrics)
+	case "settings":
+		s.mu.Lock()
+		settings := map[string]interface{}{"ServerName": s.name, "ServerPlayerMaxNum": 32, "RESTAPIEnabled": true}
+		s.mu.Unlock()
+		writeJSON(w, settings)
+	case "doexit":
+		w.WriteHeader(http.StatusOK)
+		go s.exit()
+	default:
+		// 其余接口与RCON指令的行为一致,失败时返回400
+		if response := s.execute(name, args); strings.HasPrefix(response, "Failed") {
+			http.Error(w, response, http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// restArgs 把REST请求体转换为对应RCON指令的参数
+func restArgs(name string, req restRequest) string {
+	switch name {
+	case "broadcast":
+		return req.Message
+	case "kickplayer", "banplayer", "unbanplayer":
+		return strings.TrimPrefix(req.UserID, "steam_")
+	case "shutdown":
+		return strings.TrimSpace(fmt.Sprintf("%d %s", req.WaitTime, req.Message))
+	}
+	return ""
+}
+
+// restPlayers 返回REST格式的在线玩家列表
+func (s *Server) restPlayers() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	players := make([]map[string]interface{}, 0, len(s.players))
+	for _, player := range s.players {
+		players = append(players, map[string]interface{}{
+			"name":        player.Name,
+			"accountName": player.Name,
+			"playerId":    player.PlayerUID,
+			"userId":      "steam_" + player.SteamID,
+			"ip":          "127.0.0.1",
+			"ping":        10,
+			"location_x":  0,
+			"location_y":  0,
+			"level":       1,
+		})
+	}
+	return players
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// dropHTTP 不返回响应直接断开连接
+func dropHTTP(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		panic("palworldtest: response writer does not support hijacking")
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		panic(fmt.Sprintf("palworldtest: hijack: %v", err))
+	}
+	conn.Close()
+}
@@ -0,0 +1,216 @@
+package palworldtest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+	"github.com/hoshinonyaruko/palworld-go/palworld/palworldtest"
+	"github.com/hoshinonyaruko/palworld-go/tool"
+)
+
+func TestRESTClient(t *testing.T) {
+	server := palworldtest.NewServer(palworldtest.WithPlayers(alice, bob))
+	defer server.Close()
+	client := palworld.NewRESTClient(server.StartREST(), server.Password(), nil)
+	ctx := context.Background()
+
+	info, err := client.Info(ctx)
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if info.Name != palworldtest.DefaultServerName || info.Version != palworldtest.DefaultVersion {
+		t.Errorf("Info = %+v", info)
+	}
+
+	players, err := client.ShowPlayers(ctx)
+	if err != nil {
+		t.Fatalf("ShowPlayers: %v", err)
+	}
+	if len(players) != 2 || players[0] != alice || players[1] != bob {
+		t.Fatalf("ShowPlayers = %+v", players)
+	}
+
+	metrics, err := client.Metrics(ctx)
+	if err != nil {
+		t.Fatalf("Metrics: %v", err)
+	}
+	if metrics.CurrentPlayerNum != 2 {
+		t.Errorf("CurrentPlayerNum = %d, want 2", metrics.CurrentPlayerNum)
+	}
+
+	settings, err := client.Settings(ctx)
+	if err != nil {
+		t.Fatalf("Settings: %v", err)
+	}
+	if settings["ServerName"] != palworldtest.DefaultServerName {
+		t.Errorf("Settings = %v", settings)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{"kick", func() error { return client.KickPlayer(ctx, alice.SteamID) }, nil},
+		{"kick not found", func() error { return client.KickPlayer(ctx, alice.SteamID) }, palworld.ErrPlayerNotFound},
+		{"kick empty", func() error { return client.KickPlayer(ctx, "") }, palworld.ErrInvalidArgument},
+		{"ban", func() error { return client.BanPlayer(ctx, bob.SteamID) }, nil},
+		{"unban", func() error { return client.UnBanPlayer(ctx, bob.SteamID) }, nil},
+		{"unban not banned", func() error { return client.UnBanPlayer(ctx, bob.SteamID) }, palworld.ErrPlayerNotFound},
+		{"broadcast", func() error { return client.Broadcast(ctx, "hello world") }, nil},
+		{"save", func() error { return client.Save(ctx) }, nil},
+		{"shutdown", func() error { return client.Shutdown(ctx, 300, "reboot") }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.want) {
+				t.Fatalf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if got := server.Broadcasts(); len(got) != 1 || got[0] != "hello world" {
+		t.Errorf("Broadcasts = %q", got)
+	}
+	if request, ok := server.ShutdownRequested(); !ok || request.Seconds != 300 || request.Message != "reboot" {
+		t.Errorf("ShutdownRequested = %+v, %v", request, ok)
+	}
+	if got := server.Saves(); got != 1 {
+		t.Errorf("Saves = %d, want 1", got)
+	}
+}
+
+func TestRESTClient_Errors(t *testing.T) {
+	server := palworldtest.NewServer()
+	defer server.Close()
+	url := server.StartREST()
+	ctx := context.Background()
+
+	if _, err := palworld.NewRESTClient(url, "wrong", nil).Info(ctx); !errors.Is(err, palworld.ErrTransport) {
+		t.Errorf("wrong password: got %v, want %v", err, palworld.ErrTransport)
+	}
+
+	client := palworld.NewRESTClient(url, server.Password(), nil)
+
+	server.InjectFailure("Save", 1, palworldtest.Failure{Response: "Failed to save"})
+	if err := client.Save(ctx); !errors.Is(err, palworld.ErrCommandFailed) {
+		t.Errorf("injected response: got %v, want %v", err, palworld.ErrCommandFailed)
+	}
+
+	// http客户端会自动重试被断开的GET请求,所以这里让故障一直生效
+	server.InjectFailure("Info", 0, palworldtest.Failure{Drop: true})
+	if _, err := client.Info(ctx); !errors.Is(err, palworld.ErrTransport) {
+		t.Errorf("injected drop: got %v, want %v", err, palworld.ErrTransport)
+	}
+	server.ClearFailures()
+
+	if err := client.DoExit(ctx); err != nil {
+		t.Fatalf("DoExit: %v", err)
+	}
+	waitStopped(t, server)
+	if _, err := client.Info(ctx); !errors.Is(err, palworld.ErrTransport) {
+		t.Errorf("after exit: got %v, want %v", err, palworld.ErrTransport)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	server := palworldtest.NewServer(palworldtest.WithPlayers(alice))
+	defer server.Close()
+	cfg := server.Config()
+	defer tool.GetRconPool(server.Addr(), server.Password()).Close()
+
+	// REST API认证失败属于传输错误,会回退到RCON
+	rest := palworld.NewRESTClient(server.StartREST(), "wrong", nil)
+	rconClient, err := tool.NewPalworldClient(cfg)
+	if err != nil {
+		t.Fatalf("NewPalworldClient: %v", err)
+	}
+	fallback := palworld.NewFallback(rest, rconClient)
+	ctx := context.Background()
+
+	players, err := fallback.ShowPlayers(ctx)
+	if err != nil {
+		t.Fatalf("ShowPlayers: %v", err)
+	}
+	if len(players) != 1 || players[0] != alice {
+		t.Fatalf("ShowPlayers = %+v", players)
+	}
+
+	// 服务端明确返回失败时不回退
+	fallback = palworld.NewFallback(palworld.NewRESTClient(server.RESTURL(), server.Password(), nil), rconClient)
+	server.InjectFailure("Save", 1, palworldtest.Failure{Response: "Failed to save"})
+	if err := fallback.Save(ctx); !errors.Is(err, palworld.ErrCommandFailed) {
+		t.Fatalf("got %v, want %v", err, palworld.ErrCommandFailed)
+	}
+	if got := server.Saves(); got != 0 {
+		t.Errorf("Saves = %d, want 0", got)
+	}
+}
+
+func TestFallback_NotIdempotent(t *testing.T) {
+	server := palworldtest.NewServer()
+	defer server.Close()
+	cfg := server.Config()
+	defer tool.GetRconPool(server.Addr(), server.Password()).Close()
+	rconClient, err := tool.NewPalworldClient(cfg)
+	if err != nil {
+		t.Fatalf("NewPalworldClient: %v", err)
+	}
+	url := server.StartREST()
+	ctx := context.Background()
+
+	// 认证失败时请求没有被执行,广播改用RCON发送
+	fallback := palworld.NewFallback(palworld.NewRESTClient(url, "wrong", nil), rconClient)
+	if err := fallback.Broadcast(ctx, "hello"); err != nil {
+		t.Fatalf("Broadcast: %v", err)
+	}
+	if got := server.Broadcasts(); len(got) != 1 {
+		t.Fatalf("Broadcasts = %v", got)
+	}
+
+	// 超时时无法确定广播是否已经发出,不再用RCON重发
+	server.SetLatency(300 * time.Millisecond)
+	slow := palworld.NewRESTClient(url, server.Password(), &http.Client{Timeout: 50 * time.Millisecond})
+	fallback = palworld.NewFallback(slow, rconClient)
+	if err := fallback.Broadcast(ctx, "again"); !errors.Is(err, palworld.ErrTransport) {
+		t.Fatalf("got %v, want %v", err, palworld.ErrTransport)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if got := server.Broadcasts(); len(got) != 2 {
+		t.Errorf("Broadcasts = %v, want the timed out broadcast exactly once", got)
+	}
+}
+
+func TestNewServerClient(t *testing.T) {
+	server := palworldtest.NewServer(palworldtest.WithPlayers(alice))
+	defer server.Close()
+	server.StartREST()
+	defer tool.GetRconPool(server.Addr(), server.Password()).Close()
+
+	for _, backend := range []string{tool.BackendRcon, tool.BackendRest, tool.BackendAuto} {
+		t.Run(backend, func(t *testing.T) {
+			cfg := server.Config()
+			cfg.Backend = backend
+
+			players, err := tool.ShowPlayers(cfg)
+			if err != nil {
+				t.Fatalf("ShowPlayers: %v", err)
+			}
+			if len(players) != 1 || players[0]["steamid"] != alice.SteamID {
+				t.Fatalf("ShowPlayers = %v", players)
+			}
+		})
+	}
+
+	// REST端口不可用时auto回退到RCON
+	cfg := server.Config()
+	cfg.Backend = tool.BackendAuto
+	cfg.RestApiPort = 1
+	if _, err := tool.ShowPlayers(cfg); err != nil {
+		t.Fatalf("auto fallback: %v", err)
+	}
+}
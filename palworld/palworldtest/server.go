@@ -0,0 +1,493 @@
+// Package palworldtest 提供一个模拟的帕鲁服务端,用于在没有游戏本体的情况下对守护进程、白名单、机器人和网页接口做端到端测试。
+// 模拟服务端基于rcontest,维护一份可控的玩家列表,记录收到的指令,并支持延迟和故障注入。
+package palworldtest
+
+import (
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorcon/rcon/rcontest"
+	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+)
+
+const (
+	// DefaultPassword 默认的管理员密码
+	DefaultPassword = "password"
+	// DefaultServerName 默认的服务器名称
+	DefaultServerName = "Palworld Test Server"
+	// DefaultVersion 默认的服务端版本
+	DefaultVersion = "v0.1.5.0"
+)
+
+// Failure 描述一次注入的故障
+type Failure struct {
+	// Response 非空时代替正常响应返回给客户端,指令不会生效
+	Response string
+	// Drop 为true时直接断开连接,不返回响应
+	Drop bool
+	// Delay 在响应前额外等待的时间,可以用来模拟超时
+	Delay time.Duration
+}
+
+// ShutdownRequest 记录一次Shutdown指令
+type ShutdownRequest struct {
+	Seconds int
+	Message string
+	At      time.Time
+}
+
+// injectedFailure 一条注入的故障,remaining为0表示一直生效
+type injectedFailure struct {
+	failure   Failure
+	remaining int
+}
+
+// Server 模拟的帕鲁服务端
+type Server struct {
+	password string
+	name     string
+	version  string
+
+	mu         sync.Mutex
+	rcon       *rcontest.Server
+	addr       string
+	conns      map[net.Conn]struct{}
+	players    []palworld.Player
+	banned     map[string]bool
+	broadcasts []string
+	commands   []string
+	saves      int
+	shutdown   *ShutdownRequest
+	exitTimer  *time.Timer
+	running    bool
+	startedAt  time.Time
+	rest       *httptest.Server
+	latency    time.Duration
+	failures   map[string]*injectedFailure
+}
+
+// Option 修改模拟服务端的初始设置
+type Option func(s *Server)
+
+// WithPassword 设置管理员密码
+func WithPassword(password string) Option {
+	return func(s *Server) {
+		s.password = password
+	}
+}
+
+// WithServerName 设置Info指令返回的服务器名称
+func WithServerName(name string) Option {
+	return func(s *Server) {
+		s.name = name
+	}
+}
+
+// WithVersion 设置Info指令返回的服务端版本
+func WithVersion(version string) Option {
+	return func(s *Server) {
+		s.version = version
+	}
+}
+
+// WithPlayers 设置初始在线玩家
+func WithPlayers(players ...palworld.Player) Option {
+	return func(s *Server) {
+		s.players = append(s.players, players...)
+	}
+}
+
+// WithLatency 设置每条指令的响应延迟
+func WithLatency(latency time.Duration) Option {
+	return func(s *Server) {
+		s.latency = latency
+	}
+}
+
+// NewServer 创建并启动一个监听在本地回环地址上的模拟服务端,用完后需要调用Close
+func NewServer(options ...Option) *Server {
+	s := &Server{
+		password: DefaultPassword,
+		name:     DefaultServerName,
+		version:  DefaultVersion,
+		conns:    make(map[net.Conn]struct{}),
+		banned:   make(map[string]bool),
+		failures: make(map[string]*injectedFailure),
+	}
+	for _, option := range options {
+		option(s)
+	}
+
+	s.mu.Lock()
+	s.startLocked(nil)
+	s.mu.Unlock()
+	return s
+}
+
+// startLocked 启动RCON监听,listener为nil时使用随机端口
+func (s *Server) startLocked(listener net.Listener) {
+	server := rcontest.NewUnstartedServer(
+		rcontest.SetSettings(rcontest.Settings{Password: s.password}),
+		rcontest.SetAuthHandler(s.handleAuth),
+		rcontest.SetCommandHandler(s.handleCommand),
+	)
+	if listener != nil {
+		server.Listener.Close()
+		server.Listener = listener
+	}
+	server.Start()
+
+	s.rcon = server
+	s.addr = server.Addr()
+	s.running = true
+	s.startedAt = time.Now()
+}
+
+// Addr 返回RCON监听地址
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addr
+}
+
+// Password 返回管理员密码
+func (s *Server) Password() string {
+	return s.password
+}
+
+// Config 返回一份指向该模拟服务端的配置,可以直接传给tool包的函数
+func (s *Server) Config() config.Config {
+	host, port, _ := net.SplitHostPort(s.Addr())
+	rconPort, _ := strconv.Atoi(port)
+	cfg := config.Config{
+		Address: host,
+		WorldSettings: &config.GameWorldSettings{
+			RconEnabled:   true,
+			RconPort:      rconPort,
+			AdminPassword: s.password,
+		},
+	}
+
+	if restURL := s.RESTURL(); restURL != "" {
+		_, port, _ = net.SplitHostPort(strings.TrimPrefix(restURL, "http://"))
+		cfg.RestApiPort, _ = strconv.Atoi(port)
+	}
+	return cfg
+}
+
+// Running 返回服务端是否仍在运行
+func (s *Server) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// Close 断开所有客户端并停止服务端,包括REST API
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.stopLocked()
+	rest := s.rest
+	s.rest = nil
+	s.mu.Unlock()
+
+	// httptest在关闭时会等待处理中的请求,不能持有锁
+	if rest != nil {
+		rest.Close()
+	}
+}
+
+// exit 模拟游戏进程退出,在线玩家全部离线。REST API随之不可用,直到Restart。
+func (s *Server) exit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.players = nil
+	s.stopLocked()
+}
+
+// Restart 在原来的地址上重新启动已经退出的服务端,玩家列表会被清空,封禁列表保留
+func (s *Server) Restart() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopLocked()
+
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("palworldtest: restart: %w", err)
+	}
+
+	s.players = nil
+	s.shutdown = nil
+	s.startLocked(listener)
+	return nil
+}
+
+// stopLocked 停止服务端。rcontest在关闭时会等待所有连接结束,所以先断开客户端。
+func (s *Server) stopLocked() {
+	if !s.running {
+		return
+	}
+	s.running = false
+
+	if s.exitTimer != nil {
+		s.exitTimer.Stop()
+		s.exitTimer = nil
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = make(map[net.Conn]struct{})
+
+	server := s.rcon
+	s.mu.Unlock()
+	server.Close()
+	s.mu.Lock()
+}
+
+// Join 模拟玩家加入,被封禁的玩家无法加入
+func (s *Server) Join(player palworld.Player) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.banned[player.SteamID] {
+		return false
+	}
+	s.removePlayerLocked(player.SteamID)
+	s.players = append(s.players, player)
+	return true
+}
+
+// Leave 模拟玩家离开
+func (s *Server) Leave(steamID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removePlayerLocked(steamID)
+}
+
+// Players 返回当前在线玩家
+func (s *Server) Players() []palworld.Player {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]palworld.Player(nil), s.players...)
+}
+
+// Banned 返回SteamID是否被封禁
+func (s *Server) Banned(steamID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.banned[steamID]
+}
+
+// Broadcasts 返回收到的广播内容
+func (s *Server) Broadcasts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.broadcasts...)
+}
+
+// Commands 返回收到的全部指令,包括被注入故障的指令
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Saves 返回Save指令成功执行的次数
+func (s *Server) Saves() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saves
+}
+
+// ShutdownRequested 返回最近一次Shutdown指令
+func (s *Server) ShutdownRequested() (ShutdownRequest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdown == nil {
+		return ShutdownRequest{}, false
+	}
+	return *s.shutdown, true
+}
+
+// SetLatency 修改每条指令的响应延迟
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = latency
+}
+
+// InjectFailure 让之后的times次command指令(不区分大小写)按failure失败,times为0时一直失败直到ClearFailures
+func (s *Server) InjectFailure(command string, times int, failure Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[strings.ToLower(command)] = &injectedFailure{failure: failure, remaining: times}
+}
+
+// ClearFailures 清除所有注入的故障
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = make(map[string]*injectedFailure)
+}
+
+// handleAuth 记录连接以便关闭服务端时断开客户端
+func (s *Server) handleAuth(c *rcontest.Context) {
+	s.mu.Lock()
+	s.conns[c.Conn()] = struct{}{}
+	s.mu.Unlock()
+
+	rcontest.AuthHandler(c)
+}
+
+// handleCommand 按真实服务端的格式响应指令
+func (s *Server) handleCommand(c *rcontest.Context) {
+	command := strings.TrimSpace(c.Request().Body())
+	name, args, _ := strings.Cut(command, " ")
+	name = strings.ToLower(name)
+	args = strings.TrimSpace(args)
+
+	if failure, failed := s.begin(name, command); failed {
+		if failure.Drop {
+			s.dropConn(c.Conn())
+			return
+		}
+		_ = c.WriteResponse(failure.Response)
+		return
+	}
+
+	if name == "doexit" {
+		// 真实服务端退出时不会返回响应,直接断开连接
+		go s.exit()
+		return
+	}
+
+	_ = c.WriteResponse(s.execute(name, args))
+}
+
+// begin 记录收到的指令,等待设定的延迟,并返回注入的故障
+func (s *Server) begin(name, command string) (Failure, bool) {
+	s.mu.Lock()
+	s.commands = append(s.commands, command)
+	latency := s.latency
+	failure, failed := s.takeFailureLocked(name)
+	s.mu.Unlock()
+
+	if failed {
+		latency += failure.Delay
+	}
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	return failure, failed
+}
+
+// takeFailureLocked 取出command对应的注入故障
+func (s *Server) takeFailureLocked(name string) (Failure, bool) {
+	injected, ok := s.failures[name]
+	if !ok {
+		return Failure{}, false
+	}
+	if injected.remaining > 0 {
+		injected.remaining--
+		if injected.remaining == 0 {
+			delete(s.failures, name)
+		}
+	}
+	return injected.failure, true
+}
+
+// execute 执行指令并返回响应
+func (s *Server) execute(name, args string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch name {
+	case "info":
+		return fmt.Sprintf("Welcome to Pal Server[%s] %s", s.version, s.name)
+	case "showplayers":
+		var b strings.Builder
+		b.WriteString("name,playeruid,steamid\n")
+		for _, player := range s.players {
+			fmt.Fprintf(&b, "%s,%s,%s\n", player.Name, player.PlayerUID, player.SteamID)
+		}
+		return b.String()
+	case "kickplayer":
+		if !s.removePlayerLocked(args) {
+			return "Failed to find player by SteamID: " + args
+		}
+		return "Kicked: " + args
+	case "banplayer":
+		if args == "" {
+			return "Failed to find player by SteamID: " + args
+		}
+		s.removePlayerLocked(args)
+		s.banned[args] = true
+		return "Banned: " + args
+	case "unbanplayer":
+		if !s.banned[args] {
+			return "Failed to find player by SteamID: " + args
+		}
+		delete(s.banned, args)
+		return "Unbanned: " + args
+	case "teleporttoplayer", "teleporttome":
+		if s.findPlayerLocked(args) < 0 {
+			return "Failed to find player by SteamID: " + args
+		}
+		return "Teleported: " + args
+	case "broadcast":
+		s.broadcasts = append(s.broadcasts, args)
+		return "Broadcasted: " + args
+	case "save":
+		s.saves++
+		return "Complete Save"
+	case "shutdown":
+		secondsArg, message, _ := strings.Cut(args, " ")
+		seconds, err := strconv.Atoi(secondsArg)
+		if err != nil || seconds < 0 {
+			return "Failed to parse shutdown seconds: " + secondsArg
+		}
+		s.shutdown = &ShutdownRequest{Seconds: seconds, Message: message, At: time.Now()}
+		if s.exitTimer != nil {
+			s.exitTimer.Stop()
+		}
+		s.exitTimer = time.AfterFunc(time.Duration(seconds)*time.Second, s.exit)
+		return fmt.Sprintf("The server will shut down in %d seconds. Please prepare to exit the game.", seconds)
+	default:
+		return fmt.Sprintf("Unknown command: %s", name)
+	}
+}
+
+// findPlayerLocked 返回玩家在列表中的位置,不存在时返回-1
+func (s *Server) findPlayerLocked(steamID string) int {
+	for i, player := range s.players {
+		if player.SteamID == steamID {
+			return i
+		}
+	}
+	return -1
+}
+
+// removePlayerLocked 从在线列表中移除玩家
+func (s *Server) removePlayerLocked(steamID string) bool {
+	i := s.findPlayerLocked(steamID)
+	if i < 0 {
+		return false
+	}
+	s.players = append(s.players[:i], s.players[i+1:]...)
+	return true
+}
+
+// dropConn 断开一个客户端连接
+func (s *Server) dropConn(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+
+	conn.Close()
+}
@@ -0,0 +1,223 @@
+package palworldtest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorcon/rcon"
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+	"github.com/hoshinonyaruko/palworld-go/palworld/palworldtest"
+	"github.com/hoshinonyaruko/palworld-go/tool"
+)
+
+var (
+	alice = palworld.Player{Name: "Alice", PlayerUID: "1001", SteamID: "76561190000000001"}
+	bob   = palworld.Player{Name: "Bob", PlayerUID: "1002", SteamID: "76561190000000002"}
+)
+
+func dial(t *testing.T, server *palworldtest.Server) (*palworld.Client, *rcon.Conn) {
+	t.Helper()
+
+	conn, err := rcon.Dial(server.Addr(), server.Password())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return palworld.NewClient(conn), conn
+}
+
+// waitStopped 等待模拟服务端退出
+func waitStopped(t *testing.T, server *palworldtest.Server) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Running() {
+		if time.Now().After(deadline) {
+			t.Fatal("server is still running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServer_Roster(t *testing.T) {
+	server := palworldtest.NewServer(palworldtest.WithPlayers(alice))
+	defer server.Close()
+	client, _ := dial(t, server)
+	ctx := context.Background()
+
+	if !server.Join(bob) {
+		t.Fatal("Join(bob) = false")
+	}
+
+	players, err := client.ShowPlayers(ctx)
+	if err != nil {
+		t.Fatalf("ShowPlayers: %v", err)
+	}
+	if len(players) != 2 || players[0] != alice || players[1] != bob {
+		t.Fatalf("ShowPlayers = %+v", players)
+	}
+
+	if err := client.KickPlayer(ctx, alice.SteamID); err != nil {
+		t.Fatalf("KickPlayer: %v", err)
+	}
+	if err := client.KickPlayer(ctx, alice.SteamID); !errors.Is(err, palworld.ErrPlayerNotFound) {
+		t.Fatalf("second KickPlayer: got %v, want %v", err, palworld.ErrPlayerNotFound)
+	}
+
+	if err := client.BanPlayer(ctx, bob.SteamID); err != nil {
+		t.Fatalf("BanPlayer: %v", err)
+	}
+	if server.Join(bob) {
+		t.Fatal("banned player joined")
+	}
+	if err := client.UnBanPlayer(ctx, bob.SteamID); err != nil {
+		t.Fatalf("UnBanPlayer: %v", err)
+	}
+	if !server.Join(bob) {
+		t.Fatal("unbanned player could not join")
+	}
+
+	if players := server.Players(); len(players) != 1 || players[0] != bob {
+		t.Fatalf("Players = %+v", players)
+	}
+}
+
+func TestServer_InfoSaveBroadcast(t *testing.T) {
+	server := palworldtest.NewServer(palworldtest.WithServerName("My World"))
+	defer server.Close()
+	client, _ := dial(t, server)
+	ctx := context.Background()
+
+	info, err := client.Info(ctx)
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if info.Name != "My World" || info.Version != palworldtest.DefaultVersion {
+		t.Errorf("Info = %+v", info)
+	}
+
+	if err := client.Save(ctx); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := client.Broadcast(ctx, "hello world"); err != nil {
+		t.Fatalf("Broadcast: %v", err)
+	}
+
+	if got := server.Saves(); got != 1 {
+		t.Errorf("Saves = %d, want 1", got)
+	}
+	if got := server.Broadcasts(); len(got) != 1 || got[0] != "hello_world" {
+		t.Errorf("Broadcasts = %q", got)
+	}
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	server := palworldtest.NewServer()
+	defer server.Close()
+	client, _ := dial(t, server)
+
+	if err := client.Shutdown(context.Background(), 0, "bye"); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	request, ok := server.ShutdownRequested()
+	if !ok || request.Seconds != 0 || request.Message != "bye" {
+		t.Fatalf("ShutdownRequested = %+v, %v", request, ok)
+	}
+
+	waitStopped(t, server)
+}
+
+func TestServer_DoExitAndRestart(t *testing.T) {
+	server := palworldtest.NewServer(palworldtest.WithPlayers(alice))
+	defer server.Close()
+	client, _ := dial(t, server)
+
+	if err := client.DoExit(context.Background()); err != nil {
+		t.Fatalf("DoExit: %v", err)
+	}
+
+	waitStopped(t, server)
+
+	if err := server.Restart(); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+
+	client, _ = dial(t, server)
+	players, err := client.ShowPlayers(context.Background())
+	if err != nil {
+		t.Fatalf("ShowPlayers after restart: %v", err)
+	}
+	if len(players) != 0 {
+		t.Errorf("players after restart = %+v", players)
+	}
+}
+
+func TestServer_FailureInjection(t *testing.T) {
+	server := palworldtest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+
+	t.Run("response", func(t *testing.T) {
+		client, _ := dial(t, server)
+		server.InjectFailure("Save", 1, palworldtest.Failure{Response: "Failed to save"})
+
+		if err := client.Save(ctx); !errors.Is(err, palworld.ErrCommandFailed) {
+			t.Fatalf("got %v, want %v", err, palworld.ErrCommandFailed)
+		}
+		if err := client.Save(ctx); err != nil {
+			t.Fatalf("Save after failure: %v", err)
+		}
+		if got := server.Saves(); got != 1 {
+			t.Errorf("Saves = %d, want 1", got)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		client, _ := dial(t, server)
+		server.InjectFailure("info", 1, palworldtest.Failure{Drop: true})
+
+		if _, err := client.Info(ctx); !errors.Is(err, palworld.ErrTransport) {
+			t.Fatalf("got %v, want %v", err, palworld.ErrTransport)
+		}
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		client, _ := dial(t, server)
+		server.SetLatency(200 * time.Millisecond)
+		defer server.SetLatency(0)
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		if _, err := client.Info(timeoutCtx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestServer_ToolPackage(t *testing.T) {
+	server := palworldtest.NewServer(palworldtest.WithPlayers(alice, bob))
+	defer server.Close()
+	cfg := server.Config()
+
+	players, err := tool.ShowPlayers(cfg)
+	if err != nil {
+		t.Fatalf("ShowPlayers: %v", err)
+	}
+	if len(players) != 2 || players[1]["steamid"] != bob.SteamID {
+		t.Fatalf("ShowPlayers = %v", players)
+	}
+
+	if err := tool.KickPlayer(cfg, bob.SteamID); err != nil {
+		t.Fatalf("KickPlayer: %v", err)
+	}
+	if players := server.Players(); len(players) != 1 {
+		t.Fatalf("Players after kick = %+v", players)
+	}
+
+	tool.GetRconPool(server.Addr(), server.Password()).Close()
+}
@@ -0,0 +1,236 @@
+package palworld
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// RESTUsername 官方REST API的basic auth用户名固定为admin,密码为AdminPassword
+	RESTUsername = "admin"
+	// DefaultRESTPort 官方REST API的默认端口
+	DefaultRESTPort = 8212
+
+	restPathPrefix = "/v1/api/"
+	steamIDPrefix  = "steam_"
+)
+
+// Metrics /v1/api/metrics的结果
+type Metrics struct {
+	ServerFPS        int     `json:"serverfps"`
+	CurrentPlayerNum int     `json:"currentplayernum"`
+	ServerFrameTime  float64 `json:"serverframetime"`
+	MaxPlayerNum     int     `json:"maxplayernum"`
+	Uptime           int     `json:"uptime"`
+	Days             int     `json:"days"`
+}
+
+// RESTClient 官方REST API客户端,新版本服务端在RESTAPIEnabled=True时提供
+type RESTClient struct {
+	baseURL  string
+	password string
+	http     *http.Client
+}
+
+// NewRESTClient 创建REST API客户端,baseURL形如http://127.0.0.1:8212,httpClient为nil时使用带超时的默认客户端
+func NewRESTClient(baseURL, password string, httpClient *http.Client) *RESTClient {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &RESTClient{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		password: password,
+		http:     httpClient,
+	}
+}
+
+// restInfo /v1/api/info的原始结构
+type restInfo struct {
+	Version     string `json:"version"`
+	ServerName  string `json:"servername"`
+	Description string `json:"description"`
+	WorldGUID   string `json:"worldguid"`
+}
+
+// restPlayer /v1/api/players中的一名玩家
+type restPlayer struct {
+	Name        string  `json:"name"`
+	AccountName string  `json:"accountName"`
+	PlayerID    string  `json:"playerId"`
+	UserID      string  `json:"userId"`
+	IP          string  `json:"ip"`
+	Ping        float64 `json:"ping"`
+	LocationX   float64 `json:"location_x"`
+	LocationY   float64 `json:"location_y"`
+	Level       int     `json:"level"`
+}
+
+// Info 查询服务端版本和名称
+func (c *RESTClient) Info(ctx context.Context) (ServerInfo, error) {
+	var info restInfo
+	if err := c.do(ctx, "Info", http.MethodGet, "info", nil, &info); err != nil {
+		return ServerInfo{}, err
+	}
+	return ServerInfo{Version: info.Version, Name: info.ServerName}, nil
+}
+
+// ShowPlayers 查询当前在线玩家
+func (c *RESTClient) ShowPlayers(ctx context.Context) ([]Player, error) {
+	var response struct {
+		Players []restPlayer `json:"players"`
+	}
+	if err := c.do(ctx, "ShowPlayers", http.MethodGet, "players", nil, &response); err != nil {
+		return nil, err
+	}
+
+	players := make([]Player, 0, len(response.Players))
+	for _, p := range response.Players {
+		players = append(players, Player{
+			Name:      p.Name,
+			PlayerUID: p.PlayerID,
+			SteamID:   strings.TrimPrefix(p.UserID, steamIDPrefix),
+		})
+	}
+	return players, nil
+}
+
+// Metrics 查询服务端性能指标,RCON没有对应的指令
+func (c *RESTClient) Metrics(ctx context.Context) (Metrics, error) {
+	var metrics Metrics
+	err := c.do(ctx, "Metrics", http.MethodGet, "metrics", nil, &metrics)
+	return metrics, err
+}
+
+// Settings 查询服务端当前生效的世界设定,RCON没有对应的指令
+func (c *RESTClient) Settings(ctx context.Context) (map[string]interface{}, error) {
+	settings := make(map[string]interface{})
+	err := c.do(ctx, "Settings", http.MethodGet, "settings", nil, &settings)
+	return settings, err
+}
+
+// KickPlayer 按SteamID踢出玩家
+func (c *RESTClient) KickPlayer(ctx context.Context, steamID string) error {
+	return c.playerCommand(ctx, "KickPlayer", "kick", steamID)
+}
+
+// BanPlayer 按SteamID封禁玩家
+func (c *RESTClient) BanPlayer(ctx context.Context, steamID string) error {
+	return c.playerCommand(ctx, "BanPlayer", "ban", steamID)
+}
+
+// UnBanPlayer 按SteamID解除封禁
+func (c *RESTClient) UnBanPlayer(ctx context.Context, steamID string) error {
+	return c.playerCommand(ctx, "UnBanPlayer", "unban", steamID)
+}
+
+// Broadcast 向全服发送广播,REST API支持空格,不需要替换
+func (c *RESTClient) Broadcast(ctx context.Context, message string) error {
+	if strings.TrimSpace(message) == "" {
+		return &CommandError{Command: "Broadcast", Kind: ErrInvalidArgument}
+	}
+	return c.do(ctx, "Broadcast", http.MethodPost, "announce", map[string]interface{}{"message": message}, nil)
+}
+
+// Save 立即保存世界
+func (c *RESTClient) Save(ctx context.Context) error {
+	return c.do(ctx, "Save", http.MethodPost, "save", nil, nil)
+}
+
+// Shutdown 在seconds秒后关闭服务端,并向玩家显示message
+func (c *RESTClient) Shutdown(ctx context.Context, seconds int, message string) error {
+	if seconds < 0 {
+		return &CommandError{Command: "Shutdown", Kind: ErrInvalidArgument}
+	}
+	body := map[string]interface{}{"waittime": seconds, "message": message}
+	return c.do(ctx, "Shutdown", http.MethodPost, "shutdown", body, nil)
+}
+
+// DoExit 立即关闭服务端。服务端退出时可能来不及返回响应,此时视为成功。
+func (c *RESTClient) DoExit(ctx context.Context) error {
+	err := c.do(ctx, "DoExit", http.MethodPost, "stop", nil, nil)
+	if err != nil && errors.Is(err, ErrTransport) && errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// playerCommand 执行以SteamID为参数的指令,REST API使用带steam_前缀的userid
+func (c *RESTClient) playerCommand(ctx context.Context, command, endpoint, steamID string) error {
+	steamID = strings.TrimSpace(steamID)
+	if steamID == "" || strings.ContainsAny(steamID, " \t\r\n") || steamID == InvalidField {
+		return &CommandError{Command: command, Kind: ErrInvalidArgument}
+	}
+	if !strings.HasPrefix(steamID, steamIDPrefix) {
+		steamID = steamIDPrefix + steamID
+	}
+
+	err := c.do(ctx, command, http.MethodPost, endpoint, map[string]interface{}{"userid": steamID}, nil)
+	if commandErr, ok := err.(*CommandError); ok && commandErr.Kind == ErrCommandFailed {
+		// 服务端对不存在的玩家返回400
+		commandErr.Kind = ErrPlayerNotFound
+	}
+	return err
+}
+
+// do 发送请求,成功时把响应解析到out中(out为nil时忽略响应内容)
+func (c *RESTClient) do(ctx context.Context, command, method, endpoint string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return &CommandError{Command: command, Kind: ErrInvalidArgument, Err: err}
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+restPathPrefix+endpoint, body)
+	if err != nil {
+		return &CommandError{Command: command, Kind: ErrTransport, Err: err}
+	}
+	req.SetBasicAuth(RESTUsername, c.password)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return &CommandError{Command: command, Kind: ErrTransport, Err: markNotSent(err)}
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &CommandError{Command: command, Kind: ErrTransport, Err: err}
+	}
+	response := strings.TrimSpace(string(data))
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		// 密码错误与RCON认证失败一样按传输错误处理,以便回退到另一种后端
+		return &CommandError{Command: command, Response: response, Kind: ErrTransport, Err: fmt.Errorf("%w: http status %d", ErrNotSent, resp.StatusCode)}
+	case resp.StatusCode == http.StatusNotFound:
+		// 旧版本服务端没有该接口
+		return &CommandError{Command: command, Response: response, Kind: ErrTransport, Err: fmt.Errorf("%w: http status %d", ErrNotSent, resp.StatusCode)}
+	case resp.StatusCode >= 500:
+		// 服务端内部错误,指令可能已经执行
+		return &CommandError{Command: command, Response: response, Kind: ErrTransport, Err: fmt.Errorf("http status %d", resp.StatusCode)}
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return &CommandError{Command: command, Response: response, Kind: ErrCommandFailed}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return &CommandError{Command: command, Response: response, Kind: ErrUnexpectedResponse, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package palworld
+
+import (
+	"context"
+	"errors"
+)
+
+// Server 帕鲁服务端的管理接口,RCON客户端(Client)和官方REST API客户端(RESTClient)都实现了该接口
+type Server interface {
+	Info(ctx context.Context) (ServerInfo, error)
+	ShowPlayers(ctx context.Context) ([]Player, error)
+	KickPlayer(ctx context.Context, steamID string) error
+	BanPlayer(ctx context.Context, steamID string) error
+	UnBanPlayer(ctx context.Context, steamID string) error
+	Broadcast(ctx context.Context, message string) error
+	Save(ctx context.Context) error
+	Shutdown(ctx context.Context, seconds int, message string) error
+	DoExit(ctx context.Context) error
+}
+
+var (
+	_ Server = (*Client)(nil)
+	_ Server = (*RESTClient)(nil)
+	_ Server = (*Fallback)(nil)
+)
+
+// Fallback 优先使用primary,当primary出现传输错误(连接失败、超时、认证失败)时改用secondary重试。
+// 服务端明确返回的失败不会触发重试。广播、踢人和关服等重复执行有副作用的指令只在确定没有发出时
+// (ErrNotSent)才重试,超时等无法确定是否已经执行的情况直接返回错误,避免重复广播或提前关服。
+type Fallback struct {
+	primary   Server
+	secondary Server
+}
+
+// NewFallback 创建一个带自动回退的Server
+func NewFallback(primary, secondary Server) *Fallback {
+	return &Fallback{primary: primary, secondary: secondary}
+}
+
+// Info 查询服务端版本和名称
+func (f *Fallback) Info(ctx context.Context) (ServerInfo, error) {
+	info, err := f.primary.Info(ctx)
+	if f.shouldFallback(ctx, err, true) {
+		return f.secondary.Info(ctx)
+	}
+	return info, err
+}
+
+// ShowPlayers 查询当前在线玩家
+func (f *Fallback) ShowPlayers(ctx context.Context) ([]Player, error) {
+	players, err := f.primary.ShowPlayers(ctx)
+	if f.shouldFallback(ctx, err, true) {
+		return f.secondary.ShowPlayers(ctx)
+	}
+	return players, err
+}
+
+// KickPlayer 按SteamID踢出玩家
+func (f *Fallback) KickPlayer(ctx context.Context, steamID string) error {
+	return f.do(ctx, false, func(s Server) error { return s.KickPlayer(ctx, steamID) })
+}
+
+// BanPlayer 按SteamID封禁玩家,重复封禁没有副作用
+func (f *Fallback) BanPlayer(ctx context.Context, steamID string) error {
+	return f.do(ctx, true, func(s Server) error { return s.BanPlayer(ctx, steamID) })
+}
+
+// UnBanPlayer 按SteamID解除封禁,重复解封没有副作用
+func (f *Fallback) UnBanPlayer(ctx context.Context, steamID string) error {
+	return f.do(ctx, true, func(s Server) error { return s.UnBanPlayer(ctx, steamID) })
+}
+
+// Broadcast 向全服发送广播
+func (f *Fallback) Broadcast(ctx context.Context, message string) error {
+	return f.do(ctx, false, func(s Server) error { return s.Broadcast(ctx, message) })
+}
+
+// Save 立即保存世界,重复保存没有副作用
+func (f *Fallback) Save(ctx context.Context) error {
+	return f.do(ctx, true, func(s Server) error { return s.Save(ctx) })
+}
+
+// Shutdown 在seconds秒后关闭服务端
+func (f *Fallback) Shutdown(ctx context.Context, seconds int, message string) error {
+	return f.do(ctx, false, func(s Server) error { return s.Shutdown(ctx, seconds, message) })
+}
+
+// DoExit 立即关闭服务端
+func (f *Fallback) DoExit(ctx context.Context) error {
+	return f.do(ctx, false, func(s Server) error { return s.DoExit(ctx) })
+}
+
+// do 执行指令,idempotent表示指令可以安全地重复执行
+func (f *Fallback) do(ctx context.Context, idempotent bool, call func(s Server) error) error {
+	err := call(f.primary)
+	if f.shouldFallback(ctx, err, idempotent) {
+		return call(f.secondary)
+	}
+	return err
+}
+
+// shouldFallback 只有传输错误才回退,调用方取消或超时时不再重试。
+// 不能重复执行的指令只在确定没有发出时回退
+func (f *Fallback) shouldFallback(ctx context.Context, err error, idempotent bool) bool {
+	if !errors.Is(err, ErrTransport) || ctx.Err() != nil {
+		return false
+	}
+	return idempotent || errors.Is(err, ErrNotSent)
+}
@@ -0,0 +1,162 @@
+// Package presence 定期拉取在线玩家列表,与上一次的结果比较,
+// 把玩家的加入和离开作为event.PlayerJoined和event.PlayerLeft发布到事件总线。
+package presence
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/event"
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+)
+
+// DefaultInterval 默认的拉取间隔
+const DefaultInterval = 30 * time.Second
+
+// Session 在线玩家本次加入的时间,离开后以event.PlayerLeft发布
+type Session struct {
+	Player palworld.Player `json:"player"`
+	Start  time.Time       `json:"start"`
+}
+
+// Fetcher 拉取当前在线玩家
+type Fetcher func(ctx context.Context) ([]palworld.Player, error)
+
+// Tracker 在线状态跟踪器
+type Tracker struct {
+	fetch    Fetcher
+	interval time.Duration
+	bus      *event.Bus
+
+	mu       sync.Mutex
+	sessions map[string]Session
+	// seeded 是否已经拿到过一次玩家列表
+	seeded bool
+}
+
+// NewTracker 创建跟踪器,interval不大于0时使用DefaultInterval,bus为nil时使用event.Default
+func NewTracker(fetch Fetcher, interval time.Duration, bus *event.Bus) *Tracker {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	if bus == nil {
+		bus = event.Default
+	}
+	return &Tracker{
+		fetch:    fetch,
+		interval: interval,
+		bus:      bus,
+		sessions: make(map[string]Session),
+	}
+}
+
+// Run 每隔interval拉取一次玩家列表,直到ctx被取消
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.Poll(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("获取在线玩家失败: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll 拉取一次玩家列表并发布变化。拉取失败时不改变任何状态,
+// 避免服务端短暂无响应时把所有人都判定为离开。
+func (t *Tracker) Poll(ctx context.Context) error {
+	players, err := t.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	t.Update(players, time.Now())
+	return nil
+}
+
+// Update 用新的玩家列表更新状态,发布并返回加入和离开事件。
+// 第一次更新只记录当前在线的玩家,不发布加入事件,因为无法知道他们是何时加入的。
+func (t *Tracker) Update(players []palworld.Player, now time.Time) []event.Event {
+	t.mu.Lock()
+
+	current := make(map[string]palworld.Player, len(players))
+	for _, player := range players {
+		current[key(player)] = player
+	}
+
+	var left, joined []event.Payload
+	for k, session := range t.sessions {
+		if _, ok := current[k]; ok {
+			continue
+		}
+		delete(t.sessions, k)
+		left = append(left, event.PlayerLeft{Player: session.Player, Start: session.Start, End: now})
+	}
+
+	for k, player := range current {
+		if session, ok := t.sessions[k]; ok {
+			// 名字等字段可能在之后的列表中才能正确解析
+			session.Player = player
+			t.sessions[k] = session
+			continue
+		}
+		t.sessions[k] = Session{Player: player, Start: now}
+		if t.seeded {
+			joined = append(joined, event.PlayerJoined{Player: player, Start: now})
+		}
+	}
+	t.seeded = true
+
+	t.mu.Unlock()
+
+	// map的遍历顺序是随机的,先离开后加入并按玩家名排序后发布,保证结果稳定
+	sort.Slice(left, func(i, j int) bool {
+		return left[i].(event.PlayerLeft).Player.Name < left[j].(event.PlayerLeft).Player.Name
+	})
+	sort.Slice(joined, func(i, j int) bool {
+		return joined[i].(event.PlayerJoined).Player.Name < joined[j].(event.PlayerJoined).Player.Name
+	})
+
+	events := make([]event.Event, 0, len(left)+len(joined))
+	for _, payload := range append(left, joined...) {
+		events = append(events, t.bus.PublishAt(payload, now))
+	}
+	return events
+}
+
+// Online 返回当前在线玩家的会话,按开始时间排序
+func (t *Tracker) Online() []Session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sessions := make([]Session, 0, len(t.sessions))
+	for _, session := range t.sessions {
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Start.Equal(sessions[j].Start) {
+			return sessions[i].Player.Name < sessions[j].Player.Name
+		}
+		return sessions[i].Start.Before(sessions[j].Start)
+	})
+	return sessions
+}
+
+// key 用于识别同一名玩家,SteamID无法解析时依次退回到PlayerUID和名字
+func key(player palworld.Player) string {
+	if player.SteamID != "" && player.SteamID != palworld.InvalidField {
+		return "steam:" + player.SteamID
+	}
+	if player.PlayerUID != "" && player.PlayerUID != palworld.InvalidField {
+		return "uid:" + player.PlayerUID
+	}
+	return "name:" + player.Name
+}
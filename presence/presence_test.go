@@ -0,0 +1,147 @@
+package presence_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/event"
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+	"github.com/hoshinonyaruko/palworld-go/palworld/palworldtest"
+	"github.com/hoshinonyaruko/palworld-go/presence"
+	"github.com/hoshinonyaruko/palworld-go/tool"
+)
+
+var (
+	alice = palworld.Player{Name: "Alice", PlayerUID: "1001", SteamID: "76561190000000001"}
+	bob   = palworld.Player{Name: "Bob", PlayerUID: "1002", SteamID: "76561190000000002"}
+	carol = palworld.Player{Name: "Carol", PlayerUID: "1003", SteamID: palworld.InvalidField}
+)
+
+func describe(events []event.Event) []string {
+	result := make([]string, len(events))
+	for i, e := range events {
+		switch data := e.Data.(type) {
+		case event.PlayerJoined:
+			result[i] = "joined " + data.Player.Name
+		case event.PlayerLeft:
+			result[i] = "left " + data.Player.Name
+		}
+	}
+	return result
+}
+
+func TestTracker_Update(t *testing.T) {
+	tracker := presence.NewTracker(nil, 0, event.NewBus(0))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		players []palworld.Player
+		want    []string
+	}{
+		// 第一次只记录已在线的玩家
+		{[]palworld.Player{alice}, nil},
+		{[]palworld.Player{alice, bob, carol}, []string{"joined Bob", "joined Carol"}},
+		{[]palworld.Player{alice, carol}, []string{"left Bob"}},
+		{nil, []string{"left Alice", "left Carol"}},
+		{[]palworld.Player{bob}, []string{"joined Bob"}},
+	}
+
+	for i, step := range steps {
+		now := start.Add(time.Duration(i) * time.Minute)
+		got := describe(tracker.Update(step.players, now))
+		if len(got) != len(step.want) {
+			t.Fatalf("step %d: events = %q, want %q", i, got, step.want)
+		}
+		for j := range got {
+			if got[j] != step.want[j] {
+				t.Fatalf("step %d: events = %q, want %q", i, got, step.want)
+			}
+		}
+	}
+
+	online := tracker.Online()
+	if len(online) != 1 || online[0].Player != bob || !online[0].Start.Equal(start.Add(4*time.Minute)) {
+		t.Fatalf("Online = %+v", online)
+	}
+}
+
+func TestTracker_SessionTimes(t *testing.T) {
+	tracker := presence.NewTracker(nil, 0, event.NewBus(0))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tracker.Update(nil, start)
+	tracker.Update([]palworld.Player{alice}, start.Add(time.Minute))
+	events := tracker.Update(nil, start.Add(31*time.Minute))
+
+	left := events[0].Data.(event.PlayerLeft)
+	if !left.Start.Equal(start.Add(time.Minute)) || !left.End.Equal(start.Add(31*time.Minute)) {
+		t.Errorf("left = %+v", left)
+	}
+	if got := left.Duration(); got != 30*time.Minute {
+		t.Errorf("Duration = %v, want 30m", got)
+	}
+}
+
+func TestTracker_PollError(t *testing.T) {
+	players := []palworld.Player{alice}
+	var fetchErr error
+	tracker := presence.NewTracker(func(ctx context.Context) ([]palworld.Player, error) {
+		return players, fetchErr
+	}, 0, event.NewBus(0))
+
+	ctx := context.Background()
+	if err := tracker.Poll(ctx); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+
+	fetchErr = errors.New("connection refused")
+	players = nil
+	if err := tracker.Poll(ctx); err == nil {
+		t.Fatal("Poll succeeded with a failing fetcher")
+	}
+	if online := tracker.Online(); len(online) != 1 {
+		t.Errorf("a failed poll changed the roster: %+v", online)
+	}
+}
+
+func TestTracker_Emulator(t *testing.T) {
+	server := palworldtest.NewServer(palworldtest.WithPlayers(alice))
+	defer server.Close()
+	defer tool.GetRconPool(server.Addr(), server.Password()).Close()
+
+	client, err := tool.NewServerClient(server.Config())
+	if err != nil {
+		t.Fatalf("NewServerClient: %v", err)
+	}
+
+	bus := event.NewBus(0)
+	received := make(chan event.Event, 10)
+	bus.Subscribe(func(e event.Event) { received <- e })
+
+	tracker := presence.NewTracker(client.ShowPlayers, 0, bus)
+	ctx := context.Background()
+	if err := tracker.Poll(ctx); err != nil {
+		t.Fatalf("first Poll: %v", err)
+	}
+
+	server.Join(bob)
+	server.Leave(alice.SteamID)
+	if err := tracker.Poll(ctx); err != nil {
+		t.Fatalf("second Poll: %v", err)
+	}
+
+	var got []string
+	for len(got) < 2 {
+		select {
+		case e := <-received:
+			got = append(got, describe([]event.Event{e})...)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out, events so far: %q", got)
+		}
+	}
+	if got[0] != "left Alice" || got[1] != "joined Bob" {
+		t.Errorf("events = %q", got)
+	}
+}
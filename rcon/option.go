@@ -6,6 +6,32 @@ import "time"
 type Settings struct {
 	dialTimeout time.Duration
 	deadline    time.Duration
+	multiPacket bool
+	encoding    Encoding
+}
+
+// Encoding defines how command and response bodies are encoded on the wire.
+type Encoding int
+
+const (
+	// EncodingPlain sends commands and reads responses as is.
+	EncodingPlain Encoding = iota
+
+	// EncodingBase64 sends base64 encoded commands and decodes base64 encoded
+	// responses. Responses which are not valid base64 are returned as is.
+	EncodingBase64
+)
+
+// String returns the name of the encoding.
+func (e Encoding) String() string {
+	switch e {
+	case EncodingPlain:
+		return "plain"
+	case EncodingBase64:
+		return "base64"
+	default:
+		return "unknown"
+	}
 }
 
 // DefaultSettings provides default deadline settings to Conn.
@@ -30,3 +56,22 @@ func SetDeadline(timeout time.Duration) Option {
 		s.deadline = timeout
 	}
 }
+
+// SetMultiPacket enables reassembly of responses which the server splits
+// into several packets. After each command an empty SERVERDATA_RESPONSE_VALUE
+// packet is sent, and response packets are read until the server mirrors it
+// back. The server must support mirroring, otherwise every command waits for
+// the read deadline.
+func SetMultiPacket(enabled bool) Option {
+	return func(s *Settings) {
+		s.multiPacket = enabled
+	}
+}
+
+// SetEncoding injects the encoding of command and response bodies to Settings.
+// The default is EncodingPlain.
+func SetEncoding(encoding Encoding) Option {
+	return func(s *Settings) {
+		s.encoding = encoding
+	}
+}
@@ -89,6 +89,31 @@ func (packet *Packet) WriteTo(w io.Writer) (int64, error) {
 	return buffer.WriteTo(w)
 }
 
+// WriteResponse writes body to w as SERVERDATA_RESPONSE_VALUE packets with the
+// given id. The body is split into several packets when it is longer than
+// chunkSize. A chunkSize <= 0 uses the largest body a packet can carry.
+func WriteResponse(w io.Writer, id int32, body string, chunkSize int) error {
+	if chunkSize <= 0 {
+		chunkSize = int(MaxPacketSize - MinPacketSize)
+	}
+
+	for {
+		chunk := body
+		if len(chunk) > chunkSize {
+			chunk = body[:chunkSize]
+		}
+
+		if _, err := NewPacket(SERVERDATA_RESPONSE_VALUE, id, chunk).WriteTo(w); err != nil {
+			return err
+		}
+
+		body = body[len(chunk):]
+		if body == "" {
+			return nil
+		}
+	}
+}
+
 // ReadFrom implements io.ReaderFrom for read a packet from r.
 func (packet *Packet) ReadFrom(r io.Reader) (int64, error) {
 	var n int64
@@ -157,3 +157,46 @@ func TestPacket_ReadFrom(t *testing.T) {
 		}
 	})
 }
+
+func TestWriteResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		chunkSize int
+		want      []string
+	}{
+		{"empty", "", 4, []string{""}},
+		{"single", "abcd", 4, []string{"abcd"}},
+		{"split", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"default size", "abc", 0, []string{"abc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := WriteResponse(&buffer, 42, tt.body, tt.chunkSize); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for buffer.Len() > 0 {
+				packet := &Packet{}
+				if _, err := packet.ReadFrom(&buffer); err != nil {
+					t.Fatal(err)
+				}
+				if packet.Type != SERVERDATA_RESPONSE_VALUE || packet.ID != 42 {
+					t.Errorf("packet type = %d, id = %d", packet.Type, packet.ID)
+				}
+				got = append(got, packet.Body())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -3,14 +3,13 @@
 package rcon
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/binary"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
-	"os"
-	"path/filepath"
 	"time"
 )
 
@@ -55,6 +54,12 @@ const (
 	// SERVERDATA_EXECCOMMAND_ID is any positive integer, chosen by the client
 	// (will be mirrored back in the server's response).
 	SERVERDATA_EXECCOMMAND_ID int32 = 0
+
+	// MultiPacketTerminatorID is the id of the empty SERVERDATA_RESPONSE_VALUE
+	// packet sent right after a command when multi-packet responses are enabled.
+	// The server mirrors it back only after every packet of the command response
+	// has been written, so it marks the end of a fragmented response.
+	MultiPacketTerminatorID int32 = 1
 )
 
 var (
@@ -94,29 +99,47 @@ var (
 	ErrMultiErrorOccurred = errors.New("an error occurred while handling another error")
 )
 
+// aLongTimeAgo is a non-zero time, far in the past, used for immediate
+// cancellation of network operations.
+var aLongTimeAgo = time.Unix(1, 0)
+
 // Conn is source RCON generic stream-oriented network connection.
 type Conn struct {
 	conn     net.Conn
 	settings Settings
+
+	// ctx is the context of the operation in progress. Its deadline limits
+	// read/write deadlines together with settings.deadline.
+	ctx context.Context
 }
 
 // Dial creates a new authorized Conn tcp dialer connection.
 func Dial(address string, password string, options ...Option) (*Conn, error) {
+	return DialContext(context.Background(), address, password, options...)
+}
+
+// DialContext creates a new authorized Conn tcp dialer connection using the
+// provided context. The context must be non-nil. Connecting and authentication
+// are aborted when the context is canceled or its deadline is exceeded,
+// whichever comes first with the configured timeouts.
+func DialContext(ctx context.Context, address string, password string, options ...Option) (*Conn, error) {
 	settings := DefaultSettings
 
 	for _, option := range options {
 		option(&settings)
 	}
 
-	conn, err := net.DialTimeout("tcp", address, settings.dialTimeout)
+	dialer := net.Dialer{Timeout: settings.dialTimeout}
+
+	conn, err := dialer.DialContext(ctx, "tcp", address)
 	if err != nil {
 		// Failed to open TCP connection to the server.
 		return nil, fmt.Errorf("rcon: %w", err)
 	}
 
-	client := Conn{conn: conn, settings: settings}
+	client := Conn{conn: conn, settings: settings, ctx: context.Background()}
 
-	if err := client.auth(password); err != nil {
+	if err := client.withContext(ctx, func() error { return client.auth(password) }); err != nil {
 		// Failed to auth conn with the server.
 		if err2 := client.Close(); err2 != nil {
 			return &client, fmt.Errorf("%w: %v. Previous error: %v", ErrMultiErrorOccurred, err2, err)
@@ -131,32 +154,13 @@ func Dial(address string, password string, options ...Option) (*Conn, error) {
 // Execute sends command type and it string to execute to the remote server,
 // creating a packet with a SERVERDATA_EXECCOMMAND_ID for the server to mirror,
 // and compiling its payload bytes in the appropriate order. The response body
-// is decompiled from bytes into a string for return.
-// Execute 根据条件执行命令
-func (c *Conn) Execute(command string, isUseDLL bool) (string, error) {
-	if isUseDLL {
-		// 尝试读取palguard.json文件来判断是否使用Base64执行命令
-		relativePath := "..\\PalServer\\Pal\\Binaries\\Win64\\palguard.json"
-		absPath, err := filepath.Abs(relativePath)
-		if err == nil {
-			if _, err := os.Stat(absPath); err == nil {
-				// 如果文件存在，则读取并解析JSON
-				jsonFile, err := os.ReadFile(absPath)
-				if err == nil {
-					var config map[string]interface{}
-					if json.Unmarshal(jsonFile, &config) == nil {
-						if rconBase64, ok := config["RCONbase64"].(bool); ok && rconBase64 {
-							fmt.Printf("rcon ExecuteWithBase64:%v\n", command)
-							// 如果RCONbase64为true，则使用Base64方式执行命令
-							return c.ExecuteWithBase64(command)
-						}
-					}
-				}
-			}
-		}
+// is decompiled from bytes into a string for return. The command and response
+// bodies are encoded according to the SetEncoding option.
+func (c *Conn) Execute(command string) (string, error) {
+	if c.settings.encoding == EncodingBase64 {
+		return c.ExecuteWithBase64(command)
 	}
 
-	// 原有逻辑
 	if command == "" {
 		return "", ErrCommandEmpty
 	}
@@ -165,20 +169,29 @@ func (c *Conn) Execute(command string, isUseDLL bool) (string, error) {
 		return "", ErrCommandTooLong
 	}
 
-	if err := c.write(SERVERDATA_EXECCOMMAND, SERVERDATA_EXECCOMMAND_ID, command); err != nil {
-		return "", err
-	}
-
-	response, err := c.read()
+	response, err := c.execute(command)
 	if err != nil {
-		return "", err
+		return response.Body(), err
 	}
 
-	if response.ID != SERVERDATA_EXECCOMMAND_ID {
-		return "", ErrInvalidPacketID
-	}
+	return response.Body(), nil
+}
+
+// ExecuteContext is like Execute but honours cancellation and the deadline of
+// the provided context. The context must be non-nil. When the context is done
+// before the response is read, the connection state is undefined and the
+// connection should be closed.
+func (c *Conn) ExecuteContext(ctx context.Context, command string) (string, error) {
+	var response string
+
+	err := c.withContext(ctx, func() error {
+		var err error
+		response, err = c.Execute(command)
+
+		return err
+	})
 
-	return response.Body(), nil // 假设response有Body()方法返回响应体
+	return response, err
 }
 
 // ExecuteWithBase64 sends a Base64 encoded command and decodes Base64 encoded response from the remote server.
@@ -193,17 +206,9 @@ func (c *Conn) ExecuteWithBase64(command string) (string, error) {
 		return "", ErrCommandTooLong
 	}
 
-	if err := c.write(SERVERDATA_EXECCOMMAND, SERVERDATA_EXECCOMMAND_ID, encodedCommand); err != nil {
-		return "", err
-	}
-
-	response, err := c.read()
+	response, err := c.execute(encodedCommand)
 	if err != nil {
-		return "", err
-	}
-
-	if response.ID != SERVERDATA_EXECCOMMAND_ID {
-		return "", ErrInvalidPacketID
+		return response.Body(), err
 	}
 
 	// 尝试解码响应体
@@ -232,6 +237,71 @@ func (c *Conn) Close() error {
 	return c.conn.Close()
 }
 
+// withContext runs fn with ctx as the context of the operation in progress.
+// If ctx is done while fn is blocked on the network, the connection deadline
+// is moved to the past to interrupt it and ctx.Err() is returned.
+func (c *Conn) withContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("rcon: %w", err)
+	}
+
+	c.ctx = ctx
+	defer func() { c.ctx = context.Background() }()
+
+	if ctx.Done() == nil {
+		return fn()
+	}
+
+	done := make(chan struct{})
+	interrupted := make(chan bool, 1)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.conn.SetDeadline(aLongTimeAgo)
+			interrupted <- true
+		case <-done:
+			interrupted <- false
+		}
+	}()
+
+	err := fn()
+
+	close(done)
+
+	if <-interrupted {
+		return fmt.Errorf("rcon: %w", ctx.Err())
+	}
+
+	// The context deadline is also applied as the I/O deadline, so the
+	// operation may time out slightly before the context reports it is done.
+	if deadline, ok := ctx.Deadline(); ok && err != nil && !time.Now().Before(deadline) {
+		return fmt.Errorf("rcon: %w", context.DeadlineExceeded)
+	}
+
+	return err
+}
+
+// ioDeadline returns the deadline for the next read or write operation: the
+// earliest of the configured deadline and the deadline of the current context.
+// The zero value means no deadline.
+func (c *Conn) ioDeadline() time.Time {
+	if c.ctx.Err() != nil {
+		return aLongTimeAgo
+	}
+
+	var deadline time.Time
+	if c.settings.deadline != 0 {
+		deadline = time.Now().Add(c.settings.deadline)
+	}
+
+	if ctxDeadline, ok := c.ctx.Deadline(); ok && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+		deadline = ctxDeadline
+	}
+
+	return deadline
+}
+
 // auth sends SERVERDATA_AUTH request to the remote server and
 // authenticates client for the next requests.
 func (c *Conn) auth(password string) error {
@@ -239,8 +309,8 @@ func (c *Conn) auth(password string) error {
 		return err
 	}
 
-	if c.settings.deadline != 0 {
-		if err := c.conn.SetReadDeadline(time.Now().Add(c.settings.deadline)); err != nil {
+	if deadline := c.ioDeadline(); !deadline.IsZero() {
+		if err := c.conn.SetReadDeadline(deadline); err != nil {
 			return fmt.Errorf("rcon: %w", err)
 		}
 	}
@@ -290,10 +360,75 @@ func (c *Conn) auth(password string) error {
 	return nil
 }
 
+// execute writes SERVERDATA_EXECCOMMAND packet with the given body and reads
+// the response. When multi-packet responses are enabled, an empty
+// SERVERDATA_RESPONSE_VALUE packet is written after the command and all
+// response packets are read until the server mirrors it back.
+func (c *Conn) execute(body string) (*Packet, error) {
+	if err := c.write(SERVERDATA_EXECCOMMAND, SERVERDATA_EXECCOMMAND_ID, body); err != nil {
+		return &Packet{}, err
+	}
+
+	if !c.settings.multiPacket {
+		response, err := c.read()
+		if err != nil {
+			return response, err
+		}
+
+		if response.ID != SERVERDATA_EXECCOMMAND_ID {
+			return &Packet{}, ErrInvalidPacketID
+		}
+
+		return response, nil
+	}
+
+	if err := c.write(SERVERDATA_RESPONSE_VALUE, MultiPacketTerminatorID, ""); err != nil {
+		return &Packet{}, err
+	}
+
+	return c.readMultiPacket()
+}
+
+// readMultiPacket reads SERVERDATA_RESPONSE_VALUE packets and concatenates
+// their bodies until the mirrored terminator packet is received.
+func (c *Conn) readMultiPacket() (*Packet, error) {
+	var body bytes.Buffer
+
+	received := false
+
+	for {
+		packet, err := c.read()
+		if err != nil {
+			return NewPacket(SERVERDATA_RESPONSE_VALUE, SERVERDATA_EXECCOMMAND_ID, body.String()), err
+		}
+
+		if packet.ID == MultiPacketTerminatorID {
+			// Some servers answer the terminator with more than one packet.
+			// Leftovers of the previous command arrive before any packet of the
+			// current response, so skip them.
+			if !received {
+				continue
+			}
+
+			break
+		}
+
+		if packet.ID != SERVERDATA_EXECCOMMAND_ID {
+			return &Packet{}, ErrInvalidPacketID
+		}
+
+		received = true
+
+		body.Write(packet.body)
+	}
+
+	return NewPacket(SERVERDATA_RESPONSE_VALUE, SERVERDATA_EXECCOMMAND_ID, body.String()), nil
+}
+
 // write creates packet and writes it to established tcp conn.
 func (c *Conn) write(packetType int32, packetID int32, command string) error {
-	if c.settings.deadline != 0 {
-		if err := c.conn.SetWriteDeadline(time.Now().Add(c.settings.deadline)); err != nil {
+	if deadline := c.ioDeadline(); !deadline.IsZero() {
+		if err := c.conn.SetWriteDeadline(deadline); err != nil {
 			return fmt.Errorf("rcon: %w", err)
 		}
 	}
@@ -306,9 +441,9 @@ func (c *Conn) write(packetType int32, packetID int32, command string) error {
 
 // read reads structured binary data from c.conn into packet.
 func (c *Conn) read() (*Packet, error) {
-	if c.settings.deadline != 0 {
-		if err := c.conn.SetReadDeadline(time.Now().Add(c.settings.deadline)); err != nil {
-			return nil, fmt.Errorf("rcon: %w", err)
+	if deadline := c.ioDeadline(); !deadline.IsZero() {
+		if err := c.conn.SetReadDeadline(deadline); err != nil {
+			return &Packet{}, fmt.Errorf("rcon: %w", err)
 		}
 	}
 
@@ -2,6 +2,8 @@ package rcon_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -154,6 +156,108 @@ func TestDial(t *testing.T) {
 	})
 }
 
+func TestDialContext(t *testing.T) {
+	server := rcontest.NewServer(rcontest.SetSettings(rcontest.Settings{Password: "password", AuthResponseDelay: 2 * time.Second}))
+	defer server.Close()
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := rcon.DialContext(ctx, server.Addr(), "password")
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got err %q, want %q", err, context.Canceled)
+		}
+	})
+
+	t.Run("context deadline during auth", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+
+		_, err := rcon.DialContext(ctx, server.Addr(), "password")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got err %q, want %q", err, context.DeadlineExceeded)
+		}
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("got elapsed %v, want less than %v", elapsed, time.Second)
+		}
+	})
+
+	t.Run("auth success", func(t *testing.T) {
+		conn, err := rcon.DialContext(context.Background(), server.Addr(), "password")
+		if err != nil {
+			t.Fatalf("got err %q, want %v", err, nil)
+		}
+
+		conn.Close()
+	})
+}
+
+func TestConn_ExecuteContext(t *testing.T) {
+	server := rcontest.NewUnstartedServer()
+	server.Settings.Password = "password"
+	server.Settings.CommandResponseDelay = 500 * time.Millisecond
+	server.SetCommandHandler(commandHandler)
+	server.Start()
+	defer server.Close()
+
+	t.Run("per call deadline", func(t *testing.T) {
+		conn, err := rcon.Dial(server.Addr(), "password")
+		if err != nil {
+			t.Fatalf("got err %q, want %v", err, nil)
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err = conn.ExecuteContext(ctx, "help")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got err %q, want %q", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("cancellation", func(t *testing.T) {
+		conn, err := rcon.Dial(server.Addr(), "password")
+		if err != nil {
+			t.Fatalf("got err %q, want %v", err, nil)
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		_, err = conn.ExecuteContext(ctx, "help")
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got err %q, want %q", err, context.Canceled)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		conn, err := rcon.Dial(server.Addr(), "password")
+		if err != nil {
+			t.Fatalf("got err %q, want %v", err, nil)
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		result, err := conn.ExecuteContext(ctx, "help")
+		if err != nil {
+			t.Fatalf("got err %q, want %v", err, nil)
+		}
+
+		resultWant := "lorem ipsum dolor sit amet"
+		if result != resultWant {
+			t.Fatalf("got result %q, want %q", result, resultWant)
+		}
+	})
+}
+
 func TestConn_Execute(t *testing.T) {
 	server := rcontest.NewUnstartedServer()
 	server.Settings.Password = "password"
@@ -314,6 +418,96 @@ func TestConn_Execute(t *testing.T) {
 		}
 	})
 
+	t.Run("multi packet response", func(t *testing.T) {
+		server := rcontest.NewUnstartedServer()
+		server.Settings.Password = "password"
+		server.Settings.ResponseChunkSize = 16
+		server.SetCommandHandler(func(c *rcontest.Context) {
+			c.WriteResponse(strings.Repeat("0123456789", 10))
+		})
+		server.Start()
+		defer server.Close()
+
+		conn, err := rcon.Dial(server.Addr(), "password", rcon.SetMultiPacket(true), rcon.SetDeadline(1*time.Second))
+		if err != nil {
+			t.Fatalf("got err %q, want %v", err, nil)
+		}
+		defer conn.Close()
+
+		resultWant := strings.Repeat("0123456789", 10)
+
+		// Execute twice to make sure the terminator of the first command
+		// does not leak into the next response.
+		for i := 0; i < 2; i++ {
+			result, err := conn.Execute("ShowPlayers")
+			if err != nil {
+				t.Fatalf("got err %q, want %v", err, nil)
+			}
+
+			if result != resultWant {
+				t.Fatalf("got result %q, want %q", result, resultWant)
+			}
+		}
+	})
+
+	t.Run("multi packet without mirroring", func(t *testing.T) {
+		server := rcontest.NewServer(
+			rcontest.SetSettings(rcontest.Settings{Password: "password"}),
+			rcontest.SetCommandHandler(commandHandler),
+			rcontest.SetResponseValueHandler(func(c *rcontest.Context) {}),
+		)
+		defer server.Close()
+
+		conn, err := rcon.Dial(server.Addr(), "password", rcon.SetMultiPacket(true), rcon.SetDeadline(100*time.Millisecond))
+		if err != nil {
+			t.Fatalf("got err %q, want %v", err, nil)
+		}
+		defer conn.Close()
+
+		result, err := conn.Execute("help")
+		wantErrContains := "i/o timeout"
+		if err == nil || !strings.Contains(err.Error(), wantErrContains) {
+			t.Errorf("got err %q, want to contain %q", err, wantErrContains)
+		}
+
+		resultWant := "lorem ipsum dolor sit amet"
+		if result != resultWant {
+			t.Fatalf("got result %q, want %q", result, resultWant)
+		}
+	})
+
+	t.Run("base64 encoding", func(t *testing.T) {
+		server := rcontest.NewServer(
+			rcontest.SetSettings(rcontest.Settings{Password: "password"}),
+			rcontest.SetCommandHandler(func(c *rcontest.Context) {
+				command, err := base64.StdEncoding.DecodeString(c.Request().Body())
+				if err != nil {
+					command = []byte("not base64")
+				}
+
+				body := base64.StdEncoding.EncodeToString([]byte("echo: " + string(command)))
+				rcon.NewPacket(rcon.SERVERDATA_RESPONSE_VALUE, c.Request().ID, body).WriteTo(c.Conn())
+			}),
+		)
+		defer server.Close()
+
+		conn, err := rcon.Dial(server.Addr(), "password", rcon.SetEncoding(rcon.EncodingBase64))
+		if err != nil {
+			t.Fatalf("got err %q, want %v", err, nil)
+		}
+		defer conn.Close()
+
+		result, err := conn.Execute("Broadcast hello")
+		if err != nil {
+			t.Fatalf("got err %q, want %v", err, nil)
+		}
+
+		resultWant := "echo: Broadcast hello"
+		if result != resultWant {
+			t.Fatalf("got result %q, want %q", result, resultWant)
+		}
+	})
+
 	if run := getVar("TEST_PZ_SERVER", "false"); run == "true" {
 		addr := getVar("TEST_PZ_SERVER_ADDR", "127.0.0.1:16260")
 		password := getVar("TEST_PZ_SERVER_PASSWORD", "docker")
@@ -28,3 +28,10 @@ func (c *Context) Conn() net.Conn {
 func (c *Context) Request() *rcon.Packet {
 	return c.request
 }
+
+// WriteResponse writes body to the client as SERVERDATA_RESPONSE_VALUE packets
+// with the request id. The body is split into several packets when it is longer
+// than Settings.ResponseChunkSize.
+func (c *Context) WriteResponse(body string) error {
+	return rcon.WriteResponse(c.conn, c.request.ID, body, c.server.Settings.ResponseChunkSize)
+}
@@ -15,16 +15,17 @@ import (
 // Server is an RCON server listening on a system-chosen port on the
 // local loopback interface, for use in end-to-end RCON tests.
 type Server struct {
-	Settings       Settings
-	Listener       net.Listener
-	addr           string
-	authHandler    HandlerFunc
-	commandHandler HandlerFunc
-	connections    map[net.Conn]struct{}
-	quit           chan bool
-	wg             sync.WaitGroup
-	mu             sync.Mutex
-	closed         bool
+	Settings             Settings
+	Listener             net.Listener
+	addr                 string
+	authHandler          HandlerFunc
+	commandHandler       HandlerFunc
+	responseValueHandler HandlerFunc
+	connections          map[net.Conn]struct{}
+	quit                 chan bool
+	wg                   sync.WaitGroup
+	mu                   sync.Mutex
+	closed               bool
 }
 
 // Settings contains configuration for RCON Server.
@@ -32,6 +33,11 @@ type Settings struct {
 	Password             string
 	AuthResponseDelay    time.Duration
 	CommandResponseDelay time.Duration
+
+	// ResponseChunkSize is the max body size of a single packet written by
+	// Context.WriteResponse. Longer responses are split into several packets.
+	// Zero means the protocol limit of 4096 bytes.
+	ResponseChunkSize int
 }
 
 // HandlerFunc defines a function to serve RCON requests.
@@ -58,6 +64,13 @@ func EmptyHandler(c *Context) {
 	_, _ = rcon.NewPacket(rcon.SERVERDATA_RESPONSE_VALUE, c.Request().ID, "").WriteTo(c.Conn())
 }
 
+// MirrorHandler responses to an empty SERVERDATA_RESPONSE_VALUE request with
+// an empty SERVERDATA_RESPONSE_VALUE packet with the same id. Clients use it to
+// detect the end of a multi-packet response.
+func MirrorHandler(c *Context) {
+	_, _ = rcon.NewPacket(rcon.SERVERDATA_RESPONSE_VALUE, c.Request().ID, "").WriteTo(c.Conn())
+}
+
 func newLocalListener() net.Listener {
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -81,11 +94,12 @@ func NewServer(options ...Option) *Server {
 // The caller should call Close when finished, to shut it down.
 func NewUnstartedServer(options ...Option) *Server {
 	server := Server{
-		Listener:       newLocalListener(),
-		authHandler:    AuthHandler,
-		commandHandler: EmptyHandler,
-		connections:    make(map[net.Conn]struct{}),
-		quit:           make(chan bool),
+		Listener:             newLocalListener(),
+		authHandler:          AuthHandler,
+		commandHandler:       EmptyHandler,
+		responseValueHandler: MirrorHandler,
+		connections:          make(map[net.Conn]struct{}),
+		quit:                 make(chan bool),
 	}
 
 	for _, option := range options {
@@ -105,6 +119,12 @@ func (s *Server) SetCommandHandler(handler HandlerFunc) {
 	s.commandHandler = handler
 }
 
+// SetResponseValueHandler injects HandlerFunc with SERVERDATA_RESPONSE_VALUE
+// requests processing.
+func (s *Server) SetResponseValueHandler(handler HandlerFunc) {
+	s.responseValueHandler = handler
+}
+
 // Start starts a server from NewUnstartedServer.
 func (s *Server) Start() {
 	if s.addr != "" {
@@ -195,7 +215,9 @@ func (s *Server) handle(conn net.Conn) {
 	for {
 		ctx, err := s.NewContext(conn)
 		if err != nil {
-			if !errors.Is(err, io.EOF) {
+			// The connection may have been closed by a handler to emulate a
+			// server dropping the client.
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
 				panic(fmt.Errorf("failed read request: %w", err))
 			}
 
@@ -215,6 +237,8 @@ func (s *Server) handle(conn net.Conn) {
 			}
 
 			s.commandHandler(ctx)
+		case rcon.SERVERDATA_RESPONSE_VALUE:
+			s.responseValueHandler(ctx)
 		}
 	}
 }
@@ -234,7 +258,7 @@ func (s *Server) closeConn(conn net.Conn) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if err := conn.Close(); err != nil {
+	if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
 		panic(fmt.Errorf("close conn error: %w", err))
 	}
 
@@ -101,4 +101,29 @@ func TestNewServer(t *testing.T) {
 			t.Errorf("got %q, want empty string", response)
 		}
 	})
+
+	t.Run("split response", func(t *testing.T) {
+		server := rcontest.NewServer(
+			rcontest.SetSettings(rcontest.Settings{Password: "password", ResponseChunkSize: 4}),
+			rcontest.SetCommandHandler(func(c *rcontest.Context) {
+				c.WriteResponse("abcdefghij")
+			}),
+		)
+		defer server.Close()
+
+		client, err := rcon.Dial(server.Addr(), "password", rcon.SetMultiPacket(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		response, err := client.Execute("whatever")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if response != "abcdefghij" {
+			t.Errorf("got %q, want abcdefghij", response)
+		}
+	})
 }
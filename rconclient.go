@@ -1,35 +1,46 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 
-	"github.com/gorcon/rcon"
+	"github.com/hoshinonyaruko/palworld-go/audit"
 	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/event"
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+	"github.com/hoshinonyaruko/palworld-go/restart"
+	"github.com/hoshinonyaruko/palworld-go/tool"
 )
 
 // RconClient 结构体，用于存储RCON连接和配置信息
 type RconClient struct {
-	Conn       *rcon.Conn
-	BackupTask *BackupTask
-	Config     *config.Config
+	Conn   *tool.Executor
+	Client palworld.Server
+	Config *config.Config
 }
 
-// NewRconClient 创建一个新的RCON客户端
-func NewRconClient(address, password string, BackupTask *BackupTask, config *config.Config) *RconClient {
-	conn, err := rcon.Dial(address, password)
+// NewRconClient 创建一个新的RCON客户端,底层连接来自共享连接池
+func NewRconClient(address, password string, config *config.Config) *RconClient {
+	conn, err := tool.NewExecutor(address, password, false)
 	if err != nil {
 		log.Printf("无法连接到RCON服务器: %v", err)
 		return nil
 	}
+	// 按config.Backend选择RCON或REST API
+	client, err := tool.NewServerClient(*config)
+	if err != nil {
+		log.Printf("无法创建服务端管理客户端: %v", err)
+		return nil
+	}
 	return &RconClient{
-		Conn:       conn,
-		BackupTask: BackupTask,
-		Config:     config,
+		Conn:   conn,
+		Client: client,
+		Config: config,
 	}
 }
 
-// Close 关闭RCON连接
+// Close 归还RCON连接
 func (client *RconClient) Close() {
 	err := client.Conn.Close()
 	if err != nil {
@@ -37,48 +48,48 @@ func (client *RconClient) Close() {
 	}
 }
 
-// 重启服务器
-func RestartServer(RconClient *RconClient) error {
-	if _, err := RconClient.Conn.Execute("broadcast Auto_Reboot_Initialized", RconClient.Config.UseDll); err != nil {
-		return fmt.Errorf("error broadcasting restart initialization: %w", err)
-	}
-	if _, err := RconClient.Conn.Execute("save", RconClient.Config.UseDll); err != nil {
-		return fmt.Errorf("error saving game state: %w", err)
-	}
-	if _, err := RconClient.Conn.Execute("shutdown 300 Server_is_going_to_reboot_in_5_minutes", RconClient.Config.UseDll); err != nil {
-		return fmt.Errorf("error executing shutdown: %w", err)
+// HandleMemoryUsage 发布MemoryThresholdExceeded事件,广播维护警告后经由重启流程保存、备份并重启。
+// 超过MemoryHardLimit时重启不等待维护窗口和玩家下线
+func HandleMemoryUsage(usage, threshold float64, RconClient *RconClient, config config.Config) {
+	critical := config.MemoryHardLimit > 0 && usage >= config.MemoryHardLimit
+	// 重启已经在等待或倒计时中,不重复广播
+	if run, ok := restart.Default.Current(); ok && (run.Critical || !critical) {
+		log.Printf("内存占用%.1f%%,重启已在进行中(%v)", usage, run.Reason)
+		return
 	}
-	return nil
-}
 
-// 发广播 重启维护
-func HandleMemoryUsage(threshold float64, RconClient *RconClient, config config.Config) {
+	ctx := audit.WithOrigin(context.Background(), audit.OriginMemoryCheck)
+	event.Publish(event.MemoryThresholdExceeded{Usage: usage, Threshold: threshold})
+
 	// 广播内存超阈值的警告
-	if _, err := RconClient.Conn.Execute(fmt.Sprintf("broadcast Memory_Is_Above_%v%%", threshold), config.UseDll); err != nil {
+	if err := RconClient.Client.Broadcast(ctx, fmt.Sprintf("Memory_Is_Above_%v%%", threshold)); err != nil {
 		log.Printf("Error broadcasting memory threshold alert: %v", err)
 	}
 
 	// 原有的方式发送广播
-	if _, err := RconClient.Conn.Execute("broadcast "+config.MaintenanceWarningMessage, config.UseDll); err != nil {
+	if err := RconClient.Client.Broadcast(ctx, config.MaintenanceWarningMessage); err != nil {
 		log.Printf("Error broadcasting: %v", err)
 	}
 
-	// 保存游戏状态
-	if _, err := RconClient.Conn.Execute("save", config.UseDll); err != nil {
-		log.Printf("Error saving game state: %v", err)
+	detail := fmt.Sprintf("内存占用%.1f%%,阈值%v%%", usage, threshold)
+	if critical {
+		detail = fmt.Sprintf("内存占用%.1f%%,超过硬上限%v%%", usage, config.MemoryHardLimit)
 	}
-
-	// 安排服务器重启
-	if _, err := RconClient.Conn.Execute("shutdown 60 Reboot_In_60_Seconds", config.UseDll); err != nil {
-		log.Printf("Error executing shutdown: %v", err)
+	// 按配置的倒计时广播后重启
+	_, err := restart.Default.Restart(restart.Request{
+		Reason:   restart.ReasonMemory,
+		Detail:   detail,
+		Delay:    restart.Default.DefaultDelay(),
+		Critical: critical,
+	})
+	if err != nil {
+		log.Printf("内存占用过高,重启失败: %v", err)
 	}
-
-	RconClient.BackupTask.RunBackup()
 }
 
-func Broadcast(message string, RconClient *RconClient, usedll bool) {
+func Broadcast(message string, RconClient *RconClient) {
 	// 广播
-	if _, err := RconClient.Conn.Execute("broadcast "+message, usedll); err != nil {
+	if err := RconClient.Client.Broadcast(audit.WithOrigin(context.Background(), audit.OriginBroadcast), message); err != nil {
 		log.Printf("Error broadcasting : %v", err)
 	}
 }
@@ -0,0 +1,297 @@
+// Package rconproxy 提供一个RCON代理,团队成员使用各自的令牌连接代理,
+// 代理按用户的指令白名单校验并记录每条指令,再通过共享的RCON连接转发给游戏服务端,
+// 这样既不会与palworld-go自身的连接冲突,也不需要分发管理员密码。
+package rconproxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorcon/rcon"
+	"github.com/hoshinonyaruko/palworld-go/audit"
+	"github.com/hoshinonyaruko/palworld-go/config"
+)
+
+const (
+	// 等待客户端认证的时间
+	authTimeout = 10 * time.Second
+	// 转发单条指令的超时时间
+	commandTimeout = 15 * time.Second
+	// 写回响应的超时时间,客户端不读取时断开
+	writeTimeout = 10 * time.Second
+)
+
+// DefaultIdleTimeout 认证后等待客户端下一条指令的默认时间,超时断开以释放连接
+const DefaultIdleTimeout = 5 * time.Minute
+
+// Executor 转发指令的目标,tool.Executor满足该接口
+type Executor interface {
+	ExecuteContext(ctx context.Context, command string) (string, error)
+}
+
+// User 代理的一个用户
+type User struct {
+	Name  string
+	Token string
+	// Commands 允许执行的指令,为空时不能执行任何指令,*允许所有指令
+	Commands []string
+}
+
+// Allowed 判断用户是否可以执行command,只比较指令名且不区分大小写
+func (u User) Allowed(command string) bool {
+	name, _, _ := strings.Cut(strings.TrimSpace(command), " ")
+	for _, allowed := range u.Commands {
+		if allowed == "*" || strings.EqualFold(allowed, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// UsersFromConfig 把配置中的用户转换为User,忽略没有令牌的用户
+func UsersFromConfig(users []*config.RconProxyUser) []User {
+	result := make([]User, 0, len(users))
+	for _, u := range users {
+		if u == nil || u.Token == "" {
+			continue
+		}
+		if len(u.Commands) == 0 {
+			log.Printf("RCON代理: 用户%v没有配置允许的指令,将拒绝它的所有指令,需要全部权限时请配置为*", u.Name)
+		}
+		result = append(result, User{Name: u.Name, Token: u.Token, Commands: u.Commands})
+	}
+	return result
+}
+
+// Proxy RCON代理
+type Proxy struct {
+	// IdleTimeout 认证后等待下一条指令的时间,为0时使用DefaultIdleTimeout
+	IdleTimeout time.Duration
+
+	exec  Executor
+	users []User
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// New 创建一个RCON代理
+func New(exec Executor, users []User) *Proxy {
+	return &Proxy{
+		exec:  exec,
+		users: users,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe 在addr上监听并处理连接,直到Close
+func (p *Proxy) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return p.Serve(listener)
+}
+
+// Serve 在listener上接受连接,直到Close
+func (p *Proxy) Serve(listener net.Listener) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		listener.Close()
+		return net.ErrClosed
+	}
+	p.listener = listener
+	p.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		p.conns[conn] = struct{}{}
+		p.wg.Add(1)
+		p.mu.Unlock()
+
+		go p.handle(conn)
+	}
+}
+
+// Addr 返回监听地址,尚未开始监听时返回nil
+func (p *Proxy) Addr() net.Addr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.listener == nil {
+		return nil
+	}
+	return p.listener.Addr()
+}
+
+// Close 停止监听并断开所有客户端
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	var err error
+	if p.listener != nil {
+		err = p.listener.Close()
+	}
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return err
+}
+
+// handle 处理一个客户端连接
+func (p *Proxy) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		p.mu.Lock()
+		delete(p.conns, conn)
+		p.mu.Unlock()
+		p.wg.Done()
+	}()
+
+	remote := conn.RemoteAddr().String()
+
+	var user *User
+
+	for {
+		// 未认证的客户端必须尽快认证,认证后空闲太久也会被断开
+		timeout := authTimeout
+		if user != nil {
+			timeout = p.idleTimeout()
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+
+		request := &rcon.Packet{}
+		if _, err := request.ReadFrom(conn); err != nil {
+			if user == nil && !errors.Is(err, net.ErrClosed) {
+				log.Printf("RCON代理: %v 未完成认证即断开: %v", remote, err)
+			} else if user != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+				log.Printf("RCON代理: 用户%v(%v)空闲超时,断开连接", user.Name, remote)
+			}
+			return
+		}
+
+		switch request.Type {
+		case rcon.SERVERDATA_AUTH:
+			user = p.authenticate(request.Body())
+			if user == nil {
+				log.Printf("RCON代理: %v 认证失败", remote)
+				// 认证失败时ID必须为-1,随后断开连接,避免暴力尝试
+				_ = writePacket(conn, rcon.SERVERDATA_AUTH_RESPONSE, -1, string([]byte{0x00}))
+				return
+			}
+
+			log.Printf("RCON代理: 用户%v(%v)已连接", user.Name, remote)
+			if err := writePacket(conn, rcon.SERVERDATA_RESPONSE_VALUE, request.ID, ""); err != nil {
+				return
+			}
+			if err := writePacket(conn, rcon.SERVERDATA_AUTH_RESPONSE, request.ID, ""); err != nil {
+				return
+			}
+
+		case rcon.SERVERDATA_EXECCOMMAND:
+			if user == nil {
+				log.Printf("RCON代理: %v 未认证即发送指令,断开连接", remote)
+				return
+			}
+			if err := p.execute(conn, *user, request); err != nil {
+				return
+			}
+
+		case rcon.SERVERDATA_RESPONSE_VALUE:
+			// 客户端用空包标记多包响应的结尾,原样返回
+			if err := writePacket(conn, rcon.SERVERDATA_RESPONSE_VALUE, request.ID, ""); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (p *Proxy) idleTimeout() time.Duration {
+	if p.IdleTimeout > 0 {
+		return p.IdleTimeout
+	}
+	return DefaultIdleTimeout
+}
+
+// authenticate 按令牌查找用户,使用常量时间比较
+func (p *Proxy) authenticate(token string) *User {
+	if token == "" {
+		return nil
+	}
+	for i := range p.users {
+		if subtle.ConstantTimeCompare([]byte(p.users[i].Token), []byte(token)) == 1 {
+			return &p.users[i]
+		}
+	}
+	return nil
+}
+
+// execute 校验并转发一条指令,返回写回客户端时的错误
+func (p *Proxy) execute(conn net.Conn, user User, request *rcon.Packet) error {
+	command := strings.TrimSpace(request.Body())
+
+	if !user.Allowed(command) {
+		log.Printf("RCON代理: 拒绝用户%v执行指令: %v", user.Name, command)
+		name, _, _ := strings.Cut(command, " ")
+		return writeResponse(conn, request.ID, fmt.Sprintf("Permission denied: %s", name))
+	}
+
+	ctx := audit.WithUser(audit.WithOrigin(context.Background(), audit.OriginProxy), user.Name)
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	start := time.Now()
+	response, err := p.exec.ExecuteContext(ctx, command)
+	if err != nil {
+		log.Printf("RCON代理: 用户%v执行指令失败(%v): %v: %v", user.Name, time.Since(start).Round(time.Millisecond), command, err)
+		if response == "" {
+			response = fmt.Sprintf("Error: %v", err)
+		}
+	} else {
+		log.Printf("RCON代理: 用户%v执行指令(%v): %v", user.Name, time.Since(start).Round(time.Millisecond), command)
+	}
+
+	return writeResponse(conn, request.ID, response)
+}
+
+// writeResponse 写回响应,过长时拆分为多个包
+func writeResponse(conn net.Conn, id int32, body string) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return rcon.WriteResponse(conn, id, body, 0)
+}
+
+func writePacket(conn net.Conn, packetType, id int32, body string) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := rcon.NewPacket(packetType, id, body).WriteTo(conn)
+	return err
+}
@@ -0,0 +1,161 @@
+package rconproxy_test
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorcon/rcon"
+	"github.com/hoshinonyaruko/palworld-go/audit"
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+	"github.com/hoshinonyaruko/palworld-go/palworld/palworldtest"
+	"github.com/hoshinonyaruko/palworld-go/rconproxy"
+	"github.com/hoshinonyaruko/palworld-go/tool"
+	"go.etcd.io/bbolt"
+)
+
+func startProxy(t *testing.T, users []rconproxy.User, idleTimeout time.Duration) (*palworldtest.Server, string) {
+	t.Helper()
+
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "audit.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("open audit db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := audit.InitDB(db); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+
+	server := palworldtest.NewServer(palworldtest.WithPlayers(palworld.Player{Name: "Alice", PlayerUID: "1", SteamID: "76561190000000001"}))
+	t.Cleanup(server.Close)
+
+	executor, err := tool.NewExecutor(server.Addr(), server.Password(), false)
+	if err != nil {
+		t.Fatalf("NewExecutor: %v", err)
+	}
+	t.Cleanup(func() { tool.GetRconPool(server.Addr(), server.Password()).Close() })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	proxy := rconproxy.New(executor, users)
+	proxy.IdleTimeout = idleTimeout
+	go proxy.Serve(listener)
+	t.Cleanup(func() { proxy.Close() })
+
+	return server, listener.Addr().String()
+}
+
+func TestProxy(t *testing.T) {
+	users := []rconproxy.User{
+		{Name: "admin", Token: "admin-token", Commands: []string{"*"}},
+		{Name: "mod", Token: "mod-token", Commands: []string{"ShowPlayers", "broadcast"}},
+	}
+	server, addr := startProxy(t, users, 0)
+
+	t.Run("wrong token", func(t *testing.T) {
+		_, err := rcon.Dial(addr, server.Password())
+		if !errors.Is(err, rcon.ErrAuthFailed) {
+			t.Fatalf("got err %v, want %v", err, rcon.ErrAuthFailed)
+		}
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		conn, err := rcon.Dial(addr, "admin-token")
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+
+		response, err := conn.Execute("Save")
+		if err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		if response != "Complete Save" {
+			t.Errorf("got response %q", response)
+		}
+		if server.Saves() != 1 {
+			t.Errorf("Saves = %d, want 1", server.Saves())
+		}
+
+		entries, _, err := audit.Query(audit.Filter{Origin: audit.OriginProxy, User: "admin"})
+		if err != nil || len(entries) != 1 || entries[0].Command != "Save" || entries[0].Response != "Complete Save" {
+			t.Errorf("audit entries = %+v, %v", entries, err)
+		}
+	})
+
+	t.Run("allowlist", func(t *testing.T) {
+		conn, err := rcon.Dial(addr, "mod-token")
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+
+		response, err := conn.Execute("showplayers")
+		if err != nil {
+			t.Fatalf("ShowPlayers: %v", err)
+		}
+		if !strings.Contains(response, "76561190000000001") {
+			t.Errorf("got response %q", response)
+		}
+
+		response, err = conn.Execute("KickPlayer 76561190000000001")
+		if err != nil {
+			t.Fatalf("KickPlayer: %v", err)
+		}
+		if !strings.HasPrefix(response, "Permission denied") {
+			t.Errorf("got response %q, want permission denied", response)
+		}
+		if len(server.Players()) != 1 {
+			t.Errorf("denied command reached the server")
+		}
+	})
+}
+
+func TestProxy_IdleTimeout(t *testing.T) {
+	users := []rconproxy.User{{Name: "admin", Token: "admin-token", Commands: []string{"*"}}}
+	_, addr := startProxy(t, users, 50*time.Millisecond)
+
+	conn, err := rcon.Dial(addr, "admin-token")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Execute("Save"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// 空闲超过IdleTimeout后代理断开连接
+	time.Sleep(200 * time.Millisecond)
+	if _, err := conn.Execute("Save"); err == nil {
+		t.Error("idle connection was not closed")
+	}
+}
+
+func TestUser_Allowed(t *testing.T) {
+	tests := []struct {
+		commands []string
+		command  string
+		want     bool
+	}{
+		{nil, "DoExit", false},
+		{[]string{}, "ShowPlayers", false},
+		{[]string{"*"}, "DoExit", true},
+		{[]string{"Broadcast"}, "broadcast hello", true},
+		{[]string{"Broadcast"}, "BroadcastX hello", false},
+		{[]string{"ShowPlayers"}, "DoExit", false},
+	}
+
+	for _, tt := range tests {
+		user := rconproxy.User{Commands: tt.commands}
+		if got := user.Allowed(tt.command); got != tt.want {
+			t.Errorf("Allowed(%q) with %q = %v, want %v", tt.command, tt.commands, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,713 @@
+// Package restart 统一的服务端重启流程:倒计时广播、保存、备份、正常关闭(超时后强制结束)、
+// 重新启动并确认服务端恢复响应。定时重启、内存超限、更新、手动重启和健康检查失败都经由这里,
+// 每次重启的原因和各步骤的结果都会被记录。
+package restart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/event"
+)
+
+// Reason 重启原因
+type Reason string
+
+const (
+	ReasonScheduled Reason = "scheduled"
+	ReasonMemory    Reason = "memory"
+	ReasonUpdate    Reason = "update"
+	ReasonManual    Reason = "manual"
+	ReasonHealth    Reason = "health"
+)
+
+// Automated 定时和内存超限触发的重启可以推迟到维护窗口内进行
+func (r Reason) Automated() bool {
+	return r == ReasonScheduled || r == ReasonMemory
+}
+
+// 步骤名称
+const (
+	StepWindow    = "window"
+	StepPlayers   = "players"
+	StepCountdown = "countdown"
+	StepSave      = "save"
+	StepBackup    = "backup"
+	StepStop      = "stop"
+	StepKill      = "kill"
+	StepPrepare   = "prepare"
+	StepStart     = "start"
+	StepVerify    = "verify"
+)
+
+// 状态
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// 默认参数
+const (
+	// DefaultMessage 倒计时广播,{time}替换为剩余时间。RCON广播不支持空格
+	DefaultMessage       = "Server_will_restart_in_{time}"
+	DefaultStepTimeout   = 30 * time.Second
+	DefaultExitTimeout   = 2 * time.Minute
+	DefaultVerifyTimeout = 5 * time.Minute
+	DefaultVerifyPoll    = 5 * time.Second
+	// DefaultDeferMessage 等待玩家下线时的广播,{time}替换为最长剩余等待时间
+	DefaultDeferMessage = "Restart_pending._Server_restarts_when_empty_or_in_{time}"
+	DefaultMaxDeferral  = time.Hour
+	DefaultDeferPoll    = 30 * time.Second
+	// HistorySize 保留的重启记录条数
+	HistorySize = 50
+	// killWait 强制结束后等待进程消失的时间
+	killWait     = 10 * time.Second
+	pollInterval = time.Second
+)
+
+// DefaultCountdown 默认在剩余这些时间时广播
+var DefaultCountdown = []time.Duration{10 * time.Minute, 5 * time.Minute, time.Minute, 30 * time.Second, 10 * time.Second}
+
+// ErrInProgress 已经有重启正在进行
+var ErrInProgress = errors.New("restart already in progress")
+
+// Request 一次重启请求
+type Request struct {
+	Reason Reason
+	// Detail 补充说明,如触发的内存占用或发起的用户
+	Detail string
+	// Delay 倒计时总时长,为0时跳过倒计时
+	Delay time.Duration
+	// Message 覆盖倒计时广播内容
+	Message string
+	// Force 跳过正常关闭直接结束进程,用于服务端已经无响应的情况
+	Force bool
+	// Critical 自动重启不等待维护窗口和玩家下线。正在等待的重启收到Critical请求时立即进行
+	Critical bool
+	// Prepare 进程退出后、重新启动前执行,如更新服务端
+	Prepare func(ctx context.Context) error
+}
+
+// Step 一个步骤的执行结果
+type Step struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Error string    `json:"error,omitempty"`
+}
+
+// Run 一次重启的记录
+type Run struct {
+	ID       uint64 `json:"id"`
+	Reason   Reason `json:"reason"`
+	Detail   string `json:"detail,omitempty"`
+	Delay    int    `json:"delay_seconds"`
+	Critical bool   `json:"critical,omitempty"`
+	// DeferredUntil 不在维护窗口内时,推迟到这个时间开始倒计时
+	DeferredUntil *time.Time `json:"deferred_until,omitempty"`
+	// PlayersDeadline 等待玩家下线的最晚时间,超过后即使有玩家在线也会重启
+	PlayersDeadline *time.Time `json:"players_deadline,omitempty"`
+	Status          string     `json:"status"`
+	Start           time.Time  `json:"start"`
+	End             *time.Time `json:"end,omitempty"`
+	Steps           []Step     `json:"steps"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// Orchestrator 重启编排器,同一时间只进行一次重启。各步骤的具体操作由调用方提供,为nil的步骤被跳过
+type Orchestrator struct {
+	// Countdown 倒计时中剩余这些时间时广播,为空时使用DefaultCountdown
+	Countdown []time.Duration
+	// Message 倒计时广播模板,为空时使用DefaultMessage
+	Message string
+	// StepTimeout 保存和正常关闭的超时时间
+	StepTimeout time.Duration
+	// ExitTimeout 正常关闭后等待进程退出的时间,超时后强制结束
+	ExitTimeout time.Duration
+	// VerifyTimeout 重新启动后等待服务端恢复响应的时间
+	VerifyTimeout time.Duration
+	VerifyPoll    time.Duration
+	// Window 返回t之后最近的维护窗口开始时间,t在窗口内时返回t。为nil时不限制
+	Window func(t time.Time) time.Time
+	// DeferForPlayers 自动重启等待服务器没有玩家在线,最多等待MaxDeferral
+	DeferForPlayers bool
+	MaxDeferral     time.Duration
+	// DeferWarnings 等待玩家下线时,在距离MaxDeferral结束还剩这些时间时广播
+	DeferWarnings []time.Duration
+	// DeferMessage 等待玩家下线时的广播模板,为空时使用DefaultDeferMessage
+	DeferMessage string
+	DeferPoll    time.Duration
+
+	Broadcast func(ctx context.Context, message string) error
+	Save      func(ctx context.Context) error
+	Backup    func(ctx context.Context) error
+	// Stop 请求服务端正常关闭
+	Stop func(ctx context.Context) error
+	Kill func() error
+	// Running 服务端进程是否存活
+	Running func() bool
+	Start   func(reason Reason) error
+	// Verify 检查一次服务端是否正常响应
+	Verify func(ctx context.Context) error
+	// Players 返回在线玩家数
+	Players func(ctx context.Context) (int, error)
+
+	bus *event.Bus
+
+	mu      sync.Mutex
+	nextID  uint64
+	current *Run
+	cancel  context.CancelFunc
+	// expedite 结束正在进行的等待(维护窗口、玩家下线)
+	expedite context.CancelFunc
+	history  []Run
+}
+
+// Default 全局使用的编排器,各步骤的操作在启动时设置
+var Default = New(nil)
+
+// New 创建编排器,bus为nil时使用event.Default
+func New(bus *event.Bus) *Orchestrator {
+	if bus == nil {
+		bus = event.Default
+	}
+	return &Orchestrator{bus: bus}
+}
+
+// DefaultDelay 倒计时中最长的时间,作为默认的倒计时总时长
+func (o *Orchestrator) DefaultDelay() time.Duration {
+	var longest time.Duration
+	for _, d := range o.countdown() {
+		if d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+// Restart 在后台开始一次重启,已经有重启正在进行时返回ErrInProgress。
+// 如果req是Critical且正在进行的重启还在等待,让它立即进行并返回它
+func (o *Orchestrator) Restart(req Request) (Run, error) {
+	if run, ok := o.escalate(req); ok {
+		return run, nil
+	}
+	ctx, run, err := o.begin(req)
+	if err != nil {
+		return Run{}, err
+	}
+	go o.execute(ctx, run, req)
+	return o.snapshot(run), nil
+}
+
+// Do 执行一次重启并等待完成
+func (o *Orchestrator) Do(req Request) (Run, error) {
+	ctx, run, err := o.begin(req)
+	if err != nil {
+		return Run{}, err
+	}
+	o.execute(ctx, run, req)
+
+	result := o.snapshot(run)
+	if result.Error != "" {
+		return result, errors.New(result.Error)
+	}
+	return result, nil
+}
+
+// Cancel 取消正在等待维护窗口或倒计时的重启,倒计时结束后无法取消
+func (o *Orchestrator) Cancel() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.current == nil || o.cancel == nil {
+		return false
+	}
+	o.cancel()
+	return true
+}
+
+// Current 返回正在进行的重启
+func (o *Orchestrator) Current() (Run, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.current == nil {
+		return Run{}, false
+	}
+	return o.copyRun(o.current), true
+}
+
+// History 返回最近的重启记录(按时间倒序)
+func (o *Orchestrator) History() []Run {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	result := make([]Run, 0, len(o.history))
+	for i := len(o.history) - 1; i >= 0; i-- {
+		result = append(result, o.history[i])
+	}
+	return result
+}
+
+func (o *Orchestrator) begin(req Request) (context.Context, *Run, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.current != nil {
+		return nil, nil, ErrInProgress
+	}
+
+	o.nextID++
+	run := &Run{
+		ID:       o.nextID,
+		Reason:   req.Reason,
+		Detail:   req.Detail,
+		Delay:    int(req.Delay / time.Second),
+		Status:   StatusRunning,
+		Start:    time.Now(),
+		Critical: req.Critical,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	o.current = run
+	o.cancel = cancel
+	return ctx, run, nil
+}
+
+// escalate 正在进行的重启不是Critical时,标记为Critical并结束它的等待
+func (o *Orchestrator) escalate(req Request) (Run, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !req.Critical || o.current == nil || o.current.Critical {
+		return Run{}, false
+	}
+	o.current.Critical = true
+	if req.Detail != "" {
+		o.current.Detail = strings.TrimSpace(o.current.Detail + " " + req.Detail)
+	}
+	if o.expedite != nil {
+		o.expedite()
+	}
+	log.Printf("收到紧急重启请求(%v),正在进行的重启不再等待", req.Reason)
+	return o.copyRun(o.current), true
+}
+
+// critical 正在进行的重启是否为Critical
+func (o *Orchestrator) critical(run *Run) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return run.Critical
+}
+
+func (o *Orchestrator) execute(ctx context.Context, run *Run, req Request) {
+	log.Printf("开始重启服务端,原因: %v %v", req.Reason, req.Detail)
+
+	// waitCtx 在收到Critical请求时被取消,结束等待但不取消重启
+	waitCtx, expedite := context.WithCancel(ctx)
+	o.mu.Lock()
+	o.expedite = expedite
+	o.mu.Unlock()
+	wait := func(fn func() error) error {
+		if err := fn(); err != nil && ctx.Err() != nil {
+			return err
+		}
+		return nil
+	}
+
+	var err error
+	if until := o.deferral(req, run); !until.IsZero() {
+		o.mu.Lock()
+		run.DeferredUntil = &until
+		o.mu.Unlock()
+		log.Printf("不在维护窗口内,重启推迟到%v", until.Format("2006-01-02 15:04"))
+		err = o.step(run, StepWindow, func() error {
+			return wait(func() error { return sleepUntil(waitCtx, until) })
+		})
+	}
+
+	empty := false
+	if err == nil && o.deferForPlayers(req, run) {
+		err = o.step(run, StepPlayers, func() error {
+			return wait(func() (err error) {
+				empty, err = o.waitForPlayers(waitCtx, run)
+				return err
+			})
+		})
+	}
+
+	// 服务器已经没有玩家时不需要倒计时
+	if err == nil && req.Delay > 0 && !empty {
+		err = o.step(run, StepCountdown, func() error { return o.countdownFor(ctx, req) })
+	}
+
+	// 倒计时结束后不再响应取消,服务端一旦关闭就必须重新启动
+	o.mu.Lock()
+	o.cancel()
+	o.cancel = nil
+	o.expedite = nil
+	o.mu.Unlock()
+	expedite()
+
+	if err != nil {
+		o.finish(run, StatusCancelled, err)
+		return
+	}
+
+	bg := context.Background()
+	if o.Save != nil {
+		o.step(run, StepSave, func() error { return o.withTimeout(bg, o.Save) })
+	}
+	if o.Backup != nil {
+		o.step(run, StepBackup, func() error { return o.Backup(bg) })
+	}
+
+	if err := o.stopServer(run, req); err != nil {
+		o.finish(run, StatusFailed, err)
+		return
+	}
+
+	if req.Prepare != nil {
+		// 准备失败(如更新失败)时仍然启动原来的服务端
+		o.step(run, StepPrepare, func() error { return req.Prepare(bg) })
+	}
+
+	if o.Start != nil {
+		if err := o.step(run, StepStart, func() error { return o.Start(req.Reason) }); err != nil {
+			o.finish(run, StatusFailed, err)
+			return
+		}
+	}
+
+	if o.Verify != nil {
+		if err := o.step(run, StepVerify, o.verify); err != nil {
+			o.finish(run, StatusFailed, err)
+			return
+		}
+	}
+
+	o.finish(run, StatusCompleted, nil)
+}
+
+// deferral 自动重启在倒计时结束时不在维护窗口内时,返回开始倒计时的时间,否则返回零值
+func (o *Orchestrator) deferral(req Request, run *Run) time.Time {
+	if o.Window == nil || !req.Reason.Automated() || o.critical(run) {
+		return time.Time{}
+	}
+	at := time.Now().Add(req.Delay)
+	start := o.Window(at)
+	if !start.After(at) {
+		return time.Time{}
+	}
+	return start.Add(-req.Delay)
+}
+
+// deferForPlayers 自动重启是否需要等待玩家下线
+func (o *Orchestrator) deferForPlayers(req Request, run *Run) bool {
+	return o.DeferForPlayers && o.Players != nil && req.Reason.Automated() && !o.critical(run)
+}
+
+// waitForPlayers 等待服务器没有玩家在线,等待期间按DeferWarnings广播。
+// 服务器变空时返回true;超过MaxDeferral或无法获取玩家数时返回false,之后照常倒计时重启
+func (o *Orchestrator) waitForPlayers(ctx context.Context, run *Run) (bool, error) {
+	maxDeferral := o.MaxDeferral
+	if maxDeferral <= 0 {
+		maxDeferral = DefaultMaxDeferral
+	}
+	poll := o.DeferPoll
+	if poll <= 0 {
+		poll = DefaultDeferPoll
+	}
+	message := o.DeferMessage
+	if message == "" {
+		message = DefaultDeferMessage
+	}
+
+	deadline := time.Now().Add(maxDeferral)
+	o.mu.Lock()
+	run.PlayersDeadline = &deadline
+	o.mu.Unlock()
+
+	// 开始等待时广播一次,之后在剩余时间到达每个警告点时广播
+	marks := []time.Duration{maxDeferral}
+	for _, d := range o.DeferWarnings {
+		if d > 0 && d < maxDeferral {
+			marks = append(marks, d)
+		}
+	}
+	sort.Slice(marks, func(i, j int) bool { return marks[i] > marks[j] })
+
+	next := 0
+	for {
+		var players int
+		err := o.withTimeout(ctx, func(ctx context.Context) (err error) {
+			players, err = o.Players(ctx)
+			return err
+		})
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if err != nil {
+			log.Printf("无法获取在线玩家数,不再等待玩家下线: %v", err)
+			return false, nil
+		}
+		if players == 0 {
+			log.Printf("服务器已经没有玩家在线,开始重启")
+			return true, nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			log.Printf("等待玩家下线超过%v,仍有%d名玩家在线,开始重启", maxDeferral, players)
+			return false, nil
+		}
+
+		// 只广播最近到达的警告点
+		warn := time.Duration(0)
+		for next < len(marks) && remaining <= marks[next] {
+			warn = marks[next]
+			next++
+		}
+		if warn > 0 && o.Broadcast != nil {
+			text := strings.ReplaceAll(message, "{time}", FormatDuration(warn))
+			if err := o.withTimeout(ctx, func(ctx context.Context) error { return o.Broadcast(ctx, text) }); err != nil {
+				log.Printf("重启推迟广播失败: %v", err)
+			}
+		}
+
+		sleep := poll
+		if next < len(marks) && remaining-marks[next] < sleep {
+			sleep = remaining - marks[next]
+		}
+		if remaining < sleep {
+			sleep = remaining
+		}
+		if err := sleepUntil(ctx, time.Now().Add(sleep)); err != nil {
+			return false, err
+		}
+	}
+}
+
+// countdownFor 在开始时和剩余时间到达每个倒计时点时广播,Delay结束后返回
+func (o *Orchestrator) countdownFor(ctx context.Context, req Request) error {
+	if req.Delay <= 0 {
+		return nil
+	}
+
+	message := req.Message
+	if message == "" {
+		message = o.Message
+	}
+	if message == "" {
+		message = DefaultMessage
+	}
+
+	// 开始时广播一次,之后在小于Delay的每个倒计时点广播
+	marks := []time.Duration{req.Delay}
+	for _, d := range o.countdown() {
+		if d > 0 && d < req.Delay {
+			marks = append(marks, d)
+		}
+	}
+	sort.Slice(marks, func(i, j int) bool { return marks[i] > marks[j] })
+
+	deadline := time.Now().Add(req.Delay)
+	for _, mark := range marks {
+		if err := sleepUntil(ctx, deadline.Add(-mark)); err != nil {
+			return err
+		}
+		if o.Broadcast != nil {
+			text := strings.ReplaceAll(message, "{time}", FormatDuration(mark))
+			if err := o.withTimeout(ctx, func(ctx context.Context) error { return o.Broadcast(ctx, text) }); err != nil {
+				log.Printf("重启倒计时广播失败: %v", err)
+			}
+		}
+	}
+	return sleepUntil(ctx, deadline)
+}
+
+// stopServer 请求正常关闭,超时后强制结束进程
+func (o *Orchestrator) stopServer(run *Run, req Request) error {
+	if o.Running == nil {
+		return nil
+	}
+
+	if !req.Force && o.Stop != nil && o.Running() {
+		o.step(run, StepStop, func() error {
+			if err := o.withTimeout(context.Background(), o.Stop); err != nil {
+				return err
+			}
+			return o.waitExit(o.exitTimeout())
+		})
+	}
+	if !o.Running() {
+		return nil
+	}
+
+	return o.step(run, StepKill, func() error {
+		if o.Kill == nil {
+			return errors.New("server did not exit and no kill function is set")
+		}
+		if err := o.Kill(); err != nil {
+			return err
+		}
+		return o.waitExit(killWait)
+	})
+}
+
+func (o *Orchestrator) waitExit(timeout time.Duration) error {
+	poll := pollInterval
+	if timeout/10 < poll {
+		poll = timeout / 10
+	}
+	deadline := time.Now().Add(timeout)
+	for o.Running() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("server still running after %v", timeout)
+		}
+		time.Sleep(poll)
+	}
+	return nil
+}
+
+// verify 重复检查直到服务端正常响应或超时
+func (o *Orchestrator) verify() error {
+	timeout := o.VerifyTimeout
+	if timeout <= 0 {
+		timeout = DefaultVerifyTimeout
+	}
+	poll := o.VerifyPoll
+	if poll <= 0 {
+		poll = DefaultVerifyPoll
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := o.withTimeout(context.Background(), o.Verify)
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(poll).After(deadline) {
+			return fmt.Errorf("server not healthy after %v: %w", timeout, err)
+		}
+		time.Sleep(poll)
+	}
+}
+
+// step 执行一个步骤并记录结果
+func (o *Orchestrator) step(run *Run, name string, fn func() error) error {
+	o.mu.Lock()
+	run.Steps = append(run.Steps, Step{Name: name, Start: time.Now()})
+	i := len(run.Steps) - 1
+	o.mu.Unlock()
+
+	err := fn()
+
+	o.mu.Lock()
+	run.Steps[i].End = time.Now()
+	if err != nil {
+		run.Steps[i].Error = err.Error()
+		log.Printf("重启步骤%v失败: %v", name, err)
+	}
+	o.mu.Unlock()
+	return err
+}
+
+func (o *Orchestrator) finish(run *Run, status string, err error) {
+	end := time.Now()
+
+	o.mu.Lock()
+	run.Status = status
+	run.End = &end
+	if err != nil {
+		run.Error = err.Error()
+	}
+	o.history = append(o.history, o.copyRun(run))
+	if len(o.history) > HistorySize {
+		o.history = o.history[len(o.history)-HistorySize:]
+	}
+	o.current = nil
+	o.mu.Unlock()
+
+	log.Printf("服务端重启结束: %v %v", status, run.Error)
+	o.bus.Publish(event.RestartCompleted{
+		Reason:   string(run.Reason),
+		Detail:   run.Detail,
+		Status:   status,
+		Duration: end.Sub(run.Start).Seconds(),
+		Error:    run.Error,
+	})
+}
+
+func (o *Orchestrator) snapshot(run *Run) Run {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.copyRun(run)
+}
+
+func (o *Orchestrator) copyRun(run *Run) Run {
+	result := *run
+	result.Steps = append([]Step(nil), run.Steps...)
+	return result
+}
+
+func (o *Orchestrator) countdown() []time.Duration {
+	if len(o.Countdown) == 0 {
+		return DefaultCountdown
+	}
+	return o.Countdown
+}
+
+func (o *Orchestrator) exitTimeout() time.Duration {
+	if o.ExitTimeout <= 0 {
+		return DefaultExitTimeout
+	}
+	return o.ExitTimeout
+}
+
+func (o *Orchestrator) withTimeout(ctx context.Context, fn func(ctx context.Context) error) error {
+	timeout := o.StepTimeout
+	if timeout <= 0 {
+		timeout = DefaultStepTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// FormatDuration 把倒计时格式化为10m 1m30s 10s这样的形式
+func FormatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	minutes := int(d / time.Minute)
+	seconds := int((d % time.Minute) / time.Second)
+	switch {
+	case minutes > 0 && seconds > 0:
+		return fmt.Sprintf("%dm%ds", minutes, seconds)
+	case minutes > 0:
+		return fmt.Sprintf("%dm", minutes)
+	default:
+		return fmt.Sprintf("%ds", seconds)
+	}
+}
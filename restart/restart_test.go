@@ -0,0 +1,463 @@
+package restart_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/event"
+	"github.com/hoshinonyaruko/palworld-go/restart"
+)
+
+// fakeServer 记录编排器调用的操作,stopWorks为false时正常关闭不会让进程退出
+type fakeServer struct {
+	mu        sync.Mutex
+	calls     []string
+	running   bool
+	stopWorks bool
+	verifyErr []error
+}
+
+func (f *fakeServer) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeServer) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func newOrchestrator(f *fakeServer) (*restart.Orchestrator, *event.Bus) {
+	bus := event.NewBus(10)
+	o := restart.New(bus)
+	o.ExitTimeout = 50 * time.Millisecond
+	o.VerifyTimeout = time.Second
+	o.VerifyPoll = 5 * time.Millisecond
+
+	o.Broadcast = func(ctx context.Context, message string) error {
+		f.record("broadcast " + message)
+		return nil
+	}
+	o.Save = func(ctx context.Context) error {
+		f.record("save")
+		return nil
+	}
+	o.Backup = func(ctx context.Context) error {
+		f.record("backup")
+		return errors.New("disk full")
+	}
+	o.Stop = func(ctx context.Context) error {
+		f.record("stop")
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.stopWorks {
+			f.running = false
+		}
+		return nil
+	}
+	o.Kill = func() error {
+		f.record("kill")
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.running = false
+		return nil
+	}
+	o.Running = func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.running
+	}
+	o.Start = func(reason restart.Reason) error {
+		f.record("start " + string(reason))
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.running = true
+		return nil
+	}
+	o.Verify = func(ctx context.Context) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if len(f.verifyErr) == 0 {
+			f.calls = append(f.calls, "verify ok")
+			return nil
+		}
+		err := f.verifyErr[0]
+		f.verifyErr = f.verifyErr[1:]
+		f.calls = append(f.calls, "verify failed")
+		return err
+	}
+	return o, bus
+}
+
+func stepNames(run restart.Run) []string {
+	var names []string
+	for _, step := range run.Steps {
+		names = append(names, step.Name)
+	}
+	return names
+}
+
+func TestOrchestrator_Pipeline(t *testing.T) {
+	refused := errors.New("connection refused")
+	tests := []struct {
+		name      string
+		req       restart.Request
+		stopWorks bool
+		calls     []string
+		steps     []string
+	}{
+		{
+			name:      "graceful",
+			req:       restart.Request{Reason: restart.ReasonScheduled},
+			stopWorks: true,
+			calls:     []string{"save", "backup", "stop", "start scheduled", "verify failed", "verify ok"},
+			steps:     []string{restart.StepSave, restart.StepBackup, restart.StepStop, restart.StepStart, restart.StepVerify},
+		},
+		{
+			name:  "kill after exit timeout",
+			req:   restart.Request{Reason: restart.ReasonMemory},
+			calls: []string{"save", "backup", "stop", "kill", "start memory", "verify failed", "verify ok"},
+			steps: []string{restart.StepSave, restart.StepBackup, restart.StepStop, restart.StepKill, restart.StepStart, restart.StepVerify},
+		},
+		{
+			name:  "force",
+			req:   restart.Request{Reason: restart.ReasonHealth, Force: true},
+			calls: []string{"save", "backup", "kill", "start health", "verify failed", "verify ok"},
+			steps: []string{restart.StepSave, restart.StepBackup, restart.StepKill, restart.StepStart, restart.StepVerify},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeServer{running: true, stopWorks: tt.stopWorks, verifyErr: []error{refused}}
+			o, bus := newOrchestrator(f)
+
+			run, err := o.Do(tt.req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			if got := f.Calls(); !reflect.DeepEqual(got, tt.calls) {
+				t.Errorf("calls = %q, want %q", got, tt.calls)
+			}
+			if got := stepNames(run); !reflect.DeepEqual(got, tt.steps) {
+				t.Errorf("steps = %q, want %q", got, tt.steps)
+			}
+			// 备份失败不影响重启,但会记录在步骤中
+			if run.Status != restart.StatusCompleted || run.Steps[1].Error != "disk full" {
+				t.Errorf("run = %+v", run)
+			}
+
+			events := bus.Recent(0, []event.Type{event.TypeServerRestarted}, 0)
+			if len(events) != 1 {
+				t.Fatalf("published %d restart events", len(events))
+			}
+			if data := events[0].Data.(event.RestartCompleted); data.Reason != string(tt.req.Reason) || data.Status != restart.StatusCompleted {
+				t.Errorf("event = %+v", data)
+			}
+		})
+	}
+}
+
+func TestOrchestrator_Countdown(t *testing.T) {
+	f := &fakeServer{stopWorks: true}
+	o, _ := newOrchestrator(f)
+	o.Countdown = []time.Duration{10 * time.Minute, 2 * time.Second, time.Second}
+	o.Message = "Restart_in_{time}"
+
+	start := time.Now()
+	if _, err := o.Do(restart.Request{Reason: restart.ReasonManual, Delay: 2500 * time.Millisecond}); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 2500*time.Millisecond {
+		t.Errorf("restart finished after %v, before the countdown ended", elapsed)
+	}
+
+	// 开始时广播一次,之后只在小于Delay的倒计时点广播
+	want := []string{"broadcast Restart_in_3s", "broadcast Restart_in_2s", "broadcast Restart_in_1s", "save"}
+	if got := f.Calls()[:4]; !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+}
+
+func TestOrchestrator_Cancel(t *testing.T) {
+	f := &fakeServer{running: true, stopWorks: true}
+	o, bus := newOrchestrator(f)
+
+	if _, err := o.Restart(restart.Request{Reason: restart.ReasonManual, Delay: time.Minute}); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	if _, err := o.Restart(restart.Request{Reason: restart.ReasonScheduled}); err != restart.ErrInProgress {
+		t.Errorf("second Restart error = %v, want ErrInProgress", err)
+	}
+	if current, ok := o.Current(); !ok || current.Status != restart.StatusRunning {
+		t.Errorf("Current = %+v, %v", current, ok)
+	}
+
+	if !o.Cancel() {
+		t.Fatal("Cancel returned false during the countdown")
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := o.Current(); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("restart still running after cancel")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	history := o.History()
+	if len(history) != 1 || history[0].Status != restart.StatusCancelled || history[0].Reason != restart.ReasonManual {
+		t.Errorf("history = %+v", history)
+	}
+	for _, call := range f.Calls() {
+		if !strings.HasPrefix(call, "broadcast") {
+			t.Errorf("cancelled restart called %q", call)
+		}
+	}
+	if o.Cancel() {
+		t.Error("Cancel returned true with no restart in progress")
+	}
+	if events := bus.Recent(0, []event.Type{event.TypeServerRestarted}, 0); len(events) != 1 || events[0].Data.(event.RestartCompleted).Status != restart.StatusCancelled {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestOrchestrator_Window(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      restart.Request
+		deferred bool
+	}{
+		{"scheduled waits for the window", restart.Request{Reason: restart.ReasonScheduled, Delay: 100 * time.Millisecond}, true},
+		{"memory waits for the window", restart.Request{Reason: restart.ReasonMemory}, true},
+		{"critical memory restarts now", restart.Request{Reason: restart.ReasonMemory, Critical: true}, false},
+		{"manual ignores the window", restart.Request{Reason: restart.ReasonManual}, false},
+		{"health ignores the window", restart.Request{Reason: restart.ReasonHealth, Force: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeServer{running: true, stopWorks: true}
+			o, _ := newOrchestrator(f)
+			windowStart := time.Now().Add(300 * time.Millisecond)
+			o.Window = func(at time.Time) time.Time {
+				if at.Before(windowStart) {
+					return windowStart
+				}
+				return at
+			}
+
+			start := time.Now()
+			run, err := o.Do(tt.req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			stoppedAt := run.Steps[len(run.Steps)-1].Start
+			for _, step := range run.Steps {
+				if step.Name == restart.StepStop || step.Name == restart.StepKill {
+					stoppedAt = step.Start
+				}
+			}
+
+			if !tt.deferred {
+				if run.DeferredUntil != nil || stoppedAt.After(windowStart) {
+					t.Errorf("restart was deferred: %+v", run)
+				}
+				return
+			}
+			// 倒计时安排在窗口开始时结束
+			if run.DeferredUntil == nil || run.Steps[0].Name != restart.StepWindow {
+				t.Fatalf("restart was not deferred: %+v", run)
+			}
+			if want := windowStart.Add(-tt.req.Delay); !run.DeferredUntil.Equal(want) {
+				t.Errorf("DeferredUntil = %v, want %v", run.DeferredUntil, want)
+			}
+			if stoppedAt.Before(windowStart) {
+				t.Errorf("server stopped %v after start, before the window opened", stoppedAt.Sub(start))
+			}
+		})
+	}
+}
+
+// players 按顺序返回counts中的在线人数,用完后一直返回最后一个
+func players(counts ...int) func(ctx context.Context) (int, error) {
+	var mu sync.Mutex
+	return func(ctx context.Context) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		n := counts[0]
+		if len(counts) > 1 {
+			counts = counts[1:]
+		}
+		return n, nil
+	}
+}
+
+func countPrefix(calls []string, prefix string) int {
+	n := 0
+	for _, call := range calls {
+		if strings.HasPrefix(call, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestOrchestrator_DeferForPlayers(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        restart.Request
+		counts     []int
+		steps      []string
+		warnings   int
+		countdowns int
+	}{
+		{
+			name:     "waits until empty and skips the countdown",
+			req:      restart.Request{Reason: restart.ReasonScheduled, Delay: 50 * time.Millisecond},
+			counts:   []int{2, 1, 0},
+			steps:    []string{restart.StepPlayers, restart.StepSave},
+			warnings: 1,
+		},
+		{
+			name:       "restarts after the max deferral",
+			req:        restart.Request{Reason: restart.ReasonMemory, Delay: 50 * time.Millisecond},
+			counts:     []int{3},
+			steps:      []string{restart.StepPlayers, restart.StepCountdown, restart.StepSave},
+			warnings:   2,
+			countdowns: 1,
+		},
+		{
+			name:  "empty server restarts at once",
+			req:   restart.Request{Reason: restart.ReasonMemory},
+			steps: []string{restart.StepPlayers, restart.StepSave},
+		},
+		{
+			name:       "manual restarts do not wait",
+			req:        restart.Request{Reason: restart.ReasonManual, Delay: 50 * time.Millisecond},
+			counts:     []int{3},
+			steps:      []string{restart.StepCountdown, restart.StepSave},
+			countdowns: 1,
+		},
+		{
+			name:   "critical restarts do not wait",
+			req:    restart.Request{Reason: restart.ReasonMemory, Critical: true},
+			counts: []int{3},
+			steps:  []string{restart.StepSave},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeServer{running: true, stopWorks: true}
+			o, _ := newOrchestrator(f)
+			o.Message = "countdown_{time}"
+			o.DeferForPlayers = true
+			o.MaxDeferral = 200 * time.Millisecond
+			o.DeferWarnings = []time.Duration{100 * time.Millisecond}
+			o.DeferMessage = "pending_{time}"
+			o.DeferPoll = 10 * time.Millisecond
+			if tt.counts == nil {
+				tt.counts = []int{0}
+			}
+			o.Players = players(tt.counts...)
+
+			run, err := o.Do(tt.req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			if got := stepNames(run)[:len(tt.steps)]; !reflect.DeepEqual(got, tt.steps) {
+				t.Errorf("steps = %q, want prefix %q", got, tt.steps)
+			}
+			calls := f.Calls()
+			if got := countPrefix(calls, "broadcast pending_"); got != tt.warnings {
+				t.Errorf("%d warnings in %q, want %d", got, calls, tt.warnings)
+			}
+			if got := countPrefix(calls, "broadcast countdown_"); got != tt.countdowns {
+				t.Errorf("%d countdown broadcasts in %q, want %d", got, calls, tt.countdowns)
+			}
+		})
+	}
+}
+
+func TestOrchestrator_Escalate(t *testing.T) {
+	f := &fakeServer{running: true, stopWorks: true}
+	o, _ := newOrchestrator(f)
+	o.DeferForPlayers = true
+	o.MaxDeferral = time.Minute
+	o.DeferPoll = 10 * time.Millisecond
+	o.Players = players(5)
+
+	first, err := o.Restart(restart.Request{Reason: restart.ReasonMemory, Detail: "85%"})
+	if err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	if _, err := o.Restart(restart.Request{Reason: restart.ReasonMemory, Detail: "90%"}); err != restart.ErrInProgress {
+		t.Errorf("non-critical Restart error = %v, want ErrInProgress", err)
+	}
+
+	// 超过内存硬上限的请求让正在等待玩家下线的重启立即进行
+	escalated, err := o.Restart(restart.Request{Reason: restart.ReasonMemory, Detail: "97%", Critical: true})
+	if err != nil || escalated.ID != first.ID || !escalated.Critical {
+		t.Fatalf("critical Restart = %+v, %v", escalated, err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := o.Current(); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("escalated restart still waiting")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	history := o.History()
+	if len(history) != 1 || history[0].Status != restart.StatusCompleted || history[0].Detail != "85% 97%" {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+func TestOrchestrator_VerifyTimeout(t *testing.T) {
+	f := &fakeServer{running: true, stopWorks: true, verifyErr: make([]error, 1000)}
+	for i := range f.verifyErr {
+		f.verifyErr[i] = errors.New("no response")
+	}
+	o, _ := newOrchestrator(f)
+	o.VerifyTimeout = 30 * time.Millisecond
+
+	run, err := o.Do(restart.Request{Reason: restart.ReasonUpdate, Prepare: func(ctx context.Context) error {
+		f.record("prepare")
+		return nil
+	}})
+	if err == nil || run.Status != restart.StatusFailed {
+		t.Fatalf("Do = %+v, %v; want failure", run, err)
+	}
+	want := []string{restart.StepSave, restart.StepBackup, restart.StepStop, restart.StepPrepare, restart.StepStart, restart.StepVerify}
+	if got := stepNames(run); !reflect.DeepEqual(got, want) {
+		t.Errorf("steps = %q, want %q", got, want)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{10 * time.Minute, "10m"},
+		{90 * time.Second, "1m30s"},
+		{30 * time.Second, "30s"},
+		{2500 * time.Millisecond, "3s"},
+	}
+	for _, tt := range tests {
+		if got := restart.FormatDuration(tt.d); got != tt.want {
+			t.Errorf("FormatDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
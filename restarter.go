@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/audit"
+	"github.com/hoshinonyaruko/palworld-go/backup"
+	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/health"
+	"github.com/hoshinonyaruko/palworld-go/jobs"
+	"github.com/hoshinonyaruko/palworld-go/lifecycle"
+	"github.com/hoshinonyaruko/palworld-go/restart"
+	"github.com/hoshinonyaruko/palworld-go/schedule"
+	"github.com/hoshinonyaruko/palworld-go/status"
+	"github.com/hoshinonyaruko/palworld-go/sys"
+	"github.com/hoshinonyaruko/palworld-go/tool"
+)
+
+// restartShutdownMessage 倒计时结束后关闭服务端时的广播
+const restartShutdownMessage = "Server_is_restarting"
+
+// setupRestarter 设置restart.Default各步骤使用的操作和维护窗口
+func setupRestarter(cfg config.Config, backupTask *BackupTask, checker *health.Checker, windows schedule.Windows) {
+	o := restart.Default
+	if len(windows) > 0 {
+		o.Window = windows.NextStart
+	}
+
+	o.Countdown = nil
+	for _, seconds := range cfg.RestartCountdown {
+		o.Countdown = append(o.Countdown, time.Duration(seconds)*time.Second)
+	}
+	o.Message = cfg.RestartCountdownMessage
+	o.ExitTimeout = time.Duration(cfg.RestartExitTimeout) * time.Second
+	o.VerifyTimeout = time.Duration(cfg.RestartVerifyTimeout) * time.Second
+	o.DeferForPlayers = cfg.RestartDeferForPlayers
+	o.MaxDeferral = time.Duration(cfg.RestartMaxDeferral) * time.Second
+	o.DeferWarnings = nil
+	for _, seconds := range cfg.RestartDeferWarnings {
+		o.DeferWarnings = append(o.DeferWarnings, time.Duration(seconds)*time.Second)
+	}
+	o.DeferMessage = cfg.RestartDeferMessage
+
+	withOrigin := func(ctx context.Context) context.Context {
+		return audit.WithOrigin(ctx, audit.OriginRestart)
+	}
+
+	o.Broadcast = func(ctx context.Context, message string) error {
+		client, err := tool.NewServerClient(cfg)
+		if err != nil {
+			return err
+		}
+		return client.Broadcast(withOrigin(ctx), message)
+	}
+	o.Save = func(ctx context.Context) error {
+		client, err := tool.NewServerClient(cfg)
+		if err != nil {
+			return err
+		}
+		return client.Save(withOrigin(ctx))
+	}
+	o.Backup = func(ctx context.Context) error {
+		return backupTask.RunBackup(backup.TriggerRestart)
+	}
+	// 关闭前先通知状态机,进程退出后守护不会自动拉起,由编排器重新启动
+	o.Stop = func(ctx context.Context) error {
+		lifecycle.Default.Stop("重启")
+		client, err := tool.NewServerClient(cfg)
+		if err != nil {
+			return err
+		}
+		return client.Shutdown(withOrigin(ctx), 1, restartShutdownMessage)
+	}
+	o.Kill = func() error {
+		lifecycle.Default.Stop("重启")
+		return sys.KillProcess(cfg)
+	}
+	o.Running = func() bool {
+		return sys.IsRunning(status.GetGlobalPid())
+	}
+	o.Start = func(reason restart.Reason) error {
+		status.SetManualServerShutdown(false)
+		sys.RestartService(cfg)
+		lifecycle.Default.Start("重启: " + string(reason))
+		return nil
+	}
+	o.Players = func(ctx context.Context) (int, error) {
+		client, err := tool.NewServerClient(cfg)
+		if err != nil {
+			return 0, err
+		}
+		players, err := client.ShowPlayers(withOrigin(ctx))
+		return len(players), err
+	}
+	if checker != nil {
+		o.Verify = checker.Verify
+	}
+}
+
+// restartLocation 返回定时重启和维护窗口使用的时区
+func restartLocation(cfg config.Config) *time.Location {
+	if cfg.RestartTimezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(cfg.RestartTimezone)
+	if err != nil {
+		log.Printf("时区%v无效,使用系统时区: %v", cfg.RestartTimezone, err)
+		return time.Local
+	}
+	return loc
+}
+
+// parseRestartSchedules 解析定时重启计划,无效的表达式被跳过
+func parseRestartSchedules(cfg config.Config, loc *time.Location) []*schedule.Schedule {
+	var schedules []*schedule.Schedule
+	for _, expr := range cfg.RestartSchedule {
+		if strings.TrimSpace(expr) == "" {
+			continue
+		}
+		s, err := schedule.Parse(expr, loc)
+		if err != nil {
+			log.Printf("定时重启计划无效: %v", err)
+			continue
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules
+}
+
+// restartTrigger 在计划重启的时间点前DefaultDelay触发,倒计时结束时正好关闭服务端
+type restartTrigger []*schedule.Schedule
+
+func (r restartTrigger) Next(t time.Time) time.Time {
+	delay := restart.Default.DefaultDelay()
+	next := schedule.Earliest(r, t.Add(delay))
+	if next.IsZero() {
+		return next
+	}
+	return next.Add(-delay)
+}
+
+func (r restartTrigger) String() string {
+	exprs := make([]string, len(r))
+	for i, s := range r {
+		exprs[i] = s.String()
+	}
+	return strings.Join(exprs, ", ")
+}
+
+// restartScheduleJob 按cron计划重启服务端的任务
+func restartScheduleJob(schedules []*schedule.Schedule) jobs.Job {
+	return jobs.Job{
+		Name:        "restart-schedule",
+		Description: "按计划重启服务端",
+		Trigger:     restartTrigger(schedules),
+		Run: func(ctx context.Context) error {
+			next := schedule.Earliest(schedules, time.Now())
+			if next.IsZero() {
+				return nil
+			}
+			_, err := restart.Default.Restart(restart.Request{
+				Reason: restart.ReasonScheduled,
+				Detail: "计划" + next.Format("2006-01-02 15:04 MST"),
+				Delay:  time.Until(next),
+			})
+			return err
+		},
+	}
+}
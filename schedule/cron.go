@@ -0,0 +1,291 @@
+// Package schedule 解析cron表达式和维护窗口,用于在固定的时间点重启服务端,
+// 并把自动重启推迟到维护窗口内进行。
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule 一个cron计划,时间按所在时区计算
+type Schedule struct {
+	expr   string
+	loc    *time.Location
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// domAny dowAny 日期和星期字段为*时,按cron的规则另一个字段单独生效
+	domAny bool
+	dowAny bool
+}
+
+// field 一个cron字段的取值范围
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 星期允许0-7,7和0都表示星期日
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// macros 常用的简写
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// maxYears Next最多向后查找的年数,超过时认为表达式不会触发(如2月30日)
+const maxYears = 5
+
+// Parse 解析cron表达式,loc为nil时使用本地时区。支持:
+//   - 标准的5个字段: 分 时 日 月 星期,字段支持 * , - / 和英文缩写(jan sun等)
+//   - @daily @hourly @weekly @monthly @yearly
+//   - HH:MM,表示每天的这个时间
+//   - 以CRON_TZ=时区 开头时覆盖loc,如 CRON_TZ=Asia/Shanghai 0 4 * * *
+func Parse(expr string, loc *time.Location) (*Schedule, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	spec := strings.TrimSpace(expr)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.IndexAny(spec, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("cron %q: missing schedule after time zone", expr)
+		}
+		name := spec[strings.Index(spec, "=")+1 : i]
+		tz, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %w", expr, err)
+		}
+		loc = tz
+		spec = strings.TrimSpace(spec[i:])
+	}
+
+	if m, ok := macros[strings.ToLower(spec)]; ok {
+		spec = m
+	} else if hour, minute, err := parseClock(spec); err == nil {
+		spec = fmt.Sprintf("%d %d * * *", minute, hour)
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	s := &Schedule{expr: strings.TrimSpace(expr), loc: loc}
+	var err error
+	if s.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, fmt.Errorf("cron %q: %w", expr, err)
+	}
+	if s.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, fmt.Errorf("cron %q: %w", expr, err)
+	}
+	if s.dom, err = domField.parse(fields[2]); err != nil {
+		return nil, fmt.Errorf("cron %q: %w", expr, err)
+	}
+	if s.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, fmt.Errorf("cron %q: %w", expr, err)
+	}
+	if s.dow, err = dowField.parse(fields[4]); err != nil {
+		return nil, fmt.Errorf("cron %q: %w", expr, err)
+	}
+	// 7也是星期日
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = fields[2] == "*" || fields[2] == "?"
+	s.dowAny = fields[4] == "*" || fields[4] == "?"
+	return s, nil
+}
+
+// String 返回原始表达式
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Location 返回计算时间使用的时区
+func (s *Schedule) Location() *time.Location {
+	return s.loc
+}
+
+// Next 返回t之后(不含t)的下一个触发时间,找不到时返回零值
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + maxYears
+
+wrap:
+	for t.Year() <= limit {
+		for !has(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+			if t.Month() == time.January {
+				continue wrap
+			}
+		}
+		for !s.dayMatches(t) {
+			month := t.Month()
+			next := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+			// 午夜切换夏令时的时区里0点可能不存在,被规范化到前一天
+			if !next.After(t) {
+				next = next.Add(time.Hour)
+			}
+			t = next
+			if t.Month() != month {
+				continue wrap
+			}
+		}
+		for !has(s.hour, t.Hour()) {
+			day := t.Day()
+			// 按实际经过的时间前进,夏令时跳过的小时不会被规范化回来
+			t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+			if t.Day() != day {
+				continue wrap
+			}
+		}
+		for !has(s.minute, t.Minute()) {
+			hour := t.Hour()
+			t = t.Add(time.Minute)
+			if t.Hour() != hour {
+				continue wrap
+			}
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches 日期和星期都有限制时满足其一即可,否则两者都要满足
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := has(s.dom, t.Day())
+	dow := has(s.dow, int(t.Weekday()))
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// parse 把一个字段解析为位集合
+func (f field) parse(spec string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(spec, ",") {
+		b, err := f.parsePart(part)
+		if err != nil {
+			return 0, err
+		}
+		bits |= b
+	}
+	return bits, nil
+}
+
+// parsePart 解析 * a a-b */n a-b/n a/n
+func (f field) parsePart(part string) (uint64, error) {
+	rangeSpec, stepSpec, hasStep := strings.Cut(part, "/")
+	step := 1
+	if hasStep {
+		n, err := strconv.Atoi(stepSpec)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("%v: invalid step %q", f.name, stepSpec)
+		}
+		step = n
+	}
+
+	var low, high int
+	switch {
+	case rangeSpec == "*" || rangeSpec == "?":
+		low, high = f.min, f.max
+	case strings.Contains(rangeSpec, "-"):
+		a, b, _ := strings.Cut(rangeSpec, "-")
+		var err error
+		if low, err = f.value(a); err != nil {
+			return 0, err
+		}
+		if high, err = f.value(b); err != nil {
+			return 0, err
+		}
+		if high < low {
+			return 0, fmt.Errorf("%v: invalid range %q", f.name, rangeSpec)
+		}
+	default:
+		v, err := f.value(rangeSpec)
+		if err != nil {
+			return 0, err
+		}
+		low, high = v, v
+		// a/n 表示从a开始到最大值每隔n
+		if hasStep {
+			high = f.max
+		}
+	}
+
+	var bits uint64
+	for v := low; v <= high; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%v: invalid value %q", f.name, s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%v: %d out of range %d-%d", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+// parseClock 解析HH:MM
+func parseClock(s string) (hour, minute int, err error) {
+	h, m, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	hour, err = strconv.Atoi(h)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, fmt.Errorf("invalid hour in %q", s)
+	}
+	minute, err = strconv.Atoi(m)
+	if err != nil || minute < 0 || minute > 59 || len(m) != 2 {
+		return 0, 0, fmt.Errorf("invalid minute in %q", s)
+	}
+	return hour, minute, nil
+}
+
+// Earliest 返回多个计划中t之后最早的触发时间,没有时返回零值
+func Earliest(schedules []*Schedule, t time.Time) time.Time {
+	var next time.Time
+	for _, s := range schedules {
+		if n := s.Next(t); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	return next
+}
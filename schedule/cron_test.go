@@ -0,0 +1,131 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/schedule"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %v not available: %v", name, err)
+	}
+	return loc
+}
+
+func TestSchedule_Next(t *testing.T) {
+	// 2024-03-13是星期三
+	from := time.Date(2024, 3, 13, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 3, 13, 10, 31, 0, 0, time.UTC)},
+		{"0 4 * * *", time.Date(2024, 3, 14, 4, 0, 0, 0, time.UTC)},
+		{"04:00", time.Date(2024, 3, 14, 4, 0, 0, 0, time.UTC)},
+		{"12:45", time.Date(2024, 3, 13, 12, 45, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 3, 13, 10, 45, 0, 0, time.UTC)},
+		{"0 */6 * * *", time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2024, 3, 14, 10, 30, 0, 0, time.UTC)},
+		{"0 4 * * sat,sun", time.Date(2024, 3, 16, 4, 0, 0, 0, time.UTC)},
+		{"0 4 * * 1-5", time.Date(2024, 3, 14, 4, 0, 0, 0, time.UTC)},
+		{"0 4 * * 7", time.Date(2024, 3, 17, 4, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// 日期和星期都有限制时满足其一即可
+		{"0 0 1 * mon", time.Date(2024, 3, 18, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 3, 13, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"5/20 10 * * *", time.Date(2024, 3, 13, 10, 45, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := schedule.Parse(tt.expr, time.UTC)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).Next = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestSchedule_Timezone(t *testing.T) {
+	shanghai := mustLoad(t, "Asia/Shanghai")
+	from := time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC)
+	want := time.Date(2024, 3, 13, 20, 0, 0, 0, time.UTC)
+
+	s, err := schedule.Parse("0 4 * * *", shanghai)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := s.Next(from); !got.Equal(want) {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+
+	// CRON_TZ覆盖传入的时区
+	s, err = schedule.Parse("CRON_TZ=Asia/Shanghai 0 4 * * *", time.UTC)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := s.Next(from); !got.Equal(want) || s.Location().String() != "Asia/Shanghai" {
+		t.Errorf("CRON_TZ Next = %v in %v, want %v", got, s.Location(), want)
+	}
+}
+
+func TestSchedule_DST(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	s, err := schedule.Parse("30 2 * * *", ny)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	// 2024-03-10 02:30不存在,跳到下一天
+	got := s.Next(time.Date(2024, 3, 10, 0, 0, 0, 0, ny))
+	if want := time.Date(2024, 3, 11, 2, 30, 0, 0, ny); !got.Equal(want) {
+		t.Errorf("Next over spring forward = %v, want %v", got, want)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"abc * * * *",
+		"25:00",
+		"CRON_TZ=Nowhere/City 0 4 * * *",
+	} {
+		if _, err := schedule.Parse(expr, nil); err == nil {
+			t.Errorf("Parse(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestEarliest(t *testing.T) {
+	from := time.Date(2024, 3, 13, 10, 0, 0, 0, time.UTC)
+	var schedules []*schedule.Schedule
+	for _, expr := range []string{"0 4 * * *", "0 16 * * *"} {
+		s, err := schedule.Parse(expr, time.UTC)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", expr, err)
+		}
+		schedules = append(schedules, s)
+	}
+	if got, want := schedule.Earliest(schedules, from), time.Date(2024, 3, 13, 16, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Earliest = %v, want %v", got, want)
+	}
+	if got := schedule.Earliest(nil, from); !got.IsZero() {
+		t.Errorf("Earliest(nil) = %v", got)
+	}
+}
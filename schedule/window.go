@@ -0,0 +1,153 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window 维护窗口,如 02:00-06:00(每天) 或 Sat,Sun 01:00-09:00。
+// 结束时间不晚于开始时间时窗口跨越午夜,星期指的是窗口开始的那天
+type Window struct {
+	expr string
+	loc  *time.Location
+	// days 允许开始的星期位集合
+	days uint64
+	// start end 距离当天0点的分钟数
+	start, end int
+}
+
+// ParseWindow 解析维护窗口,loc为nil时使用本地时区
+func ParseWindow(expr string, loc *time.Location) (Window, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	w := Window{expr: strings.TrimSpace(expr), loc: loc, days: 0x7F}
+
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 1:
+	case 2:
+		days, err := dowField.parse(fields[0])
+		if err != nil {
+			return Window{}, fmt.Errorf("window %q: %w", expr, err)
+		}
+		if days&(1<<7) != 0 {
+			days |= 1
+		}
+		w.days = days & 0x7F
+	default:
+		return Window{}, fmt.Errorf("window %q: expected [days] HH:MM-HH:MM", expr)
+	}
+
+	span := fields[len(fields)-1]
+	from, to, ok := strings.Cut(span, "-")
+	if !ok {
+		return Window{}, fmt.Errorf("window %q: expected HH:MM-HH:MM", expr)
+	}
+	h, m, err := parseClock(from)
+	if err != nil {
+		return Window{}, fmt.Errorf("window %q: %w", expr, err)
+	}
+	w.start = h*60 + m
+	h, m, err = parseClock(to)
+	if err != nil {
+		return Window{}, fmt.Errorf("window %q: %w", expr, err)
+	}
+	w.end = h*60 + m
+	return w, nil
+}
+
+// String 返回原始表达式
+func (w Window) String() string {
+	return w.expr
+}
+
+// Contains t是否在窗口内
+func (w Window) Contains(t time.Time) bool {
+	t = t.In(w.loc)
+	// 跨越午夜的窗口可能是前一天开始的
+	for _, offset := range []int{0, -1} {
+		start, end := w.bounds(t, offset)
+		if has(w.days, int(start.Weekday())) && !t.Before(start) && t.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextStart 返回t之后最近一次窗口开始的时间,t在窗口内时返回t
+func (w Window) NextStart(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+	t = t.In(w.loc)
+	for offset := 0; offset <= 7; offset++ {
+		start, _ := w.bounds(t, offset)
+		if has(w.days, int(start.Weekday())) && start.After(t) {
+			return start
+		}
+	}
+	return time.Time{}
+}
+
+// bounds 返回从t所在日期偏移offset天开始的窗口起止时间
+func (w Window) bounds(t time.Time, offset int) (time.Time, time.Time) {
+	day := time.Date(t.Year(), t.Month(), t.Day()+offset, 0, 0, 0, 0, w.loc)
+	start := time.Date(day.Year(), day.Month(), day.Day(), w.start/60, w.start%60, 0, 0, w.loc)
+	endDay := day
+	if w.end <= w.start {
+		endDay = day.AddDate(0, 0, 1)
+	}
+	end := time.Date(endDay.Year(), endDay.Month(), endDay.Day(), w.end/60, w.end%60, 0, 0, w.loc)
+	return start, end
+}
+
+// Windows 一组维护窗口
+type Windows []Window
+
+// ParseWindows 解析多个维护窗口
+func ParseWindows(exprs []string, loc *time.Location) (Windows, error) {
+	var windows Windows
+	for _, expr := range exprs {
+		if strings.TrimSpace(expr) == "" {
+			continue
+		}
+		w, err := ParseWindow(expr, loc)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// Contains t是否在任意一个窗口内,没有配置窗口时总是返回true
+func (ws Windows) Contains(t time.Time) bool {
+	if len(ws) == 0 {
+		return true
+	}
+	for _, w := range ws {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextStart 返回t之后最早的窗口开始时间,t在窗口内或没有配置窗口时返回t
+func (ws Windows) NextStart(t time.Time) time.Time {
+	if ws.Contains(t) {
+		return t
+	}
+	var next time.Time
+	for _, w := range ws {
+		if n := w.NextStart(t); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	if next.IsZero() {
+		return t
+	}
+	return next
+}
@@ -0,0 +1,75 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/schedule"
+)
+
+func TestWindow(t *testing.T) {
+	// 2024-03-13是星期三
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		expr      string
+		t         time.Time
+		contains  bool
+		nextStart time.Time
+	}{
+		{"02:00-06:00", at(13, 3, 0), true, at(13, 3, 0)},
+		{"02:00-06:00", at(13, 6, 0), false, at(14, 2, 0)},
+		{"02:00-06:00", at(13, 1, 59), false, at(13, 2, 0)},
+		// 跨越午夜
+		{"23:00-05:00", at(13, 23, 30), true, at(13, 23, 30)},
+		{"23:00-05:00", at(13, 4, 0), true, at(13, 4, 0)},
+		{"23:00-05:00", at(13, 12, 0), false, at(13, 23, 0)},
+		// 星期指窗口开始的那天
+		{"Sat,Sun 01:00-09:00", at(13, 3, 0), false, at(16, 1, 0)},
+		{"Sat,Sun 01:00-09:00", at(17, 8, 59), true, at(17, 8, 59)},
+		{"fri 22:00-02:00", at(16, 1, 0), true, at(16, 1, 0)},
+		{"fri 22:00-02:00", at(16, 2, 0), false, at(22, 22, 0)},
+		{"1-5 03:00-04:00", at(16, 3, 30), false, at(18, 3, 0)},
+	}
+	for _, tt := range tests {
+		w, err := schedule.ParseWindow(tt.expr, time.UTC)
+		if err != nil {
+			t.Errorf("ParseWindow(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := w.Contains(tt.t); got != tt.contains {
+			t.Errorf("%q.Contains(%v) = %v, want %v", tt.expr, tt.t, got, tt.contains)
+		}
+		if got := w.NextStart(tt.t); !got.Equal(tt.nextStart) {
+			t.Errorf("%q.NextStart(%v) = %v, want %v", tt.expr, tt.t, got, tt.nextStart)
+		}
+	}
+}
+
+func TestWindows(t *testing.T) {
+	from := time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC)
+
+	// 没有配置窗口时不限制
+	var none schedule.Windows
+	if !none.Contains(from) || !none.NextStart(from).Equal(from) {
+		t.Error("empty windows should always contain t")
+	}
+
+	windows, err := schedule.ParseWindows([]string{"02:00-06:00", "", "wed 18:00-20:00"}, time.UTC)
+	if err != nil {
+		t.Fatalf("ParseWindows: %v", err)
+	}
+	if len(windows) != 2 || windows.Contains(from) {
+		t.Fatalf("windows = %v, contains = %v", windows, windows.Contains(from))
+	}
+	if got, want := windows.NextStart(from), time.Date(2024, 3, 13, 18, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("NextStart = %v, want %v", got, want)
+	}
+
+	for _, expr := range []string{"02:00", "02:00-6", "xyz 02:00-06:00", "mon tue 02:00-06:00"} {
+		if _, err := schedule.ParseWindow(expr, nil); err == nil {
+			t.Errorf("ParseWindow(%q) succeeded", expr)
+		}
+	}
+}
@@ -5,25 +5,29 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 
 	"gopkg.in/ini.v1"
 )
 
 var (
-	cfg *ini.File
+	mu         sync.Mutex
+	cfg        *ini.File
+	configPath string
 )
 
-func init() {
-	// 获取当前工作目录
-	currentDir, err := os.Getwd()
-	if err != nil {
-		log.Fatalf("Error getting current directory: %v", err)
-	}
-
-	// 定义配置文件路径为当前目录下的config.ini
-	configPath := filepath.Join(currentDir, "config.ini")
+// SetPath 设置状态文件的路径并从中加载,未设置时第一次使用才加载当前目录下的config.ini。
+// 测试用它把状态写到临时目录
+func SetPath(path string) {
+	mu.Lock()
+	defer mu.Unlock()
+	load(path)
+}
 
-	// 初始化时加载或创建配置文件
+// load 加载或创建配置文件
+func load(path string) {
+	configPath = path
+	var err error
 	cfg, err = ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, configPath)
 	if err != nil {
 		log.Printf("Fail to read file: %v", err)
@@ -33,31 +37,42 @@ func init() {
 	}
 }
 
+// file 返回已加载的配置文件
+func file() *ini.File {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if cfg == nil {
+		// 获取当前工作目录
+		currentDir, err := os.Getwd()
+		if err != nil {
+			log.Fatalf("Error getting current directory: %v", err)
+		}
+		// 定义配置文件路径为当前目录下的config.ini
+		load(filepath.Join(currentDir, "config.ini"))
+	}
+	return cfg
+}
+
 // saveConfig 保存更改到配置文件
 func saveConfig() {
-	// 在init中定义的configPath是局部变量，这里需要重新获取或定义全局变量
-	currentDir, err := os.Getwd()
-	if err != nil {
-		log.Printf("Error getting current directory for saving config: %v", err)
-		return
-	}
-	configPath := filepath.Join(currentDir, "config.ini")
+	mu.Lock()
+	defer mu.Unlock()
 
-	err = cfg.SaveTo(configPath)
-	if err != nil {
+	if err := cfg.SaveTo(configPath); err != nil {
 		log.Printf("Fail to save config: %v", err)
 	}
 }
 
 // SetMemoryIssueDetected 设置内存问题检测标志
 func SetMemoryIssueDetected(flag bool) {
-	cfg.Section("").Key("MemoryIssueDetected").SetValue(strconv.FormatBool(flag))
+	file().Section("").Key("MemoryIssueDetected").SetValue(strconv.FormatBool(flag))
 	saveConfig()
 }
 
 // GetMemoryIssueDetected 获取内存问题检测标志的当前值
 func GetMemoryIssueDetected() bool {
-	flag, err := cfg.Section("").Key("MemoryIssueDetected").Bool()
+	flag, err := file().Section("").Key("MemoryIssueDetected").Bool()
 	if err != nil {
 		return false
 	}
@@ -66,13 +81,13 @@ func GetMemoryIssueDetected() bool {
 
 // SetsuccessReadGameWorldSettings 设置成功读取游戏世界设置标志
 func SetsuccessReadGameWorldSettings(flag bool) {
-	cfg.Section("").Key("SuccessReadGameWorldSettings").SetValue(strconv.FormatBool(flag))
+	file().Section("").Key("SuccessReadGameWorldSettings").SetValue(strconv.FormatBool(flag))
 	saveConfig()
 }
 
 // GetsuccessReadGameWorldSettings 获取成功读取游戏世界设置标志的当前值
 func GetsuccessReadGameWorldSettings() bool {
-	flag, err := cfg.Section("").Key("SuccessReadGameWorldSettings").Bool()
+	flag, err := file().Section("").Key("SuccessReadGameWorldSettings").Bool()
 	if err != nil {
 		return false
 	}
@@ -81,13 +96,13 @@ func GetsuccessReadGameWorldSettings() bool {
 
 // SetManualServerShutdown 设置手动关闭服务器的状态
 func SetManualServerShutdown(flag bool) {
-	cfg.Section("").Key("ManualServerShutdown").SetValue(strconv.FormatBool(flag))
+	file().Section("").Key("ManualServerShutdown").SetValue(strconv.FormatBool(flag))
 	saveConfig()
 }
 
 // GetManualServerShutdown 获取手动关闭服务器的状态
 func GetManualServerShutdown() bool {
-	flag, err := cfg.Section("").Key("ManualServerShutdown").Bool()
+	flag, err := file().Section("").Key("ManualServerShutdown").Bool()
 	if err != nil {
 		return false
 	}
@@ -95,12 +110,12 @@ func GetManualServerShutdown() bool {
 }
 
 func SetGlobalPid(pid int) {
-	cfg.Section("").Key("GlobalPid").SetValue(strconv.Itoa(pid))
+	file().Section("").Key("GlobalPid").SetValue(strconv.Itoa(pid))
 	saveConfig()
 }
 
 func GetGlobalPid() int {
-	pid, err := cfg.Section("").Key("GlobalPid").Int()
+	pid, err := file().Section("").Key("GlobalPid").Int()
 	if err != nil {
 		return 0
 	}
@@ -108,12 +123,12 @@ func GetGlobalPid() int {
 }
 
 func SetGlobalSubPid(pid int) {
-	cfg.Section("").Key("GlobalSubPid").SetValue(strconv.Itoa(pid))
+	file().Section("").Key("GlobalSubPid").SetValue(strconv.Itoa(pid))
 	saveConfig()
 }
 
 func GetGlobalSubPid() int {
-	pid, err := cfg.Section("").Key("GlobalSubPid").Int()
+	pid, err := file().Section("").Key("GlobalSubPid").Int()
 	if err != nil {
 		return 0
 	}
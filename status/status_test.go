@@ -0,0 +1,27 @@
+package status
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.ini")
+	SetPath(path)
+
+	SetGlobalPid(42)
+	SetManualServerShutdown(true)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("state file: %v", err)
+	}
+
+	// 重新加载后状态不变
+	SetPath(path)
+	if GetGlobalPid() != 42 || !GetManualServerShutdown() {
+		t.Errorf("pid = %d, manual shutdown = %v", GetGlobalPid(), GetManualServerShutdown())
+	}
+	if _, err := os.Stat("config.ini"); !os.IsNotExist(err) {
+		t.Error("state written to the working directory")
+	}
+}
@@ -1,29 +1,47 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"os/exec"
-	"runtime"
+	"log"
+	"net"
 	"strconv"
-	"strings"
 	"time"
 
+	"github.com/hoshinonyaruko/palworld-go/audit"
 	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/event"
+	"github.com/hoshinonyaruko/palworld-go/health"
+	"github.com/hoshinonyaruko/palworld-go/lifecycle"
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+	"github.com/hoshinonyaruko/palworld-go/restart"
 	"github.com/hoshinonyaruko/palworld-go/status"
 	"github.com/hoshinonyaruko/palworld-go/sys"
+	"github.com/hoshinonyaruko/palworld-go/tool"
 )
 
 type Supervisor struct {
 	Config     config.Config
 	RconClient RconClient
+	Lifecycle  *lifecycle.Machine
 }
 
 func NewSupervisor(config config.Config) *Supervisor {
-	return &Supervisor{Config: config}
+	lifecycle.Default.SetOptions(lifecycle.Options{
+		BaseDelay:   time.Duration(config.CrashBackoffBase) * time.Second,
+		MaxDelay:    time.Duration(config.CrashBackoffMax) * time.Second,
+		MaxRestarts: config.CrashMaxRestarts,
+		Window:      time.Duration(config.CrashRestartWindow) * time.Second,
+		StartGrace:  time.Duration(config.CrashStartGrace) * time.Second,
+	})
+	return &Supervisor{Config: config, Lifecycle: lifecycle.Default}
 }
 
 func (s *Supervisor) Start() {
+	// 子进程退出时立即处理,不必等到下一次检查。不检查进程存活时也要处理崩溃
+	sys.SetExitHandler(s.handleExit)
+
 	if s.Config.CheckInterval == 0 {
 		fmt.Println("CheckInterval 设置为 0，不检查进程存活")
 		return // 直接返回，不启动定时器
@@ -33,66 +51,108 @@ func (s *Supervisor) Start() {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		// 在尝试重启服务之前检查是否手动关闭了服务器
+		// 手动关闭的服务器交给状态机进入Stopped,不会被拉起
 		if status.GetManualServerShutdown() {
-			fmt.Println("检测到服务器已手动关闭，不执行重启操作")
-			continue // 跳过本次循环，不执行重启操作
+			if state := s.Lifecycle.State(); state != lifecycle.Stopped && state != lifecycle.Stopping {
+				fmt.Println("检测到服务器已手动关闭，不执行重启操作")
+				s.Lifecycle.Stop("手动关闭")
+			}
 		}
 
-		if !s.isServiceRunning() {
+		running := s.isServiceRunning()
+		if s.Lifecycle.Observe(running, status.GetGlobalPid()) == lifecycle.ActionStart {
 			sys.RestartService(s.Config)
-		} else {
-			fmt.Println("当前正常运行中~")
 		}
-		if s.hasDefunct() {
-			fmt.Printf("发现僵尸进程，准备清理~\n")
-			// 此处只考虑僵尸进程是由自身内存释放导致的，如有其他原因，后续再patch
-			sys.RestartApplication()
+		switch state := s.Lifecycle.State(); state {
+		case lifecycle.Running:
+			fmt.Println("当前正常运行中~")
+		case lifecycle.Backoff, lifecycle.Disabled:
+			fmt.Printf("服务端当前状态: %v\n", state)
 		}
+
 	}
 }
 
-func (s *Supervisor) hasDefunct() bool {
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		return false
-	} else {
-		cmd = exec.Command("ps", "-ef")
+// handleExit 交给状态机处理子进程退出,需要等待后重启时到时间再检查一次,不依赖定时检查
+func (s *Supervisor) handleExit(exit sys.Exit) {
+	if s.Lifecycle.Exited(exit.Pid, exit.Expected, exit.Clean(), exit.String()) == lifecycle.ActionStart {
+		sys.RestartService(s.Config)
+		return
 	}
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if err != nil {
-		fmt.Printf("[ERROR] %v", err)
+	if next := s.Lifecycle.Snapshot().NextStart; next != nil {
+		time.AfterFunc(time.Until(*next), func() {
+			if s.Lifecycle.Observe(s.isServiceRunning(), status.GetGlobalPid()) == lifecycle.ActionStart {
+				sys.RestartService(s.Config)
+			}
+		})
 	}
-	return strings.Contains(out.String(), "[PalServer.sh] <defunct>")
 }
 
+// isServiceRunning 检查服务端进程是否存活,自己启动的子进程以Wait的结果为准
 func (s *Supervisor) isServiceRunning() bool {
-	pid := status.GetGlobalPid() // 假设这是从之前存储的地方获取PID
-	if pid == 0 {
-		return false
-	}
+	return sys.IsRunning(status.GetGlobalPid())
+}
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("tasklist", "/FI", fmt.Sprintf("PID eq %d", pid))
-	} else {
-		cmd = exec.Command("ps", "-p", strconv.Itoa(pid))
+// HealthProbes 根据配置创建健康检查探针,阈值不大于0的探针不启用
+func (s *Supervisor) HealthProbes() []health.Probe {
+	ctx := func(ctx context.Context) context.Context {
+		return audit.WithOrigin(ctx, audit.OriginHealth)
 	}
-
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if err != nil {
-		return false
+	// 游戏端口不回应A2S查询,查询由Steam查询端口负责
+	queryPort := s.Config.HealthQueryPort
+	if queryPort == 0 {
+		queryPort = 27015
+	}
+	return []health.Probe{
+		{
+			Name:      "rcon",
+			Threshold: s.Config.HealthRconThreshold,
+			Check: func(c context.Context) error {
+				client, err := tool.NewPalworldClient(s.Config)
+				if err != nil {
+					return err
+				}
+				// 旧版本服务端的Info格式不同,但已经说明服务端有响应
+				if _, err := client.Info(ctx(c)); err != nil && !errors.Is(err, palworld.ErrUnexpectedResponse) {
+					return err
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "udp",
+			Threshold: s.Config.HealthUdpThreshold,
+			Check:     health.UDPCheck(net.JoinHostPort(s.Config.Address, strconv.Itoa(queryPort))),
+		},
+		{
+			Name:      "rest",
+			Threshold: s.Config.HealthRestThreshold,
+			Check: func(c context.Context) error {
+				_, err := tool.NewRestClient(s.Config).Info(ctx(c))
+				return err
+			},
+		},
 	}
+}
 
-	if runtime.GOOS == "windows" {
-		// 检查输出中是否有行包含PID，这意味着进程存在
-		return strings.Contains(out.String(), strconv.Itoa(pid))
-	} else {
-		// Unix/Linux，如果`ps`命令找到了PID，它会返回成功
-		return true
+// HealthActive 服务端已运行超过启动宽限期时才进行健康检查
+func (s *Supervisor) HealthActive() bool {
+	snapshot := s.Lifecycle.Snapshot()
+	return snapshot.State == lifecycle.Running &&
+		time.Since(snapshot.Since) >= time.Duration(s.Config.HealthStartupGrace)*time.Second
+}
+
+// ForceRestart 服务端无响应时跳过倒计时和正常关闭,尽量保存后强制结束进程并重新启动
+func (s *Supervisor) ForceRestart(status health.Status) {
+	event.Publish(event.ServerUnhealthy{Probe: status.Name, Failures: status.Failures, Error: status.LastError})
+	fmt.Printf("健康检查%v连续失败%d次,保存并强制重启服务端\n", status.Name, status.Failures)
+
+	_, err := restart.Default.Restart(restart.Request{
+		Reason: restart.ReasonHealth,
+		Detail: fmt.Sprintf("健康检查%v连续失败%d次", status.Name, status.Failures),
+		Force:  true,
+	})
+	if err != nil {
+		log.Printf("强制重启失败: %v", err)
 	}
 }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/health"
+	"github.com/hoshinonyaruko/palworld-go/lifecycle"
+	"github.com/hoshinonyaruko/palworld-go/palworld/palworldtest"
+	"github.com/hoshinonyaruko/palworld-go/restart"
+	"github.com/hoshinonyaruko/palworld-go/tool"
+)
+
+// newSupervisor 启动带REST API的模拟服务端,返回检查它的守护
+func newSupervisor(t *testing.T) (*Supervisor, *palworldtest.Server) {
+	t.Helper()
+
+	server := palworldtest.NewServer()
+	server.StartREST()
+	t.Cleanup(func() {
+		tool.GetRconPool(server.Addr(), server.Password()).Close()
+		server.Close()
+	})
+
+	cfg := server.Config()
+	cfg.HealthRconThreshold = 1
+	cfg.HealthRestThreshold = 1
+	return &Supervisor{Config: cfg, Lifecycle: lifecycle.New(lifecycle.Options{}, nil)}, server
+}
+
+func TestSupervisor_HealthProbes(t *testing.T) {
+	s, server := newSupervisor(t)
+	checker := health.New(s.HealthProbes(), time.Second, time.Second)
+	var tripped []health.Status
+	checker.OnUnhealthy = func(status health.Status) { tripped = append(tripped, status) }
+
+	checker.CheckOnce(context.Background())
+	if !checker.Live() || !checker.Ready() {
+		t.Fatalf("statuses = %+v", checker.Statuses())
+	}
+	// udp阈值为0,探针不启用
+	if statuses := checker.Statuses(); len(statuses) != 2 {
+		t.Errorf("statuses = %+v", statuses)
+	}
+
+	// 服务端不再响应Info,所有启用的探针失败
+	server.InjectFailure("Info", 0, palworldtest.Failure{Drop: true})
+	checker.CheckOnce(context.Background())
+	if checker.Live() || checker.Ready() {
+		t.Fatalf("statuses = %+v", checker.Statuses())
+	}
+	for _, status := range checker.Statuses() {
+		if status.Healthy {
+			t.Errorf("status = %+v", status)
+		}
+	}
+	// 服务端变为无响应时只通知一次
+	if len(tripped) != 1 {
+		t.Errorf("tripped = %+v", tripped)
+	}
+}
+
+func TestSupervisor_HealthActive(t *testing.T) {
+	s, _ := newSupervisor(t)
+
+	s.Lifecycle.Start("测试")
+	if s.HealthActive() {
+		t.Error("health check active while starting")
+	}
+	s.Lifecycle.Observe(true, 1)
+	if !s.HealthActive() {
+		t.Error("health check inactive while running")
+	}
+
+	// 启动宽限期内不检查
+	s.Config.HealthStartupGrace = 60
+	if s.HealthActive() {
+		t.Error("health check active during the startup grace")
+	}
+}
+
+func TestSupervisor_ForceRestart(t *testing.T) {
+	s, server := newSupervisor(t)
+	s.Config.HealthRestThreshold = 0
+	checker := health.New(s.HealthProbes(), time.Second, time.Second)
+	checker.OnUnhealthy = s.ForceRestart
+
+	// 编排器的各步骤操作模拟服务端
+	saved := restart.Default
+	t.Cleanup(func() { restart.Default = saved })
+	restart.Default = restart.New(nil)
+	restart.Default.Save = func(ctx context.Context) error {
+		client, err := tool.NewServerClient(s.Config)
+		if err != nil {
+			return err
+		}
+		return client.Save(ctx)
+	}
+	restart.Default.Kill = func() error {
+		server.Close()
+		return nil
+	}
+	restart.Default.Running = server.Running
+	restart.Default.Start = func(reason restart.Reason) error {
+		server.ClearFailures()
+		return server.Restart()
+	}
+	restart.Default.Verify = checker.Verify
+	restart.Default.VerifyPoll = 10 * time.Millisecond
+
+	server.InjectFailure("Info", 0, palworldtest.Failure{Drop: true})
+	checker.CheckOnce(context.Background())
+
+	deadline := time.Now().Add(5 * time.Second)
+	var runs []restart.Run
+	for {
+		runs = restart.Default.History()
+		if len(runs) > 0 && runs[0].Status != restart.StatusRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("forced restart did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	run := runs[0]
+	if run.Reason != restart.ReasonHealth || run.Status != restart.StatusCompleted {
+		t.Fatalf("run = %+v", run)
+	}
+	// 强制重启跳过正常关闭
+	for _, step := range run.Steps {
+		if step.Name == restart.StepStop {
+			t.Errorf("forced restart ran the stop step: %+v", run.Steps)
+		}
+	}
+	if !server.Running() {
+		t.Error("server is not running after the restart")
+	}
+
+	checker.CheckOnce(context.Background())
+	if !checker.Live() {
+		t.Errorf("statuses after restart = %+v", checker.Statuses())
+	}
+}
@@ -0,0 +1,188 @@
+package sys
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/event"
+	"github.com/shirou/gopsutil/process"
+)
+
+// Exit 服务端进程退出的信息
+type Exit struct {
+	Pid    int    `json:"pid"`
+	Code   int    `json:"code"`
+	Signal string `json:"signal,omitempty"`
+	// Expected 由KillProcess主动结束
+	Expected bool      `json:"expected"`
+	Time     time.Time `json:"time"`
+}
+
+// Clean 是否为正常退出:被主动结束,或进程自行以0退出(如RCON的DoExit和Shutdown)
+func (e Exit) Clean() bool {
+	return e.Expected || (e.Code == 0 && e.Signal == "")
+}
+
+func (e Exit) String() string {
+	var s string
+	if e.Signal != "" {
+		s = "signal: " + e.Signal
+	} else {
+		s = fmt.Sprintf("exit code %d", e.Code)
+	}
+	if e.Expected {
+		s += " (killed)"
+	}
+	return s
+}
+
+// child 由本进程启动并负责回收的服务端进程
+type child struct {
+	cmd *exec.Cmd
+	// report 退出时是否上报给exitHandler
+	report   bool
+	done     bool
+	expected bool
+}
+
+// outputWaitDelay 进程退出后等待输出管道关闭的最长时间,防止孙进程占用管道导致Wait无法返回
+const outputWaitDelay = 5 * time.Second
+
+var (
+	// serverStdout serverStderr 服务端进程的输出,为nil时不捕获
+	serverStdout io.Writer
+	serverStderr io.Writer
+
+	childMu     sync.Mutex
+	current     *child
+	lastExit    *Exit
+	exitHandler func(Exit)
+)
+
+// SetExitHandler 设置服务端进程退出时的回调,在回收进程的goroutine中调用
+func SetExitHandler(handler func(Exit)) {
+	childMu.Lock()
+	defer childMu.Unlock()
+	exitHandler = handler
+}
+
+// SetOutput 设置之后启动的服务端进程的stdout和stderr
+func SetOutput(stdout, stderr io.Writer) {
+	childMu.Lock()
+	defer childMu.Unlock()
+	serverStdout, serverStderr = stdout, stderr
+}
+
+// captureOutput 把服务端进程的输出接到SetOutput设置的Writer上,返回是否已接管输出
+func captureOutput(cmd *exec.Cmd) bool {
+	childMu.Lock()
+	defer childMu.Unlock()
+
+	if serverStdout == nil && serverStderr == nil {
+		return false
+	}
+	cmd.Stdout = serverStdout
+	cmd.Stderr = serverStderr
+	cmd.WaitDelay = outputWaitDelay
+	return true
+}
+
+// LastExit 返回最近一次服务端进程退出的信息
+func LastExit() (Exit, bool) {
+	childMu.Lock()
+	defer childMu.Unlock()
+	if lastExit == nil {
+		return Exit{}, false
+	}
+	return *lastExit, true
+}
+
+// watch 接管已经Start的子进程,在后台Wait回收,避免留下僵尸进程。
+// report为false时只回收不上报,用于启动器等不代表服务端本身的进程
+func watch(cmd *exec.Cmd, report bool) {
+	c := &child{cmd: cmd, report: report}
+	if report {
+		childMu.Lock()
+		current = c
+		childMu.Unlock()
+	}
+
+	go func() {
+		err := cmd.Wait()
+		if !report {
+			return
+		}
+
+		exit := Exit{Pid: cmd.Process.Pid, Time: time.Now()}
+		if state := cmd.ProcessState; state != nil {
+			exit.Code = state.ExitCode()
+			if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+				exit.Signal = ws.Signal().String()
+			}
+		} else if err != nil {
+			exit.Code = -1
+		}
+
+		childMu.Lock()
+		c.done = true
+		exit.Expected = c.expected
+		// 已经被新启动的进程替换时不再上报
+		isCurrent := current == c
+		if isCurrent {
+			lastExit = &exit
+		}
+		handler := exitHandler
+		childMu.Unlock()
+
+		if !isCurrent {
+			return
+		}
+		log.Printf("服务端进程 PID %d 已退出: %v", exit.Pid, exit)
+		if exit.Clean() && !exit.Expected {
+			event.Publish(event.ServerStopped{Pid: exit.Pid})
+		}
+		if handler != nil {
+			handler(exit)
+		}
+	}()
+}
+
+// expectExit 标记当前子进程即将被主动结束,退出时视为正常退出
+func expectExit() {
+	childMu.Lock()
+	defer childMu.Unlock()
+	if current != nil {
+		current.expected = true
+	}
+}
+
+// IsRunning 判断服务端进程是否存活。由本进程启动的子进程以Wait的结果为准,
+// 其他进程(如palworld-go重启前启动的)通过gopsutil检查,僵尸进程视为已退出
+func IsRunning(pid int) bool {
+	if pid == 0 {
+		return false
+	}
+
+	childMu.Lock()
+	if current != nil && current.cmd.Process.Pid == pid {
+		done := current.done
+		childMu.Unlock()
+		return !done
+	}
+	childMu.Unlock()
+
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return false
+	}
+	if s, err := p.Status(); err == nil && strings.HasPrefix(s, "Z") {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package sys
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// start 启动并接管一个子进程,返回它退出时上报的Exit
+func start(t *testing.T, name string, args ...string) (*exec.Cmd, <-chan Exit) {
+	t.Helper()
+
+	exits := make(chan Exit, 1)
+	SetExitHandler(func(exit Exit) { exits <- exit })
+	t.Cleanup(func() { SetExitHandler(nil) })
+
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start %v: %v", name, err)
+	}
+	t.Cleanup(func() { cmd.Process.Kill() })
+	watch(cmd, true)
+	return cmd, exits
+}
+
+func waitExit(t *testing.T, exits <-chan Exit) Exit {
+	t.Helper()
+	select {
+	case exit := <-exits:
+		return exit
+	case <-time.After(5 * time.Second):
+		t.Fatal("exit was not reported")
+		return Exit{}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		kill      bool
+		expected  bool
+		wantCode  int
+		wantSig   string
+		wantClean bool
+	}{
+		{"clean exit", []string{"-c", "exit 0"}, false, false, 0, "", true},
+		{"exit code", []string{"-c", "exit 3"}, false, false, 3, "", false},
+		{"killed unexpectedly", []string{"-c", "sleep 10"}, true, false, -1, "killed", false},
+		{"killed by KillProcess", []string{"-c", "sleep 10"}, true, true, -1, "killed", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, exits := start(t, "sh", tt.args...)
+			pid := cmd.Process.Pid
+			if tt.kill {
+				if !IsRunning(pid) {
+					t.Fatal("IsRunning = false before the process exited")
+				}
+				if tt.expected {
+					expectExit()
+				}
+				cmd.Process.Kill()
+			}
+
+			exit := waitExit(t, exits)
+			if exit.Pid != pid || exit.Code != tt.wantCode || exit.Signal != tt.wantSig || exit.Expected != tt.expected {
+				t.Errorf("exit = %+v", exit)
+			}
+			if exit.Clean() != tt.wantClean {
+				t.Errorf("Clean() = %v, want %v", exit.Clean(), tt.wantClean)
+			}
+			if IsRunning(pid) {
+				t.Error("IsRunning = true after the process was reaped")
+			}
+			if last, ok := LastExit(); !ok || last != exit {
+				t.Errorf("LastExit = %+v, %v", last, ok)
+			}
+		})
+	}
+}
+
+func TestWatch_Replaced(t *testing.T) {
+	old, _ := start(t, "sh", "-c", "sleep 10")
+	_, exits := start(t, "sh", "-c", "sleep 10")
+
+	// 已经被新进程替换的子进程退出时不上报
+	old.Process.Kill()
+	select {
+	case exit := <-exits:
+		t.Errorf("replaced process reported %+v", exit)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestIsRunning_Zombie(t *testing.T) {
+	// 不是由watch接管的进程退出后未被回收,成为僵尸进程
+	cmd := exec.Command("sh", "-c", "exit 0")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer cmd.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for IsRunning(cmd.Process.Pid) {
+		if time.Now().After(deadline) {
+			t.Fatal("zombie process reported as running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"syscall"
 
 	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/event"
 	"github.com/hoshinonyaruko/palworld-go/status"
 )
 
@@ -68,7 +69,12 @@ func KillProcess(config config.Config) error {
 		cmd = exec.Command("pkill", "-f", "PalServer-Linux-Test")
 	}
 
-	return cmd.Run()
+	expectExit()
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	event.Publish(event.ServerStopped{Pid: status.GetGlobalPid()})
+	return nil
 }
 
 // RunViaBatch 函数接受配置，程序路径和参数数组
@@ -107,7 +113,10 @@ func RestartService(config config.Config) {
 		if err := cmd.Start(); err != nil {
 			log.Printf("Failed to restart game server: %v", err)
 		} else {
+			// 只回收systemctl进程,服务端由systemd管理
+			watch(cmd, false)
 			log.Printf("Game server restarted successfully")
+			event.Publish(event.ServerStarted{})
 		}
 	} else {
 		// 执行启动命令
@@ -115,17 +124,20 @@ func RestartService(config config.Config) {
 
 		cmd := exec.Command(exePath, args...)
 		cmd.Dir = config.GamePath // 设置工作目录为游戏路径
+		captureOutput(cmd)
 
 		// 启动进程
 		if err := cmd.Start(); err != nil {
 			log.Printf("Failed to restart game server: %v", err)
-		} else {
-			log.Printf("Game server restarted successfully")
+			return
 		}
+		// 由守护负责回收子进程并上报退出码
+		watch(cmd, true)
 
 		// 获取并打印 PID
 		log.Printf("Game server started successfully with PID %d", cmd.Process.Pid)
 		status.SetGlobalPid(cmd.Process.Pid)
+		event.Publish(event.ServerStarted{Pid: cmd.Process.Pid})
 	}
 
 }
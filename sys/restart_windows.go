@@ -17,8 +17,8 @@ import (
 	"time"
 	"unsafe"
 
-	"github.com/hoshinonyaruko/palworld-go/bot"
 	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/event"
 	"github.com/hoshinonyaruko/palworld-go/mod"
 	"github.com/hoshinonyaruko/palworld-go/status"
 	"gopkg.in/ini.v1"
@@ -85,14 +85,13 @@ func setConsoleTitleWindows(title string) error {
 func KillProcess(config config.Config) error {
 	pid := status.GetGlobalPid()
 	subPid := status.GetGlobalSubPid()
-	//发送机器人推送
-	bot.SendCommandMessages("stop", config)
 	fmt.Printf("获取到当前服务端进程pid:%v\n", pid)
 	if pid == 0 {
 		return fmt.Errorf("invalid PID: %d", pid)
 	}
 
 	// 结束主进程
+	expectExit()
 	err := killByPid(pid)
 	if err != nil {
 		return err
@@ -107,6 +106,7 @@ func KillProcess(config config.Config) error {
 		}
 	}
 
+	event.Publish(event.ServerStopped{Pid: pid})
 	return nil
 }
 
@@ -209,8 +209,6 @@ func RestartService(config config.Config) {
 	var exePath string
 	var args []string
 
-	//发送机器人推送
-	bot.SendCommandMessages("run", config)
 	if config.UseDll {
 		err := mod.CheckAndWriteFiles(filepath.Join(config.GamePath, "Pal", "Binaries", "Win64"), config)
 		if err != nil {
@@ -278,7 +276,8 @@ func RestartService(config config.Config) {
 	// }
 	cmd := exec.Command(exePath, args...)
 	cmd.Dir = config.GamePath // 设置工作目录为游戏路径
-	if runtime.GOOS == "windows" {
+	// 捕获输出时不再为服务端单独打开控制台窗口(CREATE_NEW_CONSOLE)
+	if !captureOutput(cmd) && runtime.GOOS == "windows" {
 		// 仅在Windows平台上设置
 		cmd.SysProcAttr = &syscall.SysProcAttr{
 			CreationFlags: 16,
@@ -288,9 +287,12 @@ func RestartService(config config.Config) {
 	// 启动进程
 	if err := cmd.Start(); err != nil {
 		log.Printf("Failed to restart game server: %v", err)
-	} else {
-		log.Printf("Game server restarted successfully")
+		return
 	}
+	log.Printf("Game server restarted successfully")
+	event.Publish(event.ServerStarted{Pid: cmd.Process.Pid})
+	// 由守护负责回收子进程,使用PalServer.exe启动时它只是启动器,退出不代表服务端退出
+	watch(cmd, !config.UsePalServerExe)
 
 	// 获取并打印 PID
 	log.Printf("Game server started successfully with PID %d", cmd.Process.Pid)
@@ -0,0 +1,98 @@
+package tool
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/audit"
+	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+)
+
+const (
+	// BackendRcon 通过RCON管理服务端
+	BackendRcon = "rcon"
+	// BackendRest 通过官方REST API管理服务端
+	BackendRest = "rest"
+	// BackendAuto 优先使用REST API,连接失败时回退到RCON
+	BackendAuto = "auto"
+)
+
+// restHTTPClient 所有REST API请求共享的http客户端,复用长连接
+var restHTTPClient = &http.Client{
+	Timeout:   time.Duration(timeout) * time.Second,
+	Transport: auditTransport{http.DefaultTransport},
+}
+
+// auditTransport 把经由REST API发出的指令也写入审计日志
+type auditTransport struct {
+	next http.RoundTripper
+}
+
+func (t auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	command := "REST " + req.Method + " " + req.URL.Path
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(body)
+			body.Close()
+			if len(data) > 0 {
+				command += " " + string(data)
+			}
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		audit.Record(req.Context(), command, "", time.Since(start), err)
+		return nil, err
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	audit.Record(req.Context(), command, resp.Status+" "+string(data), time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return resp, nil
+}
+
+// NewServerClient 根据config.Backend创建服务端管理客户端
+func NewServerClient(config config.Config) (palworld.Server, error) {
+	switch strings.ToLower(strings.TrimSpace(config.Backend)) {
+	case BackendRest:
+		return NewRestClient(config), nil
+	case BackendAuto:
+		rest := NewRestClient(config)
+		rcon, err := NewPalworldClient(config)
+		if err != nil {
+			// 没有设置RCON密码时只能使用REST API
+			return rest, nil
+		}
+		return palworld.NewFallback(rest, rcon), nil
+	default:
+		return NewPalworldClient(config)
+	}
+}
+
+// NewRestClient 根据配置创建官方REST API客户端,密码与RCON相同均为AdminPassword
+func NewRestClient(config config.Config) *palworld.RESTClient {
+	port := config.RestApiPort
+	if port == 0 {
+		port = palworld.DefaultRESTPort
+	}
+
+	var password string
+	if config.WorldSettings != nil {
+		password = config.WorldSettings.AdminPassword
+	}
+
+	baseURL := "http://" + net.JoinHostPort(config.Address, strconv.Itoa(port))
+	return palworld.NewRESTClient(baseURL, password, restHTTPClient)
+}
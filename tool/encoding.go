@@ -0,0 +1,64 @@
+package tool
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gorcon/rcon"
+	"github.com/hoshinonyaruko/palworld-go/config"
+)
+
+const (
+	// RconEncodingAuto 启动时根据palguard.json的RCONbase64决定一次
+	RconEncodingAuto = "auto"
+	// RconEncodingPlain 明文发送指令
+	RconEncodingPlain = "plain"
+	// RconEncodingBase64 以base64发送指令并解码响应
+	RconEncodingBase64 = "base64"
+)
+
+// PalguardJSONPath 返回palguard.json的路径,位于游戏目录的Pal/Binaries/Win64下
+func PalguardJSONPath(config config.Config) string {
+	return filepath.Join(config.GamePath, "Pal", "Binaries", "Win64", "palguard.json")
+}
+
+// ResolveRconEncoding 根据config.RconEncoding确定RCON指令的编码方式,应在启动时调用一次。
+// auto时只有开启了dll注入且palguard.json中RCONbase64为true才使用base64。
+func ResolveRconEncoding(config config.Config) rcon.Encoding {
+	switch strings.ToLower(strings.TrimSpace(config.RconEncoding)) {
+	case RconEncodingPlain:
+		return rcon.EncodingPlain
+	case RconEncodingBase64:
+		return rcon.EncodingBase64
+	}
+
+	if !config.UseDll {
+		return rcon.EncodingPlain
+	}
+
+	path := PalguardJSONPath(config)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("读取%v失败,RCON使用明文指令: %v", path, err)
+		}
+		return rcon.EncodingPlain
+	}
+
+	var palguard struct {
+		RCONbase64 bool `json:"RCONbase64"`
+	}
+	if err := json.Unmarshal(data, &palguard); err != nil {
+		log.Printf("解析%v失败,RCON使用明文指令: %v", path, err)
+		return rcon.EncodingPlain
+	}
+
+	if palguard.RCONbase64 {
+		log.Printf("palguard.json中开启了RCONbase64,RCON指令将以base64发送")
+		return rcon.EncodingBase64
+	}
+	return rcon.EncodingPlain
+}
@@ -0,0 +1,48 @@
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorcon/rcon"
+	"github.com/hoshinonyaruko/palworld-go/config"
+)
+
+func TestResolveRconEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		useDll   bool
+		palguard string // 为空时不创建palguard.json
+		want     rcon.Encoding
+	}{
+		{"plain", "plain", true, `{"RCONbase64": true}`, rcon.EncodingPlain},
+		{"base64", "base64", false, "", rcon.EncodingBase64},
+		{"explicit is case insensitive", " Base64 ", false, "", rcon.EncodingBase64},
+		{"auto without dll", "auto", false, `{"RCONbase64": true}`, rcon.EncodingPlain},
+		{"auto with base64 enabled", "auto", true, `{"RCONbase64": true}`, rcon.EncodingBase64},
+		{"auto with base64 disabled", "auto", true, `{"RCONbase64": false}`, rcon.EncodingPlain},
+		{"auto without palguard.json", "auto", true, "", rcon.EncodingPlain},
+		{"auto with invalid palguard.json", "auto", true, `{`, rcon.EncodingPlain},
+		{"empty defaults to auto", "", true, `{"RCONbase64": true}`, rcon.EncodingBase64},
+		{"unknown defaults to auto", "utf16", false, "", rcon.EncodingPlain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{GamePath: t.TempDir(), RconEncoding: tt.encoding, UseDll: tt.useDll}
+			if tt.palguard != "" {
+				path := PalguardJSONPath(cfg)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(tt.palguard), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := ResolveRconEncoding(cfg); got != tt.want {
+				t.Errorf("ResolveRconEncoding() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@
 package tool
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -11,7 +12,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/gorcon/rcon"
+	"github.com/hoshinonyaruko/palworld-go/audit"
 	"github.com/hoshinonyaruko/palworld-go/config"
 )
 
@@ -20,7 +21,8 @@ var (
 )
 
 type ExecuteCloser interface {
-	Execute(command string, usedll bool) (string, error)
+	Execute(command string) (string, error)
+	ExecuteContext(ctx context.Context, command string) (string, error)
 	Close() error
 }
 
@@ -31,28 +33,28 @@ type Executor struct {
 
 var timeout int = 10
 
+// NewExecutor 返回一个使用共享RCON连接池的执行器,不会为每次调用单独建立连接
 func NewExecutor(address, password string, skipErrors bool) (*Executor, error) {
-	var client ExecuteCloser
-	var err error
-
 	if password == "" {
 		return nil, ErrPasswordEmpty
 	}
 
-	timeoutDuration := time.Duration(timeout) * time.Second
-
-	client, err = rcon.Dial(address, password, rcon.SetDialTimeout(timeoutDuration), rcon.SetDeadline(timeoutDuration))
-
-	if err != nil {
-		return nil, err
-	}
+	client := &pooledClient{pool: GetRconPool(address, password)}
 
 	return &Executor{client: client, skipErrors: skipErrors}, nil
 }
 
-func (e *Executor) Execute(command string, usedll bool) (string, error) {
+func (e *Executor) Execute(command string) (string, error) {
+	return e.ExecuteContext(context.Background(), command)
+}
+
+// ExecuteContext 执行指令,ctx被取消(例如HTTP客户端断开)时立即停止等待。
+// 每条指令都会连同ctx中的来源和用户写入审计日志。
+func (e *Executor) ExecuteContext(ctx context.Context, command string) (string, error) {
 
-	response, err := e.client.Execute(command, usedll)
+	start := time.Now()
+	response, err := e.client.ExecuteContext(ctx, command)
+	audit.Record(ctx, command, response, time.Since(start), err)
 
 	if response != "" {
 		response = strings.TrimSpace(response)
@@ -71,6 +73,23 @@ func (e *Executor) Close() error {
 	return nil
 }
 
+// pooledClient 把连接池包装成ExecuteCloser,Close时只是归还而不关闭共享连接
+type pooledClient struct {
+	pool *RconPool
+}
+
+func (c *pooledClient) Execute(command string) (string, error) {
+	return c.pool.Execute(command)
+}
+
+func (c *pooledClient) ExecuteContext(ctx context.Context, command string) (string, error) {
+	return c.pool.ExecuteContext(ctx, command)
+}
+
+func (c *pooledClient) Close() error {
+	return nil
+}
+
 // UpdateServer 使用SteamCMD更新服务端
 func CreateAndRunPSScript(config config.Config) error {
 	scriptContent := fmt.Sprintf("$SteamCmdPath = \"%s\\steamcmd.exe\"\n& $SteamCmdPath +login anonymous +app_update 2394010 validate +quit", config.SteamCmdPath)
@@ -82,13 +101,13 @@ func CreateAndRunPSScript(config config.Config) error {
 		return fmt.Errorf("failed to create PowerShell script: %w", err)
 	}
 
-	// 使用cmd /C start powershell来在新窗口中执行.ps1脚本
-	cmd := exec.Command("cmd", "/C", "start", "powershell", "-ExecutionPolicy", "Bypass", "-File", scriptPath)
-	err = cmd.Start()
-	if err != nil {
+	// 使用cmd /C start /WAIT powershell在新窗口中执行.ps1脚本,并等待更新结束后再启动服务端
+	log.Printf("PowerShell script started in a new window: %s", scriptPath)
+	cmd := exec.Command("cmd", "/C", "start", "/WAIT", "powershell", "-ExecutionPolicy", "Bypass", "-File", scriptPath)
+	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to execute PowerShell script: %w", err)
 	}
 
-	log.Printf("PowerShell script started in a new window: %s", scriptPath)
+	log.Printf("PowerShell script finished: %s", scriptPath)
 	return nil
 }
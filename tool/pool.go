@@ -0,0 +1,291 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorcon/rcon"
+)
+
+const (
+	// 默认每个RCON地址保持的长连接数量
+	defaultPoolSize = 2
+	// 默认保活探测间隔
+	defaultKeepAlive = 60 * time.Second
+	// 重连退避的初始值和上限
+	minReconnectBackoff = 1 * time.Second
+	maxReconnectBackoff = 60 * time.Second
+	// 保活探测使用的指令,Info对服务端没有副作用
+	keepAliveCommand = "Info"
+)
+
+var (
+	poolSettingsMu  sync.Mutex
+	poolSize        = defaultPoolSize
+	poolKeepAlive   = defaultKeepAlive
+	poolDialOptions []rcon.Option
+
+	poolsMu sync.Mutex
+	pools   = make(map[string]*RconPool)
+)
+
+// SetRconPoolSettings 设置之后新建连接池的大小和保活间隔,keepAlive为0时不做保活探测
+func SetRconPoolSettings(size int, keepAlive time.Duration) {
+	poolSettingsMu.Lock()
+	defer poolSettingsMu.Unlock()
+
+	if size <= 0 {
+		size = defaultPoolSize
+	}
+	poolSize = size
+	poolKeepAlive = keepAlive
+}
+
+// SetRconDialOptions 设置之后新建连接时附加的rcon选项,例如多包响应重组
+func SetRconDialOptions(options ...rcon.Option) {
+	poolSettingsMu.Lock()
+	defer poolSettingsMu.Unlock()
+
+	poolDialOptions = options
+}
+
+// GetRconPool 返回指定地址和密码对应的共享连接池,不存在时创建
+func GetRconPool(address, password string) *RconPool {
+	key := address + "\x00" + password
+
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+
+	if p, ok := pools[key]; ok {
+		return p
+	}
+
+	poolSettingsMu.Lock()
+	size, keepAlive, options := poolSize, poolKeepAlive, poolDialOptions
+	poolSettingsMu.Unlock()
+
+	p := NewRconPool(address, password, size, keepAlive, options...)
+	pools[key] = p
+	return p
+}
+
+// RconPool 维护到同一个RCON服务端的少量长连接,供定时任务、广播、白名单检查和网页控制台共享。
+// 每条连接同一时间只被一个调用方使用,断线后按指数退避自动重连。
+type RconPool struct {
+	address   string
+	password  string
+	keepAlive time.Duration
+	options   []rcon.Option
+
+	// slots 中的每个元素代表一条连接的使用权,nil表示该位置尚未建立连接
+	slots chan *rcon.Conn
+
+	mu       sync.Mutex
+	failures int
+	retryAt  time.Time
+	lastErr  error
+
+	closeOnce sync.Once
+	quit      chan struct{}
+}
+
+// NewRconPool 创建一个新的连接池,连接在第一次使用时才会建立
+func NewRconPool(address, password string, size int, keepAlive time.Duration, options ...rcon.Option) *RconPool {
+	if size <= 0 {
+		size = defaultPoolSize
+	}
+
+	p := &RconPool{
+		address:   address,
+		password:  password,
+		keepAlive: keepAlive,
+		options:   options,
+		slots:     make(chan *rcon.Conn, size),
+		quit:      make(chan struct{}),
+	}
+	for i := 0; i < size; i++ {
+		p.slots <- nil
+	}
+
+	if keepAlive > 0 {
+		go p.keepAliveLoop()
+	}
+
+	return p
+}
+
+// Execute 从池中取出一条连接执行指令,执行完毕后归还
+func (p *RconPool) Execute(command string) (string, error) {
+	return p.ExecuteContext(context.Background(), command)
+}
+
+// ExecuteContext 与Execute相同,但等待空闲连接、建立连接和执行指令都受ctx的取消和超时控制。
+// 被取消的连接状态未知,会被丢弃。
+func (p *RconPool) ExecuteContext(ctx context.Context, command string) (string, error) {
+	conn, reused, err := p.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := conn.ExecuteContext(ctx, command)
+	if err != nil && reused && isConnClosedByPeer(err) {
+		// 复用的连接已经被服务端关闭,指令没有被处理,换一条新连接重试一次
+		conn.Close()
+		if conn, err = p.dial(ctx); err != nil {
+			p.release(nil)
+			return "", err
+		}
+		response, err = conn.ExecuteContext(ctx, command)
+	}
+
+	if err != nil && !isCommandError(err) {
+		// 连接状态未知,丢弃,下次使用时重新建立
+		conn.Close()
+		p.release(nil)
+		return response, err
+	}
+
+	p.release(conn)
+	return response, err
+}
+
+// Close 关闭连接池中的所有空闲连接并停止保活
+func (p *RconPool) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.quit)
+	})
+
+	for i := 0; i < cap(p.slots); i++ {
+		select {
+		case conn := <-p.slots:
+			if conn != nil {
+				conn.Close()
+			}
+			p.slots <- nil
+		default:
+		}
+	}
+	return nil
+}
+
+// acquire 取得一条连接的使用权,必要时建立新连接
+func (p *RconPool) acquire(ctx context.Context) (*rcon.Conn, bool, error) {
+	var conn *rcon.Conn
+	select {
+	case conn = <-p.slots:
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+	if conn != nil {
+		return conn, true, nil
+	}
+
+	conn, err := p.dial(ctx)
+	if err != nil {
+		p.release(nil)
+		return nil, false, err
+	}
+	return conn, false, nil
+}
+
+// release 归还连接的使用权
+func (p *RconPool) release(conn *rcon.Conn) {
+	p.slots <- conn
+}
+
+// dial 建立并认证一条新连接,连续失败时在退避时间内直接返回上一次的错误,避免刷屏式地重复认证
+func (p *RconPool) dial(ctx context.Context) (*rcon.Conn, error) {
+	p.mu.Lock()
+	if p.failures > 0 && time.Now().Before(p.retryAt) {
+		err := p.lastErr
+		p.mu.Unlock()
+		return nil, fmt.Errorf("rcon重连退避中,%v后重试: %w", time.Until(p.retryAt).Round(time.Second), err)
+	}
+	p.mu.Unlock()
+
+	timeoutDuration := time.Duration(timeout) * time.Second
+	options := append([]rcon.Option{rcon.SetDialTimeout(timeoutDuration), rcon.SetDeadline(timeoutDuration)}, p.options...)
+	conn, err := rcon.DialContext(ctx, p.address, p.password, options...)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil && ctx.Err() != nil {
+		// 调用方主动取消,不计入连接失败
+		return nil, err
+	}
+
+	if err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		p.failures++
+		backoff := minReconnectBackoff << (p.failures - 1)
+		if backoff > maxReconnectBackoff || backoff <= 0 {
+			backoff = maxReconnectBackoff
+		}
+		p.retryAt = time.Now().Add(backoff)
+		p.lastErr = err
+		log.Printf("无法连接到RCON服务器%v(第%d次): %v,%v后重试", p.address, p.failures, err, backoff)
+		return nil, err
+	}
+
+	if p.failures > 0 {
+		log.Printf("已重新连接到RCON服务器%v", p.address)
+	}
+	p.failures = 0
+	p.lastErr = nil
+	return conn, nil
+}
+
+// keepAliveLoop 定期对空闲连接发送探测指令,及时发现被服务端断开的连接
+func (p *RconPool) keepAliveLoop() {
+	ticker := time.NewTicker(p.keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-ticker.C:
+			p.probeIdle()
+		}
+	}
+}
+
+// probeIdle 只探测当前空闲且已建立的连接,不会为了保活主动建立连接
+func (p *RconPool) probeIdle() {
+	for i := 0; i < cap(p.slots); i++ {
+		var conn *rcon.Conn
+		select {
+		case conn = <-p.slots:
+		default:
+			return
+		}
+
+		if conn != nil {
+			if _, err := conn.Execute(keepAliveCommand); err != nil && !isCommandError(err) {
+				log.Printf("RCON保活探测失败,丢弃连接: %v", err)
+				conn.Close()
+				conn = nil
+			}
+		}
+		p.release(conn)
+	}
+}
+
+// isCommandError 判断错误是否只是指令本身不合法,此时连接仍然可用
+func isCommandError(err error) bool {
+	return errors.Is(err, rcon.ErrCommandEmpty) || errors.Is(err, rcon.ErrCommandTooLong)
+}
+
+// isConnClosedByPeer 判断错误是否由服务端提前关闭连接导致
+func isConnClosedByPeer(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,201 @@
+package tool
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorcon/rcon/rcontest"
+)
+
+// poolServer 记录认证次数、指令和同时处理的指令数的RCON测试服务端
+type poolServer struct {
+	*rcontest.Server
+
+	auths    atomic.Int32
+	probes   atomic.Int32
+	inflight atomic.Int32
+	peak     atomic.Int32
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newPoolServer(t *testing.T) *poolServer {
+	t.Helper()
+	s := &poolServer{Server: rcontest.NewUnstartedServer()}
+	s.Settings.Password = "password"
+	s.SetAuthHandler(func(c *rcontest.Context) {
+		s.auths.Add(1)
+		s.mu.Lock()
+		s.conns = append(s.conns, c.Conn())
+		s.mu.Unlock()
+		rcontest.AuthHandler(c)
+	})
+	s.SetCommandHandler(func(c *rcontest.Context) {
+		switch c.Request().Body() {
+		case keepAliveCommand:
+			s.probes.Add(1)
+		case "slow":
+			n := s.inflight.Add(1)
+			for {
+				peak := s.peak.Load()
+				if n <= peak || s.peak.CompareAndSwap(peak, n) {
+					break
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			s.inflight.Add(-1)
+		}
+		_ = c.WriteResponse("ok " + c.Request().Body())
+	})
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// dropAll 模拟服务端断开所有已建立的连接
+func (s *poolServer) dropAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func TestRconPool_ReplacesDeadConnection(t *testing.T) {
+	server := newPoolServer(t)
+	pool := NewRconPool(server.Addr(), "password", 1, 0)
+	defer pool.Close()
+
+	if response, err := pool.Execute("first"); err != nil || response != "ok first" {
+		t.Fatalf("Execute = %q, %v", response, err)
+	}
+	if response, err := pool.Execute("second"); err != nil || response != "ok second" {
+		t.Fatalf("Execute = %q, %v", response, err)
+	}
+	if got := server.auths.Load(); got != 1 {
+		t.Fatalf("auths = %d, want the connection to be reused", got)
+	}
+
+	// 服务端断开空闲连接后,下一次调用换一条新连接,调用方看不到错误
+	server.dropAll()
+	time.Sleep(20 * time.Millisecond)
+	if response, err := pool.Execute("third"); err != nil || response != "ok third" {
+		t.Fatalf("Execute after drop = %q, %v", response, err)
+	}
+	if got := server.auths.Load(); got != 2 {
+		t.Errorf("auths = %d, want 2", got)
+	}
+}
+
+func TestRconPool_BoundsConcurrency(t *testing.T) {
+	server := newPoolServer(t)
+	pool := NewRconPool(server.Addr(), "password", 2, 0)
+	defer pool.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pool.Execute("slow"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Execute: %v", err)
+	}
+
+	if got := server.peak.Load(); got > 2 {
+		t.Errorf("peak concurrent commands = %d, want at most 2", got)
+	}
+	if got := server.auths.Load(); got > 2 {
+		t.Errorf("auths = %d, want at most 2 connections", got)
+	}
+}
+
+func TestRconPool_Backoff(t *testing.T) {
+	server := newPoolServer(t)
+	pool := NewRconPool(server.Addr(), "wrong", 1, 0)
+	defer pool.Close()
+
+	if _, err := pool.Execute("Info"); err == nil {
+		t.Fatal("Execute with wrong password succeeded")
+	}
+	// 退避期间不会重新认证
+	if _, err := pool.Execute("Info"); err == nil {
+		t.Fatal("Execute during backoff succeeded")
+	}
+	if got := server.auths.Load(); got != 1 {
+		t.Errorf("auths = %d, want 1 during backoff", got)
+	}
+}
+
+func TestRconPool_KeepAlive(t *testing.T) {
+	server := newPoolServer(t)
+	pool := NewRconPool(server.Addr(), "password", 1, 30*time.Millisecond)
+	defer pool.Close()
+
+	if _, err := pool.Execute("first"); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	waitFor(t, func() bool { return server.probes.Load() > 0 })
+
+	// 保活探测发现连接已断开后丢弃它,下一次调用重新建立连接
+	server.dropAll()
+	time.Sleep(100 * time.Millisecond)
+	conn := <-pool.slots
+	pool.release(conn)
+	if conn != nil {
+		t.Fatal("keepalive kept the dropped connection")
+	}
+	if response, err := pool.Execute("second"); err != nil || response != "ok second" {
+		t.Fatalf("Execute after keepalive = %q, %v", response, err)
+	}
+	if got := server.auths.Load(); got != 2 {
+		t.Errorf("auths = %d, want 2", got)
+	}
+	probes := server.probes.Load()
+	waitFor(t, func() bool { return server.probes.Load() > probes })
+}
+
+func TestPooledClient_CloseKeepsConnection(t *testing.T) {
+	server := newPoolServer(t)
+	exec, err := NewExecutor(server.Addr(), "password", false)
+	if err != nil {
+		t.Fatalf("NewExecutor: %v", err)
+	}
+	defer GetRconPool(server.Addr(), "password").Close()
+
+	for i := 0; i < 4; i++ {
+		if _, err := exec.Execute("Save"); err != nil {
+			t.Fatalf("Execute: %v", err)
+		}
+		// Close只归还执行器,不关闭共享的连接
+		if err := exec.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+	if got := server.auths.Load(); got > defaultPoolSize {
+		t.Errorf("auths = %d, want the shared connections to survive Close", got)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -2,179 +2,152 @@
 package tool
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"regexp"
 	"strconv"
-	"strings"
 
+	"github.com/hoshinonyaruko/palworld-go/audit"
 	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/palworld"
 )
 
-func Info(config config.Config) (map[string]string, error) {
+// NewPalworldClient 根据配置创建一个基于共享连接池的指令客户端
+func NewPalworldClient(config config.Config) (*palworld.Client, error) {
 	address := config.Address + ":" + strconv.Itoa(config.WorldSettings.RconPort)
 	exec, err := NewExecutor(address, config.WorldSettings.AdminPassword, true)
 	if err != nil {
 		return nil, err
 	}
-	defer exec.Close()
+	return palworld.NewClient(exec), nil
+}
 
-	response, err := exec.Execute("Info", config.UseDll)
+func Info(config config.Config) (map[string]string, error) {
+	return InfoContext(context.Background(), config)
+}
+
+// InfoContext 与Info相同,ctx被取消时停止等待RCON响应
+func InfoContext(ctx context.Context, config config.Config) (map[string]string, error) {
+	client, err := NewServerClient(config)
 	if err != nil {
 		return nil, err
 	}
-	re := regexp.MustCompile(`\[(v[\d\.]+)\]\s*(.+)`)
-	matches := re.FindStringSubmatch(response)
-	if matches == nil || len(matches) < 3 {
+
+	info, err := client.Info(ctx)
+	if errors.Is(err, palworld.ErrUnexpectedResponse) {
+		// 旧版本服务端的Info格式不同,保持原有行为
 		return map[string]string{
 			"version": "unknown",
 			"name":    "unknown",
 		}, nil
 	}
-	result := map[string]string{
-		"version": matches[1],
-		"name":    matches[2],
+	if err != nil {
+		return nil, err
 	}
-	return result, nil
+	return map[string]string{
+		"version": info.Version,
+		"name":    info.Name,
+	}, nil
 }
 
 func ShowPlayers(config config.Config) ([]map[string]string, error) {
-	address := config.Address + ":" + strconv.Itoa(config.WorldSettings.RconPort)
-	exec, err := NewExecutor(address, config.WorldSettings.AdminPassword, true)
+	return ShowPlayersContext(context.Background(), config)
+}
+
+// ShowPlayersContext 与ShowPlayers相同,ctx被取消时停止等待RCON响应
+func ShowPlayersContext(ctx context.Context, config config.Config) ([]map[string]string, error) {
+	client, err := NewServerClient(config)
 	if err != nil {
 		return nil, err
 	}
-	defer exec.Close()
 
-	response, err := exec.Execute("ShowPlayers", config.UseDll)
+	players, err := client.ShowPlayers(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	//第一行指令标题 然后才是内容
-	lines := strings.Split(response, "\n")
-	if len(lines) < 2 {
-		return nil, fmt.Errorf("invalid response format")
-	}
-
-	titles := strings.Split(lines[0], ",")
-	result := make([]map[string]string, 0, len(lines)-1)
-	for _, line := range lines[1:] {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		fields := strings.Split(line, ",")
-		dataMap := make(map[string]string, len(titles))
-		for i, title := range titles {
-			value := "<null/err>"
-			if i < len(fields) && !strings.Contains(fields[i], "\u0000") {
-				value = fields[i]
-			}
-			dataMap[title] = value
-		}
-		result = append(result, dataMap)
+	result := make([]map[string]string, 0, len(players))
+	for _, player := range players {
+		result = append(result, map[string]string{
+			"name":      player.Name,
+			"playeruid": player.PlayerUID,
+			"steamid":   player.SteamID,
+		})
 	}
-
 	return result, nil
 }
 
 func KickPlayer(config config.Config, steamID string) error {
-	address := config.Address + ":" + strconv.Itoa(config.WorldSettings.RconPort)
-	exec, err := NewExecutor(address, config.WorldSettings.AdminPassword, true)
-	if err != nil {
-		return err
-	}
-	defer exec.Close()
+	return KickPlayerContext(context.Background(), config, steamID)
+}
 
-	response, err := exec.Execute("KickPlayer "+steamID, config.UseDll)
+// KickPlayerContext 与KickPlayer相同,ctx被取消时停止等待RCON响应
+func KickPlayerContext(ctx context.Context, config config.Config, steamID string) error {
+	client, err := NewServerClient(config)
 	if err != nil {
 		return err
 	}
-	if response != fmt.Sprintf("Kicked: %s", steamID) {
-		return errors.New(response)
-	}
-	return nil
+	return client.KickPlayer(ctx, steamID)
 }
 
 func BanPlayer(config config.Config, steamID string) error {
-	address := config.Address + ":" + strconv.Itoa(config.WorldSettings.RconPort)
-	exec, err := NewExecutor(address, config.WorldSettings.AdminPassword, true)
-	if err != nil {
-		return err
-	}
-	defer exec.Close()
+	return BanPlayerContext(context.Background(), config, steamID)
+}
 
-	response, err := exec.Execute("BanPlayer "+steamID, config.UseDll)
+// BanPlayerContext 与BanPlayer相同,ctx被取消时停止等待RCON响应
+func BanPlayerContext(ctx context.Context, config config.Config, steamID string) error {
+	client, err := NewServerClient(config)
 	if err != nil {
 		return err
 	}
-	if response != fmt.Sprintf("Banned: %s", steamID) {
-		return errors.New(response)
-	}
-	return nil
+	return client.BanPlayer(ctx, steamID)
 }
 
 func Broadcast(config config.Config, message string) error {
-	address := config.Address + ":" + strconv.Itoa(config.WorldSettings.RconPort)
-	exec, err := NewExecutor(address, config.WorldSettings.AdminPassword, true)
-	if err != nil {
-		return err
-	}
-	defer exec.Close()
+	return BroadcastContext(context.Background(), config, message)
+}
 
-	response, err := exec.Execute("broadcast "+strings.ReplaceAll(message, " ", "_"), config.UseDll)
+// BroadcastContext 与Broadcast相同,ctx被取消时停止等待RCON响应
+func BroadcastContext(ctx context.Context, config config.Config, message string) error {
+	client, err := NewServerClient(config)
 	if err != nil {
 		return err
 	}
-	if response != fmt.Sprintf("Broadcasted: %s", message) {
-		return errors.New(response)
-	}
-	return nil
+	return client.Broadcast(ctx, message)
 }
 
 func Shutdown(config config.Config, seconds string, message string) error {
-	address := config.Address + ":" + strconv.Itoa(config.WorldSettings.RconPort)
-	exec, err := NewExecutor(address, config.WorldSettings.AdminPassword, true)
+	return ShutdownContext(context.Background(), config, seconds, message)
+}
+
+// ShutdownContext 与Shutdown相同,ctx被取消时停止等待RCON响应
+func ShutdownContext(ctx context.Context, config config.Config, seconds string, message string) error {
+	delay, err := strconv.Atoi(seconds)
 	if err != nil {
-		return err
+		return &palworld.CommandError{Command: "Shutdown", Kind: palworld.ErrInvalidArgument, Err: err}
 	}
-	defer exec.Close()
-
-	message = strings.ReplaceAll(message, " ", "_")
 
-	response, err := exec.Execute(fmt.Sprintf("Shutdown %s %s", seconds, message), config.UseDll)
+	client, err := NewServerClient(config)
 	if err != nil {
 		return err
 	}
-	if response != fmt.Sprintf("Shutdown: %s", message) {
-		// return errors.New(response)
-		return nil // HACK: Not Tested
-	}
-	return nil
+	return client.Shutdown(ctx, delay, message)
 }
 
 func DoExit(config config.Config) error {
-	address := config.Address + ":" + strconv.Itoa(config.WorldSettings.RconPort)
-	exec, err := NewExecutor(address, config.WorldSettings.AdminPassword, true)
-	if err != nil {
-		return err
-	}
-	defer exec.Close()
+	return DoExitContext(context.Background(), config)
+}
 
-	response, err := exec.Execute("DoExit", config.UseDll)
+// DoExitContext 与DoExit相同,ctx被取消时停止等待RCON响应
+func DoExitContext(ctx context.Context, config config.Config) error {
+	client, err := NewServerClient(config)
 	if err != nil {
 		return err
 	}
-	if response != "Exited" {
-		// return errors.New(response)
-		return nil // Hack: Not Tested
-	}
-	return nil
+	return client.DoExit(ctx)
 }
 
 func CheckAndKickPlayers(config config.Config) {
@@ -199,7 +172,7 @@ func CheckAndKickPlayers(config config.Config) {
 	for _, player := range players {
 		if player.Online && !IsPlayerInWhitelist(player, config.Players) {
 			// 玩家在线但不在白名单，执行踢出操作
-			if err := KickPlayer(config, player.SteamID); err != nil {
+			if err := KickPlayerContext(audit.WithOrigin(context.Background(), audit.OriginWhitelist), config, player.SteamID); err != nil {
 				log.Printf("踢出玩家失败: %v", err)
 			} else {
 				log.Printf("踢出玩家%v成功: %v", player.Name, err)
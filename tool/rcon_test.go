@@ -0,0 +1,152 @@
+package tool_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+	"github.com/hoshinonyaruko/palworld-go/palworld/palworldtest"
+	"github.com/hoshinonyaruko/palworld-go/tool"
+	"github.com/hoshinonyaruko/palworld-go/webui"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	alice   = palworld.Player{Name: "Alice", PlayerUID: "1001", SteamID: "76561190000000001"}
+	bob     = palworld.Player{Name: "Bob", PlayerUID: "1002", SteamID: "76561190000000002"}
+	mallory = palworld.Player{Name: "Mallory", PlayerUID: "1003", SteamID: "76561190000000003"}
+)
+
+// newServer 启动模拟服务端,测试结束时关闭它和共享的连接池
+func newServer(t *testing.T, players ...palworld.Player) *palworldtest.Server {
+	t.Helper()
+
+	server := palworldtest.NewServer(palworldtest.WithPlayers(players...))
+	t.Cleanup(func() {
+		tool.GetRconPool(server.Addr(), server.Password()).Close()
+		server.Close()
+	})
+	return server
+}
+
+// openPlayersDB 创建与webui.InitDB结构相同的玩家数据库
+func openPlayersDB(t *testing.T) *bbolt.DB {
+	t.Helper()
+
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "players.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("players"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	return db
+}
+
+func TestCommands(t *testing.T) {
+	server := newServer(t, alice, bob)
+	cfg := server.Config()
+
+	info, err := tool.Info(cfg)
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if info["version"] != palworldtest.DefaultVersion || info["name"] != palworldtest.DefaultServerName {
+		t.Errorf("Info = %v", info)
+	}
+
+	if err := tool.Broadcast(cfg, "server restarts soon"); err != nil {
+		t.Fatalf("Broadcast: %v", err)
+	}
+	if got := server.Broadcasts(); len(got) != 1 || got[0] != "server_restarts_soon" {
+		t.Errorf("Broadcasts = %q", got)
+	}
+
+	if err := tool.BanPlayer(cfg, bob.SteamID); err != nil {
+		t.Fatalf("BanPlayer: %v", err)
+	}
+	if !server.Banned(bob.SteamID) || len(server.Players()) != 1 {
+		t.Errorf("after ban: banned = %v, players = %+v", server.Banned(bob.SteamID), server.Players())
+	}
+	if err := tool.KickPlayer(cfg, bob.SteamID); !errors.Is(err, palworld.ErrPlayerNotFound) {
+		t.Errorf("KickPlayer of an offline player = %v, want ErrPlayerNotFound", err)
+	}
+
+	if err := tool.Shutdown(cfg, "soon", "bye"); !errors.Is(err, palworld.ErrInvalidArgument) {
+		t.Errorf("Shutdown with invalid seconds = %v", err)
+	}
+	if err := tool.Shutdown(cfg, "60", "maintenance"); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if req, ok := server.ShutdownRequested(); !ok || req.Seconds != 60 || req.Message != "maintenance" {
+		t.Errorf("ShutdownRequested = %+v, %v", req, ok)
+	}
+}
+
+func TestRefreshPlayerData(t *testing.T) {
+	server := newServer(t, alice, bob)
+	db := openPlayersDB(t)
+
+	if err := tool.RefreshPlayerData(context.Background(), db, server.Config()); err != nil {
+		t.Fatalf("RefreshPlayerData: %v", err)
+	}
+	for _, want := range []palworld.Player{alice, bob} {
+		player, err := tool.GetPlayerDataBySteamID(db, want.SteamID)
+		if err != nil {
+			t.Fatalf("GetPlayerDataBySteamID(%v): %v", want.SteamID, err)
+		}
+		if player.Name != want.Name || player.PlayerUID != want.PlayerUID {
+			t.Errorf("player = %+v, want %+v", player, want)
+		}
+	}
+
+	// 服务端无响应时不修改数据库
+	server.Close()
+	if err := tool.RefreshPlayerData(context.Background(), db, server.Config()); err == nil {
+		t.Error("RefreshPlayerData succeeded against a stopped server")
+	}
+}
+
+func TestCheckAndKickPlayers(t *testing.T) {
+	server := newServer(t, alice, bob, mallory)
+	cfg := server.Config()
+
+	// 白名单检查通过本机webui的/api/player获取在线玩家
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/*filepath", webui.CombinedMiddleware(cfg, openPlayersDB(t)))
+	panel := httptest.NewServer(r)
+	defer panel.Close()
+	_, cfg.WebuiPort, _ = net.SplitHostPort(panel.Listener.Addr().String())
+
+	// 按名称或SteamID匹配,Mallory不在白名单中
+	cfg.Players = []*config.PlayerW{
+		{Name: alice.Name},
+		{SteamID: bob.SteamID},
+	}
+	tool.CheckAndKickPlayers(cfg)
+
+	players := server.Players()
+	if len(players) != 2 || players[0].Name != alice.Name || players[1].Name != bob.Name {
+		t.Errorf("players after whitelist check = %+v", players)
+	}
+
+	// 白名单为空时不踢人
+	server.Join(mallory)
+	cfg.Players = nil
+	tool.CheckAndKickPlayers(cfg)
+	if got := len(server.Players()); got != 3 {
+		t.Errorf("empty whitelist kicked players, %d left", got)
+	}
+}
@@ -2,12 +2,14 @@
 package tool
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"strings"
 	"time"
 
+	"github.com/hoshinonyaruko/palworld-go/audit"
 	"github.com/hoshinonyaruko/palworld-go/config"
 	"go.etcd.io/bbolt"
 )
@@ -26,19 +28,15 @@ type PlayerW struct {
 	Online    bool   `json:"online"`
 }
 
-func ScheduleTask(db *bbolt.DB, config config.Config) {
-	ticker := time.NewTicker(3 * time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		players, err := ShowPlayers(config)
-		if err != nil {
-			log.Println("Error fetching players:", err)
-			continue
-		}
-		UpdatePlayerData(db, players)
-		log.Println("Schedule Updated Player Data")
+// RefreshPlayerData 获取在线玩家并更新玩家数据库,由调度器定期运行
+func RefreshPlayerData(ctx context.Context, db *bbolt.DB, config config.Config) error {
+	players, err := ShowPlayersContext(audit.WithOrigin(ctx, audit.OriginSchedule), config)
+	if err != nil {
+		return err
 	}
+	UpdatePlayerData(db, players)
+	log.Println("Schedule Updated Player Data")
+	return nil
 }
 
 func UpdatePlayerData(db *bbolt.DB, playersData []map[string]string) {
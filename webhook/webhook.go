@@ -0,0 +1,640 @@
+// Package webhook 把事件总线上的事件通过HTTP推送给外部服务。
+// 每个webhook可以按事件类型过滤、自定义请求体模板,并用共享密钥对时间戳和请求体做HMAC-SHA256签名。
+// 待投递的请求保存在bbolt中,失败后按指数退避重试,程序重启后继续投递,每次投递都记录在投递日志中。
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/event"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// QueueBucket 待投递请求所在的bucket
+	QueueBucket = "webhook_queue"
+	// LogBucket 投递日志所在的bucket
+	LogBucket = "webhook_log"
+
+	// SignatureHeader 签名请求头,值为 sha256=<"时间戳.请求体"的HMAC-SHA256十六进制>
+	SignatureHeader = "X-Palworld-Go-Signature"
+	// TimestampHeader 发送时间的Unix秒数,参与签名,接收方可以拒绝过旧的请求以防止重放
+	TimestampHeader = "X-Palworld-Go-Timestamp"
+	// EventHeader 事件类型请求头
+	EventHeader = "X-Palworld-Go-Event"
+	// DeliveryHeader 投递ID请求头,重试时不变,接收方可用于去重
+	DeliveryHeader = "X-Palworld-Go-Delivery"
+
+	// FormatJSON 以application/json发送
+	FormatJSON = "json"
+	// FormatForm 以application/x-www-form-urlencoded发送
+	FormatForm = "form"
+
+	// DefaultMaxAttempts 默认最多投递次数
+	DefaultMaxAttempts = 8
+	// DefaultBaseDelay 第一次重试前的等待时间,之后每次翻倍
+	DefaultBaseDelay = 10 * time.Second
+	// DefaultMaxDelay 重试等待时间的上限
+	DefaultMaxDelay = time.Hour
+	// MaxLogEntries 投递日志最多保留的条数
+	MaxLogEntries = 1000
+
+	// pollInterval 检查到期重试的间隔
+	pollInterval = time.Second
+	// maxResponseSize 投递日志中记录的响应最大长度
+	maxResponseSize = 512
+)
+
+// Hook 一个webhook
+type Hook struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Events   []string `json:"events"`
+	Format   string   `json:"format"`
+	Template string   `json:"template,omitempty"`
+	Secret   string   `json:"-"`
+
+	tmpl *template.Template
+}
+
+// HooksFromConfig 把配置转换为Hook并解析模板,忽略没有URL的webhook。
+// 名称为空时使用URL,重名时追加序号。
+func HooksFromConfig(webhooks []*config.Webhook) ([]Hook, error) {
+	hooks := make([]Hook, 0, len(webhooks))
+	names := make(map[string]int)
+
+	for _, w := range webhooks {
+		if w == nil || strings.TrimSpace(w.URL) == "" {
+			continue
+		}
+
+		hook := Hook{
+			Name:     w.Name,
+			URL:      strings.TrimSpace(w.URL),
+			Events:   w.Events,
+			Format:   strings.ToLower(strings.TrimSpace(w.Format)),
+			Template: w.Template,
+			Secret:   w.Secret,
+		}
+		if hook.Name == "" {
+			hook.Name = hook.URL
+		}
+		if n := names[hook.Name]; n > 0 {
+			names[hook.Name]++
+			hook.Name = fmt.Sprintf("%s#%d", hook.Name, n+1)
+		} else {
+			names[hook.Name] = 1
+		}
+
+		switch hook.Format {
+		case "":
+			hook.Format = FormatJSON
+		case FormatJSON, FormatForm:
+		default:
+			return nil, fmt.Errorf("webhook %v: unknown format %q", hook.Name, w.Format)
+		}
+
+		if err := hook.parse(); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+
+	return hooks, nil
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func (h *Hook) parse() error {
+	if h.Template == "" {
+		return nil
+	}
+	tmpl, err := template.New(h.Name).Funcs(templateFuncs).Parse(h.Template)
+	if err != nil {
+		return fmt.Errorf("webhook %v: invalid template: %w", h.Name, err)
+	}
+	h.tmpl = tmpl
+	return nil
+}
+
+// Matches 判断webhook是否订阅了事件类型t。Events为空时订阅全部,以*结尾时按前缀匹配。
+func (h Hook) Matches(t event.Type) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, pattern := range h.Events {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "*" || pattern == string(t) {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(string(t), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Render 生成事件e的请求体。没有模板时,json格式发送完整事件,
+// form格式发送id type time data四个字段,其中data为JSON。
+func (h Hook) Render(e event.Event) (body []byte, contentType string, err error) {
+	contentType = "application/json"
+	if h.Format == FormatForm {
+		contentType = "application/x-www-form-urlencoded"
+	}
+
+	if h.Template != "" {
+		if h.tmpl == nil {
+			if err := h.parse(); err != nil {
+				return nil, "", err
+			}
+		}
+		var buf bytes.Buffer
+		if err := h.tmpl.Execute(&buf, e); err != nil {
+			return nil, "", fmt.Errorf("webhook %v: render template: %w", h.Name, err)
+		}
+		return buf.Bytes(), contentType, nil
+	}
+
+	if h.Format == FormatForm {
+		data, err := json.Marshal(e.Data)
+		if err != nil {
+			return nil, "", err
+		}
+		values := url.Values{
+			"id":   {strconv.FormatUint(e.ID, 10)},
+			"type": {string(e.Type)},
+			"time": {e.Time.Format(time.RFC3339)},
+			"data": {string(data)},
+		}
+		return []byte(values.Encode()), contentType, nil
+	}
+
+	body, err = json.Marshal(e)
+	return body, contentType, err
+}
+
+// Sign 返回timestamp和body使用secret签名后的SignatureHeader值,签名内容为 timestamp + "." + body
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Delivery 一个待投递的请求
+type Delivery struct {
+	ID          uint64     `json:"id"`
+	Hook        string     `json:"hook"`
+	EventID     uint64     `json:"event_id"`
+	EventType   event.Type `json:"event_type"`
+	Body        string     `json:"body"`
+	ContentType string     `json:"content_type"`
+	Attempts    int        `json:"attempts"`
+	NextAttempt time.Time  `json:"next_attempt"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Status 一次投递尝试后请求的状态
+type Status string
+
+const (
+	StatusDelivered Status = "delivered"
+	StatusRetrying  Status = "retrying"
+	StatusFailed    Status = "failed"
+)
+
+// Attempt 投递日志中的一次投递尝试
+type Attempt struct {
+	ID         uint64     `json:"id"`
+	DeliveryID uint64     `json:"delivery_id"`
+	Hook       string     `json:"hook"`
+	URL        string     `json:"url"`
+	EventType  event.Type `json:"event_type"`
+	Attempt    int        `json:"attempt"`
+	Time       time.Time  `json:"time"`
+	StatusCode int        `json:"status_code,omitempty"`
+	Response   string     `json:"response,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	LatencyMs  int64      `json:"latency_ms"`
+	Status     Status     `json:"status"`
+	// NextAttempt 状态为retrying时下一次投递的时间
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+}
+
+// Dispatcher 负责入队、投递和重试
+type Dispatcher struct {
+	db     *bbolt.DB
+	client *http.Client
+
+	// MaxAttempts 最多投递次数,包括第一次
+	MaxAttempts int
+	// BaseDelay 第一次重试前的等待时间,之后每次翻倍,不超过MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	mu    sync.RWMutex
+	hooks map[string]Hook
+	// processing 保证同一时间只有一个goroutine在投递
+	processing sync.Mutex
+	now        func() time.Time
+	wake       chan struct{}
+}
+
+// New 创建Dispatcher,client为nil时使用10秒超时的http客户端
+func New(db *bbolt.DB, hooks []Hook, client *http.Client) (*Dispatcher, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte(QueueBucket)); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists([]byte(LogBucket))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	d := &Dispatcher{
+		db:          db,
+		client:      client,
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   DefaultBaseDelay,
+		MaxDelay:    DefaultMaxDelay,
+		now:         time.Now,
+		wake:        make(chan struct{}, 1),
+	}
+	d.SetHooks(hooks)
+	return d, nil
+}
+
+// SetHooks 替换webhook列表,已入队的请求按名称投递到新的配置
+func (d *Dispatcher) SetHooks(hooks []Hook) {
+	m := make(map[string]Hook, len(hooks))
+	for _, hook := range hooks {
+		m[hook.Name] = hook
+	}
+	d.mu.Lock()
+	d.hooks = m
+	d.mu.Unlock()
+}
+
+// Hooks 返回当前的webhook,不包含密钥
+func (d *Dispatcher) Hooks() []Hook {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	hooks := make([]Hook, 0, len(d.hooks))
+	for _, hook := range d.hooks {
+		hook.Secret = ""
+		hook.tmpl = nil
+		hooks = append(hooks, hook)
+	}
+	return hooks
+}
+
+func (d *Dispatcher) hook(name string) (Hook, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	hook, ok := d.hooks[name]
+	return hook, ok
+}
+
+// Subscribe 订阅bus,把事件加入投递队列。事件较多时bus等待入队完成,不会在进入持久化队列前丢失
+func (d *Dispatcher) Subscribe(bus *event.Bus) (unsubscribe func()) {
+	return bus.SubscribeBlocking(func(e event.Event) {
+		if err := d.Enqueue(e); err != nil {
+			log.Printf("webhook入队失败: %v", err)
+		}
+	})
+}
+
+// Enqueue 为订阅了e的每个webhook生成一个待投递请求
+func (d *Dispatcher) Enqueue(e event.Event) error {
+	d.mu.RLock()
+	var deliveries []Delivery
+	var renderErr error
+	for _, hook := range d.hooks {
+		if !hook.Matches(e.Type) {
+			continue
+		}
+		body, contentType, err := hook.Render(e)
+		if err != nil {
+			renderErr = err
+			continue
+		}
+		deliveries = append(deliveries, Delivery{
+			Hook:        hook.Name,
+			EventID:     e.ID,
+			EventType:   e.Type,
+			Body:        string(body),
+			ContentType: contentType,
+			NextAttempt: d.now(),
+			CreatedAt:   d.now(),
+		})
+	}
+	d.mu.RUnlock()
+
+	if len(deliveries) == 0 {
+		return renderErr
+	}
+
+	err := d.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(QueueBucket))
+		for i := range deliveries {
+			id, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			deliveries[i].ID = id
+			if err := putJSON(bucket, id, deliveries[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return renderErr
+}
+
+// Run 持续投递到期的请求,直到ctx被取消
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.ProcessDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// ProcessDue 投递所有到期的请求,返回尝试投递的数量
+func (d *Dispatcher) ProcessDue(ctx context.Context) int {
+	d.processing.Lock()
+	defer d.processing.Unlock()
+
+	now := d.now()
+	var due []Delivery
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(QueueBucket)).ForEach(func(k, v []byte) error {
+			var delivery Delivery
+			if err := json.Unmarshal(v, &delivery); err != nil {
+				return nil
+			}
+			if !delivery.NextAttempt.After(now) {
+				due = append(due, delivery)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("读取webhook队列失败: %v", err)
+		return 0
+	}
+
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := d.attempt(ctx, delivery); err != nil {
+			log.Printf("更新webhook队列失败: %v", err)
+		}
+	}
+	return len(due)
+}
+
+// attempt 投递一次并更新队列和投递日志
+func (d *Dispatcher) attempt(ctx context.Context, delivery Delivery) error {
+	delivery.Attempts++
+	attempt := Attempt{
+		DeliveryID: delivery.ID,
+		Hook:       delivery.Hook,
+		EventType:  delivery.EventType,
+		Attempt:    delivery.Attempts,
+		Time:       d.now(),
+	}
+
+	hook, ok := d.hook(delivery.Hook)
+	if !ok {
+		// webhook已从配置中移除,不再投递
+		attempt.Error = "webhook no longer configured"
+		attempt.Status = StatusFailed
+		return d.finish(delivery, attempt)
+	}
+	attempt.URL = hook.URL
+
+	start := time.Now()
+	statusCode, response, err := d.send(ctx, hook, delivery)
+	attempt.LatencyMs = time.Since(start).Milliseconds()
+	attempt.StatusCode = statusCode
+	attempt.Response = response
+
+	switch {
+	case err == nil:
+		attempt.Status = StatusDelivered
+	case delivery.Attempts >= d.MaxAttempts || !retryable(statusCode):
+		attempt.Error = err.Error()
+		attempt.Status = StatusFailed
+		log.Printf("webhook %v 投递失败,已放弃: %v", hook.Name, err)
+	default:
+		attempt.Error = err.Error()
+		attempt.Status = StatusRetrying
+		delivery.NextAttempt = d.now().Add(d.Backoff(delivery.Attempts))
+		attempt.NextAttempt = delivery.NextAttempt
+	}
+
+	return d.finish(delivery, attempt)
+}
+
+// retryable 除408和429外的4xx说明请求本身有问题,重试也不会成功
+func retryable(statusCode int) bool {
+	if statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return statusCode < 400 || statusCode > 499
+}
+
+// send 发送请求,返回非2xx状态码时也视为失败
+func (d *Dispatcher) send(ctx context.Context, hook Hook, delivery Delivery) (int, string, error) {
+	body := []byte(delivery.Body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", delivery.ContentType)
+	req.Header.Set("User-Agent", "palworld-go-webhook")
+	req.Header.Set(EventHeader, string(delivery.EventType))
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(delivery.ID, 10))
+	timestamp := strconv.FormatInt(d.now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, string(data), fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, string(data), nil
+}
+
+// finish 记录投递日志,并根据结果更新或移除队列中的请求
+func (d *Dispatcher) finish(delivery Delivery, attempt Attempt) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		queue := tx.Bucket([]byte(QueueBucket))
+		if attempt.Status == StatusRetrying {
+			if err := putJSON(queue, delivery.ID, delivery); err != nil {
+				return err
+			}
+		} else if err := queue.Delete(itob(delivery.ID)); err != nil {
+			return err
+		}
+
+		logs := tx.Bucket([]byte(LogBucket))
+		id, err := logs.NextSequence()
+		if err != nil {
+			return err
+		}
+		attempt.ID = id
+		if err := putJSON(logs, id, attempt); err != nil {
+			return err
+		}
+
+		// 只保留最新的MaxLogEntries条。日志ID连续递增且只从最旧的开始删除,
+		// 条数就是最新ID与最旧ID之差,不需要遍历整个bucket
+		cursor := logs.Cursor()
+		for k, _ := cursor.First(); k != nil && id-binary.BigEndian.Uint64(k) >= MaxLogEntries; k, _ = cursor.First() {
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Backoff 第attempts次投递失败后等待的时间
+func (d *Dispatcher) Backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return delay
+}
+
+// Pending 返回队列中等待投递或重试的请求
+func (d *Dispatcher) Pending() ([]Delivery, error) {
+	deliveries := []Delivery{}
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(QueueBucket)).ForEach(func(k, v []byte) error {
+			var delivery Delivery
+			if err := json.Unmarshal(v, &delivery); err == nil {
+				deliveries = append(deliveries, delivery)
+			}
+			return nil
+		})
+	})
+	return deliveries, err
+}
+
+// Attempts 按时间倒序返回投递日志,hook不为空时只返回该webhook的记录,
+// before大于0时只返回ID小于before的记录,next非0时可作为下一页的before
+func (d *Dispatcher) Attempts(hook string, before uint64, limit int) (attempts []Attempt, next uint64, err error) {
+	if limit <= 0 || limit > MaxLogEntries {
+		limit = 50
+	}
+
+	attempts = make([]Attempt, 0, limit)
+	err = d.db.View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket([]byte(LogBucket)).Cursor()
+
+		var k, v []byte
+		if before > 0 {
+			k, v = cursor.Seek(itob(before))
+			if k == nil {
+				k, v = cursor.Last()
+			} else {
+				k, v = cursor.Prev()
+			}
+		} else {
+			k, v = cursor.Last()
+		}
+
+		for ; k != nil; k, v = cursor.Prev() {
+			var attempt Attempt
+			if err := json.Unmarshal(v, &attempt); err != nil {
+				continue
+			}
+			if hook != "" && attempt.Hook != hook {
+				continue
+			}
+			if len(attempts) == limit {
+				next = attempts[len(attempts)-1].ID
+				return nil
+			}
+			attempts = append(attempts, attempt)
+		}
+		return nil
+	})
+	return attempts, next, err
+}
+
+func putJSON(bucket *bbolt.Bucket, id uint64, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(itob(id), data)
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
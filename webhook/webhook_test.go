@@ -0,0 +1,425 @@
+package webhook
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/event"
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+	"go.etcd.io/bbolt"
+)
+
+type request struct {
+	header http.Header
+	body   string
+}
+
+// receiver 记录收到的请求,按statuses依次返回状态码,用完后返回200
+type receiver struct {
+	mu       sync.Mutex
+	requests []request
+	statuses []int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	r.requests = append(r.requests, request{header: req.Header.Clone(), body: string(body)})
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	r.mu.Unlock()
+
+	w.WriteHeader(status)
+}
+
+func (r *receiver) received() []request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]request(nil), r.requests...)
+}
+
+func openDB(t *testing.T, path string) *bbolt.DB {
+	t.Helper()
+
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newDispatcher(t *testing.T, db *bbolt.DB, webhooks ...*config.Webhook) (*Dispatcher, *time.Time) {
+	t.Helper()
+
+	hooks, err := HooksFromConfig(webhooks)
+	if err != nil {
+		t.Fatalf("HooksFromConfig: %v", err)
+	}
+	d, err := New(db, hooks, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	return d, &now
+}
+
+var joined = event.Event{
+	ID:   7,
+	Type: event.TypePlayerJoined,
+	Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	Data: event.PlayerJoined{Player: palworld.Player{Name: "Alice", SteamID: "76561190000000001"}},
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	recv := &receiver{}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	db := openDB(t, filepath.Join(t.TempDir(), "webhook.db"))
+	d, _ := newDispatcher(t, db, &config.Webhook{Name: "ops", URL: server.URL, Secret: "s3cret"})
+
+	if err := d.Enqueue(joined); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if n := d.ProcessDue(context.Background()); n != 1 {
+		t.Fatalf("ProcessDue attempted %d deliveries, want 1", n)
+	}
+
+	requests := recv.received()
+	if len(requests) != 1 {
+		t.Fatalf("received %d requests, want 1", len(requests))
+	}
+	req := requests[0]
+
+	timestamp := req.header.Get(TimestampHeader)
+	if timestamp != "1704067200" {
+		t.Errorf("timestamp = %q", timestamp)
+	}
+	if got, want := req.header.Get(SignatureHeader), Sign("s3cret", timestamp, []byte(req.body)); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if got := Sign("s3cret", "1704067201", []byte(req.body)); got == req.header.Get(SignatureHeader) {
+		t.Error("signature does not cover the timestamp")
+	}
+	if got := req.header.Get(EventHeader); got != string(event.TypePlayerJoined) {
+		t.Errorf("event header = %q", got)
+	}
+	if got := req.header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("content type = %q", got)
+	}
+
+	var body struct {
+		ID   uint64 `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Player palworld.Player `json:"player"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(req.body), &body); err != nil {
+		t.Fatalf("body %q: %v", req.body, err)
+	}
+	if body.ID != 7 || body.Type != "player.joined" || body.Data.Player.Name != "Alice" {
+		t.Errorf("body = %+v", body)
+	}
+
+	pending, _ := d.Pending()
+	if len(pending) != 0 {
+		t.Errorf("pending = %+v", pending)
+	}
+	attempts, _, _ := d.Attempts("", 0, 0)
+	if len(attempts) != 1 || attempts[0].Status != StatusDelivered || attempts[0].StatusCode != http.StatusOK {
+		t.Errorf("attempts = %+v", attempts)
+	}
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	recv := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusBadGateway}}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	db := openDB(t, filepath.Join(t.TempDir(), "webhook.db"))
+	d, now := newDispatcher(t, db, &config.Webhook{Name: "ops", URL: server.URL})
+	ctx := context.Background()
+
+	d.Enqueue(joined)
+
+	// 第一次失败,10秒后重试
+	d.ProcessDue(ctx)
+	pending, _ := d.Pending()
+	if len(pending) != 1 || pending[0].Attempts != 1 || !pending[0].NextAttempt.Equal(now.Add(10*time.Second)) {
+		t.Fatalf("pending after first failure = %+v", pending)
+	}
+	if n := d.ProcessDue(ctx); n != 0 {
+		t.Fatalf("retried %d deliveries before backoff elapsed", n)
+	}
+
+	// 第二次失败,等待时间翻倍
+	*now = now.Add(10 * time.Second)
+	d.ProcessDue(ctx)
+	pending, _ = d.Pending()
+	if len(pending) != 1 || !pending[0].NextAttempt.Equal(now.Add(20*time.Second)) {
+		t.Fatalf("pending after second failure = %+v", pending)
+	}
+
+	*now = now.Add(20 * time.Second)
+	d.ProcessDue(ctx)
+	if pending, _ := d.Pending(); len(pending) != 0 {
+		t.Fatalf("pending after success = %+v", pending)
+	}
+
+	attempts, _, _ := d.Attempts("ops", 0, 0)
+	want := []Status{StatusDelivered, StatusRetrying, StatusRetrying}
+	if len(attempts) != len(want) {
+		t.Fatalf("attempts = %+v", attempts)
+	}
+	for i, attempt := range attempts {
+		if attempt.Status != want[i] || attempt.Attempt != len(want)-i {
+			t.Errorf("attempt %d = %+v", i, attempt)
+		}
+	}
+	if attempts[2].StatusCode != http.StatusInternalServerError || attempts[2].Error == "" {
+		t.Errorf("first attempt = %+v", attempts[2])
+	}
+}
+
+func TestDispatcher_GiveUp(t *testing.T) {
+	recv := &receiver{statuses: []int{500, 500, 500}}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	db := openDB(t, filepath.Join(t.TempDir(), "webhook.db"))
+	d, now := newDispatcher(t, db, &config.Webhook{URL: server.URL})
+	d.MaxAttempts = 2
+
+	d.Enqueue(joined)
+	d.ProcessDue(context.Background())
+	*now = now.Add(time.Hour)
+	d.ProcessDue(context.Background())
+
+	if pending, _ := d.Pending(); len(pending) != 0 {
+		t.Fatalf("pending after giving up = %+v", pending)
+	}
+	attempts, _, _ := d.Attempts(server.URL, 0, 0)
+	if len(attempts) != 2 || attempts[0].Status != StatusFailed {
+		t.Errorf("attempts = %+v", attempts)
+	}
+	if got := len(recv.received()); got != 2 {
+		t.Errorf("received %d requests, want 2", got)
+	}
+}
+
+func TestDispatcher_ClientError(t *testing.T) {
+	tests := []struct {
+		status    int
+		wantRetry bool
+	}{
+		{http.StatusBadRequest, false},
+		{http.StatusNotFound, false},
+		{http.StatusRequestTimeout, true},
+		{http.StatusTooManyRequests, true},
+		{http.StatusServiceUnavailable, true},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			recv := &receiver{statuses: []int{tt.status}}
+			server := httptest.NewServer(recv)
+			defer server.Close()
+
+			db := openDB(t, filepath.Join(t.TempDir(), "webhook.db"))
+			d, _ := newDispatcher(t, db, &config.Webhook{Name: "ops", URL: server.URL})
+			d.Enqueue(joined)
+			d.ProcessDue(context.Background())
+
+			pending, _ := d.Pending()
+			if retried := len(pending) == 1; retried != tt.wantRetry {
+				t.Errorf("pending = %+v, want retry %v", pending, tt.wantRetry)
+			}
+			attempts, _, _ := d.Attempts("ops", 0, 0)
+			if len(attempts) != 1 || (attempts[0].Status == StatusFailed) == tt.wantRetry {
+				t.Errorf("attempts = %+v", attempts)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Persistence(t *testing.T) {
+	recv := &receiver{}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "webhook.db")
+	hook := &config.Webhook{Name: "ops", URL: server.URL}
+
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	d, _ := newDispatcher(t, db, hook)
+	d.Enqueue(joined)
+	db.Close()
+
+	// 重新打开后继续投递
+	d, _ = newDispatcher(t, openDB(t, path), hook)
+	if pending, _ := d.Pending(); len(pending) != 1 {
+		t.Fatalf("pending after reopen = %+v", pending)
+	}
+	d.ProcessDue(context.Background())
+	if got := len(recv.received()); got != 1 {
+		t.Errorf("received %d requests, want 1", got)
+	}
+}
+
+func TestHook_Render(t *testing.T) {
+	tests := []struct {
+		name        string
+		hook        config.Webhook
+		wantType    string
+		wantBody    string
+		checkValues bool
+	}{
+		{
+			name:     "json template",
+			hook:     config.Webhook{Template: `{"text":"{{.Data.Player.Name}} joined ({{.Type}})"}`},
+			wantType: "application/json",
+			wantBody: `{"text":"Alice joined (player.joined)"}`,
+		},
+		{
+			name:     "form template",
+			hook:     config.Webhook{Format: "form", Template: `content={{.Data.Player.Name}}`},
+			wantType: "application/x-www-form-urlencoded",
+			wantBody: `content=Alice`,
+		},
+		{
+			name:        "form default",
+			hook:        config.Webhook{Format: "form"},
+			wantType:    "application/x-www-form-urlencoded",
+			checkValues: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.hook.URL = "http://example.invalid"
+			hooks, err := HooksFromConfig([]*config.Webhook{&tt.hook})
+			if err != nil {
+				t.Fatalf("HooksFromConfig: %v", err)
+			}
+
+			body, contentType, err := hooks[0].Render(joined)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if contentType != tt.wantType {
+				t.Errorf("content type = %q, want %q", contentType, tt.wantType)
+			}
+			if tt.checkValues {
+				values, err := url.ParseQuery(string(body))
+				if err != nil || values.Get("type") != "player.joined" || values.Get("id") != "7" {
+					t.Errorf("body = %q", body)
+				}
+				return
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+
+	if _, err := HooksFromConfig([]*config.Webhook{{URL: "http://x", Template: "{{"}}); err == nil {
+		t.Error("invalid template was accepted")
+	}
+	if _, err := HooksFromConfig([]*config.Webhook{{URL: "http://x", Format: "xml"}}); err == nil {
+		t.Error("unknown format was accepted")
+	}
+}
+
+func TestHook_Matches(t *testing.T) {
+	tests := []struct {
+		events []string
+		t      event.Type
+		want   bool
+	}{
+		{nil, event.TypeServerStarted, true},
+		{[]string{"*"}, event.TypeServerStarted, true},
+		{[]string{"player.*"}, event.TypePlayerLeft, true},
+		{[]string{"player.*"}, event.TypeServerCrashed, false},
+		{[]string{"backup.completed"}, event.TypeBackupCompleted, true},
+		{[]string{"backup.completed"}, event.TypeServerStarted, false},
+	}
+
+	for _, tt := range tests {
+		hook := Hook{Events: tt.events}
+		if got := hook.Matches(tt.t); got != tt.want {
+			t.Errorf("Matches(%v) with %q = %v, want %v", tt.t, tt.events, got, tt.want)
+		}
+	}
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := &Dispatcher{BaseDelay: 10 * time.Second, MaxDelay: time.Minute}
+
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, w := range want {
+		if got := d.Backoff(i + 1); got != w {
+			t.Errorf("Backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestDispatcher_LogLimit(t *testing.T) {
+	db := openDB(t, filepath.Join(t.TempDir(), "webhook.db"))
+	d, _ := newDispatcher(t, db)
+
+	for i := 0; i < MaxLogEntries+5; i++ {
+		if err := d.finish(Delivery{ID: uint64(i + 1)}, Attempt{Status: StatusDelivered}); err != nil {
+			t.Fatalf("finish: %v", err)
+		}
+	}
+
+	var count int
+	var oldest uint64
+	db.View(func(tx *bbolt.Tx) error {
+		logs := tx.Bucket([]byte(LogBucket))
+		k, _ := logs.Cursor().First()
+		oldest = binary.BigEndian.Uint64(k)
+		count = logs.Stats().KeyN
+		return nil
+	})
+	if count != MaxLogEntries || oldest != 6 {
+		t.Errorf("kept %d attempts, oldest = %d", count, oldest)
+	}
+}
+
+func TestDispatcher_SubscribeBurst(t *testing.T) {
+	db := openDB(t, filepath.Join(t.TempDir(), "webhook.db"))
+	d, _ := newDispatcher(t, db, &config.Webhook{Name: "ops", URL: "http://127.0.0.1:1"})
+
+	bus := event.NewBus(0)
+	unsubscribe := d.Subscribe(bus)
+	defer unsubscribe()
+
+	// 超过事件总线队列长度的突发事件全部进入投递队列
+	for i := 0; i < 200; i++ {
+		bus.Publish(event.ServerStarted{})
+	}
+	bus.Flush(5 * time.Second)
+	if pending, _ := d.Pending(); len(pending) != 200 {
+		t.Errorf("pending = %d, want 200", len(pending))
+	}
+}
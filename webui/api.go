@@ -2,6 +2,7 @@ package webui
 
 import (
 	"bufio"
+	"context"
 	"embed"
 	"encoding/json"
 	"errors"
@@ -12,7 +13,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"sort"
 	"strconv"
@@ -20,10 +20,14 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gorcon/rcon"
 	"github.com/gorilla/websocket"
+	"github.com/hoshinonyaruko/palworld-go/audit"
+	"github.com/hoshinonyaruko/palworld-go/backup"
 	"github.com/hoshinonyaruko/palworld-go/bot"
 	"github.com/hoshinonyaruko/palworld-go/config"
+	"github.com/hoshinonyaruko/palworld-go/event"
+	"github.com/hoshinonyaruko/palworld-go/lifecycle"
+	"github.com/hoshinonyaruko/palworld-go/restart"
 	"github.com/hoshinonyaruko/palworld-go/status"
 	"github.com/hoshinonyaruko/palworld-go/sys"
 	"github.com/hoshinonyaruko/palworld-go/tool"
@@ -46,11 +50,13 @@ type Player struct {
 type Client struct {
 	conn *websocket.Conn
 	send chan string
+	// ctx 携带审计日志的来源和用户
+	ctx context.Context
 }
 
 // RconClient 结构体，用于存储RCON连接和配置信息
 type RconClient struct {
-	Conn *rcon.Conn
+	Conn *tool.Executor
 }
 
 type KickOrBanRequest struct {
@@ -101,6 +107,15 @@ func InitDB() *bbolt.DB {
 // NewCombinedMiddleware 创建并返回一个带有依赖的中间件闭包
 func CombinedMiddleware(config config.Config, db *bbolt.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 健康检查端点不需要登录,供负载均衡和监控使用
+		if c.Request.URL.Path == "/healthz" && c.Request.Method == http.MethodGet {
+			handleHealthz(c)
+			return
+		}
+		if c.Request.URL.Path == "/readyz" && c.Request.Method == http.MethodGet {
+			handleReadyz(c)
+			return
+		}
 		if strings.HasPrefix(c.Request.URL.Path, "/api") {
 
 			if c.Param("filepath") == "/api/ws" {
@@ -109,6 +124,51 @@ func CombinedMiddleware(config config.Config, db *bbolt.DB) gin.HandlerFunc {
 				}
 				return
 			}
+			// 处理 /api/events 的GET请求
+			if c.Request.URL.Path == "/api/events" && c.Request.Method == http.MethodGet {
+				handleEvents(c)
+				return
+			}
+			// 处理 /api/events/stream 的GET请求,SSE推送事件
+			if c.Request.URL.Path == "/api/events/stream" && c.Request.Method == http.MethodGet {
+				handleEventStream(c)
+				return
+			}
+			// 处理 /api/webhooks 的GET请求
+			if c.Request.URL.Path == "/api/webhooks" && c.Request.Method == http.MethodGet {
+				handleWebhooks(c)
+				return
+			}
+			// 处理 /api/webhooks/deliveries 的GET请求
+			if c.Request.URL.Path == "/api/webhooks/deliveries" && c.Request.Method == http.MethodGet {
+				handleWebhookDeliveries(c)
+				return
+			}
+			// 处理 /api/gamelog 的GET请求,返回最近的服务端输出
+			if c.Request.URL.Path == "/api/gamelog" && c.Request.Method == http.MethodGet {
+				handleGameLog(c)
+				return
+			}
+			// 处理 /api/gamelog/search 的GET请求,搜索服务端日志文件
+			if c.Request.URL.Path == "/api/gamelog/search" && c.Request.Method == http.MethodGet {
+				handleGameLogSearch(c)
+				return
+			}
+			// 处理 /api/gamelog/ws 的websocket请求,实时推送服务端输出
+			if c.Request.URL.Path == "/api/gamelog/ws" && c.GetHeader("Upgrade") == "websocket" {
+				handleGameLogStream(c)
+				return
+			}
+			// 处理 /api/lifecycle 的GET请求
+			if c.Request.URL.Path == "/api/lifecycle" && c.Request.Method == http.MethodGet {
+				handleLifecycle(c)
+				return
+			}
+			// 处理 /api/audit 的GET请求
+			if c.Request.URL.Path == "/api/audit" && c.Request.Method == http.MethodGet {
+				handleAudit(c)
+				return
+			}
 			// 处理/api/login的POST请求
 			if c.Param("filepath") == "/api/login" && c.Request.Method == http.MethodPost {
 				HandleLoginRequest(c, config)
@@ -129,6 +189,26 @@ func CombinedMiddleware(config config.Config, db *bbolt.DB) gin.HandlerFunc {
 				HandleSaveJSON(c, config)
 				return
 			}
+			// 处理 /api/jobs 的GET请求
+			if c.Request.URL.Path == "/api/jobs" && c.Request.Method == http.MethodGet {
+				handleJobs(c)
+				return
+			}
+			// 处理 /api/jobs/{name}/pause|resume|run 的POST请求
+			if strings.HasPrefix(c.Request.URL.Path, "/api/jobs/") && c.Request.Method == http.MethodPost {
+				handleJobAction(c)
+				return
+			}
+			// 处理 /api/restart/status 的GET请求
+			if c.Request.URL.Path == "/api/restart/status" && c.Request.Method == http.MethodGet {
+				handleRestartStatus(c)
+				return
+			}
+			// 处理 /api/restart 的DELETE请求
+			if c.Request.URL.Path == "/api/restart" && c.Request.Method == http.MethodDelete {
+				handleRestartCancel(c)
+				return
+			}
 			// 处理 /api/save-json 的POST请求
 			if c.Request.URL.Path == "/api/restart" && c.Request.Method == http.MethodPost {
 				HandleRestart(c, config)
@@ -167,6 +247,36 @@ func CombinedMiddleware(config config.Config, db *bbolt.DB) gin.HandlerFunc {
 				handleGetSavelist(c, config)
 				return
 			}
+			// 处理 /api/downloadsave 的GET请求 下载压缩包备份
+			if c.Request.URL.Path == "/api/downloadsave" && c.Request.Method == http.MethodGet {
+				handleDownloadSave(c, config)
+				return
+			}
+			// 处理 /api/saveretention 的GET请求 预览保留策略会删除的备份
+			if c.Request.URL.Path == "/api/saveretention" && c.Request.Method == http.MethodGet {
+				handleSaveRetention(c, config)
+				return
+			}
+			// 处理 /api/pinsave 的POST请求 固定备份
+			if c.Request.URL.Path == "/api/pinsave" && c.Request.Method == http.MethodPost {
+				handlePinSave(c, config, true)
+				return
+			}
+			// 处理 /api/unpinsave 的POST请求 取消固定备份
+			if c.Request.URL.Path == "/api/unpinsave" && c.Request.Method == http.MethodPost {
+				handlePinSave(c, config, false)
+				return
+			}
+			// 处理 /api/savemanifest 的GET请求 查看备份的清单
+			if c.Request.URL.Path == "/api/savemanifest" && c.Request.Method == http.MethodGet {
+				handleSaveManifest(c, config)
+				return
+			}
+			// 处理 /api/verifysave 的POST请求 校验备份是否完整
+			if c.Request.URL.Path == "/api/verifysave" && c.Request.Method == http.MethodPost {
+				handleVerifySave(c, config)
+				return
+			}
 			// 处理 /changesave 的POST请求
 			if c.Request.URL.Path == "/api/changesave" && c.Request.Method == http.MethodPost {
 				handleChangeSave(c, config)
@@ -234,12 +344,12 @@ func CombinedMiddleware(config config.Config, db *bbolt.DB) gin.HandlerFunc {
 			}
 			// 处理 /api/getpalguardjson 的Get请求
 			if c.Request.URL.Path == "/api/getpalguardjson" && c.Request.Method == http.MethodGet {
-				HandleGetPalguardJson(c)
+				HandleGetPalguardJson(c, config)
 				return
 			}
 			// 处理 /api/savepalguardjson 的POST请求
 			if c.Request.URL.Path == "/api/savepalguardjson" && c.Request.Method == http.MethodPost {
-				HandleSavePalguardJson(c)
+				HandleSavePalguardJson(c, config)
 				return
 			}
 
@@ -303,9 +413,9 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-// NewRconClient 创建一个新的RCON客户端
+// NewRconClient 创建一个新的RCON客户端,底层连接来自共享连接池
 func NewRconClient(address, password string) *RconClient {
-	conn, err := rcon.Dial(address, password)
+	conn, err := tool.NewExecutor(address, password, false)
 	if err != nil {
 		log.Printf("无法连接到RCON服务器: %v", err)
 		return nil
@@ -319,23 +429,24 @@ func (c *Client) readPump(config config.Config) {
 	defer func() {
 		c.conn.Close()
 	}()
+	// 初始化RCON客户端,整个websocket会话共用连接池中的连接
+	address := config.Address + ":" + strconv.Itoa(config.WorldSettings.RconPort)
+	rconClient := NewRconClient(address, config.WorldSettings.AdminPassword)
+	if rconClient == nil {
+		log.Println("RCON客户端初始化失败,无法处理webui面板请求,请按教程正确开启rcon和设置服务端admin密码")
+		return
+	}
+	defer rconClient.Conn.Close()
+
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			log.Printf("error: %v", err)
 			break
 		}
-		// 初始化RCON客户端
-		address := config.Address + ":" + strconv.Itoa(config.WorldSettings.RconPort)
-		// 初始化RCON客户端
-		rconClient := NewRconClient(address, config.WorldSettings.AdminPassword)
-		if rconClient == nil {
-			log.Println("RCON客户端初始化失败,无法处理webui面板请求,请按教程正确开启rcon和设置服务端admin密码")
-			return
-		}
 
 		// 使用原始方式发送
-		response, err := rconClient.Conn.Execute(string(message), config.UseDll)
+		response, err := rconClient.Conn.ExecuteContext(c.ctx, string(message))
 		if err != nil {
 			log.Printf("Error sending message: %v", err)
 		}
@@ -375,6 +486,8 @@ func WsHandlerWithDependencies(c *gin.Context, cfg config.Config) {
 	client := &Client{
 		conn: ws,
 		send: make(chan string),
+		// 升级完成后请求ctx会被取消,只保留审计信息
+		ctx: context.WithoutCancel(auditContext(c, audit.OriginConsole)),
 	}
 	go client.writePump()
 	go client.readPump(cfg)
@@ -442,6 +555,11 @@ func HandleSaveJSON(c *gin.Context, cfg config.Config) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Config updated successfully"})
+	event.Publish(event.ConfigChanged{Source: configFile})
+	// 等订阅者(机器人、webhook)处理完配置变更事件再重启,否则事件会随进程一起丢失
+	if !event.Default.Flush(5 * time.Second) {
+		log.Printf("等待配置变更事件处理超时")
+	}
 
 	//重启自身 很快 唰的一下
 	sys.RestartApplication()
@@ -483,19 +601,15 @@ func HandleRestart(c *gin.Context, cfg config.Config) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: Invalid cookie"})
 		return
 	}
-	if !cfg.EnableRebootLater {
-		// Cookie验证通过后，执行重启操作
-		sys.KillProcess(cfg)
-		sys.RestartService(cfg)
-	} else {
-		//延迟60秒关闭 然后不设置status.SetManualServerShutdown(true) 守护会拉起服务器
-		err = tool.Shutdown(cfg, "60", cfg.MaintenanceWarningMessage)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+	// 未开启延迟重启时跳过倒计时,否则60秒后重启
+	req := restart.Request{Reason: restart.ReasonManual, Detail: "webui", Message: cfg.MaintenanceWarningMessage}
+	if cfg.EnableRebootLater {
+		req.Delay = 60 * time.Second
+	}
+	if _, err := restart.Default.Restart(req); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
 	}
-
 	c.JSON(http.StatusOK, gin.H{"message": "Restart initiated"})
 
 }
@@ -515,6 +629,8 @@ func HandleStart(c *gin.Context, cfg config.Config) {
 		return
 	}
 	status.SetManualServerShutdown(false)
+	// 手动启动会解除因频繁崩溃导致的停止自动重启
+	lifecycle.Default.Start("webui启动")
 	// Cookie验证通过后，执行重启操作
 	sys.RestartService(cfg)
 	c.JSON(http.StatusOK, gin.H{"message": "start initiated"})
@@ -535,6 +651,9 @@ func HandleStop(c *gin.Context, cfg config.Config) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: Invalid cookie"})
 		return
 	}
+	// 先通知守护,进程退出后不会被重新拉起
+	status.SetManualServerShutdown(true)
+	lifecycle.Default.Stop("webui关闭")
 	if !cfg.EnableRebootLater {
 		// 终止进程
 		if err := sys.KillProcess(cfg); err != nil {
@@ -543,14 +662,16 @@ func HandleStop(c *gin.Context, cfg config.Config) {
 		}
 	} else {
 		// 调用tool.Shutdown来安排重启
-		err = tool.Shutdown(cfg, "60", cfg.MaintenanceWarningMessage)
+		err = tool.ShutdownContext(auditContext(c, audit.OriginWebui), cfg, "60", cfg.MaintenanceWarningMessage)
 		if err != nil {
+			// 关服指令没有发出,恢复守护,下一次检查时回到Running
+			status.SetManualServerShutdown(false)
+			lifecycle.Default.Start("webui关闭失败")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 	}
 
-	status.SetManualServerShutdown(true)
 	c.JSON(http.StatusOK, gin.H{"message": "Stop initiated"})
 
 }
@@ -582,7 +703,7 @@ func HandleLoginRequest(c *gin.Context, config config.Config) {
 
 	if checkCredentials(json.Username, json.Password, config) {
 		// 如果验证成功，设置cookie
-		cookieValue, err := GenerateCookie()
+		cookieValue, err := GenerateCookie(json.Username)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate cookie"})
 			return
@@ -711,7 +832,7 @@ func listPlayer(c *gin.Context, config config.Config, db *bbolt.DB) {
 
 	var currentPlayersMap map[string]bool
 	if update == "true" {
-		getCurrentPlayers, err := tool.ShowPlayers(config)
+		getCurrentPlayers, err := tool.ShowPlayersContext(auditContext(c, audit.OriginWebui), config)
 		if err != nil {
 			// Log the error instead of returning it
 			log.Println("Error fetching current players:", err)
@@ -833,9 +954,9 @@ func handleKickOrBan(c *gin.Context, config config.Config, db *bbolt.DB) {
 	}
 
 	if req.Type == "kick" {
-		err = tool.KickPlayer(config, req.SteamID)
+		err = tool.KickPlayerContext(auditContext(c, audit.OriginWebui), config, req.SteamID)
 	} else if req.Type == "ban" {
-		err = tool.BanPlayer(config, req.SteamID)
+		err = tool.BanPlayerContext(auditContext(c, audit.OriginWebui), config, req.SteamID)
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type"})
 		return
@@ -850,43 +971,19 @@ func handleKickOrBan(c *gin.Context, config config.Config, db *bbolt.DB) {
 	c.JSON(http.StatusOK, gin.H{"message": "Success"})
 }
 
-// handleGetSavelist 处理 /api/getsavelist 请求
+// handleGetSavelist 处理 /api/getsavelist 请求,返回备份名称,从新到旧排列
 func handleGetSavelist(c *gin.Context, config config.Config) {
-	// 获取保存路径
-	savePath := config.BackupPath
-
-	// 正则表达式匹配特定的日期时间格式
-	regex, err := regexp.Compile(`^\d{4}-\d{2}-\d{2}-\d{2}-\d{2}-\d{2}$`)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Regex compile error"})
-		return
-	}
-
-	// 枚举文件夹并匹配
-	var folders []string
-	err = filepath.Walk(savePath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() && regex.MatchString(info.Name()) {
-			folders = append(folders, info.Name())
-		}
-		return nil
-	})
-
+	backups, err := backup.List(config.BackupPath)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 反转文件夹列表
-	for i, j := 0, len(folders)-1; i < j; i, j = i+1, j-1 {
-		folders[i], folders[j] = folders[j], folders[i]
+	names := make([]string, 0, len(backups))
+	for _, b := range backups {
+		names = append(names, b.Name)
 	}
-
-	// 返回符合条件的文件夹名称
-	c.JSON(http.StatusOK, folders)
+	c.JSON(http.StatusOK, names)
 }
 
 // handleChangeSave 处理 /api/changesave 请求
@@ -897,15 +994,33 @@ func handleChangeSave(c *gin.Context, config config.Config) {
 		return
 	}
 
-	// 首先，尝试终止同名进程
-	if err := sys.KillProcess(config); err != nil {
-		log.Printf("Failed to kill existing process: %v", err)
-		// 可以选择在此处返回，也可以继续尝试启动新进程
+	b, ok := findBackup(config, filepath.Base(req.Path))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source save path does not exist"})
+		return
+	}
+	// 压缩包先解压到临时目录,复制结束后由重启流程删除
+	backupDir := b.Path
+	cleanup := func() {}
+	if !b.Dir {
+		tempDir, err := os.MkdirTemp(config.BackupPath, "restore-")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		cleanup = func() { os.RemoveAll(tempDir) }
+		if err := backup.Extract(b.Path, tempDir); err != nil {
+			cleanup()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		backupDir = tempDir
 	}
 
 	// 检查源路径是否存在
-	sourcePath := filepath.Join(config.BackupPath, req.Path, "SaveGames", "0")
+	sourcePath := filepath.Join(backupDir, "SaveGames", "0")
 	if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
+		cleanup()
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Source save path does not exist"})
 		return
 	}
@@ -913,6 +1028,7 @@ func handleChangeSave(c *gin.Context, config config.Config) {
 	// 获取源路径中的哈希文件夹名称
 	sourceHashFolder, err := getHashFolderName(sourcePath)
 	if err != nil {
+		cleanup()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -921,22 +1037,28 @@ func handleChangeSave(c *gin.Context, config config.Config) {
 	destPath := filepath.Join(config.GamePath, "Pal", "Saved", "SaveGames", "0")
 	destHashFolder, err := getHashFolderName(destPath)
 	if err != nil {
+		cleanup()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 复制文件
-	err = copyDir(filepath.Join(sourcePath, sourceHashFolder), filepath.Join(destPath, destHashFolder))
+	// 在后台关闭服务端后复制存档,复制结束后由重启流程重新启动,进度和结果通过 /api/restart/status 查询
+	run, err := restart.Default.Restart(restart.Request{
+		Reason: restart.ReasonManual,
+		Detail: "更换存档",
+		Prepare: func(ctx context.Context) error {
+			defer cleanup()
+			return copyDir(filepath.Join(sourcePath, sourceHashFolder), filepath.Join(destPath, destHashFolder))
+		},
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		cleanup()
+		log.Printf("Failed to change save: %v", err)
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 存档更换成功后
-	sys.KillProcess(config)
-	sys.RestartService(config)
-
-	c.JSON(http.StatusOK, gin.H{"message": "Save changed successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Save change initiated", "id": run.ID})
 }
 
 // getHashFolderName 获取哈希命名的文件夹名称
@@ -956,41 +1078,6 @@ func getHashFolderName(path string) (string, error) {
 	return "", errors.New("no hash folder found")
 }
 
-// runBackup 执行备份操作
-func runBackup(config config.Config) {
-	// 获取当前日期和时间
-	currentDate := time.Now().Format("2006-01-02-15-04-05")
-
-	// 创建新的备份目录
-	backupDir := filepath.Join(config.BackupPath, currentDate)
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		log.Printf("Failed to create backup directory: %v", err)
-		return
-	}
-
-	// 确定源文件的路径和目标路径
-	sourcePath := filepath.Join(config.GameSavePath, "SaveGames")
-	destinationPath := filepath.Join(backupDir, "SaveGames")
-
-	// 执行文件复制操作
-	if err := copyDir(sourcePath, destinationPath); err != nil {
-		log.Printf("Failed to copy files for backup SaveGames: %v", err)
-	} else {
-		log.Printf("Backup completed successfully: %s", destinationPath)
-	}
-
-	// 确定源文件的路径和目标路径
-	sourcePath = filepath.Join(config.GameSavePath, "Config")
-	destinationPath = filepath.Join(backupDir, "Config")
-
-	// 执行文件复制操作
-	if err := copyDir(sourcePath, destinationPath); err != nil {
-		log.Printf("Failed to copy files for backup Config: %v", err)
-	} else {
-		log.Printf("Backup completed successfully: %s", destinationPath)
-	}
-}
-
 // copyDir 递归复制目录及其内容
 func copyDir(src string, dst string) error {
 	srcInfo, err := os.Stat(src)
@@ -1084,8 +1171,17 @@ func handleSaveNow(c *gin.Context, config config.Config) {
 		return
 	}
 
+	if runBackup == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Backup is not available"})
+		return
+	}
+
 	// 执行备份操作
-	go runBackup(config)
+	go func() {
+		if err := runBackup(backup.TriggerManual); err != nil {
+			log.Printf("手动备份失败: %v", err)
+		}
+	}()
 	c.JSON(http.StatusOK, gin.H{"message": "Backup initiated"})
 }
 
@@ -1108,6 +1204,20 @@ func handleDelSave(c *gin.Context, config config.Config) {
 
 	savePath := config.BackupPath
 
+	// 固定的备份需要先取消固定才能删除
+	pins, err := backup.Pins(savePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, file := range files {
+		if pins[file] {
+			c.JSON(http.StatusConflict, gin.H{"error": "Backup is pinned: " + file})
+			return
+		}
+	}
+
+	prunedSnapshots := false
 	for _, file := range files {
 		// 构建完整的文件路径
 		filePath := filepath.Join(savePath, file)
@@ -1118,11 +1228,19 @@ func handleDelSave(c *gin.Context, config config.Config) {
 			return
 		}
 
-		// 删除文件
-		if err := os.Remove(filePath); err != nil {
+		// 删除文件和它的清单
+		if err := backup.Remove(filePath); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file: " + file})
 			return
 		}
+		prunedSnapshots = prunedSnapshots || backup.FormatOf(file) == backup.FormatSnapshot
+	}
+
+	// 删除增量备份后清理不再被引用的文件内容
+	if prunedSnapshots {
+		if _, err := backup.GC(savePath); err != nil {
+			log.Printf("清理增量备份失败: %v", err)
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Files deleted successfully"})
@@ -1143,7 +1261,7 @@ func handleGetBot(c *gin.Context, config config.Config) {
 		return
 	}
 
-	cookie, _ := GenerateCookie()
+	cookie, _ := GenerateCookie(BotCookieOwner)
 	ip, _ := sys.GetPublicIP()
 	ipWithPort := fmt.Sprintf("%s:%s", ip, config.WebuiPort)
 
@@ -1195,7 +1313,7 @@ func handleBroadcast(c *gin.Context, config config.Config) {
 	}
 
 	// 调用 tool.Broadcast 发送广播
-	err = tool.Broadcast(config, req.Message)
+	err = tool.BroadcastContext(auditContext(c, audit.OriginWebui), config, req.Message)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -1234,10 +1352,20 @@ func handleRestartLater(c *gin.Context, config config.Config) {
 		return
 	}
 
-	// 调用tool.Shutdown来安排重启
-	err = tool.Shutdown(config, req.Seconds, req.Message)
+	seconds, err := strconv.Atoi(req.Seconds)
+	if err != nil || seconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid seconds"})
+		return
+	}
+	// 倒计时期间可以通过 DELETE /api/restart 取消
+	_, err = restart.Default.Restart(restart.Request{
+		Reason:  restart.ReasonManual,
+		Detail:  "webui延迟重启",
+		Delay:   time.Duration(seconds) * time.Second,
+		Message: req.Message,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -1266,17 +1394,17 @@ func handleUpdate(c *gin.Context, config config.Config) {
 		return
 	}
 
-	// 终止当前服务器进程
-	if err := sys.KillProcess(config); err != nil {
-		log.Printf("Failed to stop the server for update: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop the server for update"})
-	}
-
-	// 在PowerShell中执行更新脚本
-	err = tool.CreateAndRunPSScript(config)
+	// 保存并关闭服务端后执行更新脚本,更新结束后重新启动
+	_, err = restart.Default.Restart(restart.Request{
+		Reason: restart.ReasonUpdate,
+		Detail: "webui",
+		Prepare: func(ctx context.Context) error {
+			return tool.CreateAndRunPSScript(config)
+		},
+	})
 	if err != nil {
-		log.Printf("Failed to execute update script: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to execute update script"})
+		log.Printf("Failed to start update: %v", err)
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -1519,7 +1647,7 @@ func updateBanList(banListPath, steamID string) (bool, error) {
 }
 
 // HandleGetPalguardJson 返回palguard.json的内容
-func HandleGetPalguardJson(c *gin.Context) {
+func HandleGetPalguardJson(c *gin.Context, config config.Config) {
 	// 从请求中获取cookie
 	cookieValue, err := c.Cookie("login_cookie")
 	if err != nil {
@@ -1534,15 +1662,8 @@ func HandleGetPalguardJson(c *gin.Context) {
 		return
 	}
 
-	// 定义相对路径到palguard.json
-	relativePath := "..\\PalServer\\Pal\\Binaries\\Win64\\palguard.json"
-
-	// 将相对路径转换为绝对路径
-	absPath, err := filepath.Abs(relativePath)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error: Unable to resolve file path"})
-		return
-	}
+	// palguard.json位于游戏目录下
+	absPath := tool.PalguardJSONPath(config)
 
 	// 读取json文件
 	jsonFile, err := os.ReadFile(absPath)
@@ -1564,7 +1685,7 @@ func HandleGetPalguardJson(c *gin.Context) {
 }
 
 // HandleSavePalguardJson 从请求体中读取JSON并写入palguard.json
-func HandleSavePalguardJson(c *gin.Context) {
+func HandleSavePalguardJson(c *gin.Context, config config.Config) {
 	// 从请求中获取cookie
 	cookieValue, err := c.Cookie("login_cookie")
 	if err != nil {
@@ -1593,15 +1714,8 @@ func HandleSavePalguardJson(c *gin.Context) {
 		return
 	}
 
-	// 定义相对路径到palguard.json
-	relativePath := "..\\PalServer\\Pal\\Binaries\\Win64\\palguard.json"
-
-	// 将相对路径转换为绝对路径
-	absPath, err := filepath.Abs(relativePath)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error: Unable to resolve file path"})
-		return
-	}
+	// palguard.json位于游戏目录下
+	absPath := tool.PalguardJSONPath(config)
 
 	// 写入JSON数据到palguard.json文件
 	if err := os.WriteFile(absPath, jsonData, 0644); err != nil {
@@ -1611,5 +1725,6 @@ func HandleSavePalguardJson(c *gin.Context) {
 
 	// 响应客户端
 	c.JSON(http.StatusOK, gin.H{"message": "Palguard data updated successfully"})
+	event.Publish(event.ConfigChanged{Source: "palguard.json"})
 
 }
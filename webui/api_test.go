@@ -0,0 +1,184 @@
+package webui
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/palworld-go/palworld"
+	"github.com/hoshinonyaruko/palworld-go/palworld/palworldtest"
+	"github.com/hoshinonyaruko/palworld-go/tool"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	alice = palworld.Player{Name: "Alice", PlayerUID: "1001", SteamID: "76561190000000001"}
+	bob   = palworld.Player{Name: "Bob", PlayerUID: "1002", SteamID: "76561190000000002"}
+)
+
+// panel 连接到模拟服务端的webui,cookie为已登录的cookie
+type panel struct {
+	server *palworldtest.Server
+	url    string
+	cookie string
+}
+
+func newPanel(t *testing.T, players ...palworld.Player) *panel {
+	t.Helper()
+
+	dir := t.TempDir()
+	var err error
+	dbcookie, err = bolt.Open(filepath.Join(dir, DBName), 0600, nil)
+	if err != nil {
+		t.Fatalf("open cookie db: %v", err)
+	}
+	t.Cleanup(CloseDB)
+	dbcookie.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(CookieBucket))
+		return err
+	})
+	cookie, err := GenerateCookie("tester")
+	if err != nil {
+		t.Fatalf("GenerateCookie: %v", err)
+	}
+
+	db, err := bbolt.Open(filepath.Join(dir, "players.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("open players db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("players"))
+		return err
+	})
+
+	server := palworldtest.NewServer(palworldtest.WithPlayers(players...))
+	t.Cleanup(func() {
+		tool.GetRconPool(server.Addr(), server.Password()).Close()
+		server.Close()
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler := CombinedMiddleware(server.Config(), db)
+	r.GET("/*filepath", handler)
+	r.POST("/*filepath", handler)
+	web := httptest.NewServer(r)
+	t.Cleanup(web.Close)
+
+	return &panel{server: server, url: web.URL, cookie: cookie}
+}
+
+// do 发送请求并解析JSON响应,cookie为空时不登录
+func (p *panel) do(t *testing.T, method, path, cookie string, body, result interface{}) int {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, p.url+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: "login_cookie", Value: cookie})
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%v %v: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatalf("%v %v: decode: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAPI_Player(t *testing.T) {
+	p := newPanel(t, alice, bob)
+
+	var players []map[string]interface{}
+	if status := p.do(t, http.MethodGet, "/api/player?update=true", "", nil, &players); status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if len(players) != 2 {
+		t.Fatalf("players = %v", players)
+	}
+	for _, player := range players {
+		if player["online"] != true {
+			t.Errorf("player %v is not online", player)
+		}
+	}
+
+	var counts map[string]int
+	p.do(t, http.MethodGet, "/api/getplayernum", "", nil, &counts)
+	if counts["total_players"] != 2 || counts["online_players"] != 2 {
+		t.Errorf("player counts = %v", counts)
+	}
+}
+
+func TestAPI_KickOrBan(t *testing.T) {
+	p := newPanel(t, alice, bob)
+
+	// 没有登录时不能踢人
+	kick := KickOrBanRequest{SteamID: alice.SteamID, Type: "kick"}
+	if status := p.do(t, http.MethodPost, "/api/kickorban", "", kick, nil); status != http.StatusUnauthorized {
+		t.Errorf("kick without cookie: status = %d", status)
+	}
+	if status := p.do(t, http.MethodPost, "/api/kickorban", "not-a-cookie", kick, nil); status != http.StatusUnauthorized {
+		t.Errorf("kick with invalid cookie: status = %d", status)
+	}
+	if got := len(p.server.Players()); got != 2 {
+		t.Fatalf("unauthorized request kicked a player, %d left", got)
+	}
+
+	if status := p.do(t, http.MethodPost, "/api/kickorban", p.cookie, kick, nil); status != http.StatusOK {
+		t.Errorf("kick: status = %d", status)
+	}
+	ban := KickOrBanRequest{SteamID: bob.SteamID, Type: "ban"}
+	if status := p.do(t, http.MethodPost, "/api/kickorban", p.cookie, ban, nil); status != http.StatusOK {
+		t.Errorf("ban: status = %d", status)
+	}
+	if players := p.server.Players(); len(players) != 0 || !p.server.Banned(bob.SteamID) {
+		t.Errorf("players = %+v, bob banned = %v", players, p.server.Banned(bob.SteamID))
+	}
+
+	// 服务端返回失败时接口返回错误
+	if status := p.do(t, http.MethodPost, "/api/kickorban", p.cookie, kick, nil); status != http.StatusInternalServerError {
+		t.Errorf("kick offline player: status = %d", status)
+	}
+}
+
+func TestAPI_Broadcast(t *testing.T) {
+	p := newPanel(t)
+
+	message := BroadcastRequest{Message: "hello world"}
+	if status := p.do(t, http.MethodPost, "/api/broadcast", "", message, nil); status != http.StatusUnauthorized {
+		t.Errorf("broadcast without cookie: status = %d", status)
+	}
+	if status := p.do(t, http.MethodPost, "/api/broadcast", p.cookie, message, nil); status != http.StatusOK {
+		t.Errorf("broadcast: status = %d", status)
+	}
+	if got := p.server.Broadcasts(); len(got) != 1 || got[0] != "hello_world" {
+		t.Errorf("Broadcasts = %q", got)
+	}
+
+	// 服务端无响应时返回错误
+	p.server.InjectFailure("Broadcast", 1, palworldtest.Failure{Drop: true})
+	if status := p.do(t, http.MethodPost, "/api/broadcast", p.cookie, message, nil); status != http.StatusInternalServerError {
+		t.Errorf("broadcast to a dropping server: status = %d", status)
+	}
+}
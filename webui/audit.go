@@ -0,0 +1,104 @@
+package webui
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/palworld-go/audit"
+	"github.com/hoshinonyaruko/palworld-go/bot"
+)
+
+// auditContext 返回标记了来源和用户的请求ctx,
+// 机器人持有的cookie归为bot来源,实际发起指令的QQ号由请求头携带
+func auditContext(c *gin.Context, origin string) context.Context {
+	ctx := c.Request.Context()
+
+	var owner string
+	cookieValue, err := c.Cookie("login_cookie")
+	if err == nil {
+		if isValid, err := ValidateCookie(cookieValue); err == nil && isValid {
+			owner = CookieOwner(cookieValue)
+		}
+	}
+
+	if owner == BotCookieOwner {
+		origin = audit.OriginBot
+		if user, ok := botUser(c.GetHeader(audit.UserHeader), cookieValue); ok {
+			owner = user
+		}
+	}
+	if owner == "" {
+		owner = "anonymous"
+	}
+
+	return audit.WithUser(audit.WithOrigin(ctx, origin), owner)
+}
+
+// botUser 校验机器人代发指令时携带的QQ号:该QQ号必须已经用这个cookie绑定了面板,
+// 否则持有机器人cookie的任何人都可以冒充其他用户。校验失败时只记录为bot
+func botUser(header, cookieValue string) (string, bool) {
+	userID, err := strconv.ParseInt(header, 10, 64)
+	if err != nil {
+		return "", false
+	}
+	data, err := bot.RetrieveIPByUserID(userID)
+	if err != nil || data.UUID != cookieValue {
+		return "", false
+	}
+	return header, true
+}
+
+// handleAudit 处理 /api/audit 的GET请求,按时间倒序分页返回审计日志
+// 支持的查询参数: origin user command since until(RFC3339) errors(true) limit before
+func handleAudit(c *gin.Context) {
+	if !checkCookie(c) {
+		return
+	}
+
+	filter := audit.Filter{
+		Origin:     c.Query("origin"),
+		User:       c.Query("user"),
+		Command:    c.Query("command"),
+		ErrorsOnly: c.Query("errors") == "true",
+	}
+
+	var err error
+	if v := c.Query("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since: " + err.Error()})
+			return
+		}
+	}
+	if v := c.Query("until"); v != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid until: " + err.Error()})
+			return
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: " + err.Error()})
+			return
+		}
+	}
+	if v := c.Query("before"); v != "" {
+		if filter.Before, err = strconv.ParseUint(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid before: " + err.Error()})
+			return
+		}
+	}
+
+	entries, next, err := audit.Query(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries":     entries,
+		"next_cursor": next,
+	})
+}
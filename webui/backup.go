@@ -0,0 +1,164 @@
+package webui
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/palworld-go/backup"
+	"github.com/hoshinonyaruko/palworld-go/config"
+)
+
+// runBackup 创建一个备份,trigger为创建备份的原因,由main设置为BackupTask.RunBackup
+var runBackup func(trigger string) error
+
+// SetBackup 设置 /api/savenow 使用的备份操作,与定时备份共用同一个实现
+func SetBackup(run func(trigger string) error) {
+	runBackup = run
+}
+
+// findBackup 按名称在BackupPath下查找备份,名称必须是 /api/getsavelist 返回的名称之一
+func findBackup(config config.Config, name string) (backup.Info, bool) {
+	backups, err := backup.List(config.BackupPath)
+	if err != nil {
+		return backup.Info{}, false
+	}
+	for _, b := range backups {
+		if b.Name == name {
+			return b, true
+		}
+	}
+	return backup.Info{}, false
+}
+
+// handleDownloadSave 处理 /api/downloadsave 的GET请求,下载一个压缩包备份
+func handleDownloadSave(c *gin.Context, config config.Config) {
+	if !checkCookie(c) {
+		return
+	}
+
+	b, ok := findBackup(config, filepath.Base(c.Query("name")))
+	if !ok || b.Dir || b.Format == backup.FormatSnapshot {
+		c.JSON(http.StatusNotFound, gin.H{"error": "backup not found or not an archive"})
+		return
+	}
+	c.FileAttachment(b.Path, b.Name)
+}
+
+// handleSaveManifest 处理 /api/savemanifest 的GET请求,返回备份的清单:版本、在线玩家、创建原因和文件列表
+func handleSaveManifest(c *gin.Context, config config.Config) {
+	if !checkCookie(c) {
+		return
+	}
+
+	b, ok := findBackup(config, filepath.Base(c.Query("name")))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "backup not found"})
+		return
+	}
+	m, err := backup.ManifestOf(b)
+	if errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "backup has no manifest"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// VerifySaveRequest /api/verifysave 的请求体
+type VerifySaveRequest struct {
+	Name string `json:"name"`
+}
+
+// handleVerifySave 处理 /api/verifysave 的POST请求,重新计算备份中文件的SHA-256并报告缺失和损坏的文件
+func handleVerifySave(c *gin.Context, config config.Config) {
+	if !checkCookie(c) {
+		return
+	}
+
+	var req VerifySaveRequest
+	if err := c.BindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	b, ok := findBackup(config, filepath.Base(req.Name))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "backup not found"})
+		return
+	}
+	report, err := backup.Verify(b)
+	if errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "backup has no manifest and cannot be verified"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// PinSaveRequest /api/pinsave 和 /api/unpinsave 的请求体
+type PinSaveRequest struct {
+	Name string `json:"name"`
+}
+
+// handleSaveRetention 处理 /api/saveretention 的GET请求,预览保留策略会删除哪些备份,不实际删除
+func handleSaveRetention(c *gin.Context, config config.Config) {
+	if !checkCookie(c) {
+		return
+	}
+
+	policy := backup.PolicyFromConfig(config)
+	decisions, err := backup.Prune(config.BackupPath, policy, time.Now(), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var deleted []string
+	for _, d := range decisions {
+		if !d.Keep {
+			deleted = append(deleted, d.Name)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": policy.Enabled(),
+		"backups": decisions,
+		"delete":  deleted,
+	})
+}
+
+// handlePinSave 处理 /api/pinsave 和 /api/unpinsave 的POST请求,固定的备份不会被保留策略删除
+func handlePinSave(c *gin.Context, config config.Config, pin bool) {
+	if !checkCookie(c) {
+		return
+	}
+
+	var req PinSaveRequest
+	if err := c.BindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var err error
+	if pin {
+		err = backup.Pin(config.BackupPath, req.Name)
+	} else {
+		err = backup.Unpin(config.BackupPath, req.Name)
+	}
+	if errors.Is(err, backup.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"name": req.Name, "pinned": pin})
+}
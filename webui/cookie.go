@@ -4,9 +4,11 @@ import (
 	"encoding/binary"
 	"errors"
 	"log"
+	"net/http"
 	"time"
 
 	"github.com/boltdb/bolt"
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
@@ -38,13 +40,19 @@ func CloseDB() {
 	dbcookie.Close()
 }
 
-func GenerateCookie() (string, error) {
+// BotCookieOwner 发给机器人的cookie的持有者
+const BotCookieOwner = "bot"
+
+// GenerateCookie 生成属于owner的cookie,owner会作为审计日志中的操作用户
+func GenerateCookie(owner string) (string, error) {
 	cookie := uuid.New().String()
 	expiration := time.Now().Add(ExpirationHours * time.Hour).Unix()
 
 	err := dbcookie.Update(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte(CookieBucket))
-		if err := bucket.Put([]byte(cookie), intToBytes(expiration)); err != nil {
+		// 前8字节为过期时间,之后是持有者
+		value := append(intToBytes(expiration), owner...)
+		if err := bucket.Put([]byte(cookie), value); err != nil {
 			return err
 		}
 		return nil
@@ -78,6 +86,19 @@ func ValidateCookie(cookie string) (bool, error) {
 	return isValid, err
 }
 
+// CookieOwner 返回cookie的持有者,旧版本生成的cookie没有持有者
+func CookieOwner(cookie string) string {
+	var owner string
+	dbcookie.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket([]byte(CookieBucket)).Get([]byte(cookie))
+		if len(value) > 8 {
+			owner = string(value[8:])
+		}
+		return nil
+	})
+	return owner
+}
+
 func intToBytes(n int64) []byte {
 	bytes := make([]byte, 8)
 	binary.BigEndian.PutUint64(bytes, uint64(n))
@@ -85,5 +106,23 @@ func intToBytes(n int64) []byte {
 }
 
 func bytesToInt(b []byte) int64 {
-	return int64(binary.BigEndian.Uint64(b))
+	return int64(binary.BigEndian.Uint64(b[:8]))
+}
+
+// checkCookie 验证cookie,失败时已经写入响应
+func checkCookie(c *gin.Context) bool {
+	// 从请求中获取cookie
+	cookieValue, err := c.Cookie("login_cookie")
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: Cookie not provided"})
+		return false
+	}
+
+	// 使用ValidateCookie函数验证cookie
+	isValid, err := ValidateCookie(cookieValue)
+	if err != nil || !isValid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: Invalid cookie"})
+		return false
+	}
+	return true
 }
@@ -0,0 +1,142 @@
+package webui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/palworld-go/event"
+)
+
+// sseKeepAlive SSE连接空闲时发送注释行的间隔,防止被代理断开
+const sseKeepAlive = 30 * time.Second
+
+// parseEventQuery 解析 after type(逗号分隔) 查询参数,after也可以来自SSE的Last-Event-ID
+func parseEventQuery(c *gin.Context) (after uint64, types []event.Type, err error) {
+	if v := c.Query("after"); v != "" {
+		if after, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return 0, nil, fmt.Errorf("invalid after: %w", err)
+		}
+	} else if v := c.GetHeader("Last-Event-ID"); v != "" {
+		if after, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return 0, nil, fmt.Errorf("invalid Last-Event-ID: %w", err)
+		}
+	}
+
+	for _, t := range strings.Split(c.Query("type"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, event.Type(t))
+		}
+	}
+	return after, types, nil
+}
+
+// handleEvents 处理 /api/events 的GET请求,返回最近的事件
+func handleEvents(c *gin.Context) {
+	if !checkCookie(c) {
+		return
+	}
+
+	after, types, err := parseEventQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: " + err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": event.Default.Recent(after, types, limit),
+		"types":  event.Types,
+	})
+}
+
+// handleEventStream 处理 /api/events/stream 的GET请求,以SSE推送事件。
+// 先补发Last-Event-ID(或after)之后仍在缓冲区中的事件,再推送新事件。
+func handleEventStream(c *gin.Context) {
+	if !checkCookie(c) {
+		return
+	}
+
+	after, types, err := parseEventQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 先订阅再读取缓冲区,避免两者之间发布的事件丢失,重复的事件按ID跳过
+	live := make(chan event.Event, 64)
+	unsubscribe := event.Subscribe(func(e event.Event) {
+		select {
+		case live <- e:
+		default:
+		}
+	})
+	defer unsubscribe()
+	backlog := event.Default.Recent(after, types, 0)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	lastID := after
+	write := func(w io.Writer, e event.Event) bool {
+		if e.ID <= lastID {
+			return true
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return true
+		}
+		lastID = e.ID
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+		return err == nil
+	}
+
+	for _, e := range backlog {
+		if !write(c.Writer, e) {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case e := <-live:
+			if len(types) > 0 && !containsType(types, e.Type) {
+				return true
+			}
+			return write(w, e)
+		case <-ticker.C:
+			_, err := io.WriteString(w, ": keepalive\n\n")
+			return err == nil
+		}
+	})
+}
+
+func containsType(types []event.Type, t event.Type) bool {
+	for _, want := range types {
+		if want == t {
+			return true
+		}
+	}
+	return false
+}
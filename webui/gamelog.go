@@ -0,0 +1,166 @@
+package webui
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/hoshinonyaruko/palworld-go/gamelog"
+)
+
+const (
+	// defaultGameLogTail 未指定tail时返回的行数
+	defaultGameLogTail = 200
+	// defaultGameLogSearchLimit 未指定limit时搜索返回的行数
+	defaultGameLogSearchLimit = 500
+	// gameLogPingInterval websocket空闲时发送ping的间隔
+	gameLogPingInterval = 30 * time.Second
+	gameLogWriteTimeout = 10 * time.Second
+)
+
+var gameLog *gamelog.Log
+
+// SetGameLog 设置 /api/gamelog 使用的服务端日志
+func SetGameLog(l *gamelog.Log) {
+	gameLog = l
+}
+
+// checkGameLogRequest 验证cookie并检查服务端日志是否可用,失败时已经写入响应
+func checkGameLogRequest(c *gin.Context) bool {
+	if !checkCookie(c) {
+		return false
+	}
+
+	if gameLog == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "服务端日志未启用"})
+		return false
+	}
+	return true
+}
+
+// queryInt 读取整数查询参数,为空时返回def
+func queryInt(c *gin.Context, name string, def int) (int, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name + ": " + err.Error()})
+		return 0, false
+	}
+	return n, true
+}
+
+// handleGameLog 处理 /api/gamelog 的GET请求,返回内存中最近的输出
+// 支持的查询参数: tail(行数,0为全部) q(过滤关键字,不区分大小写)
+func handleGameLog(c *gin.Context) {
+	if !checkGameLogRequest(c) {
+		return
+	}
+	tail, ok := queryInt(c, "tail", defaultGameLogTail)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lines": gameLog.Tail(tail, c.Query("q"))})
+}
+
+// handleGameLogSearch 处理 /api/gamelog/search 的GET请求,在所有日志文件中从新到旧搜索
+// 支持的查询参数: q(关键字,必填) limit
+func handleGameLogSearch(c *gin.Context) {
+	if !checkGameLogRequest(c) {
+		return
+	}
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	limit, ok := queryInt(c, "limit", defaultGameLogSearchLimit)
+	if !ok {
+		return
+	}
+
+	lines, err := gameLog.Search(query, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"lines": lines})
+}
+
+// handleGameLogStream 处理 /api/gamelog/ws 的websocket请求。
+// 先发送最近的tail行,再持续推送新的输出,每行一条JSON消息;q不为空时只推送包含q的行
+func handleGameLogStream(c *gin.Context) {
+	if !checkGameLogRequest(c) {
+		return
+	}
+	tail, ok := queryInt(c, "tail", defaultGameLogTail)
+	if !ok {
+		return
+	}
+	query := strings.ToLower(c.Query("q"))
+
+	// 先订阅再读取缓冲区,重复的行按Seq跳过
+	lines, unsubscribe := gameLog.Subscribe()
+	defer unsubscribe()
+	backlog := gameLog.Tail(tail, query)
+
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	// 读取并丢弃客户端消息,用于发现连接关闭
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	var lastSeq uint64
+	write := func(line gamelog.Line) bool {
+		if line.Seq <= lastSeq {
+			return true
+		}
+		lastSeq = line.Seq
+		ws.SetWriteDeadline(time.Now().Add(gameLogWriteTimeout))
+		return ws.WriteJSON(line) == nil
+	}
+
+	for _, line := range backlog {
+		if !write(line) {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(gameLogPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case line := <-lines:
+			if !gamelog.Match(line, query) {
+				continue
+			}
+			if !write(line) {
+				return
+			}
+		case <-ticker.C:
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(gameLogWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
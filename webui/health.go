@@ -0,0 +1,60 @@
+package webui
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/palworld-go/health"
+)
+
+var healthChecker *health.Checker
+
+// SetHealthChecker 设置 /healthz 和 /readyz 使用的健康检查器
+func SetHealthChecker(c *health.Checker) {
+	healthChecker = c
+}
+
+// probeResult 未登录也能看到的探针结果,不包含错误详情
+type probeResult struct {
+	Name     string `json:"name"`
+	Healthy  bool   `json:"healthy"`
+	Checked  bool   `json:"checked"`
+	Failures int    `json:"failures"`
+}
+
+func probeResults() []probeResult {
+	statuses := healthChecker.Statuses()
+	results := make([]probeResult, len(statuses))
+	for i, s := range statuses {
+		results[i] = probeResult{Name: s.Name, Healthy: s.Healthy, Checked: s.Checked, Failures: s.Failures}
+	}
+	return results
+}
+
+// handleHealthz 处理 /healthz 的GET请求,有探针连续失败达到阈值时返回503
+func handleHealthz(c *gin.Context) {
+	if healthChecker == nil {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		return
+	}
+
+	code, status := http.StatusOK, "ok"
+	if !healthChecker.Live() {
+		code, status = http.StatusServiceUnavailable, "unhealthy"
+	}
+	c.JSON(code, gin.H{"status": status, "probes": probeResults()})
+}
+
+// handleReadyz 处理 /readyz 的GET请求,服务端运行中且所有探针最近一次都成功时返回200
+func handleReadyz(c *gin.Context) {
+	if healthChecker == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unknown"})
+		return
+	}
+
+	code, status := http.StatusOK, "ready"
+	if !healthChecker.Ready() {
+		code, status = http.StatusServiceUnavailable, "not ready"
+	}
+	c.JSON(code, gin.H{"status": status, "probes": probeResults()})
+}
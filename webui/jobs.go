@@ -0,0 +1,70 @@
+package webui
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/palworld-go/jobs"
+)
+
+var jobScheduler *jobs.Scheduler
+
+// SetJobScheduler 设置 /api/jobs 使用的任务调度器
+func SetJobScheduler(s *jobs.Scheduler) {
+	jobScheduler = s
+}
+
+// handleJobs 处理 /api/jobs 的GET请求,返回所有周期任务的状态
+func handleJobs(c *gin.Context) {
+	if !checkCookie(c) {
+		return
+	}
+	if jobScheduler == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "任务调度未启用"})
+		return
+	}
+	c.JSON(http.StatusOK, jobScheduler.List())
+}
+
+// handleJobAction 处理 /api/jobs/{name}/pause|resume|run 的POST请求
+func handleJobAction(c *gin.Context) {
+	if !checkCookie(c) {
+		return
+	}
+	if jobScheduler == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "任务调度未启用"})
+		return
+	}
+
+	name, action, ok := strings.Cut(strings.TrimPrefix(c.Request.URL.Path, "/api/jobs/"), "/")
+	if !ok || name == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+
+	var err error
+	switch action {
+	case "pause":
+		err = jobScheduler.Pause(name)
+	case "resume":
+		err = jobScheduler.Resume(name)
+	case "run":
+		err = jobScheduler.RunNow(name)
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+
+	switch err {
+	case nil:
+		state, _ := jobScheduler.Get(name)
+		c.JSON(http.StatusOK, state)
+	case jobs.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case jobs.ErrRunning:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
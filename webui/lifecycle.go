@@ -0,0 +1,29 @@
+package webui
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/palworld-go/lifecycle"
+	"github.com/hoshinonyaruko/palworld-go/sys"
+)
+
+// lifecycleResponse /api/lifecycle 的返回内容
+type lifecycleResponse struct {
+	lifecycle.Snapshot
+	// LastExit 最近一次回收到的服务端进程退出信息
+	LastExit *sys.Exit `json:"last_exit,omitempty"`
+}
+
+// handleLifecycle 处理 /api/lifecycle 的GET请求,返回服务端进程的当前状态、最近的状态变化和最近一次退出
+func handleLifecycle(c *gin.Context) {
+	if !checkCookie(c) {
+		return
+	}
+
+	response := lifecycleResponse{Snapshot: lifecycle.Default.Snapshot()}
+	if exit, ok := sys.LastExit(); ok {
+		response.LastExit = &exit
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,71 @@
+package webui
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/palworld-go/restart"
+	"github.com/hoshinonyaruko/palworld-go/schedule"
+)
+
+var (
+	restartSchedules []*schedule.Schedule
+	restartWindows   schedule.Windows
+)
+
+// SetRestartSchedule 设置 /api/restart/status 显示的定时重启计划和维护窗口
+func SetRestartSchedule(schedules []*schedule.Schedule, windows schedule.Windows) {
+	restartSchedules = schedules
+	restartWindows = windows
+}
+
+// restartStatusResponse /api/restart/status 的返回内容
+type restartStatusResponse struct {
+	// Current 正在进行的重启,没有时为空
+	Current *restart.Run  `json:"current,omitempty"`
+	History []restart.Run `json:"history"`
+	// NextScheduled 下一次定时重启的时间,没有配置计划时为空
+	NextScheduled *time.Time `json:"next_scheduled,omitempty"`
+	// InWindow 当前是否在维护窗口内,没有配置窗口时总是true
+	InWindow bool `json:"in_window"`
+	// NextWindow 下一个维护窗口开始的时间,当前在窗口内时为空
+	NextWindow *time.Time `json:"next_window,omitempty"`
+}
+
+// handleRestartStatus 处理 /api/restart/status 的GET请求,返回正在进行的重启和最近的重启记录
+func handleRestartStatus(c *gin.Context) {
+	if !checkCookie(c) {
+		return
+	}
+
+	now := time.Now()
+	response := restartStatusResponse{
+		History:  restart.Default.History(),
+		InWindow: restartWindows.Contains(now),
+	}
+	if next := schedule.Earliest(restartSchedules, now); !next.IsZero() {
+		response.NextScheduled = &next
+	}
+	if !response.InWindow {
+		next := restartWindows.NextStart(now)
+		response.NextWindow = &next
+	}
+	if run, ok := restart.Default.Current(); ok {
+		response.Current = &run
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleRestartCancel 处理 /api/restart 的DELETE请求,取消仍在倒计时中的重启
+func handleRestartCancel(c *gin.Context) {
+	if !checkCookie(c) {
+		return
+	}
+
+	if !restart.Default.Cancel() {
+		c.JSON(http.StatusConflict, gin.H{"error": "没有可以取消的重启"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Restart cancelled"})
+}
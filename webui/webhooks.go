@@ -0,0 +1,81 @@
+package webui
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/palworld-go/webhook"
+)
+
+var webhooks *webhook.Dispatcher
+
+// SetWebhookDispatcher 设置 /api/webhooks 使用的webhook投递器
+func SetWebhookDispatcher(d *webhook.Dispatcher) {
+	webhooks = d
+}
+
+// handleWebhooks 处理 /api/webhooks 的GET请求,返回webhook配置(不含密钥)和待投递的请求
+func handleWebhooks(c *gin.Context) {
+	if !checkCookie(c) {
+		return
+	}
+
+	if webhooks == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "webhook未启用"})
+		return
+	}
+
+	pending, err := webhooks.Pending()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"hooks":   webhooks.Hooks(),
+		"pending": pending,
+	})
+}
+
+// handleWebhookDeliveries 处理 /api/webhooks/deliveries 的GET请求,按时间倒序分页返回投递日志
+// 支持的查询参数: hook limit before
+func handleWebhookDeliveries(c *gin.Context) {
+	if !checkCookie(c) {
+		return
+	}
+
+	if webhooks == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "webhook未启用"})
+		return
+	}
+
+	var (
+		limit  int
+		before uint64
+		err    error
+	)
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: " + err.Error()})
+			return
+		}
+	}
+	if v := c.Query("before"); v != "" {
+		if before, err = strconv.ParseUint(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid before: " + err.Error()})
+			return
+		}
+	}
+
+	attempts, next, err := webhooks.Attempts(c.Query("hook"), before, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries":  attempts,
+		"next_cursor": next,
+	})
+}